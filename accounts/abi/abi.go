@@ -34,6 +34,7 @@ type ABI struct {
 	Constructor Method
 	Methods     map[string]Method
 	Events      map[string]Event
+	Errors      map[string]Error
 
 	// Additional "special" functions introduced in solidity v0.6.0.
 	// It's separated from the original default fallback. Each contract
@@ -157,6 +158,7 @@ func (abi *ABI) UnmarshalJSON(data []byte) error {
 	}
 	abi.Methods = make(map[string]Method)
 	abi.Events = make(map[string]Event)
+	abi.Errors = make(map[string]Error)
 	for _, field := range fields {
 		switch field.Type {
 		case "constructor":
@@ -184,6 +186,11 @@ func (abi *ABI) UnmarshalJSON(data []byte) error {
 		case "event":
 			name := abi.overloadedEventName(field.Name)
 			abi.Events[name] = NewEvent(name, field.Name, field.Anonymous, field.Inputs)
+		case "error":
+			// Custom errors introduced in v0.8.4, check more detail
+			// here https://docs.soliditylang.org/en/v0.8.4/contracts.html#errors-and-the-revert-statement
+			name := abi.overloadedErrorName(field.Name)
+			abi.Errors[name] = NewError(name, field.Name, field.Inputs)
 		default:
 			return fmt.Errorf("abi: could not recognize type %v of field %v", field.Type, field.Name)
 		}
@@ -221,6 +228,21 @@ func (abi *ABI) overloadedEventName(rawName string) string {
 	return name
 }
 
+// overloadedErrorName returns the next available name for a given error.
+// Needed since solidity allows for error overload.
+//
+// e.g. if the abi contains errors failed, failed1
+// overloadedErrorName would return failed2 for input failed.
+func (abi *ABI) overloadedErrorName(rawName string) string {
+	name := rawName
+	_, ok := abi.Errors[name]
+	for idx := 0; ok; idx++ {
+		name = fmt.Sprintf("%s%d", rawName, idx)
+		_, ok = abi.Errors[name]
+	}
+	return name
+}
+
 // MethodById looks up a method by the 4-byte id,
 // returns nil if none found.
 func (abi *ABI) MethodById(sigdata []byte) (*Method, error) {
@@ -246,6 +268,34 @@ func (abi *ABI) EventByID(topic common.Hash) (*Event, error) {
 	return nil, fmt.Errorf("no event with id: %#x", topic.Hex())
 }
 
+// ErrorByID looks up an error by the 4-byte selector prefixing the revert data,
+// returns nil if none found.
+func (abi *ABI) ErrorByID(sigdata []byte) (*Error, error) {
+	if len(sigdata) < 4 {
+		return nil, fmt.Errorf("data too short (%d bytes) for abi error lookup", len(sigdata))
+	}
+	for _, e := range abi.Errors {
+		if bytes.Equal(e.ID[:4], sigdata[:4]) {
+			return &e, nil
+		}
+	}
+	return nil, fmt.Errorf("no error with id: %#x", sigdata[:4])
+}
+
+// UnpackError resolves the custom error of the ABI the revert data was raised
+// with and unpacks its arguments.
+func (abi ABI) UnpackError(data []byte) (*Error, []interface{}, error) {
+	e, err := abi.ErrorByID(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	args, err := e.Unpack(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return e, args, nil
+}
+
 // HasFallback returns an indicator whether a fallback function is included.
 func (abi *ABI) HasFallback() bool {
 	return abi.Fallback.Type == Fallback
@@ -1146,3 +1146,56 @@ func TestUnpackRevert(t *testing.T) {
 		})
 	}
 }
+
+func TestCustomErrors(t *testing.T) {
+	json := `[
+		{"type":"error","name":"Failed","inputs":[{"name":"code","type":"uint256"}]},
+		{"type":"error","name":"Failed","inputs":[{"name":"reason","type":"string"}]},
+		{"type":"error","name":"Unauthorized","inputs":[{"type":"address"}]}
+	]`
+	abi, err := JSON(strings.NewReader(json))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(abi.Errors) != 3 {
+		t.Fatalf("invalid number of errors after parsing, want 3, got %d", len(abi.Errors))
+	}
+	e, ok := abi.Errors["Unauthorized"]
+	if !ok {
+		t.Fatalf("error Unauthorized not found")
+	}
+	if e.Sig != "Unauthorized(address)" || e.Inputs[0].Name != "arg0" {
+		t.Fatalf("error mismatch: sig %s, input %s", e.Sig, e.Inputs[0].Name)
+	}
+	if e.String() != "error Unauthorized(address arg0)" {
+		t.Fatalf("error string mismatch: %s", e.String())
+	}
+	// Unpack an overloaded error from its revert data
+	overloaded := abi.Errors["Failed"]
+	if overloaded.Sig != "Failed(uint256)" {
+		overloaded = abi.Errors["Failed0"]
+	}
+	packed, err := overloaded.Inputs.Pack(big.NewInt(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(crypto.Keccak256([]byte("Failed(uint256)"))[:4], packed...)
+
+	found, args, err := abi.UnpackError(data)
+	if err != nil {
+		t.Fatalf("failed to unpack error: %v", err)
+	}
+	if found.Sig != "Failed(uint256)" || args[0].(*big.Int).Int64() != 42 {
+		t.Fatalf("unpacked error mismatch: %s %v", found.Sig, args)
+	}
+	var out struct{ Code *big.Int }
+	if err := found.UnpackIntoInterface(&out, data); err != nil {
+		t.Fatalf("failed to unpack error into struct: %v", err)
+	}
+	if out.Code.Int64() != 42 {
+		t.Fatalf("unpacked argument mismatch: have %v, want 42", out.Code)
+	}
+	if _, _, err := abi.UnpackError(append(revertSelector, packed...)); err == nil {
+		t.Fatalf("revert reason resolved to a custom error")
+	}
+}
@@ -18,6 +18,7 @@ package bind_test
 
 import (
 	"context"
+	"errors"
 	"math/big"
 	"reflect"
 	"strings"
@@ -255,3 +256,86 @@ func newMockLog(topics []common.Hash, txHash common.Hash) types.Log {
 		Removed:     false,
 	}
 }
+
+// revertCaller is a contract caller reverting every call with the given data.
+type revertCaller struct {
+	mockCaller
+	data []byte
+}
+
+type revertError struct {
+	data []byte
+}
+
+func (e *revertError) Error() string          { return "execution reverted" }
+func (e *revertError) ErrorData() interface{} { return hexutil.Encode(e.data) }
+
+func (rc *revertCaller) CallContract(ctx context.Context, call nbn.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return nil, &revertError{data: rc.data}
+}
+
+// insufficientBalanceError mirrors the binding abigen generates for the custom error.
+type insufficientBalanceError struct {
+	Available *big.Int
+	Required  *big.Int
+}
+
+func (insufficientBalanceError) ErrorSig() string { return "InsufficientBalance(uint256,uint256)" }
+
+func (e insufficientBalanceError) Error() string {
+	return bind.FormatError("InsufficientBalance", e.Available, e.Required)
+}
+
+const customErrorABI = `[
+	{"type":"function","name":"transfer","stateMutability":"view","inputs":[],"outputs":[]},
+	{"type":"error","name":"InsufficientBalance","inputs":[{"name":"available","type":"uint256"},{"name":"required","type":"uint256"}]},
+	{"type":"error","name":"Unauthorized","inputs":[]}
+]`
+
+// Tests that calls reverted with a custom error of the ABI return an error that
+// can be matched to the generated binding of the custom error.
+func TestCallCustomError(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(customErrorABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := parsed.Errors["InsufficientBalance"].Inputs.Pack(big.NewInt(10), big.NewInt(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(crypto.Keccak256([]byte("InsufficientBalance(uint256,uint256)"))[:4], data...)
+
+	bc := bind.NewBoundContract(common.Address{}, parsed, &revertCaller{data: data}, nil, nil)
+	err = bc.Call(nil, nil, "transfer")
+
+	var custom *bind.CustomError
+	if !errors.As(err, &custom) {
+		t.Fatalf("error is not a custom error: %v", err)
+	}
+	if custom.Err.Name != "InsufficientBalance" {
+		t.Fatalf("custom error mismatch: have %s, want InsufficientBalance", custom.Err.Name)
+	}
+	if want := "execution reverted: InsufficientBalance(10, 20)"; err.Error() != want {
+		t.Fatalf("error message mismatch: have %q, want %q", err.Error(), want)
+	}
+	var value insufficientBalanceError
+	if !errors.As(err, &value) {
+		t.Fatalf("error not matched to the binding value")
+	}
+	if value.Available.Int64() != 10 || value.Required.Int64() != 20 {
+		t.Fatalf("error arguments mismatch: have %v", value)
+	}
+	var ptr *insufficientBalanceError
+	if !errors.As(err, &ptr) || ptr.Required.Int64() != 20 {
+		t.Fatalf("error not matched to the binding pointer")
+	}
+	var backend *revertError
+	if !errors.As(err, &backend) {
+		t.Fatalf("backend error not wrapped")
+	}
+	// Reverts with unknown selectors must be returned untouched
+	bc = bind.NewBoundContract(common.Address{}, parsed, &revertCaller{data: []byte{1, 2, 3, 4}}, nil, nil)
+	if err := bc.Call(nil, nil, "transfer"); errors.As(err, &custom) {
+		t.Fatalf("unknown revert resolved to custom error %v", custom.Err.Name)
+	}
+}
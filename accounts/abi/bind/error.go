@@ -0,0 +1,136 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package bind
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/token/accounts/abi"
+	"github.com/token/common/hexutil"
+)
+
+// BoundError is implemented by the Go types abigen generates for the custom
+// errors of a contract, allowing errors.As to resolve a CustomError into them.
+type BoundError interface {
+	error
+
+	// ErrorSig returns the signature of the custom error, e.g. "foo(uint256)".
+	ErrorSig() string
+}
+
+// CustomError is the error returned by contract calls and transactions reverted
+// with a custom error declared in the contract ABI.
+type CustomError struct {
+	Err  abi.Error     // Custom error the contract reverted with
+	Args []interface{} // Unpacked arguments of the custom error
+	Data []byte        // Raw revert data
+
+	cause error // Error returned by the backend
+}
+
+// Error implements error, formatting the custom error with its arguments.
+func (e *CustomError) Error() string {
+	return fmt.Sprintf("%v: %s", e.cause, FormatError(e.Err.RawName, e.Args...))
+}
+
+// Unwrap returns the error returned by the backend.
+func (e *CustomError) Unwrap() error {
+	return e.cause
+}
+
+// As unpacks the custom error into the target if it points to the generated
+// binding of the same error, either as a value or as a pointer.
+func (e *CustomError) As(target interface{}) bool {
+	val := reflect.ValueOf(target)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return false
+	}
+	typ := val.Type().Elem()
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return false
+	}
+	bound := reflect.New(typ)
+	if b, ok := bound.Interface().(BoundError); !ok || b.ErrorSig() != e.Err.Sig {
+		return false
+	}
+	if typ.NumField() != len(e.Args) {
+		return false
+	}
+	if err := e.Err.Inputs.Copy(bound.Interface(), e.Args); err != nil {
+		return false
+	}
+	if val.Type().Elem().Kind() == reflect.Ptr {
+		val.Elem().Set(bound)
+	} else {
+		val.Elem().Set(bound.Elem())
+	}
+	return true
+}
+
+// FormatError formats a custom error with its arguments, e.g. "foo(1, 2)".
+func FormatError(name string, args ...interface{}) string {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = fmt.Sprintf("%v", arg)
+	}
+	return fmt.Sprintf("%s(%s)", name, strings.Join(strs, ", "))
+}
+
+// dataError is an error carrying additional data, as returned by backends for
+// reverted executions with the hex encoded revert data.
+type dataError interface {
+	error
+	ErrorData() interface{}
+}
+
+// revertData extracts the revert data from an error returned by a backend.
+func revertData(err error) []byte {
+	var de dataError
+	if !errors.As(err, &de) {
+		return nil
+	}
+	hex, ok := de.ErrorData().(string)
+	if !ok {
+		return nil
+	}
+	data, err := hexutil.Decode(hex)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// unpackError resolves the revert data of an error returned by a backend into
+// the custom error of the contract ABI it was raised with. The error is returned
+// untouched if it does not match any custom error.
+func (c *BoundContract) unpackError(err error) error {
+	data := revertData(err)
+	if len(data) < 4 {
+		return err
+	}
+	e, args, uerr := c.abi.UnpackError(data)
+	if uerr != nil {
+		return err
+	}
+	return &CustomError{Err: *e, Args: args, Data: data, cause: err}
+}
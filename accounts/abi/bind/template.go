@@ -38,6 +38,7 @@ type tmplContract struct {
 	Fallback    *tmplMethod            // Additional special fallback function
 	Receive     *tmplMethod            // Additional special receive function
 	Events      map[string]*tmplEvent  // Contract events accessors
+	Errors      map[string]*tmplError  // Contract custom errors definitions
 	Libraries   map[string]string      // Same as tmplData, but filtered to only keep what the contract needs
 	Library     bool                   // Indicator whether the contract is a library
 }
@@ -57,6 +58,13 @@ type tmplEvent struct {
 	Normalized abi.Event // Normalized version of the parsed fields
 }
 
+// tmplError is a wrapper around an abi.Error that contains a few preprocessed
+// and cached data fields.
+type tmplError struct {
+	Original   abi.Error // Original error as parsed by the abi package
+	Normalized abi.Error // Normalized version of the parsed fields
+}
+
 // tmplField is a wrapper around a struct field with binding language
 // struct type definition and relative filed name.
 type tmplField struct {
@@ -549,6 +557,25 @@ var (
 		}
 
  	{{end}}
+
+	{{range .Errors}}
+		// {{$contract.Type}}{{.Normalized.Name}}Error represents a {{.Original.RawName}} error raised by the {{$contract.Type}} contract.
+		//
+		// Solidity: {{.Original.String}}
+		type {{$contract.Type}}{{.Normalized.Name}}Error struct { {{range .Normalized.Inputs}}
+			{{capitalise .Name}} {{bindtype .Type $structs}}; {{end}}
+		}
+
+		// ErrorSig returns the signature of the error 0x{{printf "%x" (slice .Original.ID.Bytes 0 4)}}.
+		func ({{$contract.Type}}{{.Normalized.Name}}Error) ErrorSig() string {
+			return "{{.Original.Sig}}"
+		}
+
+		// Error implements error, formatting the error with its arguments.
+		func (e {{$contract.Type}}{{.Normalized.Name}}Error) Error() string {
+			return bind.FormatError("{{.Original.RawName}}"{{range .Normalized.Inputs}}, e.{{capitalise .Name}}{{end}})
+		}
+	{{end}}
 {{end}}
 `
 
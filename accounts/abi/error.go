@@ -17,66 +17,93 @@
 package abi
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
-	"reflect"
-)
+	"strings"
 
-var (
-	errBadBool = errors.New("abi: improperly encoded boolean value")
+	"github.com/token/common"
+	"github.com/token/crypto"
 )
 
-// formatSliceString formats the reflection kind with the given slice size
-// and returns a formatted string representation.
-func formatSliceString(kind reflect.Kind, sliceSize int) string {
-	if sliceSize == -1 {
-		return fmt.Sprintf("[]%v", kind)
-	}
-	return fmt.Sprintf("[%d]%v", sliceSize, kind)
+// Error is a custom error introduced in solidity v0.8.4. Contracts revert with
+// the abi-encoded error arguments, prefixed by the 4-byte error selector, as if
+// the error were a function call.
+type Error struct {
+	// Name is the error name used for internal representation. It's derived from
+	// the raw name and a suffix will be added in the case of an error overload.
+	Name string
+	// RawName is the raw error name parsed from ABI.
+	RawName string
+	Inputs  Arguments
+	str     string
+	// Sig contains the string signature according to the ABI spec.
+	// e.g.	 error foo(uint32 a, int b) = "foo(uint32,int256)"
+	// Please note that "int" is substitute for its canonical representation "int256"
+	Sig string
+	// ID returns the canonical representation of the error's signature used by the
+	// abi definition to identify errors, the selector being its first 4 bytes.
+	ID common.Hash
 }
 
-// sliceTypeCheck checks that the given slice can by assigned to the reflection
-// type in t.
-func sliceTypeCheck(t Type, val reflect.Value) error {
-	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
-		return typeErr(formatSliceString(t.GetType().Kind(), t.Size), val.Type())
-	}
+// NewError creates a new Error.
+// It sanitizes the input arguments to remove unnamed arguments.
+// It also precomputes the id, signature and string representation
+// of the error.
+func NewError(name, rawName string, inputs Arguments) Error {
+	names := make([]string, len(inputs))
+	types := make([]string, len(inputs))
+	for i, input := range inputs {
+		if input.Name == "" {
+			inputs[i] = Argument{
+				Name: fmt.Sprintf("arg%d", i),
+				Type: input.Type,
+			}
+		} else {
+			inputs[i] = input
+		}
+		// string representation
+		names[i] = fmt.Sprintf("%v %v", input.Type, inputs[i].Name)
 
-	if t.T == ArrayTy && val.Len() != t.Size {
-		return typeErr(formatSliceString(t.Elem.GetType().Kind(), t.Size), formatSliceString(val.Type().Elem().Kind(), val.Len()))
+		// sig representation
+		types[i] = input.Type.String()
 	}
 
-	if t.Elem.T == SliceTy || t.Elem.T == ArrayTy {
-		if val.Len() > 0 {
-			return sliceTypeCheck(*t.Elem, val.Index(0))
-		}
-	}
+	str := fmt.Sprintf("error %v(%v)", rawName, strings.Join(names, ", "))
+	sig := fmt.Sprintf("%v(%v)", rawName, strings.Join(types, ","))
+	id := common.BytesToHash(crypto.Keccak256([]byte(sig)))
 
-	if val.Type().Elem().Kind() != t.Elem.GetType().Kind() {
-		return typeErr(formatSliceString(t.Elem.GetType().Kind(), t.Size), val.Type())
+	return Error{
+		Name:    name,
+		RawName: rawName,
+		Inputs:  inputs,
+		str:     str,
+		Sig:     sig,
+		ID:      id,
 	}
-	return nil
 }
 
-// typeCheck checks that the given reflection value can be assigned to the reflection
-// type in t.
-func typeCheck(t Type, value reflect.Value) error {
-	if t.T == SliceTy || t.T == ArrayTy {
-		return sliceTypeCheck(t, value)
-	}
+func (e Error) String() string {
+	return e.str
+}
 
-	// Check base type validity. Element types will be checked later on.
-	if t.GetType().Kind() != value.Kind() {
-		return typeErr(t.GetType().Kind(), value.Kind())
-	} else if t.T == FixedBytesTy && t.Size != value.Len() {
-		return typeErr(t.GetType(), value.Type())
-	} else {
-		return nil
+// Unpack unpacks the arguments of the error from the revert data.
+func (e Error) Unpack(data []byte) ([]interface{}, error) {
+	if len(data) < 4 {
+		return nil, errors.New("invalid data for unpacking")
 	}
-
+	if !bytes.Equal(data[:4], e.ID[:4]) {
+		return nil, fmt.Errorf("revert data selector %#x does not match error %s", data[:4], e.Sig)
+	}
+	return e.Inputs.Unpack(data[4:])
 }
 
-// typeErr returns a formatted type casting error.
-func typeErr(expected, got interface{}) error {
-	return fmt.Errorf("abi: cannot use %v as type %v as argument", got, expected)
+// UnpackIntoInterface unpacks the arguments of the error from the revert data
+// into v, which must be a pointer to a struct with a field per argument.
+func (e Error) UnpackIntoInterface(v interface{}, data []byte) error {
+	unpacked, err := e.Unpack(data)
+	if err != nil {
+		return err
+	}
+	return e.Inputs.Copy(v, unpacked)
 }
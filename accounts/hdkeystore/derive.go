@@ -0,0 +1,85 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package hdkeystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/token/accounts"
+	"github.com/token/common/math"
+	"github.com/token/crypto"
+)
+
+// hardenedOffset is the first index of the hardened child keys.
+const hardenedOffset = 0x80000000
+
+// errInvalidChild is returned if a derivation step yields an invalid key, which
+// BIP-32 specifies to happen with a probability lower than 1 in 2^127.
+var errInvalidChild = errors.New("invalid child key, use the next index")
+
+// deriveKey derives the private key at the given BIP-32 path from the seed.
+func deriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	var (
+		curveN    = crypto.S256().Params().N
+		key       = new(big.Int).SetBytes(sum[:32])
+		chainCode = sum[32:]
+	)
+	if key.Sign() == 0 || key.Cmp(curveN) >= 0 {
+		return nil, errInvalidChild
+	}
+	for _, index := range path {
+		// Hardened children commit to the private key, normal ones to the public
+		data := make([]byte, 0, 37)
+		if index >= hardenedOffset {
+			data = append(data, 0)
+			data = append(data, math.PaddedBigBytes(key, 32)...)
+		} else {
+			priv, err := crypto.ToECDSA(math.PaddedBigBytes(key, 32))
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, crypto.CompressPubkey(&priv.PublicKey)...)
+		}
+		var serialized [4]byte
+		binary.BigEndian.PutUint32(serialized[:], index)
+		data = append(data, serialized[:]...)
+
+		mac := hmac.New(sha512.New, chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+
+		tweak := new(big.Int).SetBytes(sum[:32])
+		if tweak.Cmp(curveN) >= 0 {
+			return nil, errInvalidChild
+		}
+		key.Add(key, tweak).Mod(key, curveN)
+		if key.Sign() == 0 {
+			return nil, errInvalidChild
+		}
+		chainCode = sum[32:]
+	}
+	return crypto.ToECDSA(math.PaddedBigBytes(key, 32))
+}
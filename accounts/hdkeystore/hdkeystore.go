@@ -0,0 +1,353 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package hdkeystore implements hierarchical deterministic software wallets,
+// deriving their accounts from a BIP-39 mnemonic encrypted at rest with the
+// scrypt scheme of the keystore.
+package hdkeystore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/token/accounts"
+	"github.com/token/accounts/keystore"
+	"github.com/token/common"
+	"github.com/token/crypto"
+	"github.com/token/event"
+	"github.com/token/log"
+	"github.com/tyler-smith/go-bip39"
+)
+
+var (
+	// ErrInvalidMnemonic is returned if a mnemonic to import is not a valid
+	// BIP-39 sentence.
+	ErrInvalidMnemonic = errors.New("invalid BIP-39 mnemonic")
+
+	// ErrWalletAlreadyExists is returned if a mnemonic to import is already
+	// present in the keystore.
+	ErrWalletAlreadyExists = errors.New("wallet already exists")
+)
+
+// KeyStoreType is the reflect type of an HD keystore backend.
+var KeyStoreType = reflect.TypeOf(&KeyStore{})
+
+// KeyStoreScheme is the protocol scheme prefixing account and wallet URLs.
+const KeyStoreScheme = "hdkeystore"
+
+// KeyStoreDir is the subdirectory of a keystore directory holding the HD wallet
+// files, which the keystore itself skips when scanning for keys.
+const KeyStoreDir = "hd"
+
+// walletVersion is the version of the wallet file format.
+const walletVersion = 1
+
+// Maximum time between wallet refreshes.
+const walletRefreshCycle = 3 * time.Second
+
+// mnemonicEntropy is the entropy in bits of the generated mnemonics, yielding
+// 24 words.
+const mnemonicEntropy = 256
+
+// walletJSON is the wallet file format. The mnemonic is encrypted while the
+// pinned accounts are kept in clear, to list them without a passphrase.
+type walletJSON struct {
+	Version  int                 `json:"version"`
+	ID       string              `json:"id"`
+	Crypto   keystore.CryptoJSON `json:"crypto"`
+	Accounts []accountJSON       `json:"accounts"`
+}
+
+// accountJSON is an account pinned into a wallet file.
+type accountJSON struct {
+	Address common.Address `json:"address"`
+	Path    string         `json:"path"`
+}
+
+// KeyStore manages a directory of HD wallet files on disk.
+type KeyStore struct {
+	keydir  string // Directory holding the wallet files
+	scryptN int    // Scrypt parameters used to encrypt new mnemonics
+	scryptP int
+
+	wallets     []*wallet               // Wallets loaded from the directory, sorted by URL
+	updateFeed  event.Feed              // Event feed to notify wallet additions/removals
+	updateScope event.SubscriptionScope // Subscription scope tracking current live listeners
+	updating    bool                    // Whether the event notification loop is running
+
+	mu sync.RWMutex
+}
+
+// NewKeyStore creates an HD keystore for the given directory.
+func NewKeyStore(keydir string, scryptN, scryptP int) *KeyStore {
+	keydir, _ = filepath.Abs(keydir)
+	ks := &KeyStore{
+		keydir:  keydir,
+		scryptN: scryptN,
+		scryptP: scryptP,
+	}
+	ks.refreshWallets()
+	return ks
+}
+
+// Wallets implements accounts.Backend, returning all the HD wallets from the
+// keystore directory.
+func (ks *KeyStore) Wallets() []accounts.Wallet {
+	// Make sure the list of wallets is in sync with the directory
+	ks.refreshWallets()
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	cpy := make([]accounts.Wallet, len(ks.wallets))
+	for i, wallet := range ks.wallets {
+		cpy[i] = wallet
+	}
+	return cpy
+}
+
+// refreshWallets scans the keystore directory and based on that does any
+// necessary wallet refreshes.
+func (ks *KeyStore) refreshWallets() {
+	files, err := ioutil.ReadDir(ks.keydir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Debug("Failed to read HD keystore directory", "dir", ks.keydir, "err", err)
+		return
+	}
+	ks.mu.Lock()
+
+	known := make(map[string]*wallet, len(ks.wallets))
+	for _, wallet := range ks.wallets {
+		known[wallet.path] = wallet
+	}
+	var (
+		wallets []*wallet
+		events  []accounts.WalletEvent
+	)
+	for _, fi := range files {
+		if fi.IsDir() || fi.Mode()&os.ModeType != 0 || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(ks.keydir, fi.Name())
+		if wallet, ok := known[path]; ok {
+			wallets = append(wallets, wallet)
+			delete(known, path)
+			continue
+		}
+		wallet, err := loadWallet(ks, path)
+		if err != nil {
+			log.Debug("Failed to load HD wallet", "path", path, "err", err)
+			continue
+		}
+		wallets = append(wallets, wallet)
+		events = append(events, accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletArrived})
+	}
+	for _, wallet := range known {
+		events = append(events, accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletDropped})
+	}
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].url.Cmp(wallets[j].url) < 0 })
+	ks.wallets = wallets
+	ks.mu.Unlock()
+
+	// Fire all wallet events and return
+	for _, event := range events {
+		ks.updateFeed.Send(event)
+	}
+}
+
+// Subscribe implements accounts.Backend, creating an async subscription to
+// receive notifications on the addition or removal of HD wallets.
+func (ks *KeyStore) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	// We need the mutex to reliably start/stop the update loop
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	// Subscribe the caller and track the subscriber count
+	sub := ks.updateScope.Track(ks.updateFeed.Subscribe(sink))
+
+	// Subscribers require an active notification loop, start it
+	if !ks.updating {
+		ks.updating = true
+		go ks.updater()
+	}
+	return sub
+}
+
+// updater is responsible for maintaining an up-to-date list of wallets stored in
+// the keystore directory, and for firing wallet addition/removal events.
+func (ks *KeyStore) updater() {
+	for {
+		time.Sleep(walletRefreshCycle)
+
+		// Run the wallet refresher
+		ks.refreshWallets()
+
+		// If all our subscribers left, stop the updater
+		ks.mu.Lock()
+		if ks.updateScope.Count() == 0 {
+			ks.updating = false
+			ks.mu.Unlock()
+			return
+		}
+		ks.mu.Unlock()
+	}
+}
+
+// NewWallet generates a new mnemonic, stores it encrypted with the passphrase
+// and pins the first account along the default derivation path. The mnemonic is
+// returned for the user to back it up.
+func (ks *KeyStore) NewWallet(passphrase string) (accounts.Wallet, string, error) {
+	entropy, err := bip39.NewEntropy(mnemonicEntropy)
+	if err != nil {
+		return nil, "", err
+	}
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return nil, "", err
+	}
+	wallet, err := ks.ImportMnemonic(mnemonic, passphrase)
+	if err != nil {
+		return nil, "", err
+	}
+	return wallet, mnemonic, nil
+}
+
+// ImportMnemonic stores the mnemonic encrypted with the passphrase and pins the
+// first account along the default derivation path.
+func (ks *KeyStore) ImportMnemonic(mnemonic, passphrase string) (accounts.Wallet, error) {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil, ErrInvalidMnemonic
+	}
+	seed := bip39.NewSeed(mnemonic, "")
+	defer zeroBytes(seed)
+
+	base := accounts.DefaultBaseDerivationPath
+	key, err := deriveKey(seed, base)
+	if err != nil {
+		return nil, err
+	}
+	first := accountJSON{Address: crypto.PubkeyToAddress(key.PublicKey), Path: base.String()}
+	zeroKey(key)
+
+	// Refuse importing the same mnemonic twice, which would duplicate the accounts
+	for _, wallet := range ks.Wallets() {
+		if wallet.Contains(accounts.Account{Address: first.Address}) {
+			return nil, ErrWalletAlreadyExists
+		}
+	}
+	cryptoStruct, err := keystore.EncryptDataV3([]byte(mnemonic), []byte(passphrase), ks.scryptN, ks.scryptP)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	file := walletJSON{
+		Version:  walletVersion,
+		ID:       id.String(),
+		Crypto:   cryptoStruct,
+		Accounts: []accountJSON{first},
+	}
+	name := fmt.Sprintf("UTC--%s--%s.json", toISO8601(time.Now().UTC()), id.String())
+	path := filepath.Join(ks.keydir, name)
+	if err := writeWalletFile(path, &file); err != nil {
+		return nil, err
+	}
+	ks.refreshWallets()
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, wallet := range ks.wallets {
+		if wallet.path == path {
+			return wallet, nil
+		}
+	}
+	return nil, fmt.Errorf("wallet %s not loaded", path)
+}
+
+// loadWallet reads a wallet file from disk.
+func loadWallet(ks *KeyStore, path string) (*wallet, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file walletJSON
+	if err := json.Unmarshal(blob, &file); err != nil {
+		return nil, err
+	}
+	if file.Version != walletVersion {
+		return nil, fmt.Errorf("unsupported wallet version %d", file.Version)
+	}
+	w := newWallet(ks, path, file.ID, file.Crypto)
+	for _, acc := range file.Accounts {
+		derivation, err := accounts.ParseDerivationPath(acc.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path of account %s: %v", acc.Address.Hex(), err)
+		}
+		w.pin(acc.Address, derivation)
+	}
+	return w, nil
+}
+
+// writeWalletFile atomically writes a wallet file to disk.
+func writeWalletFile(path string, file *walletJSON) error {
+	blob, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	// Create the keystore directory with appropriate permissions
+	// in case it is not present yet.
+	const dirPerm = 0700
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(blob); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	f.Close()
+	return os.Rename(f.Name(), path)
+}
+
+// toISO8601 formats the time like the file names of the keystore.
+func toISO8601(t time.Time) string {
+	var tz string
+	name, offset := t.Zone()
+	if name == "UTC" {
+		tz = "Z"
+	} else {
+		tz = fmt.Sprintf("%03d00", offset/3600)
+	}
+	return fmt.Sprintf("%04d-%02d-%02dT%02d-%02d-%02d.%09d%s",
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), tz)
+}
@@ -0,0 +1,284 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package hdkeystore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/token/accounts"
+	"github.com/token/accounts/keystore"
+	"github.com/token/common"
+	"github.com/token/common/math"
+	"github.com/token/core/types"
+	"github.com/token/crypto"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func tmpKeyStore(t *testing.T) (string, *KeyStore) {
+	dir, err := ioutil.TempDir("", "hdkeystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+}
+
+// Tests the key derivation against the first BIP-32 test vector.
+func TestDeriveKey(t *testing.T) {
+	seed := common.FromHex("000102030405060708090a0b0c0d0e0f")
+	path, err := accounts.ParseDerivationPath("m/0'/1/2'/2/1000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := deriveKey(seed, path)
+	if err != nil {
+		t.Fatalf("failed to derive key: %v", err)
+	}
+	want := common.FromHex("471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8")
+	if have := math.PaddedBigBytes(key.D, 32); !bytes.Equal(have, want) {
+		t.Fatalf("key mismatch: have %x, want %x", have, want)
+	}
+}
+
+// Tests that importing a mnemonic pins the first account of the default path,
+// and that further accounts can be derived, persisted and signed with.
+func TestImportDeriveSign(t *testing.T) {
+	dir, ks := tmpKeyStore(t)
+	defer os.RemoveAll(dir)
+
+	wallet, err := ks.ImportMnemonic(testMnemonic, "foo")
+	if err != nil {
+		t.Fatalf("failed to import mnemonic: %v", err)
+	}
+	if _, err := ks.ImportMnemonic(testMnemonic, "bar"); err != ErrWalletAlreadyExists {
+		t.Fatalf("duplicate import error mismatch: have %v, want %v", err, ErrWalletAlreadyExists)
+	}
+	if _, err := ks.ImportMnemonic("abandon abandon", "foo"); err != ErrInvalidMnemonic {
+		t.Fatalf("invalid import error mismatch: have %v, want %v", err, ErrInvalidMnemonic)
+	}
+	accs := wallet.Accounts()
+	if len(accs) != 1 || accs[0].Address != common.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94") {
+		t.Fatalf("pinned accounts mismatch: %v", accs)
+	}
+	// Deriving requires the wallet to be open
+	path := accounts.DefaultIterator(accounts.DefaultBaseDerivationPath)
+	path()
+	second := path()
+	if _, err := wallet.Derive(second, true); err != accounts.ErrWalletClosed {
+		t.Fatalf("closed derivation error mismatch: have %v, want %v", err, accounts.ErrWalletClosed)
+	}
+	if err := wallet.Open(""); err != ErrPassphraseNeeded {
+		t.Fatalf("open error mismatch: have %v, want %v", err, ErrPassphraseNeeded)
+	}
+	if err := wallet.Open("bar"); err != keystore.ErrDecrypt {
+		t.Fatalf("open error mismatch: have %v, want %v", err, keystore.ErrDecrypt)
+	}
+	if err := wallet.Open("foo"); err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+	account, err := wallet.Derive(second, true)
+	if err != nil {
+		t.Fatalf("failed to derive account: %v", err)
+	}
+	// Sign with the open wallet and with the passphrase once closed
+	sig, err := wallet.SignText(account, []byte("hello"))
+	if err != nil {
+		t.Fatalf("failed to sign text: %v", err)
+	}
+	if pub, err := crypto.SigToPub(accounts.TextHash([]byte("hello")), sig); err != nil || crypto.PubkeyToAddress(*pub) != account.Address {
+		t.Fatalf("signer mismatch: %v", err)
+	}
+	wallet.Close()
+
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(0), 21000, big.NewInt(1), nil)
+	if _, err := wallet.SignTx(account, tx, big.NewInt(1)); err != keystore.ErrLocked {
+		t.Fatalf("closed signing error mismatch: have %v, want %v", err, keystore.ErrLocked)
+	}
+	signed, err := wallet.SignTxWithPassphrase(account, "foo", tx, big.NewInt(1))
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	if sender, err := types.Sender(types.LatestSignerForChainID(big.NewInt(1)), signed); err != nil || sender != account.Address {
+		t.Fatalf("sender mismatch: have %x, want %x", sender, account.Address)
+	}
+	// Reload the keystore and ensure the derived account was persisted
+	ks = NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	wallets := ks.Wallets()
+	if len(wallets) != 1 {
+		t.Fatalf("wallet count mismatch: have %d, want 1", len(wallets))
+	}
+	if !wallets[0].Contains(account) || len(wallets[0].Accounts()) != 2 {
+		t.Fatalf("derived account not persisted: %v", wallets[0].Accounts())
+	}
+}
+
+// Tests that a newly created wallet can be restored from its mnemonic.
+func TestNewWallet(t *testing.T) {
+	dir, ks := tmpKeyStore(t)
+	defer os.RemoveAll(dir)
+
+	wallet, mnemonic, err := ks.NewWallet("foo")
+	if err != nil {
+		t.Fatalf("failed to create wallet: %v", err)
+	}
+	other, err := ioutil.TempDir("", "hdkeystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(other)
+
+	restored, err := NewKeyStore(other, keystore.LightScryptN, keystore.LightScryptP).ImportMnemonic(mnemonic, "bar")
+	if err != nil {
+		t.Fatalf("failed to restore wallet: %v", err)
+	}
+	if have, want := restored.Accounts()[0], wallet.Accounts()[0]; have.Address != want.Address {
+		t.Fatalf("restored account mismatch: have %x, want %x", have.Address, want.Address)
+	}
+}
+
+// testChain is a chain state reader reporting the given accounts as used.
+type testChain map[common.Address]bool
+
+func (c testChain) BalanceAt(ctx context.Context, account common.Address, number *big.Int) (*big.Int, error) {
+	if c[account] {
+		return big.NewInt(1), nil
+	}
+	return new(big.Int), nil
+}
+
+func (c testChain) StorageAt(ctx context.Context, account common.Address, key common.Hash, number *big.Int) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c testChain) CodeAt(ctx context.Context, account common.Address, number *big.Int) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c testChain) NonceAt(ctx context.Context, account common.Address, number *big.Int) (uint64, error) {
+	return 0, nil
+}
+
+// Tests that self-derivation pins the used accounts and the next empty one.
+func TestSelfDerive(t *testing.T) {
+	dir, ks := tmpKeyStore(t)
+	defer os.RemoveAll(dir)
+
+	wallet, err := ks.ImportMnemonic(testMnemonic, "foo")
+	if err != nil {
+		t.Fatalf("failed to import mnemonic: %v", err)
+	}
+	if err := wallet.Open("foo"); err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+	var (
+		chain = make(testChain)
+		next  = accounts.DefaultIterator(accounts.DefaultBaseDerivationPath)
+		addrs []common.Address
+	)
+	for i := 0; i < 4; i++ {
+		account, err := wallet.Derive(next(), false)
+		if err != nil {
+			t.Fatalf("failed to derive account %d: %v", i, err)
+		}
+		addrs = append(addrs, account.Address)
+	}
+	chain[addrs[0]], chain[addrs[1]], chain[addrs[2]] = true, true, true
+
+	wallet.SelfDerive([]accounts.DerivationPath{accounts.DefaultBaseDerivationPath}, chain)
+	accs := wallet.Accounts()
+	if len(accs) != 4 {
+		t.Fatalf("self-derived account count mismatch: have %d, want 4", len(accs))
+	}
+	for i, acc := range accs {
+		if acc.Address != addrs[i] {
+			t.Errorf("account %d: address mismatch: have %x, want %x", i, acc.Address, addrs[i])
+		}
+	}
+}
+
+// blockingChain is a chain state reader blocking balance queries until released.
+type blockingChain struct {
+	testChain
+	queried chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingChain) BalanceAt(ctx context.Context, account common.Address, number *big.Int) (*big.Int, error) {
+	select {
+	case c.queried <- struct{}{}:
+	default:
+	}
+	<-c.release
+	return c.testChain.BalanceAt(ctx, account, number)
+}
+
+// Tests that self-derivation doesn't hold the wallet lock while querying the
+// chain, and drops its discoveries if the wallet was closed meanwhile.
+func TestSelfDeriveUnlocked(t *testing.T) {
+	dir, ks := tmpKeyStore(t)
+	defer os.RemoveAll(dir)
+
+	wallet, err := ks.ImportMnemonic(testMnemonic, "foo")
+	if err != nil {
+		t.Fatalf("failed to import mnemonic: %v", err)
+	}
+	if err := wallet.Open("foo"); err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+	next := accounts.DefaultIterator(accounts.DefaultBaseDerivationPath)
+	next()
+	used, err := wallet.Derive(next(), false)
+	if err != nil {
+		t.Fatalf("failed to derive account: %v", err)
+	}
+	chain := &blockingChain{testChain: testChain{used.Address: true}, queried: make(chan struct{}), release: make(chan struct{})}
+	pinned := len(wallet.Accounts())
+	wallet.SelfDerive([]accounts.DerivationPath{accounts.DefaultBaseDerivationPath}, chain)
+
+	done := make(chan []accounts.Account)
+	go func() { done <- wallet.Accounts() }()
+	<-chain.queried
+
+	// The wallet must stay usable while the chain is queried
+	status := make(chan string)
+	go func() {
+		s, _ := wallet.Status()
+		status <- s
+	}()
+	select {
+	case s := <-status:
+		if s != "Open" {
+			t.Errorf("status mismatch: have %s, want Open", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("wallet locked during chain query")
+	}
+	if err := wallet.Close(); err != nil {
+		t.Fatalf("failed to close wallet: %v", err)
+	}
+	close(chain.release)
+	if accs := <-done; len(accs) != pinned {
+		t.Errorf("accounts pinned after close: have %d, want %d", len(accs), pinned)
+	}
+}
@@ -0,0 +1,459 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package hdkeystore
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	nbn "github.com/token"
+	"github.com/token/accounts"
+	"github.com/token/accounts/keystore"
+	"github.com/token/common"
+	"github.com/token/core/types"
+	"github.com/token/crypto"
+	"github.com/token/log"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Minimum time between account self-derivation attempts.
+const selfDeriveThrottling = time.Second
+
+// ErrPassphraseNeeded is returned when opening a wallet without the passphrase
+// its mnemonic is encrypted with.
+var ErrPassphraseNeeded = accounts.NewAuthNeededError("mnemonic passphrase")
+
+// wallet is an HD wallet backed by an encrypted mnemonic on disk.
+type wallet struct {
+	ks   *KeyStore           // HD keystore the wallet belongs to
+	path string              // Path of the wallet file
+	url  accounts.URL        // Textual URL uniquely identifying this wallet
+	id   string              // Unique identifier of the wallet file
+	enc  keystore.CryptoJSON // Encrypted mnemonic
+
+	accounts []accounts.Account                         // List of derived accounts pinned into the wallet
+	paths    map[common.Address]accounts.DerivationPath // Known derivation paths for signing operations
+	seed     []byte                                     // BIP-39 seed while the wallet is open, nil otherwise
+
+	deriveNextPaths []accounts.DerivationPath // Next derivation paths for account auto-discovery (multiple bases supported)
+	deriveNextAddrs []common.Address          // Next derived account addresses for auto-discovery (multiple bases supported)
+	deriveChain     nbn.ChainStateReader      // Blockchain state reader to discover used account with
+	deriveLast      time.Time                 // Time of the last self-derivation attempt
+	deriving        bool                      // Whether a self-derivation is querying the chain
+
+	stateLock sync.RWMutex // Protects read and write access to the wallet struct fields
+	log       log.Logger   // Contextual logger to tag the wallet with its id
+}
+
+// newWallet creates a closed wallet for the given wallet file.
+func newWallet(ks *KeyStore, path, id string, enc keystore.CryptoJSON) *wallet {
+	return &wallet{
+		ks:    ks,
+		path:  path,
+		url:   accounts.URL{Scheme: KeyStoreScheme, Path: path},
+		id:    id,
+		enc:   enc,
+		paths: make(map[common.Address]accounts.DerivationPath),
+		log:   log.New("url", accounts.URL{Scheme: KeyStoreScheme, Path: path}),
+	}
+}
+
+// pin adds an account to the list of tracked accounts, returning whether it was
+// not known yet. The caller must hold the state lock.
+func (w *wallet) pin(address common.Address, path accounts.DerivationPath) (accounts.Account, bool) {
+	account := accounts.Account{
+		Address: address,
+		URL:     accounts.URL{Scheme: w.url.Scheme, Path: fmt.Sprintf("%s/%s", w.url.Path, path)},
+	}
+	if _, ok := w.paths[address]; ok {
+		return account, false
+	}
+	w.accounts = append(w.accounts, account)
+	w.paths[address] = make(accounts.DerivationPath, len(path))
+	copy(w.paths[address], path)
+	return account, true
+}
+
+// store persists the pinned accounts into the wallet file. The caller must hold
+// the state lock.
+func (w *wallet) store() error {
+	file := walletJSON{
+		Version:  walletVersion,
+		ID:       w.id,
+		Crypto:   w.enc,
+		Accounts: make([]accountJSON, len(w.accounts)),
+	}
+	for i, account := range w.accounts {
+		file.Accounts[i] = accountJSON{Address: account.Address, Path: w.paths[account.Address].String()}
+	}
+	return writeWalletFile(w.path, &file)
+}
+
+// decryptSeed decrypts the mnemonic of the wallet and returns its BIP-39 seed.
+func (w *wallet) decryptSeed(passphrase string) ([]byte, error) {
+	mnemonic, err := keystore.DecryptDataV3(w.enc, passphrase)
+	if err != nil {
+		if passphrase == "" {
+			return nil, ErrPassphraseNeeded
+		}
+		return nil, err
+	}
+	defer zeroBytes(mnemonic)
+	return bip39.NewSeed(string(mnemonic), ""), nil
+}
+
+// URL implements accounts.Wallet, returning the URL of the wallet file.
+func (w *wallet) URL() accounts.URL {
+	return w.url
+}
+
+// Status implements accounts.Wallet, returning whether the mnemonic of the
+// wallet is decrypted or not.
+func (w *wallet) Status() (string, error) {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	if w.seed == nil {
+		return "Closed", nil
+	}
+	return "Open", nil
+}
+
+// Open implements accounts.Wallet, decrypting the mnemonic of the wallet to
+// allow deriving and signing with its accounts without a passphrase.
+func (w *wallet) Open(passphrase string) error {
+	w.stateLock.Lock()
+	if w.seed != nil {
+		w.stateLock.Unlock()
+		return accounts.ErrWalletAlreadyOpen
+	}
+	seed, err := w.decryptSeed(passphrase)
+	if err != nil {
+		w.stateLock.Unlock()
+		return err
+	}
+	w.seed = seed
+	w.stateLock.Unlock()
+
+	// Notify anyone listening for wallet events that a new wallet is available
+	go w.ks.updateFeed.Send(accounts.WalletEvent{Wallet: w, Kind: accounts.WalletOpened})
+	return nil
+}
+
+// Close implements accounts.Wallet, wiping the decrypted seed from memory.
+func (w *wallet) Close() error {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	zeroBytes(w.seed)
+	w.seed = nil
+	w.deriveChain = nil
+	return nil
+}
+
+// Accounts implements accounts.Wallet, returning the list of accounts pinned to
+// the wallet. If self-derivation was enabled, the account list is expanded based
+// on current chain state.
+func (w *wallet) Accounts() []accounts.Account {
+	w.selfDerive()
+
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	cpy := make([]accounts.Account, len(w.accounts))
+	copy(cpy, w.accounts)
+	return cpy
+}
+
+// selfDerive attempts to find new non-zero accounts along the self-derivation
+// bases, unless the wallet is closed or was searched recently. The chain state is
+// queried without holding the state lock, the discovered accounts are pinned
+// afterwards unless the wallet was closed or its derivation reset meanwhile.
+func (w *wallet) selfDerive() {
+	w.stateLock.Lock()
+	if w.seed == nil || w.deriveChain == nil || w.deriving || time.Since(w.deriveLast) < selfDeriveThrottling {
+		w.stateLock.Unlock()
+		return
+	}
+	w.deriveLast = time.Now()
+	w.deriving = true
+
+	var (
+		seed  = common.CopyBytes(w.seed)
+		chain = w.deriveChain
+		last  = w.deriveLast
+		paths = make([]accounts.DerivationPath, len(w.deriveNextPaths))
+		addrs = make([]common.Address, len(w.deriveNextAddrs))
+	)
+	for i, path := range w.deriveNextPaths {
+		paths[i] = make(accounts.DerivationPath, len(path))
+		copy(paths[i], path)
+	}
+	copy(addrs, w.deriveNextAddrs)
+	w.stateLock.Unlock()
+
+	defer zeroBytes(seed)
+
+	// Discover the accounts to pin against the current chain state
+	type discovery struct {
+		address common.Address
+		path    accounts.DerivationPath
+		balance *big.Int
+		nonce   uint64
+	}
+	var (
+		found   []discovery
+		context = context.Background()
+	)
+bases:
+	for i := 0; i < len(addrs); i++ {
+		for {
+			// Retrieve the next derived nbn account
+			if addrs[i] == (common.Address{}) {
+				key, err := deriveKey(seed, paths[i])
+				if err != nil {
+					w.log.Warn("HD wallet account derivation failed", "err", err)
+					break bases
+				}
+				addrs[i] = crypto.PubkeyToAddress(key.PublicKey)
+				zeroKey(key)
+			}
+			// Check the account's status against the current chain state
+			balance, err := chain.BalanceAt(context, addrs[i], nil)
+			if err != nil {
+				w.log.Warn("HD wallet balance retrieval failed", "err", err)
+				break bases
+			}
+			nonce, err := chain.NonceAt(context, addrs[i], nil)
+			if err != nil {
+				w.log.Warn("HD wallet nonce retrieval failed", "err", err)
+				break bases
+			}
+			// Stop at the first empty account, it will be checked again on the next
+			// attempt. Only the last base pins its empty account, like USB wallets.
+			empty := balance.Sign() == 0 && nonce == 0
+			if empty && i < len(addrs)-1 {
+				break
+			}
+			path := make(accounts.DerivationPath, len(paths[i]))
+			copy(path, paths[i])
+			found = append(found, discovery{addrs[i], path, balance, nonce})
+			if empty {
+				break
+			}
+			// Fetch the next potential account
+			addrs[i] = common.Address{}
+			paths[i][len(paths[i])-1]++
+		}
+	}
+	// Pin the discovered accounts and persist them if any are new
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	w.deriving = false
+	if w.seed == nil || w.deriveChain == nil || !w.deriveLast.Equal(last) {
+		return
+	}
+	w.deriveNextPaths, w.deriveNextAddrs = paths, addrs
+
+	var pinned bool
+	for _, acc := range found {
+		if _, added := w.pin(acc.address, acc.path); added {
+			pinned = true
+			w.log.Info("HD wallet discovered new account", "address", acc.address, "path", acc.path, "balance", acc.balance, "nonce", acc.nonce)
+		}
+	}
+	if pinned {
+		if err := w.store(); err != nil {
+			w.log.Warn("Failed to persist discovered accounts", "err", err)
+		}
+	}
+}
+
+// Contains implements accounts.Wallet, returning whether a particular account is
+// or is not pinned into this wallet instance.
+func (w *wallet) Contains(account accounts.Account) bool {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	_, exists := w.paths[account.Address]
+	return exists
+}
+
+// Derive implements accounts.Wallet, deriving a new account at the specific
+// derivation path. If pin is set to true, the account will be added to the list
+// of tracked accounts and persisted into the wallet file.
+func (w *wallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	if w.seed == nil {
+		return accounts.Account{}, accounts.ErrWalletClosed
+	}
+	key, err := deriveKey(w.seed, path)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	zeroKey(key)
+
+	if !pin {
+		return accounts.Account{
+			Address: address,
+			URL:     accounts.URL{Scheme: w.url.Scheme, Path: fmt.Sprintf("%s/%s", w.url.Path, path)},
+		}, nil
+	}
+	account, added := w.pin(address, path)
+	if added {
+		if err := w.store(); err != nil {
+			return accounts.Account{}, err
+		}
+	}
+	return account, nil
+}
+
+// SelfDerive implements accounts.Wallet, setting the base account derivation
+// paths from which the wallet attempts to discover non zero accounts and
+// automatically add them to list of tracked accounts.
+//
+// Discovery only runs while the wallet is open, at most once per throttling
+// period, when its accounts are listed. The chain is queried without holding the
+// wallet lock, so other calls don't wait for it. Calling it with a nil chain
+// reader disables discovery.
+func (w *wallet) SelfDerive(bases []accounts.DerivationPath, chain nbn.ChainStateReader) {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	w.deriveNextPaths = make([]accounts.DerivationPath, len(bases))
+	for i, base := range bases {
+		w.deriveNextPaths[i] = make(accounts.DerivationPath, len(base))
+		copy(w.deriveNextPaths[i][:], base[:])
+	}
+	w.deriveNextAddrs = make([]common.Address, len(bases))
+	w.deriveChain = chain
+	w.deriveLast = time.Time{}
+}
+
+// signingKey derives the private key of a pinned account, decrypting the seed
+// with the passphrase if the wallet is closed and one is given.
+func (w *wallet) signingKey(account accounts.Account, passphrase *string) (*ecdsa.PrivateKey, error) {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	// Make sure the requested account is contained within
+	path, ok := w.paths[account.Address]
+	if !ok {
+		return nil, accounts.ErrUnknownAccount
+	}
+	seed := w.seed
+	if passphrase != nil {
+		var err error
+		if seed, err = w.decryptSeed(*passphrase); err != nil {
+			return nil, err
+		}
+		defer zeroBytes(seed)
+	}
+	if seed == nil {
+		return nil, keystore.ErrLocked
+	}
+	key, err := deriveKey(seed, path)
+	if err != nil {
+		return nil, err
+	}
+	// Guard against wallet files tampered with to list foreign addresses
+	if crypto.PubkeyToAddress(key.PublicKey) != account.Address {
+		zeroKey(key)
+		return nil, fmt.Errorf("derived address mismatch: expected %s", account.Address.Hex())
+	}
+	return key, nil
+}
+
+// signHash signs the hash with the given account.
+func (w *wallet) signHash(account accounts.Account, passphrase *string, hash []byte) ([]byte, error) {
+	key, err := w.signingKey(account, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key)
+	return crypto.Sign(hash, key)
+}
+
+// signTx signs the transaction with the given account.
+func (w *wallet) signTx(account accounts.Account, passphrase *string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	key, err := w.signingKey(account, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key)
+
+	// Depending on the presence of the chain ID, sign with 2718 or homestead
+	signer := types.LatestSignerForChainID(chainID)
+	return types.SignTx(tx, signer, key)
+}
+
+// SignData signs keccak256(data). The mimetype parameter describes the type of data being signed.
+func (w *wallet) SignData(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+	return w.signHash(account, nil, crypto.Keccak256(data))
+}
+
+// SignDataWithPassphrase signs keccak256(data). The mimetype parameter describes the type of data being signed.
+func (w *wallet) SignDataWithPassphrase(account accounts.Account, passphrase, mimeType string, data []byte) ([]byte, error) {
+	return w.signHash(account, &passphrase, crypto.Keccak256(data))
+}
+
+// SignText implements accounts.Wallet, attempting to sign the hash of
+// the given text with the given account.
+func (w *wallet) SignText(account accounts.Account, text []byte) ([]byte, error) {
+	return w.signHash(account, nil, accounts.TextHash(text))
+}
+
+// SignTextWithPassphrase implements accounts.Wallet, attempting to sign the
+// hash of the given text with the given account using passphrase as extra authentication.
+func (w *wallet) SignTextWithPassphrase(account accounts.Account, passphrase string, text []byte) ([]byte, error) {
+	return w.signHash(account, &passphrase, accounts.TextHash(text))
+}
+
+// SignTx implements accounts.Wallet, attempting to sign the given transaction
+// with the given account.
+func (w *wallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return w.signTx(account, nil, tx, chainID)
+}
+
+// SignTxWithPassphrase implements accounts.Wallet, attempting to sign the given
+// transaction with the given account using passphrase as extra authentication.
+func (w *wallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return w.signTx(account, &passphrase, tx, chainID)
+}
+
+// zeroBytes zeroes a byte slice in memory.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// zeroKey zeroes a private key in memory.
+func zeroKey(k *ecdsa.PrivateKey) {
+	b := k.D.Bits()
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,438 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package kms implements an account backend whose keys are held by a remote
+// key-management service. The private keys never leave the service: the node
+// only lists the available keys and asks the service to sign digests with them,
+// which is enough to sign transactions, messages and alien block seals.
+//
+// The service is reached over a minimal HTTP API, which is simple to put in
+// front of an enterprise KMS or HSM:
+//
+//	GET  <endpoint>/keys  -> {"keys": [{"id": "...", "address": "0x..."}]}
+//	POST <endpoint>/sign  {"keyId": "...", "digest": "0x..."} -> {"signature": "0x..."}
+//
+// Signatures are 65 bytes secp256k1 signatures in [R || S || V] format, with V
+// either 0/1 or 27/28. Failed requests are answered with a non-2xx status and
+// an optional {"error": "..."} body. If a token is configured, it is sent as a
+// bearer token in the Authorization header of every request.
+//
+// Like the keys of the local key store, the keys of the service are locked
+// until explicitly unlocked with --unlock, which is subject to the same
+// restrictions on exposed APIs.
+package kms
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/token"
+	"github.com/token/accounts"
+	"github.com/token/common"
+	"github.com/token/common/hexutil"
+	"github.com/token/core/types"
+	"github.com/token/crypto"
+	"github.com/token/event"
+	"github.com/token/log"
+)
+
+// Scheme is the URL scheme of the accounts held by a key-management service.
+const Scheme = "kms"
+
+const (
+	// requestTimeout is the maximum time allowed for a request to the service.
+	requestTimeout = 10 * time.Second
+
+	// maxResponseSize is the maximum size of a response accepted from the service.
+	maxResponseSize = 1024 * 1024
+)
+
+var (
+	// ErrUnknownAccount is returned if the service holds no key for an account.
+	ErrUnknownAccount = errors.New("unknown account in key-management service")
+
+	// ErrLocked is returned when signing with an account that wasn't unlocked.
+	ErrLocked = accounts.NewAuthNeededError("unlock")
+)
+
+// BackendType is the reflect type of a key-management service backend.
+var BackendType = reflect.TypeOf(&Backend{})
+
+// Key is a signing key held by the key-management service.
+type Key struct {
+	ID      string         `json:"id"`      // Identifier of the key within the service
+	Address common.Address `json:"address"` // Address derived from the public key
+}
+
+// keysResponse is the answer of the service to a key listing.
+type keysResponse struct {
+	Keys []Key `json:"keys"`
+}
+
+// signRequest is a request to the service to sign a digest.
+type signRequest struct {
+	KeyID  string        `json:"keyId"`
+	Digest hexutil.Bytes `json:"digest"`
+}
+
+// signResponse is the answer of the service to a signing request.
+type signResponse struct {
+	Signature hexutil.Bytes `json:"signature"`
+}
+
+// errorResponse is the body of a failed request.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Backend is an account backend exposing the keys of a key-management service
+// as a single wallet.
+type Backend struct {
+	wallet *Wallet
+}
+
+// NewBackend creates a backend for the key-management service at the given
+// endpoint, authenticating with the token if it's not empty. The service is
+// queried for its keys to check that it's reachable.
+func NewBackend(endpoint string, token string) (*Backend, error) {
+	wallet, err := NewWallet(endpoint, token)
+	if err != nil {
+		return nil, err
+	}
+	return &Backend{wallet: wallet}, nil
+}
+
+// Wallets implements accounts.Backend, returning the wallet of the service.
+func (b *Backend) Wallets() []accounts.Wallet {
+	return []accounts.Wallet{b.wallet}
+}
+
+// Unlock allows signing with the key of the account until the node stops.
+func (b *Backend) Unlock(addr common.Address) error {
+	return b.wallet.Unlock(accounts.Account{Address: addr})
+}
+
+// Subscribe implements accounts.Backend. The wallet of the service never comes
+// or goes, so no events are ever sent.
+func (b *Backend) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// Wallet is an accounts.Wallet signing with the keys of a key-management
+// service.
+type Wallet struct {
+	endpoint string
+	url      accounts.URL
+	token    string
+	client   *http.Client
+
+	keys     map[common.Address]Key // Keys of the service by address, nil until listed
+	keysErr  error                  // Error of the last key listing
+	unlocked map[common.Address]bool
+	lock     sync.RWMutex
+}
+
+// NewWallet creates a wallet for the key-management service at the given
+// endpoint, authenticating with the token if it's not empty.
+func NewWallet(endpoint string, token string) (*Wallet, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported key-management service url %q", endpoint)
+	}
+	w := &Wallet{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		url:      accounts.URL{Scheme: Scheme, Path: u.Host + strings.TrimSuffix(u.Path, "/")},
+		token:    token,
+		client:   &http.Client{Timeout: requestTimeout},
+		unlocked: make(map[common.Address]bool),
+	}
+	if _, err := w.refresh(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// URL implements accounts.Wallet, returning the URL of the service.
+func (w *Wallet) URL() accounts.URL {
+	return w.url
+}
+
+// Status implements accounts.Wallet, returning the outcome of the last key
+// listing.
+func (w *Wallet) Status() (string, error) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	if w.keysErr != nil {
+		return "Unreachable", w.keysErr
+	}
+	return fmt.Sprintf("Online, %d keys, %d unlocked", len(w.keys), len(w.unlocked)), nil
+}
+
+// Open implements accounts.Wallet. The service is reached on demand, so there
+// is nothing to open.
+func (w *Wallet) Open(passphrase string) error {
+	return nil
+}
+
+// Close implements accounts.Wallet. The service is reached on demand, so there
+// is nothing to close.
+func (w *Wallet) Close() error {
+	return nil
+}
+
+// Unlock allows signing with the key of the account until the node stops or
+// the account is locked again.
+func (w *Wallet) Unlock(account accounts.Account) error {
+	if _, err := w.key(account.Address); err != nil {
+		return err
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.unlocked[account.Address] = true
+	return nil
+}
+
+// Lock forbids signing with the key of the account.
+func (w *Wallet) Lock(account accounts.Account) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	delete(w.unlocked, account.Address)
+}
+
+// Accounts implements accounts.Wallet, listing the keys of the service.
+func (w *Wallet) Accounts() []accounts.Account {
+	keys, err := w.refresh()
+	if err != nil {
+		log.Error("Failed to list key-management service keys", "url", w.url, "err", err)
+	}
+	accs := make([]accounts.Account, 0, len(keys))
+	for _, key := range keys {
+		accs = append(accs, w.account(key))
+	}
+	return accs
+}
+
+// Contains implements accounts.Wallet, returning whether the service holds a
+// key for the account. The keys are only listed again if none were listed yet.
+func (w *Wallet) Contains(account accounts.Account) bool {
+	key, err := w.key(account.Address)
+	if err != nil {
+		return false
+	}
+	return account.URL == (accounts.URL{}) || account.URL == w.account(key).URL
+}
+
+// Derive implements accounts.Wallet. Keys are managed by the service, so no
+// derivation is possible.
+func (w *Wallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	return accounts.Account{}, accounts.ErrNotSupported
+}
+
+// SelfDerive implements accounts.Wallet. Keys are managed by the service, so
+// no derivation is possible.
+func (w *Wallet) SelfDerive(bases []accounts.DerivationPath, chain nbn.ChainStateReader) {
+}
+
+// SignData implements accounts.Wallet, signing keccak256(data). This covers
+// the alien and clique block seals too, which are signatures of the hash of
+// the RLP encoded header.
+func (w *Wallet) SignData(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+	return w.signHash(account, crypto.Keccak256(data))
+}
+
+// SignDataWithPassphrase implements accounts.Wallet. Access to the keys is
+// controlled by the service, so the passphrase is ignored, but the account must
+// still be unlocked.
+func (w *Wallet) SignDataWithPassphrase(account accounts.Account, passphrase, mimeType string, data []byte) ([]byte, error) {
+	return w.SignData(account, mimeType, data)
+}
+
+// SignText implements accounts.Wallet, signing the hash of the given text
+// prefixed by the nbn prefix scheme.
+func (w *Wallet) SignText(account accounts.Account, text []byte) ([]byte, error) {
+	return w.signHash(account, accounts.TextHash(text))
+}
+
+// SignTextWithPassphrase implements accounts.Wallet. Access to the keys is
+// controlled by the service, so the passphrase is ignored, but the account must
+// still be unlocked.
+func (w *Wallet) SignTextWithPassphrase(account accounts.Account, passphrase string, text []byte) ([]byte, error) {
+	return w.SignText(account, text)
+}
+
+// SignTx implements accounts.Wallet, signing the transaction for the given
+// chain.
+func (w *Wallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	signer := types.LatestSignerForChainID(chainID)
+	hash := signer.Hash(tx)
+
+	sig, err := w.signHash(account, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	return tx.WithSignature(signer, sig)
+}
+
+// SignTxWithPassphrase implements accounts.Wallet. Access to the keys is
+// controlled by the service, so the passphrase is ignored, but the account must
+// still be unlocked.
+func (w *Wallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return w.SignTx(account, tx, chainID)
+}
+
+// account converts a key of the service into an account of the wallet.
+func (w *Wallet) account(key Key) accounts.Account {
+	return accounts.Account{
+		Address: key.Address,
+		URL:     accounts.URL{Scheme: Scheme, Path: w.url.Path + "/keys/" + key.ID},
+	}
+}
+
+// key returns the key of the service for the address, listing the keys if
+// none were listed yet.
+func (w *Wallet) key(addr common.Address) (Key, error) {
+	w.lock.RLock()
+	keys := w.keys
+	w.lock.RUnlock()
+
+	if keys == nil {
+		var err error
+		if keys, err = w.refresh(); err != nil {
+			return Key{}, err
+		}
+	}
+	key, ok := keys[addr]
+	if !ok {
+		return Key{}, ErrUnknownAccount
+	}
+	return key, nil
+}
+
+// refresh lists the keys of the service, caching them for the lookups.
+func (w *Wallet) refresh() (map[common.Address]Key, error) {
+	var res keysResponse
+	err := w.call(http.MethodGet, "/keys", nil, &res)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.keysErr = err; err != nil {
+		return w.keys, err
+	}
+	keys := make(map[common.Address]Key, len(res.Keys))
+	for _, key := range res.Keys {
+		keys[key.Address] = key
+	}
+	w.keys = keys
+	return keys, nil
+}
+
+// signHash asks the service to sign the hash with the key of the account, if
+// it's unlocked. The signature is checked against the account, so a
+// misconfigured service can't produce signatures of another key.
+func (w *Wallet) signHash(account accounts.Account, hash []byte) ([]byte, error) {
+	key, err := w.key(account.Address)
+	if err != nil {
+		return nil, err
+	}
+	w.lock.RLock()
+	unlocked := w.unlocked[account.Address]
+	w.lock.RUnlock()
+
+	if !unlocked {
+		return nil, ErrLocked
+	}
+	var res signResponse
+	if err := w.call(http.MethodPost, "/sign", &signRequest{KeyID: key.ID, Digest: hash}, &res); err != nil {
+		return nil, err
+	}
+	sig := []byte(res.Signature)
+	if len(sig) != crypto.SignatureLength {
+		return nil, fmt.Errorf("invalid signature length %d from key-management service", len(sig))
+	}
+	if sig[crypto.RecoveryIDOffset] == 27 || sig[crypto.RecoveryIDOffset] == 28 {
+		sig[crypto.RecoveryIDOffset] -= 27 // Transform V from 27/28 to 0/1
+	}
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature from key-management service: %v", err)
+	}
+	if signer := crypto.PubkeyToAddress(*pub); signer != account.Address {
+		return nil, fmt.Errorf("key-management service signed with %x instead of %x", signer, account.Address)
+	}
+	return sig, nil
+}
+
+// call sends a request to the service and decodes its answer into result.
+func (w *Wallet) call(method, path string, params interface{}, result interface{}) error {
+	var body io.Reader
+	if params != nil {
+		blob, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(blob)
+	}
+	req, err := http.NewRequest(method, w.endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	if params != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.token)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	blob, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var failure errorResponse
+		if json.Unmarshal(blob, &failure) == nil && failure.Error != "" {
+			return fmt.Errorf("key-management service: %s (%s)", failure.Error, resp.Status)
+		}
+		return fmt.Errorf("key-management service: %s", resp.Status)
+	}
+	return json.Unmarshal(blob, result)
+}
@@ -0,0 +1,192 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package kms
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/token/accounts"
+	"github.com/token/common"
+	"github.com/token/consensus/alien"
+	"github.com/token/core/rawdb"
+	"github.com/token/core/types"
+	"github.com/token/crypto"
+	"github.com/token/params"
+)
+
+// newTestBackend starts a mock service holding two fresh keys and connects a
+// backend to it.
+func newTestBackend(t *testing.T) (*Backend, []*ecdsa.PrivateKey, func()) {
+	key1, _ := crypto.GenerateKey()
+	key2, _ := crypto.GenerateKey()
+	server := httptest.NewServer(NewMockServer("secret", key1, key2))
+
+	backend, err := NewBackend(server.URL+"/", "secret")
+	if err != nil {
+		server.Close()
+		t.Fatalf("failed to create backend: %v", err)
+	}
+	return backend, []*ecdsa.PrivateKey{key1, key2}, server.Close
+}
+
+// Tests that the keys of the service are exposed as accounts of the manager.
+func TestAccounts(t *testing.T) {
+	backend, keys, stop := newTestBackend(t)
+	defer stop()
+
+	manager := accounts.NewManager(&accounts.Config{}, backend)
+	defer manager.Close()
+
+	addrs := manager.Accounts()
+	if len(addrs) != len(keys) {
+		t.Fatalf("account count mismatch: have %d, want %d", len(addrs), len(keys))
+	}
+	for _, key := range keys {
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		wallet, err := manager.Find(accounts.Account{Address: addr})
+		if err != nil {
+			t.Fatalf("account %x not found: %v", addr, err)
+		}
+		if wallet.URL().Scheme != Scheme {
+			t.Errorf("wallet scheme mismatch: have %s, want %s", wallet.URL().Scheme, Scheme)
+		}
+	}
+	if _, err := manager.Find(accounts.Account{Address: common.Address{1}}); err == nil {
+		t.Error("found account unknown to the service")
+	}
+	if status, err := backend.wallet.Status(); err != nil {
+		t.Errorf("unexpected wallet status: %s, %v", status, err)
+	}
+}
+
+// Tests that transactions are signed by the key of the account.
+func TestSignTx(t *testing.T) {
+	backend, keys, stop := newTestBackend(t)
+	defer stop()
+
+	var (
+		wallet  = backend.Wallets()[0]
+		from    = crypto.PubkeyToAddress(keys[1].PublicKey)
+		chainID = big.NewInt(1337)
+		tx      = types.NewTransaction(0, common.Address{2}, big.NewInt(1), 21000, big.NewInt(1), nil)
+	)
+	if _, err := wallet.SignTx(accounts.Account{Address: from}, tx, chainID); err != ErrLocked {
+		t.Fatalf("signing with locked account: have %v, want %v", err, ErrLocked)
+	}
+	if _, err := wallet.SignTxWithPassphrase(accounts.Account{Address: from}, "", tx, chainID); err != ErrLocked {
+		t.Fatalf("signing with locked account and passphrase: have %v, want %v", err, ErrLocked)
+	}
+	if err := backend.Unlock(from); err != nil {
+		t.Fatalf("failed to unlock account: %v", err)
+	}
+	signed, err := wallet.SignTx(accounts.Account{Address: from}, tx, chainID)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+	if err != nil {
+		t.Fatalf("failed to recover sender: %v", err)
+	}
+	if sender != from {
+		t.Errorf("sender mismatch: have %x, want %x", sender, from)
+	}
+	if _, err := wallet.SignTx(accounts.Account{Address: common.Address{1}}, tx, chainID); !errors.Is(err, ErrUnknownAccount) {
+		t.Errorf("signing with unknown account: have %v, want %v", err, ErrUnknownAccount)
+	}
+	if err := backend.Unlock(common.Address{1}); !errors.Is(err, ErrUnknownAccount) {
+		t.Errorf("unlocking unknown account: have %v, want %v", err, ErrUnknownAccount)
+	}
+	// Locking the account again must forbid signing
+	backend.wallet.Lock(accounts.Account{Address: from})
+	if _, err := wallet.SignTx(accounts.Account{Address: from}, tx, chainID); err != ErrLocked {
+		t.Errorf("signing with relocked account: have %v, want %v", err, ErrLocked)
+	}
+}
+
+// Tests that alien block seals produced by the service are accepted by the
+// engine as signed by the account.
+func TestSignAlienSeal(t *testing.T) {
+	backend, keys, stop := newTestBackend(t)
+	defer stop()
+
+	var (
+		wallet = backend.Wallets()[0]
+		signer = crypto.PubkeyToAddress(keys[0].PublicKey)
+		engine = alien.New(&params.AlienConfig{MinVoterBalance: new(big.Int)}, rawdb.NewMemoryDatabase())
+		header = &types.Header{
+			Number:   big.NewInt(1),
+			Coinbase: signer,
+			Time:     1,
+			Extra:    make([]byte, 32+crypto.SignatureLength),
+		}
+	)
+	if err := backend.Unlock(signer); err != nil {
+		t.Fatalf("failed to unlock account: %v", err)
+	}
+	seal, err := wallet.SignData(accounts.Account{Address: signer}, accounts.MimetypeAlien, alien.AlienRLP(header))
+	if err != nil {
+		t.Fatalf("failed to sign seal: %v", err)
+	}
+	copy(header.Extra[len(header.Extra)-crypto.SignatureLength:], seal)
+
+	author, err := engine.Author(header)
+	if err != nil {
+		t.Fatalf("failed to recover author: %v", err)
+	}
+	if author != signer {
+		t.Errorf("author mismatch: have %x, want %x", author, signer)
+	}
+}
+
+// Tests that failures of the service are reported.
+func TestServiceErrors(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	server := httptest.NewServer(NewMockServer("secret", key))
+	defer server.Close()
+
+	if _, err := NewBackend(server.URL, "wrong"); err == nil {
+		t.Error("backend created with invalid token")
+	}
+	// A service signing with the wrong key must be rejected
+	other, _ := crypto.GenerateKey()
+	forger := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/keys" {
+			json := `{"keys":[{"id":"key0","address":"` + crypto.PubkeyToAddress(key.PublicKey).Hex() + `"}]}`
+			w.Write([]byte(json))
+			return
+		}
+		NewMockServer("", other).ServeHTTP(w, r)
+	}))
+	defer forger.Close()
+
+	backend, err := NewBackend(forger.URL, "")
+	if err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+	account := accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}
+	if err := backend.Unlock(account.Address); err != nil {
+		t.Fatalf("failed to unlock account: %v", err)
+	}
+	if _, err := backend.Wallets()[0].SignText(account, []byte("hello")); err == nil {
+		t.Error("accepted signature of another key")
+	}
+}
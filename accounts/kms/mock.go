@@ -0,0 +1,129 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package kms
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/token/common"
+	"github.com/token/crypto"
+)
+
+// MockServer is an in-memory key-management service implementing the HTTP API
+// of the backend, meant for testing. Keys are identified as key0, key1, etc.
+// in the order they were added.
+type MockServer struct {
+	token string
+	keys  map[string]*ecdsa.PrivateKey
+	order []string
+	lock  sync.RWMutex
+}
+
+// NewMockServer creates a mock key-management service holding the given keys.
+// If the token isn't empty, requests must carry it as a bearer token.
+func NewMockServer(token string, keys ...*ecdsa.PrivateKey) *MockServer {
+	s := &MockServer{token: token, keys: make(map[string]*ecdsa.PrivateKey)}
+	for _, key := range keys {
+		s.AddKey(key)
+	}
+	return s
+}
+
+// AddKey adds a key to the service, returning its identifier.
+func (s *MockServer) AddKey(key *ecdsa.PrivateKey) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id := fmt.Sprintf("key%d", len(s.order))
+	s.keys[id] = key
+	s.order = append(s.order, id)
+	return id
+}
+
+// ServeHTTP implements http.Handler, serving the key listing and signing
+// requests.
+func (s *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" && r.Header.Get("Authorization") != "Bearer "+s.token {
+		s.fail(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/keys"):
+		s.listKeys(w)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/sign"):
+		s.sign(w, r)
+	default:
+		s.fail(w, http.StatusNotFound, "not found")
+	}
+}
+
+// listKeys answers a key listing.
+func (s *MockServer) listKeys(w http.ResponseWriter) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	res := keysResponse{Keys: []Key{}}
+	for _, id := range s.order {
+		res.Keys = append(res.Keys, Key{ID: id, Address: crypto.PubkeyToAddress(s.keys[id].PublicKey)})
+	}
+	s.reply(w, &res)
+}
+
+// sign answers a signing request.
+func (s *MockServer) sign(w http.ResponseWriter, r *http.Request) {
+	var req signRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.Digest) != common.HashLength {
+		s.fail(w, http.StatusBadRequest, "invalid digest length")
+		return
+	}
+	s.lock.RLock()
+	key, ok := s.keys[req.KeyID]
+	s.lock.RUnlock()
+
+	if !ok {
+		s.fail(w, http.StatusNotFound, "unknown key")
+		return
+	}
+	sig, err := crypto.Sign(req.Digest, key)
+	if err != nil {
+		s.fail(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.reply(w, &signResponse{Signature: sig})
+}
+
+// reply sends a successful answer.
+func (s *MockServer) reply(w http.ResponseWriter, res interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// fail sends an error answer.
+func (s *MockServer) fail(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&errorResponse{Error: msg})
+}
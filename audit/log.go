@@ -0,0 +1,306 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package audit implements the validator audit trail of the node: an append-only
+// log of JSON records, each one chained to the previous one by hash and signed
+// by the node key, so that any modification, reordering or removal of records
+// can be detected.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/token/common"
+	"github.com/token/common/hexutil"
+	"github.com/token/crypto"
+	"github.com/token/log"
+)
+
+// maxRecordSize is the maximum length of a record line accepted when reading a
+// log back.
+const maxRecordSize = 1024 * 1024
+
+var (
+	// ErrBadHash is returned if the hash of a record doesn't match its content.
+	ErrBadHash = errors.New("record hash mismatch")
+
+	// ErrBadSignature is returned if a record isn't signed by the log's signer.
+	ErrBadSignature = errors.New("invalid record signature")
+
+	// ErrBrokenChain is returned if a record doesn't follow its predecessor.
+	ErrBrokenChain = errors.New("record not chained to its predecessor")
+)
+
+// Record is an entry of the audit log. The hash covers all the other fields
+// and the hash of the previous record, and is signed by the node key.
+type Record struct {
+	Seq  uint64          `json:"seq"`  // Position of the record in the log, starting at 1
+	Time string          `json:"time"` // Time of the record in RFC 3339 format
+	Kind string          `json:"kind"` // Kind of the recorded event
+	Data json.RawMessage `json:"data"` // Kind specific content of the record
+	Prev common.Hash     `json:"prev"` // Hash of the previous record, zero for the first
+	Hash common.Hash     `json:"hash"` // Hash of the record
+	Sig  hexutil.Bytes   `json:"sig"`  // Signature of the hash by the node key
+}
+
+// recordBody is the part of a record covered by its hash.
+type recordBody struct {
+	Seq  uint64          `json:"seq"`
+	Time string          `json:"time"`
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data"`
+	Prev common.Hash     `json:"prev"`
+}
+
+// SealHash computes the hash of the record's content, chained to the previous
+// record.
+func (r *Record) SealHash() (common.Hash, error) {
+	blob, err := json.Marshal(&recordBody{Seq: r.Seq, Time: r.Time, Kind: r.Kind, Data: r.Data, Prev: r.Prev})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(blob), nil
+}
+
+// Signer recovers the public key that signed the record.
+func (r *Record) Signer() (*ecdsa.PublicKey, error) {
+	if len(r.Sig) != crypto.SignatureLength {
+		return nil, ErrBadSignature
+	}
+	pub, err := crypto.SigToPub(r.Hash[:], r.Sig)
+	if err != nil {
+		return nil, ErrBadSignature
+	}
+	return pub, nil
+}
+
+// Log is an audit log file records are appended to.
+type Log struct {
+	file *os.File
+	key  *ecdsa.PrivateKey
+	seq  uint64      // Sequence number of the last record
+	last common.Hash // Hash of the last record
+	lock sync.Mutex
+}
+
+// Open opens the audit log at the given path, creating it if needed, to append
+// records signed by the key. An existing log is continued from its last record,
+// which must be signed by the same key.
+func Open(path string, key *ecdsa.PrivateKey) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{file: file, key: key}
+
+	last, end, err := lastRecord(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+	// Drop a record torn by a crash in the middle of a write, it was never
+	// completely written hence never acknowledged
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() > end {
+		log.Warn("Truncating torn audit log record", "path", path, "size", info.Size(), "truncated", info.Size()-end)
+		if err := file.Truncate(end); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if last != nil {
+		signer, err := last.Signer()
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read audit log: record %d: %v", last.Seq, err)
+		}
+		if crypto.PubkeyToAddress(*signer) != crypto.PubkeyToAddress(key.PublicKey) {
+			file.Close()
+			return nil, errors.New("audit log signed by a different key")
+		}
+		l.seq, l.last = last.Seq, last.Hash
+	}
+	return l, nil
+}
+
+// lastRecord returns the last record of the log, or nil if it's empty, along with
+// the length of the log up to the end of that record. Records are terminated by
+// a newline, a trailing partial line is a torn write and isn't returned.
+func lastRecord(r io.Reader) (*Record, int64, error) {
+	var (
+		reader = bufio.NewReader(r)
+		line   []byte
+		offset int64
+		end    int64
+	)
+	for {
+		blob, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(blob) > maxRecordSize {
+			return nil, 0, fmt.Errorf("record at offset %d too long", offset)
+		}
+		offset += int64(len(blob))
+		if len(bytes.TrimSpace(blob)) > 0 {
+			line = append(line[:0], blob...)
+		}
+		end = offset
+	}
+	if line == nil {
+		return nil, end, nil
+	}
+	record := new(Record)
+	if err := json.Unmarshal(line, record); err != nil {
+		return nil, 0, fmt.Errorf("invalid last record: %v", err)
+	}
+	return record, end, nil
+}
+
+// Append signs a record of the given kind and content, chains it to the last
+// one and writes it to the log.
+func (l *Log) Append(kind string, data interface{}) (*Record, error) {
+	blob, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.file == nil {
+		return nil, errors.New("audit log closed")
+	}
+	record := &Record{
+		Seq:  l.seq + 1,
+		Time: time.Now().UTC().Format(time.RFC3339Nano),
+		Kind: kind,
+		Data: blob,
+		Prev: l.last,
+	}
+	if record.Hash, err = record.SealHash(); err != nil {
+		return nil, err
+	}
+	if record.Sig, err = crypto.Sign(record.Hash[:], l.key); err != nil {
+		return nil, err
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+	if err := l.file.Sync(); err != nil {
+		return nil, err
+	}
+	l.seq, l.last = record.Seq, record.Hash
+	return record, nil
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// VerifyResult summarizes a verified audit log.
+type VerifyResult struct {
+	Records uint64           // Number of records in the log
+	Signer  *ecdsa.PublicKey // Key that signed the records, nil if the log is empty
+	First   string           // Time of the first record
+	Last    string           // Time of the last record
+	Kinds   map[string]int   // Number of records of each kind
+}
+
+// Verify checks that all the records of a log are intact, chained to each other
+// and signed by the same key. If signer is nil, the key is the one that signed
+// the first record. Errors point to the line of the first invalid record.
+func Verify(r io.Reader, signer *ecdsa.PublicKey) (*VerifyResult, error) {
+	var (
+		result  = &VerifyResult{Signer: signer, Kinds: make(map[string]int)}
+		scanner = bufio.NewScanner(r)
+		prev    common.Hash
+		line    int
+	)
+	scanner.Buffer(make([]byte, 4096), maxRecordSize)
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: invalid record: %v", line, err)
+		}
+		if record.Seq != result.Records+1 || record.Prev != prev {
+			return nil, fmt.Errorf("line %d: %w", line, ErrBrokenChain)
+		}
+		hash, err := record.SealHash()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if hash != record.Hash {
+			return nil, fmt.Errorf("line %d: %w", line, ErrBadHash)
+		}
+		pub, err := record.Signer()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if result.Signer == nil {
+			result.Signer = pub
+		}
+		if crypto.PubkeyToAddress(*pub) != crypto.PubkeyToAddress(*result.Signer) {
+			return nil, fmt.Errorf("line %d: %w", line, ErrBadSignature)
+		}
+		if result.Records == 0 {
+			result.First = record.Time
+		}
+		result.Records, result.Last = record.Seq, record.Time
+		result.Kinds[record.Kind]++
+		prev = record.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: %v", line+1, err)
+	}
+	return result, nil
+}
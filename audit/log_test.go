@@ -0,0 +1,221 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/token/common"
+	"github.com/token/crypto"
+)
+
+// writeTestLog creates a log with a few records, reopening it halfway through.
+func writeTestLog(t *testing.T, path string, key *ecdsa.PrivateKey) {
+	l, err := Open(path, key)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	l.Append(KindStart, &StartRecord{Version: "test"})
+	l.Append(KindSealed, &SealedRecord{Number: 1, Signer: crypto.PubkeyToAddress(key.PublicKey)})
+	l.Close()
+
+	if l, err = Open(path, key); err != nil {
+		t.Fatalf("failed to reopen log: %v", err)
+	}
+	defer l.Close()
+
+	l.Append(KindStart, &StartRecord{Version: "test"})
+	l.Append(KindConfirm, &TxRecord{Data: "ufo:1:event:confirm:1", Confirmed: 1})
+	if _, err := l.Append(KindMissed, &MissedRecord{Number: 2, Signer: common.Address{1}}); err != nil {
+		t.Fatalf("failed to append record: %v", err)
+	}
+}
+
+// Tests that records survive reopening the log and verify as a single chain.
+func TestLogVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	key, _ := crypto.GenerateKey()
+	writeTestLog(t, path, key)
+
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Verify(bytes.NewReader(blob), nil)
+	if err != nil {
+		t.Fatalf("failed to verify log: %v", err)
+	}
+	if result.Records != 5 {
+		t.Errorf("record count mismatch: have %d, want 5", result.Records)
+	}
+	if result.Kinds[KindStart] != 2 || result.Kinds[KindMissed] != 1 {
+		t.Errorf("record kinds mismatch: %v", result.Kinds)
+	}
+	if crypto.PubkeyToAddress(*result.Signer) != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Errorf("signer mismatch")
+	}
+	if _, err := Verify(bytes.NewReader(blob), &key.PublicKey); err != nil {
+		t.Errorf("failed to verify log with expected signer: %v", err)
+	}
+	other, _ := crypto.GenerateKey()
+	if _, err := Verify(bytes.NewReader(blob), &other.PublicKey); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("log verified with unexpected signer: %v", err)
+	}
+	// Ensure the log can't be continued with a different key
+	if _, err := Open(path, other); err == nil {
+		t.Error("log opened with a different key")
+	}
+}
+
+// Tests that modified, removed, reordered and forged records are detected.
+func TestLogTampering(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	key, _ := crypto.GenerateKey()
+	writeTestLog(t, path, key)
+
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(blob)), "\n")
+
+	// forge rewrites the third record with the given key, keeping it chained
+	forge := func(key *ecdsa.PrivateKey) []string {
+		var record Record
+		if err := json.Unmarshal([]byte(lines[2]), &record); err != nil {
+			t.Fatal(err)
+		}
+		record.Data = json.RawMessage(`{"number":3}`)
+		record.Hash, _ = record.SealHash()
+		record.Sig, _ = crypto.Sign(record.Hash[:], key)
+		line, _ := json.Marshal(&record)
+
+		forged := append([]string{}, lines...)
+		forged[2] = string(line)
+		return forged
+	}
+	other, _ := crypto.GenerateKey()
+	tests := []struct {
+		name  string
+		lines []string
+		err   error
+	}{
+		{
+			name:  "modified",
+			lines: append(append(append([]string{}, lines[:1]...), strings.Replace(lines[1], `"number":1`, `"number":2`, 1)), lines[2:]...),
+			err:   ErrBadHash,
+		},
+		{
+			name:  "removed",
+			lines: append(append([]string{}, lines[:1]...), lines[2:]...),
+			err:   ErrBrokenChain,
+		},
+		{
+			name:  "reordered",
+			lines: append(append([]string{}, lines[1], lines[0]), lines[2:]...),
+			err:   ErrBrokenChain,
+		},
+		{
+			name:  "forged",
+			lines: forge(other),
+			err:   ErrBadSignature,
+		},
+		{
+			name:  "rewritten",
+			lines: forge(key),
+			err:   ErrBrokenChain, // The next record is still chained to the original
+		},
+	}
+	for _, tt := range tests {
+		_, err := Verify(strings.NewReader(strings.Join(tt.lines, "\n")), nil)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error mismatch: have %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+// Tests that a record torn by a crash is dropped when reopening the log, and
+// that the log keeps verifying as a single chain afterwards.
+func TestLogTornRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	key, _ := crypto.GenerateKey()
+	writeTestLog(t, path, key)
+
+	// Simulate a crash halfway through writing the last record
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(blob), "\n")
+	last := lines[len(lines)-2]
+	intact := strings.Join(lines[:len(lines)-2], "")
+	if err := ioutil.WriteFile(path, []byte(intact+last[:len(last)/2]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Open(path, key)
+	if err != nil {
+		t.Fatalf("failed to reopen torn log: %v", err)
+	}
+	record, err := l.Append(KindStart, &StartRecord{Version: "test"})
+	if err != nil {
+		t.Fatalf("failed to append record: %v", err)
+	}
+	l.Close()
+
+	if record.Seq != 5 {
+		t.Errorf("record sequence mismatch: have %d, want %d", record.Seq, 5)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	result, err := Verify(f, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to verify repaired log: %v", err)
+	}
+	if result.Records != 5 {
+		t.Errorf("record count mismatch: have %d, want %d", result.Records, 5)
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package audit
+
+import (
+	"crypto/ecdsa"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/token/accounts"
+	"github.com/token/common"
+	"github.com/token/consensus"
+	"github.com/token/consensus/alien"
+	"github.com/token/core"
+	"github.com/token/core/types"
+	"github.com/token/event"
+	"github.com/token/log"
+	"github.com/token/node"
+	"github.com/token/p2p/enode"
+	"github.com/token/params"
+)
+
+const (
+	// chainEventChanSize is the size of channel listening to ChainEvent.
+	chainEventChanSize = 64
+
+	// txChanSize is the size of channel listening to NewTxsEvent.
+	txChanSize = 4096
+
+	// loggedTxsLimit is the number of recently logged transactions remembered to
+	// avoid logging the ones re-injected into the pool by reorgs again.
+	loggedTxsLimit = 4096
+
+	// auditedBlocksLimit is the number of recently audited blocks remembered to
+	// avoid recording the missed slots of a block imported again twice.
+	auditedBlocksLimit = 1024
+)
+
+// Kinds of audit records.
+const (
+	KindStart    = "start"    // Audit log (re)opened by the node
+	KindSealed   = "sealed"   // Block sealed by the local signer
+	KindConfirm  = "confirm"  // Block confirmation sent by a local account
+	KindCustomTx = "customTx" // Custom transaction submitted by a local account
+	KindMissed   = "missed"   // Slot missed by a local signer, as punished in a block
+)
+
+// StartRecord is the content of a KindStart record.
+type StartRecord struct {
+	Node    enode.ID `json:"node"`
+	Version string   `json:"version"`
+}
+
+// SealedRecord is the content of a KindSealed record.
+type SealedRecord struct {
+	Number     uint64             `json:"number"`
+	Hash       common.Hash        `json:"hash"`
+	ParentHash common.Hash        `json:"parentHash"`
+	Signer     common.Address     `json:"signer"`
+	Time       uint64             `json:"time"`
+	Txs        int                `json:"txs"`
+	GasUsed    uint64             `json:"gasUsed"`
+	Payouts    []consensus.Payout `json:"payouts,omitempty"`
+}
+
+// TxRecord is the content of KindConfirm and KindCustomTx records.
+type TxRecord struct {
+	Hash      common.Hash    `json:"hash"`
+	From      common.Address `json:"from"`
+	To        common.Address `json:"to"`
+	Nonce     uint64         `json:"nonce"`
+	Data      string         `json:"data"`
+	Confirmed uint64         `json:"confirmed,omitempty"` // Block number confirmed by a KindConfirm record
+}
+
+// MissedRecord is the content of a KindMissed record.
+type MissedRecord struct {
+	Number   uint64         `json:"number"`
+	Hash     common.Hash    `json:"hash"`
+	Reporter common.Address `json:"reporter"` // Signer of the block punishing the missed slot
+	Signer   common.Address `json:"signer"`   // Local signer that missed its slot
+}
+
+// Backend is the full node functionality needed by the audit service.
+type Backend interface {
+	AccountManager() *accounts.Manager
+	BlockChain() *core.BlockChain
+	TxPool() *core.TxPool
+	EventMux() *event.TypeMux
+	Engine() consensus.Engine
+}
+
+// Service appends the validator events of the node to an audit log.
+type Service struct {
+	backend Backend
+	path    string
+	key     *ecdsa.PrivateKey
+	node    enode.ID
+
+	log     *Log
+	logged  *lru.Cache // Hashes of the recently logged transactions
+	audited *lru.Cache // Hashes of the recently audited blocks
+
+	minedSub *event.TypeMuxSubscription
+	chainSub event.Subscription
+	txSub    event.Subscription
+	quit     chan struct{}
+	done     chan struct{}
+}
+
+// New creates the audit service appending to the log at the given path, and
+// registers it with the node.
+func New(stack *node.Node, backend Backend, path string) error {
+	key := stack.Config().NodeKey()
+	logged, _ := lru.New(loggedTxsLimit)
+	audited, _ := lru.New(auditedBlocksLimit)
+
+	stack.RegisterLifecycle(&Service{
+		backend: backend,
+		path:    stack.ResolvePath(path),
+		key:     key,
+		node:    enode.PubkeyToIDV4(&key.PublicKey),
+		logged:  logged,
+		audited: audited,
+	})
+	return nil
+}
+
+// Start implements node.Lifecycle, opening the log and starting to record.
+func (s *Service) Start() error {
+	l, err := Open(s.path, s.key)
+	if err != nil {
+		return err
+	}
+	if _, err := l.Append(KindStart, &StartRecord{Node: s.node, Version: params.VersionWithMeta}); err != nil {
+		l.Close()
+		return err
+	}
+	s.log = l
+
+	chainCh := make(chan core.ChainEvent, chainEventChanSize)
+	txCh := make(chan core.NewTxsEvent, txChanSize)
+	s.minedSub = s.backend.EventMux().Subscribe(core.NewMinedBlockEvent{})
+	s.chainSub = s.backend.BlockChain().SubscribeChainEvent(chainCh)
+	s.txSub = s.backend.TxPool().SubscribeNewTxsEvent(txCh)
+	s.quit, s.done = make(chan struct{}), make(chan struct{})
+	go s.loop(chainCh, txCh)
+
+	log.Info("Audit log started", "path", s.path)
+	return nil
+}
+
+// Stop implements node.Lifecycle, terminating the recording and closing the log.
+func (s *Service) Stop() error {
+	if s.log == nil {
+		return nil
+	}
+	s.minedSub.Unsubscribe()
+	s.chainSub.Unsubscribe()
+	s.txSub.Unsubscribe()
+	close(s.quit)
+	<-s.done
+
+	log.Info("Audit log stopped")
+	return s.log.Close()
+}
+
+// loop records the events of the node until stopped.
+func (s *Service) loop(chainCh chan core.ChainEvent, txCh chan core.NewTxsEvent) {
+	defer close(s.done)
+
+	for {
+		select {
+		case ev, ok := <-s.minedSub.Chan():
+			if !ok {
+				return
+			}
+			if mined, ok := ev.Data.(core.NewMinedBlockEvent); ok {
+				s.recordSealed(mined.Block)
+			}
+		case ev := <-chainCh:
+			s.recordMissed(ev.Block.Header())
+
+		case ev := <-txCh:
+			s.recordTxs(ev.Txs)
+
+		case <-s.chainSub.Err():
+			return
+		case <-s.txSub.Err():
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// append writes a record to the log, reporting failures.
+func (s *Service) append(kind string, data interface{}) {
+	if _, err := s.log.Append(kind, data); err != nil {
+		log.Error("Failed to write audit record", "kind", kind, "err", err)
+	}
+}
+
+// blockAudit returns the punishments and payouts of the header if the engine is
+// able to report them.
+func (s *Service) blockAudit(header *types.Header) *consensus.BlockAudit {
+	engine, ok := s.backend.Engine().(consensus.AuditEngine)
+	if !ok {
+		return nil
+	}
+	audit, err := engine.BlockAudit(header)
+	if err != nil {
+		log.Warn("Failed to audit block", "number", header.Number, "hash", header.Hash(), "err", err)
+		return nil
+	}
+	return audit
+}
+
+// recordSealed records a block sealed by the local signer along with its payouts.
+func (s *Service) recordSealed(block *types.Block) {
+	record := &SealedRecord{
+		Number:     block.NumberU64(),
+		Hash:       block.Hash(),
+		ParentHash: block.ParentHash(),
+		Signer:     block.Coinbase(),
+		Time:       block.Time(),
+		Txs:        len(block.Transactions()),
+		GasUsed:    block.GasUsed(),
+	}
+	if audit := s.blockAudit(block.Header()); audit != nil {
+		record.Payouts = audit.Payouts
+	}
+	s.append(KindSealed, record)
+}
+
+// recordMissed records the slots of local signers punished as missed by a new
+// canonical block. Blocks imported again, as during reorgs, are only recorded
+// once.
+func (s *Service) recordMissed(header *types.Header) {
+	hash := header.Hash()
+	if s.audited.Contains(hash) {
+		return
+	}
+	s.audited.Add(hash, struct{}{})
+
+	audit := s.blockAudit(header)
+	if audit == nil {
+		return
+	}
+	for _, signer := range audit.Missed {
+		if !s.isLocal(signer) {
+			continue
+		}
+		s.append(KindMissed, &MissedRecord{
+			Number:   header.Number.Uint64(),
+			Hash:     hash,
+			Reporter: header.Coinbase,
+			Signer:   signer,
+		})
+	}
+}
+
+// recordTxs records the confirmations and custom transactions of local accounts
+// entering the transaction pool.
+func (s *Service) recordTxs(txs []*types.Transaction) {
+	signer := types.LatestSigner(s.backend.BlockChain().Config())
+	for _, tx := range txs {
+		if !alien.IsCustomTx(tx.Data()) || tx.To() == nil || s.logged.Contains(tx.Hash()) {
+			continue
+		}
+		from, err := types.Sender(signer, tx)
+		if err != nil || !s.isLocal(from) {
+			continue
+		}
+		record := &TxRecord{
+			Hash:  tx.Hash(),
+			From:  from,
+			To:    *tx.To(),
+			Nonce: tx.Nonce(),
+			Data:  string(tx.Data()),
+		}
+		kind := KindCustomTx
+		if number, ok := alien.ConfirmedNumber(tx.Data()); ok {
+			kind, record.Confirmed = KindConfirm, number
+		}
+		s.logged.Add(tx.Hash(), struct{}{})
+		s.append(kind, record)
+	}
+}
+
+// isLocal reports whether the address is an account of the node's wallets.
+func (s *Service) isLocal(addr common.Address) bool {
+	_, err := s.backend.AccountManager().Find(accounts.Account{Address: addr})
+	return err == nil
+}
@@ -121,6 +121,10 @@ var (
 		Usage: "File used to emit audit logs. Set to \"\" to disable",
 		Value: "audit.log",
 	}
+	signHistoryFlag = cli.StringFlag{
+		Name:  "signhistory",
+		Usage: "File used to record sealed alien headers and refuse double signing (default = inside the configdir)",
+	}
 	ruleFlag = cli.StringFlag{
 		Name:  "rules",
 		Usage: "Path to the rule file to auto-authorize requests with",
@@ -208,6 +212,66 @@ The newaccount command creates a new keystore-backed account. It is a convenienc
 which can be used in lieu of an external UI.`,
 	}
 
+	newHDWalletCommand = cli.Command{
+		Action:    utils.MigrateFlags(newHDWallet),
+		Name:      "newhdwallet",
+		Usage:     "Create a new mnemonic wallet",
+		ArgsUsage: "",
+		Flags: []cli.Flag{
+			logLevelFlag,
+			keystoreFlag,
+			utils.LightKDFFlag,
+			acceptFlag,
+		},
+		Description: `
+The newhdwallet command generates a new BIP-39 mnemonic, stored encrypted in the keystore,
+and prints it along with its first account. Further accounts are derived along the
+default derivation path once the wallet is opened.`,
+	}
+	importMnemonicCommand = cli.Command{
+		Action:    utils.MigrateFlags(importMnemonic),
+		Name:      "importmnemonic",
+		Usage:     "Import a mnemonic into a new wallet",
+		ArgsUsage: "<file>",
+		Flags: []cli.Flag{
+			logLevelFlag,
+			keystoreFlag,
+			utils.LightKDFFlag,
+			acceptFlag,
+		},
+		Description: `
+The importmnemonic command stores the BIP-39 mnemonic read from a file encrypted in the
+keystore, and prints its first account.`,
+	}
+
+	exportHistoryCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportHistory),
+		Name:      "exporthistory",
+		Usage:     "Export the signing history of alien headers",
+		ArgsUsage: "<file>",
+		Flags: []cli.Flag{
+			logLevelFlag,
+			configdirFlag,
+			signHistoryFlag,
+		},
+		Description: `
+The exporthistory command writes the record of the alien headers sealed by this signer
+to a file, which can be imported by the signer a validator is migrated to.`,
+	}
+	importHistoryCommand = cli.Command{
+		Action:    utils.MigrateFlags(importHistory),
+		Name:      "importhistory",
+		Usage:     "Import the signing history of alien headers",
+		ArgsUsage: "<file>",
+		Flags: []cli.Flag{
+			logLevelFlag,
+			configdirFlag,
+			signHistoryFlag,
+		},
+		Description: `
+The importhistory command merges a signing history exported by another signer into the
+local one. Nothing is imported if the histories conflict.`,
+	}
 	gendocCommand = cli.Command{
 		Action: GenDoc,
 		Name:   "gendoc",
@@ -238,6 +302,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			signerSecretFlag,
 			customDBFlag,
 			auditLogFlag,
+			signHistoryFlag,
 			ruleFlag,
 			stdiouiFlag,
 			testFlag,
@@ -267,6 +332,7 @@ func init() {
 		signerSecretFlag,
 		customDBFlag,
 		auditLogFlag,
+		signHistoryFlag,
 		ruleFlag,
 		stdiouiFlag,
 		testFlag,
@@ -279,6 +345,10 @@ func init() {
 		setCredentialCommand,
 		delCredentialCommand,
 		newAccountCommand,
+		newHDWalletCommand,
+		importMnemonicCommand,
+		exportHistoryCommand,
+		importHistoryCommand,
 		gendocCommand}
 	cli.CommandHelpTemplate = flags.CommandHelpTemplate
 	// Override the default app help template
@@ -473,6 +543,63 @@ func removeCredential(ctx *cli.Context) error {
 	return nil
 }
 
+// signHistoryPath returns the file the signing history is persisted to.
+func signHistoryPath(ctx *cli.Context) string {
+	if path := ctx.GlobalString(signHistoryFlag.Name); path != "" {
+		return path
+	}
+	return filepath.Join(ctx.GlobalString(configdirFlag.Name), "signhistory.json")
+}
+
+func exportHistory(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		utils.Fatalf("This command requires a file to be passed as an argument")
+	}
+	if err := initialize(ctx); err != nil {
+		return err
+	}
+	history, err := core.NewSignHistory(signHistoryPath(ctx))
+	if err != nil {
+		utils.Fatalf("Failed to open signing history: %v", err)
+	}
+	f, err := os.OpenFile(ctx.Args().First(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		utils.Fatalf("Failed to create export file: %v", err)
+	}
+	defer f.Close()
+
+	if err := history.Export(f); err != nil {
+		utils.Fatalf("Failed to export signing history: %v", err)
+	}
+	log.Info("Exported signing history", "file", ctx.Args().First())
+	return nil
+}
+
+func importHistory(ctx *cli.Context) error {
+	if len(ctx.Args()) < 1 {
+		utils.Fatalf("This command requires a file to be passed as an argument")
+	}
+	if err := initialize(ctx); err != nil {
+		return err
+	}
+	history, err := core.NewSignHistory(signHistoryPath(ctx))
+	if err != nil {
+		utils.Fatalf("Failed to open signing history: %v", err)
+	}
+	f, err := os.Open(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Failed to open import file: %v", err)
+	}
+	defer f.Close()
+
+	count, err := history.Import(f)
+	if err != nil {
+		utils.Fatalf("Failed to import signing history: %v", err)
+	}
+	log.Info("Imported signing history", "file", ctx.Args().First(), "headers", count)
+	return nil
+}
+
 func newAccount(c *cli.Context) error {
 	if err := initialize(c); err != nil {
 		return err
@@ -488,7 +615,7 @@ func newAccount(c *cli.Context) error {
 	log.Info("Starting clef", "keystore", ksLoc, "light-kdf", lightKdf)
 	am := core.StartClefAccountManager(ksLoc, true, lightKdf, "")
 	// This gives is us access to the external API
-	apiImpl := core.NewSignerAPI(am, 0, true, ui, nil, false, pwStorage)
+	apiImpl := core.NewSignerAPI(am, 0, true, ui, nil, false, pwStorage, nil)
 	// This gives us access to the internal API
 	internalApi := core.NewUIServerAPI(apiImpl)
 	addr, err := internalApi.New(context.Background())
@@ -498,6 +625,63 @@ func newAccount(c *cli.Context) error {
 	return err
 }
 
+// hdWalletAPI starts an account manager on the keystore defined by the CLI flags
+// and returns the internal API managing its HD wallets.
+func hdWalletAPI(c *cli.Context) *core.UIServerAPI {
+	var (
+		ui                        = core.NewCommandlineUI()
+		pwStorage storage.Storage = &storage.NoStorage{}
+		ksLoc                     = c.GlobalString(keystoreFlag.Name)
+		lightKdf                  = c.GlobalBool(utils.LightKDFFlag.Name)
+	)
+	log.Info("Starting clef", "keystore", ksLoc, "light-kdf", lightKdf)
+	am := core.StartClefAccountManager(ksLoc, true, lightKdf, "")
+	return core.NewUIServerAPI(core.NewSignerAPI(am, 0, true, ui, nil, false, pwStorage, nil))
+}
+
+func newHDWallet(c *cli.Context) error {
+	if err := initialize(c); err != nil {
+		return err
+	}
+	internalApi := hdWalletAPI(c)
+	password := utils.GetPassPhrase("Please enter a password to encrypt the new mnemonic with:", true)
+	fmt.Println()
+
+	wallet, err := internalApi.NewHDWallet(password)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Generated wallet %v\n", wallet.URL)
+	fmt.Printf("Mnemonic: %v\n", wallet.Mnemonic)
+	fmt.Printf("Account #0: %v\n", wallet.Account.Address.String())
+	log.Warn("Please write down your mnemonic, it is the only backup of all derived accounts!")
+	log.Warn("Please remember your password!")
+	return nil
+}
+
+func importMnemonic(c *cli.Context) error {
+	if len(c.Args()) < 1 {
+		utils.Fatalf("This command requires a mnemonic file to be passed as an argument")
+	}
+	if err := initialize(c); err != nil {
+		return err
+	}
+	mnemonic, err := ioutil.ReadFile(c.Args().First())
+	if err != nil {
+		utils.Fatalf("Could not read mnemonic file: %v", err)
+	}
+	internalApi := hdWalletAPI(c)
+	password := utils.GetPassPhrase("Please enter a password to encrypt the mnemonic with:", true)
+	fmt.Println()
+
+	account, err := internalApi.ImportMnemonic(string(mnemonic), password)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported account %v\n", account.Address.String())
+	return nil
+}
+
 func initialize(c *cli.Context) error {
 	// Set up the logger to print everything
 	logOutput := os.Stdout
@@ -625,8 +809,12 @@ func signer(c *cli.Context) error {
 	)
 	log.Info("Starting signer", "chainid", chainId, "keystore", ksLoc,
 		"light-kdf", lightKdf, "advanced", advanced)
+	history, err := core.NewSignHistory(signHistoryPath(c))
+	if err != nil {
+		utils.Fatalf("Failed to open signing history: %v", err)
+	}
 	am := core.StartClefAccountManager(ksLoc, nousb, lightKdf, scpath)
-	apiImpl := core.NewSignerAPI(am, chainId, nousb, ui, db, advanced, pwStorage)
+	apiImpl := core.NewSignerAPI(am, chainId, nousb, ui, db, advanced, pwStorage, history)
 
 	// Establish the bidirectional communication, by creating a new UI backend and registering
 	// it with the UI.
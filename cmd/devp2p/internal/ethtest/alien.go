@@ -0,0 +1,467 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethtest
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/token/common"
+	"github.com/token/consensus/alien"
+	"github.com/token/core/types"
+	"github.com/token/crypto"
+	"github.com/token/eth/protocols/eth"
+	"github.com/token/internal/utesting"
+	"github.com/token/rlp"
+	"github.com/token/trie"
+)
+
+const (
+	// alienHalfChainLength is the number of blocks, genesis included, of the
+	// alien test chain the node under test is initialised with.
+	alienHalfChainLength = 80
+
+	// alienExtraVanity is the number of extra-data prefix bytes reserved for
+	// signer vanity in alien headers.
+	alienExtraVanity = 32
+)
+
+// alienSignerKeys are the genesis signers of the alien test chain, used by the
+// suite to seal blocks the node must reject.
+var alienSignerKeys = []*ecdsa.PrivateKey{
+	mustHexToECDSA("0d1623570392a9f833484da697aac9b63e383b8171a4df43c4f5a69771b0ef32"),
+	mustHexToECDSA("94bc9a372bfb5a86030e1f7c0e8030d72581a88ade11deebd3c08d607d988db1"),
+	mustHexToECDSA("f9df5e754bc49dcfbc2224a43a2028bc0c47f1310b3e218d9ed384917d8fac0e"),
+}
+
+func mustHexToECDSA(hex string) *ecdsa.PrivateKey {
+	key, err := crypto.HexToECDSA(hex)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// AlienTests returns the tests specific to chains sealed by the alien engine,
+// or nothing if the test chain is not one. They need the signer keys of the
+// alien test chain in testdata/alien.
+func (s *Suite) AlienTests() []utesting.Test {
+	if s.chain.chainConfig.Alien == nil {
+		return nil
+	}
+	return []utesting.Test{
+		{Name: "TestAlienHeaderExtra", Fn: s.TestAlienHeaderExtra},
+		{Name: "TestAlienSideChainHeaders", Fn: s.TestAlienSideChainHeaders},
+		{Name: "TestAlienInvalidHeaderExtra", Fn: s.TestAlienInvalidHeaderExtra},
+		{Name: "TestAlienInvalidSigner", Fn: s.TestAlienInvalidSigner},
+		{Name: "TestAlienInvalidLockReward", Fn: s.TestAlienInvalidLockReward},
+	}
+}
+
+// TestAlienHeaderExtra tests whether the node serves the alien headers of the
+// chain unaltered, each sealed by its coinbase and carrying a well formed
+// header extra.
+func (s *Suite) TestAlienHeaderExtra(t *utesting.T) {
+	conn, err := s.dial()
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.peer(s.chain, nil); err != nil {
+		t.Fatalf("peering failed: %v", err)
+	}
+	req := &GetBlockHeaders{
+		Origin: eth.HashOrNumber{Number: 1},
+		Amount: uint64(s.chain.Len() - 1),
+	}
+	headers, err := conn.headersRequest(req, s.chain, eth65, 0)
+	if err != nil {
+		t.Fatalf("GetBlockHeaders request failed: %v", err)
+	}
+	expected, err := s.chain.GetHeaders(*req)
+	if err != nil {
+		t.Fatalf("failed to get headers for given request: %v", err)
+	}
+	if !headersMatch(expected, headers) {
+		t.Fatalf("header mismatch: \nexpected %v \ngot %v", expected, headers)
+	}
+	for _, header := range headers {
+		number := header.Number.Uint64()
+		signer, err := alienSigner(header)
+		if err != nil {
+			t.Fatalf("block %d: failed to recover signer: %v", number, err)
+		}
+		if signer != header.Coinbase {
+			t.Fatalf("block %d: signer mismatch: have %x, coinbase %x", number, signer, header.Coinbase)
+		}
+		extra, err := decodeAlienExtra(header)
+		if err != nil {
+			t.Fatalf("block %d: invalid header extra: %v", number, err)
+		}
+		if have, want := uint64(len(extra.SignerQueue)), s.chain.chainConfig.Alien.MaxSignerCount; have != want {
+			t.Fatalf("block %d: signer queue length mismatch: have %d, want %d", number, have, want)
+		}
+		if extra.ConfirmedBlockNumber >= number {
+			t.Fatalf("block %d: confirmed block %d not behind header", number, extra.ConfirmedBlockNumber)
+		}
+		for _, confirmation := range extra.CurrentBlockConfirmations {
+			if confirmation.BlockNumber.Uint64() >= number {
+				t.Fatalf("block %d: confirmation of block %d not behind header", number, confirmation.BlockNumber)
+			}
+		}
+	}
+}
+
+// TestAlienSideChainHeaders tests whether the side chain confirmations in the
+// alien headers served by the node match the confirmation transactions of the
+// block bodies.
+func (s *Suite) TestAlienSideChainHeaders(t *utesting.T) {
+	conn, err := s.dial()
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.peer(s.chain, nil); err != nil {
+		t.Fatalf("peering failed: %v", err)
+	}
+	var (
+		blocks []*types.Block
+		req    GetBlockBodies
+	)
+	for _, block := range s.chain.blocks[1:] {
+		extra, err := decodeAlienExtra(block.Header())
+		if err != nil {
+			t.Fatalf("block %d: invalid header extra: %v", block.NumberU64(), err)
+		}
+		if len(extra.SideChainConfirmations) > 0 {
+			blocks = append(blocks, block)
+			req = append(req, block.Hash())
+		}
+	}
+	if len(blocks) == 0 {
+		t.Fatalf("no side chain confirmations in test chain")
+	}
+	if err := conn.Write(&req); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	msg, ok := conn.readAndServe(s.chain, timeout).(*BlockBodies)
+	if !ok {
+		t.Fatalf("unexpected: %s", pretty.Sdump(msg))
+	}
+	if len(*msg) != len(blocks) {
+		t.Fatalf("wrong bodies in response: expected %d bodies, got %d", len(blocks), len(*msg))
+	}
+	signer := types.NewEIP155Signer(s.chain.chainConfig.ChainID)
+	for i, body := range *msg {
+		block := blocks[i]
+		if have, want := types.DeriveSha(types.Transactions(body.Transactions), trie.NewStackTrie(nil)), block.TxHash(); have != want {
+			t.Fatalf("block %d: transactions root mismatch: have %x, want %x", block.NumberU64(), have, want)
+		}
+		extra, _ := decodeAlienExtra(block.Header())
+		for _, confirmation := range extra.SideChainConfirmations {
+			prefix := fmt.Sprintf("ufo:1:sc:confirm:%s:%d:", confirmation.Hash.Hex(), confirmation.Number)
+			found := false
+			for _, tx := range body.Transactions {
+				sender, err := types.Sender(signer, tx)
+				if err == nil && sender == confirmation.Coinbase && strings.HasPrefix(string(tx.Data()), prefix) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Fatalf("block %d: no transaction for side chain confirmation %v", block.NumberU64(), confirmation)
+			}
+		}
+	}
+}
+
+// TestAlienInvalidHeaderExtra tests whether the node rejects blocks whose header
+// extra disagrees with its alien snapshot, dropping the peer announcing them.
+func (s *Suite) TestAlienInvalidHeaderExtra(t *utesting.T) {
+	tests := []struct {
+		name   string
+		tamper func(extra *alien.HeaderExtra)
+	}{
+		{
+			name: "signer queue",
+			tamper: func(extra *alien.HeaderExtra) {
+				extra.SignerQueue = append(extra.SignerQueue[1:], extra.SignerQueue[0])
+			},
+		},
+		{
+			name: "signer missing",
+			tamper: func(extra *alien.HeaderExtra) {
+				extra.SignerMissing = append(extra.SignerMissing, extra.SignerQueue...)
+			},
+		},
+	}
+	for _, tt := range tests {
+		next := s.fullChain.blocks[s.chain.Len()]
+		key, err := alienSignerKey(next.Coinbase())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		header := next.Header()
+		if err := tamperAlienExtra(header, tt.tamper); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		block := next.WithSeal(sealAlienHeader(header, key))
+		if err := s.rejectAlienBlock(block, true); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+// TestAlienInvalidSigner tests whether the node rejects blocks sealed by signers
+// not in-turn or not in the signer queue at all, dropping the peer announcing
+// them.
+func (s *Suite) TestAlienInvalidSigner(t *utesting.T) {
+	outsider, _ := crypto.GenerateKey()
+	tests := []struct {
+		name string
+		key  func(signer common.Address) *ecdsa.PrivateKey
+	}{
+		{
+			name: "out-of-turn",
+			key: func(signer common.Address) *ecdsa.PrivateKey {
+				for _, key := range alienSignerKeys {
+					if crypto.PubkeyToAddress(key.PublicKey) != signer {
+						return key
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name: "unauthorized",
+			key: func(signer common.Address) *ecdsa.PrivateKey {
+				return outsider
+			},
+		},
+	}
+	for _, tt := range tests {
+		next := s.fullChain.blocks[s.chain.Len()]
+		key := tt.key(next.Coinbase())
+
+		header := next.Header()
+		header.Coinbase = crypto.PubkeyToAddress(key.PublicKey)
+		block := next.WithSeal(sealAlienHeader(header, key))
+		if err := s.rejectAlienBlock(block, true); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+// TestAlienInvalidLockReward tests whether the node refuses to import a block
+// whose header is valid, but whose lock rewards disagree with the ones resulting
+// from the execution of the block.
+func (s *Suite) TestAlienInvalidLockReward(t *utesting.T) {
+	next := s.fullChain.blocks[s.chain.Len()]
+	key, err := alienSignerKey(next.Coinbase())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	header := next.Header()
+	err = tamperAlienExtra(header, func(extra *alien.HeaderExtra) {
+		for i := range extra.LockReward {
+			extra.LockReward[i].Amount = new(big.Int).Mul(extra.LockReward[i].Amount, big.NewInt(2))
+		}
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	block := next.WithSeal(sealAlienHeader(header, key))
+	if err := s.rejectAlienBlock(block, false); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+// rejectAlienBlock announces an invalid alternative to the next block of the
+// chain and checks that the node does not import it. If drop is set, the node
+// is expected to disconnect right away, as the block is invalid according to
+// the alien snapshot of its parent. The node's snapshot must not be affected
+// by the rejected block: new peers still see the previous head in their status
+// handshake and the valid next block gets imported.
+func (s *Suite) rejectAlienBlock(block *types.Block, drop bool) error {
+	conn, err := s.dial()
+	if err != nil {
+		return fmt.Errorf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.peer(s.chain, nil); err != nil {
+		return fmt.Errorf("peering failed: %v", err)
+	}
+	announcement := &NewBlock{
+		Block: block,
+		TD:    s.fullChain.TotalDifficultyAt(s.chain.Len()),
+	}
+	if err := conn.Write(announcement); err != nil {
+		return fmt.Errorf("could not write to connection: %v", err)
+	}
+	if drop {
+	loop:
+		for {
+			switch msg := conn.readAndServe(s.chain, timeout).(type) {
+			case *Disconnect:
+				break loop
+			case *NewBlockHashes, *NewPooledTransactionHashes, *Transactions:
+				continue
+			case *Error:
+				return fmt.Errorf("node did not disconnect: %v", msg)
+			default:
+				return fmt.Errorf("unexpected: %s", pretty.Sdump(msg))
+			}
+		}
+	}
+	// Import the valid block on a new connection, establishing that the node's
+	// snapshot still accepts it, then ensure the invalid one was not imported.
+	if err := s.sendNextBlock(eth65); err != nil {
+		return fmt.Errorf("valid block not imported: %v", err)
+	}
+	conn, err = s.dial()
+	if err != nil {
+		return fmt.Errorf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.peer(s.chain, nil); err != nil {
+		return fmt.Errorf("peering failed: %v", err)
+	}
+	req := &GetBlockHeaders{
+		Origin: eth.HashOrNumber{Hash: block.Hash()},
+		Amount: 1,
+	}
+	headers, err := conn.headersRequest(req, s.chain, eth65, 0)
+	if err != nil {
+		return fmt.Errorf("GetBlockHeaders request failed: %v", err)
+	}
+	if len(headers) != 0 {
+		return fmt.Errorf("invalid block %d imported", block.NumberU64())
+	}
+	return nil
+}
+
+// alienSignerKey returns the key of the given alien test chain signer.
+func alienSignerKey(signer common.Address) (*ecdsa.PrivateKey, error) {
+	for _, key := range alienSignerKeys {
+		if crypto.PubkeyToAddress(key.PublicKey) == signer {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown alien signer %x", signer)
+}
+
+// alienSigner recovers the signer of an alien header.
+func alienSigner(header *types.Header) (common.Address, error) {
+	if len(header.Extra) < crypto.SignatureLength {
+		return common.Address{}, fmt.Errorf("missing signature")
+	}
+	sig := header.Extra[len(header.Extra)-crypto.SignatureLength:]
+	pubkey, err := crypto.SigToPub(alien.SealHash(header).Bytes(), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pubkey), nil
+}
+
+// sealAlienHeader signs the header with the given key.
+func sealAlienHeader(header *types.Header, key *ecdsa.PrivateKey) *types.Header {
+	sig, err := crypto.Sign(alien.SealHash(header).Bytes(), key)
+	if err != nil {
+		panic(err)
+	}
+	copy(header.Extra[len(header.Extra)-crypto.SignatureLength:], sig)
+	return header
+}
+
+// decodeAlienExtra decodes the header extra of an alien header, stored between
+// the vanity and the signature of the extra-data.
+func decodeAlienExtra(header *types.Header) (*alien.HeaderExtra, error) {
+	if len(header.Extra) < alienExtraVanity+crypto.SignatureLength {
+		return nil, fmt.Errorf("extra-data too short: %d bytes", len(header.Extra))
+	}
+	extra := new(alien.HeaderExtra)
+	if err := rlp.DecodeBytes(header.Extra[alienExtraVanity:len(header.Extra)-crypto.SignatureLength], extra); err != nil {
+		return nil, err
+	}
+	return extra, nil
+}
+
+// tamperAlienExtra modifies the header extra of an alien header in place. The
+// header must be resealed afterwards.
+func tamperAlienExtra(header *types.Header, tamper func(extra *alien.HeaderExtra)) error {
+	extra, err := decodeAlienExtra(header)
+	if err != nil {
+		return err
+	}
+	tamper(extra)
+	enc, err := rlp.EncodeToBytes(extra)
+	if err != nil {
+		return err
+	}
+	vanity := header.Extra[:alienExtraVanity]
+	header.Extra = append(append(append([]byte{}, vanity...), enc...), make([]byte, crypto.SignatureLength)...)
+	return nil
+}
+
+// serveAlienBlockBody waits for the node to request the body of the given block
+// and responds with it, if the chain is sealed by the alien engine and the block
+// isn't empty. It reports whether the body was served.
+func (s *Suite) serveAlienBlockBody(conn *Conn, block *types.Block, isEth66 bool) (bool, error) {
+	if s.chain.chainConfig.Alien == nil || (len(block.Transactions()) == 0 && len(block.Uncles()) == 0) {
+		return false, nil
+	}
+	var (
+		id  uint64
+		req GetBlockBodies
+	)
+	if isEth66 {
+		var msg Message
+		id, msg = conn.Read66()
+		bodiesReq, ok := msg.(GetBlockBodies)
+		if !ok {
+			return false, fmt.Errorf("unexpected %s", pretty.Sdump(msg))
+		}
+		req = bodiesReq
+	} else {
+		msg := conn.Read()
+		bodiesReq, ok := msg.(*GetBlockBodies)
+		if !ok {
+			return false, fmt.Errorf("unexpected %s", pretty.Sdump(msg))
+		}
+		req = *bodiesReq
+	}
+	if len(req) != 1 || req[0] != block.Hash() {
+		return false, fmt.Errorf("unexpected block bodies requested: %v", pretty.Sdump(req))
+	}
+	body := &eth.BlockBody{Transactions: block.Transactions(), Uncles: block.Uncles()}
+	if isEth66 {
+		resp := &eth.BlockBodiesPacket66{
+			RequestId:         id,
+			BlockBodiesPacket: eth.BlockBodiesPacket{body},
+		}
+		if err := conn.Write66(resp, BlockBodies{}.Code()); err != nil {
+			return false, fmt.Errorf("failed to write to connection: %v", err)
+		}
+		return true, nil
+	}
+	if err := conn.Write(&BlockBodies{body}); err != nil {
+		return false, fmt.Errorf("failed to write to connection: %v", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,289 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethtest
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/token/accounts"
+	"github.com/token/common"
+	"github.com/token/consensus/alien"
+	"github.com/token/core"
+	"github.com/token/core/rawdb"
+	"github.com/token/core/types"
+	"github.com/token/core/vm"
+	"github.com/token/crypto"
+	"github.com/token/params"
+	"github.com/token/rlp"
+)
+
+// The alien test chain in testdata/alien is sealed by the real engine, which
+// only produces blocks at wall clock time. It takes a couple of minutes to
+// regenerate it with:
+//
+//	go test -run TestWriteAlienChain -write-alien-chain -timeout 10m
+var writeAlienChainFlag = flag.Bool("write-alien-chain", false, "Regenerate the alien test chain in testdata/alien")
+
+const (
+	alienChainLength = 100 // Number of blocks in testdata/alien/chain.rlp
+
+	// alienScHash is the side chain confirmed by the test chain's signers.
+	alienScHash = "0x3210000000000000000000000000000000000000000000000000000000000000"
+)
+
+var alienRecipient = common.HexToAddress("0x00000000000000000000000000000000000a11e5")
+
+func TestWriteAlienChain(t *testing.T) {
+	if !*writeAlienChainFlag {
+		t.Skip("alien test chain is only regenerated with -write-alien-chain")
+	}
+	genesis := makeAlienGenesis(uint64(time.Now().Unix()))
+	blocks, err := generateAlienChain(genesis, alienChainLength)
+	if err != nil {
+		t.Fatalf("failed to generate chain: %v", err)
+	}
+	enc, err := json.MarshalIndent(genesis, "", "  ")
+	if err != nil {
+		t.Fatalf("failed to encode genesis: %v", err)
+	}
+	if err := ioutil.WriteFile(alienGenesisFile, enc, 0644); err != nil {
+		t.Fatalf("failed to write genesis: %v", err)
+	}
+	if err := writeBlocks(alienFullchainFile, blocks); err != nil {
+		t.Fatalf("failed to write chain: %v", err)
+	}
+	if err := writeBlocks(alienHalfchainFile, blocks[:alienHalfChainLength-1]); err != nil {
+		t.Fatalf("failed to write half chain: %v", err)
+	}
+}
+
+// makeAlienGenesis creates the genesis of the alien test chain, with the suite's
+// signers voting for themselves and the faucet funding the test transactions.
+func makeAlienGenesis(start uint64) *core.Genesis {
+	config := &params.ChainConfig{
+		ChainID:             big.NewInt(19763),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+		IstanbulBlock:       big.NewInt(0),
+		Alien: &params.AlienConfig{
+			Period:           1,
+			Epoch:            30000,
+			MaxSignerCount:   uint64(len(alienSignerKeys)),
+			MinVoterBalance:  big.NewInt(params.Ether),
+			GenesisTimestamp: start,
+			TrantorBlock:     big.NewInt(0),
+		},
+	}
+	funds := new(big.Int).Mul(big.NewInt(1000000), big.NewInt(params.Ether))
+	alloc := core.GenesisAlloc{
+		crypto.PubkeyToAddress(faucetKey.PublicKey): {Balance: funds},
+	}
+	for _, key := range alienSignerKeys {
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		config.Alien.SelfVoteSigners = append(config.Alien.SelfVoteSigners, common.UnprefixedAddress(addr))
+		alloc[addr] = core.GenesisAccount{Balance: funds}
+	}
+	return &core.Genesis{
+		Config:     config,
+		Timestamp:  start - config.Alien.Period,
+		ExtraData:  make([]byte, 32+crypto.SignatureLength),
+		GasLimit:   params.GenesisGasLimit,
+		Difficulty: big.NewInt(1),
+		Alloc:      alloc,
+	}
+}
+
+// generateAlienChain seals the given number of blocks on top of the genesis the
+// way the miner does, trying every signer until the one in-turn accepts to seal.
+// Each block carries a transfer from the faucet and confirmations of its parent
+// by the signers, some also side chain confirmations.
+func generateAlienChain(genesis *core.Genesis, n int) ([]*types.Block, error) {
+	db := rawdb.NewMemoryDatabase()
+	genesis.MustCommit(db)
+
+	engine := alien.New(genesis.Config.Alien, db)
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer chain.Stop()
+
+	signers := make([]*alien.Alien, len(alienSignerKeys))
+	for i, key := range alienSignerKeys {
+		key := key
+		signers[i] = alien.New(genesis.Config.Alien, rawdb.NewMemoryDatabase())
+		signers[i].Authorize(crypto.PubkeyToAddress(key.PublicKey), func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+			return crypto.Sign(crypto.Keccak256(message), key)
+		}, nil)
+	}
+	for _, e := range append(signers, engine) {
+		if err := seedAlienSnapshot(chain, e); err != nil {
+			return nil, err
+		}
+	}
+	for chain.CurrentBlock().NumberU64() < uint64(n) {
+		parent := chain.CurrentBlock()
+
+		var block *types.Block
+		for i, signer := range signers {
+			if block, err = sealAlienBlock(chain, signer, alienSignerKeys[i], parent); err == nil {
+				break
+			}
+		}
+		if block == nil {
+			return nil, fmt.Errorf("no signer sealed block %d: %v", parent.NumberU64()+1, err)
+		}
+		if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+			return nil, fmt.Errorf("failed to insert block %d: %v", block.NumberU64(), err)
+		}
+	}
+	blocks := make([]*types.Block, n)
+	for i := range blocks {
+		blocks[i] = chain.GetBlockByNumber(uint64(i + 1))
+	}
+	return blocks, nil
+}
+
+// seedAlienSnapshot creates the genesis snapshot of the engine the way a node's
+// miner does when assembling its first pending block, with the votes of the self
+// voted signers. Engines only verifying headers would otherwise create it without
+// any candidate, and fail to compute signer queues.
+func seedAlienSnapshot(chain *core.BlockChain, engine *alien.Alien) error {
+	genesis := chain.Genesis()
+	statedb, err := chain.StateAt(genesis.Root())
+	if err != nil {
+		return err
+	}
+	engine.GrantProfit(chain, &types.Header{ParentHash: genesis.Hash(), Number: common.Big1}, statedb)
+	return nil
+}
+
+// sealAlienBlock assembles a block of the signer on top of the parent, failing
+// if the signer is not in-turn.
+func sealAlienBlock(chain *core.BlockChain, engine *alien.Alien, key *ecdsa.PrivateKey, parent *types.Block) (*types.Block, error) {
+	config := chain.Config()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   core.CalcGasLimit(parent.GasUsed(), parent.GasLimit(), params.GenesisGasLimit, params.GenesisGasLimit),
+		Coinbase:   crypto.PubkeyToAddress(key.PublicKey),
+		Time:       parent.Time() + config.Alien.Period,
+	}
+	if now := uint64(time.Now().Unix()); header.Time < now {
+		header.Time = now
+	}
+	if err := engine.Prepare(chain, header); err != nil {
+		return nil, err
+	}
+	statedb, err := chain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	var (
+		gasPool   = new(core.GasPool).AddGas(header.GasLimit)
+		gasReward = new(big.Int)
+		signer    = types.NewEIP155Signer(config.ChainID)
+		txs       []*types.Transaction
+		receipts  []*types.Receipt
+	)
+	for _, msg := range alienBlockMessages(header.Number.Uint64(), header.Time) {
+		from := crypto.PubkeyToAddress(msg.key.PublicKey)
+		tx, err := types.SignTx(types.NewTransaction(statedb.GetNonce(from), msg.to, big.NewInt(msg.value), 100000, big.NewInt(params.GGasPrice), msg.data), signer, msg.key)
+		if err != nil {
+			return nil, err
+		}
+		statedb.Prepare(tx.Hash(), common.Hash{}, len(txs))
+		receipt, reward, err := core.ApplyTransaction(config, chain, &header.Coinbase, gasPool, statedb, header, tx, &header.GasUsed, vm.Config{})
+		if err != nil {
+			return nil, err
+		}
+		if reward != nil {
+			gasReward.Add(gasReward, reward)
+		}
+		txs = append(txs, tx)
+		receipts = append(receipts, receipt)
+	}
+	_, profit := engine.GrantProfit(chain, header, statedb)
+	block, err := engine.FinalizeAndAssemble(chain, header, statedb, txs, nil, receipts, profit, gasReward)
+	if err != nil {
+		return nil, err
+	}
+	results := make(chan *types.Block, 1)
+	if err := engine.Seal(chain, block, results, nil); err != nil {
+		return nil, err
+	}
+	select {
+	case block := <-results:
+		return block, nil
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("sealing timed out")
+	}
+}
+
+// alienMessage is a transaction to include in the alien test chain.
+type alienMessage struct {
+	key   *ecdsa.PrivateKey
+	to    common.Address
+	value int64
+	data  []byte
+}
+
+// alienBlockMessages returns the transactions of a block of the test chain.
+func alienBlockMessages(number uint64, time uint64) []alienMessage {
+	msgs := []alienMessage{{key: faucetKey, to: alienRecipient, value: 1}}
+	for i, key := range alienSignerKeys {
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		if number > 1 {
+			msgs = append(msgs, alienMessage{key: key, to: addr, data: []byte(fmt.Sprintf("ufo:1:event:confirm:%d", number-1))})
+		}
+		if number%10 == 7 && int(number/10)%len(alienSignerKeys) == i {
+			data := fmt.Sprintf("ufo:1:sc:confirm:%s:%d:%d:%d#%d:", alienScHash, number, time, number-1, number)
+			msgs = append(msgs, alienMessage{key: key, to: addr, data: []byte(data)})
+		}
+	}
+	return msgs
+}
+
+// writeBlocks RLP encodes the blocks into the file.
+func writeBlocks(file string, blocks []*types.Block) error {
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	for _, block := range blocks {
+		if err := rlp.Encode(out, block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -75,8 +75,8 @@ func (s *Suite) dial() (*Conn, error) {
 	}
 	// set default p2p capabilities
 	conn.caps = []p2p.Cap{
-		{Name: "nbn", Version: 64},
-		{Name: "nbn", Version: 65},
+		{Name: "eth", Version: 64},
+		{Name: "eth", Version: 65},
 	}
 	conn.ourHighestProtoVersion = 65
 	return &conn, nil
@@ -90,7 +90,7 @@ func (s *Suite) dial66() (*Conn, error) {
 	if err != nil {
 		return nil, fmt.Errorf("dial failed: %v", err)
 	}
-	conn.caps = append(conn.caps, p2p.Cap{Name: "nbn", Version: 66})
+	conn.caps = append(conn.caps, p2p.Cap{Name: "eth", Version: 66})
 	conn.ourHighestProtoVersion = 66
 	return conn, nil
 }
@@ -143,7 +143,7 @@ func (c *Conn) handshake() error {
 func (c *Conn) negotiateEthProtocol(caps []p2p.Cap) {
 	var highestEthVersion uint
 	for _, capability := range caps {
-		if capability.Name != "nbn" {
+		if capability.Name != "eth" {
 			continue
 		}
 		if capability.Version > highestEthVersion && capability.Version <= c.ourHighestProtoVersion {
@@ -539,24 +539,24 @@ func (s *Suite) maliciousHandshakes(t *utesting.T, isEth66 bool) error {
 		{
 			Version: 5,
 			Caps: []p2p.Cap{
-				{Name: "nbn", Version: 64},
-				{Name: "nbn", Version: 65},
+				{Name: "eth", Version: 64},
+				{Name: "eth", Version: 65},
 			},
 			ID: append(pub0, byte(0)),
 		},
 		{
 			Version: 5,
 			Caps: []p2p.Cap{
-				{Name: "nbn", Version: 64},
-				{Name: "nbn", Version: 65},
+				{Name: "eth", Version: 64},
+				{Name: "eth", Version: 65},
 			},
 			ID: append(pub0, pub0...),
 		},
 		{
 			Version: 5,
 			Caps: []p2p.Cap{
-				{Name: "nbn", Version: 64},
-				{Name: "nbn", Version: 65},
+				{Name: "eth", Version: 64},
+				{Name: "eth", Version: 65},
 			},
 			ID: largeBuffer(2),
 		},
@@ -699,6 +699,12 @@ func (s *Suite) hashAnnounce(isEth66 bool) error {
 			return fmt.Errorf("unexpected %s", pretty.Sdump(msg))
 		}
 	}
+	// alien blocks carry the consensus system transactions, so the node
+	// requests their body before propagating them
+	alienBody, err := s.serveAlienBlockBody(sendConn, nextBlock, isEth66)
+	if err != nil {
+		return err
+	}
 	// wait for block announcement
 	msg := recvConn.readAndServe(s.chain, timeout)
 	switch msg := msg.(type) {
@@ -714,7 +720,7 @@ func (s *Suite) hashAnnounce(isEth66 bool) error {
 	case *NewBlock:
 		// node should only propagate NewBlock without having requested the body if the body is empty
 		nextBlockBody := nextBlock.Body()
-		if len(nextBlockBody.Transactions) != 0 || len(nextBlockBody.Uncles) != 0 {
+		if !alienBody && (len(nextBlockBody.Transactions) != 0 || len(nextBlockBody.Uncles) != 0) {
 			return fmt.Errorf("unexpected non-empty new block propagated: %s", pretty.Sdump(msg))
 		}
 		if msg.Block.Hash() != nextBlock.Hash() {
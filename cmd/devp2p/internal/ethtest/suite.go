@@ -42,9 +42,13 @@ func NewSuite(dest *enode.Node, chainfile string, genesisfile string) (*Suite, e
 	if err != nil {
 		return nil, err
 	}
+	height := 1000
+	if chain.chainConfig.Alien != nil {
+		height = alienHalfChainLength
+	}
 	return &Suite{
 		Dest:      dest,
-		chain:     chain.Shorten(1000),
+		chain:     chain.Shorten(height),
 		fullChain: chain,
 	}, nil
 }
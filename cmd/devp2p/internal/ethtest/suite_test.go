@@ -21,6 +21,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/token/consensus/alien"
 	"github.com/token/eth"
 	"github.com/token/eth/ethconfig"
 	"github.com/token/internal/utesting"
@@ -32,10 +33,14 @@ var (
 	genesisFile   = "./testdata/genesis.json"
 	halfchainFile = "./testdata/halfchain.rlp"
 	fullchainFile = "./testdata/chain.rlp"
+
+	alienGenesisFile   = "./testdata/alien/genesis.json"
+	alienHalfchainFile = "./testdata/alien/halfchain.rlp"
+	alienFullchainFile = "./testdata/alien/chain.rlp"
 )
 
 func TestEthSuite(t *testing.T) {
-	geth, err := runGeth()
+	geth, err := runGeth(genesisFile, halfchainFile)
 	if err != nil {
 		t.Fatalf("could not run nbn: %v", err)
 	}
@@ -55,8 +60,29 @@ func TestEthSuite(t *testing.T) {
 	}
 }
 
+func TestAlienSuite(t *testing.T) {
+	geth, err := runGeth(alienGenesisFile, alienHalfchainFile)
+	if err != nil {
+		t.Fatalf("could not run nbn: %v", err)
+	}
+	defer geth.Close()
+
+	suite, err := NewSuite(geth.Server().Self(), alienFullchainFile, alienGenesisFile)
+	if err != nil {
+		t.Fatalf("could not create new test suite: %v", err)
+	}
+	for _, test := range append(suite.EthTests(), suite.AlienTests()...) {
+		t.Run(test.Name, func(t *testing.T) {
+			result := utesting.RunTAP([]utesting.Test{{Name: test.Name, Fn: test.Fn}}, os.Stdout)
+			if result[0].Failed {
+				t.Fatal()
+			}
+		})
+	}
+}
+
 // runGeth creates and starts a geth node
-func runGeth() (*node.Node, error) {
+func runGeth(genesisFile, halfchainFile string) (*node.Node, error) {
 	stack, err := node.New(&node.Config{
 		P2P: p2p.Config{
 			ListenAddr:  "127.0.0.1:0",
@@ -69,7 +95,7 @@ func runGeth() (*node.Node, error) {
 		return nil, err
 	}
 
-	err = setupGeth(stack)
+	err = setupGeth(stack, genesisFile, halfchainFile)
 	if err != nil {
 		stack.Close()
 		return nil, err
@@ -81,7 +107,7 @@ func runGeth() (*node.Node, error) {
 	return stack, nil
 }
 
-func setupGeth(stack *node.Node) error {
+func setupGeth(stack *node.Node, genesisFile, halfchainFile string) error {
 	chain, err := loadChain(halfchainFile, genesisFile)
 	if err != nil {
 		return err
@@ -101,7 +127,11 @@ func setupGeth(stack *node.Node) error {
 	if err != nil {
 		return err
 	}
-
+	if engine, ok := backend.Engine().(*alien.Alien); ok {
+		if err := seedAlienSnapshot(backend.BlockChain(), engine); err != nil {
+			return err
+		}
+	}
 	_, err = backend.BlockChain().InsertChain(chain.blocks[1:])
 	return err
 }
@@ -100,9 +100,10 @@ func rlpxEthTest(ctx *cli.Context) error {
 		exit(err)
 	}
 	// check if given node supports eth66, and if so, run eth66 protocol tests as well
-	is66Failed, _ := utesting.Run(utesting.Test{Name: "Is_66", Fn: suite.Is_66})
-	if is66Failed {
-		return runTests(ctx, suite.EthTests())
+	tests := suite.AllEthTests()
+	if is66Failed, _ := utesting.Run(utesting.Test{Name: "Is_66", Fn: suite.Is_66}); is66Failed {
+		tests = suite.EthTests()
 	}
-	return runTests(ctx, suite.AllEthTests())
+	// chains sealed by the alien engine are checked for its header extras too
+	return runTests(ctx, append(tests, suite.AlienTests()...))
 }
@@ -21,6 +21,7 @@ import (
 	"io/ioutil"
 
 	"github.com/token/accounts"
+	"github.com/token/accounts/hdkeystore"
 	"github.com/token/accounts/keystore"
 	"github.com/token/cmd/utils"
 	"github.com/token/crypto"
@@ -187,6 +188,81 @@ this import mechanism is not needed when you transfer an account between
 nodes.
 `,
 			},
+			{
+				Name:  "hd",
+				Usage: "Manage hierarchical deterministic wallets",
+				Description: `
+Manage BIP-39 mnemonic wallets, deriving any number of accounts along the
+default derivation path m/44'/60'/0'/0.
+
+The mnemonics are encrypted with a password and stored under
+<DATADIR>/keystore/hd. Only the derived accounts pinned into a wallet are
+listed, more can be derived explicitly or discovered automatically from the
+chain state once the wallet is opened.`,
+				Subcommands: []cli.Command{
+					{
+						Name:   "new",
+						Usage:  "Create a new mnemonic wallet",
+						Action: utils.MigrateFlags(hdWalletCreate),
+						Flags: []cli.Flag{
+							utils.DataDirFlag,
+							utils.KeyStoreDirFlag,
+							utils.PasswordFileFlag,
+							utils.LightKDFFlag,
+						},
+						Description: `
+    nbn account hd new
+
+Generates a new 24 word mnemonic, prints it and the address of its first account.
+
+The mnemonic is saved in encrypted format, you are prompted for a password.
+
+Write the mnemonic down, it is the only way to recover the accounts if the
+wallet file or its password is lost.
+`,
+					},
+					{
+						Name:      "import",
+						Usage:     "Import a mnemonic into a new wallet",
+						Action:    utils.MigrateFlags(hdWalletImport),
+						ArgsUsage: "<mnemonicFile>",
+						Flags: []cli.Flag{
+							utils.DataDirFlag,
+							utils.KeyStoreDirFlag,
+							utils.PasswordFileFlag,
+							utils.LightKDFFlag,
+						},
+						Description: `
+    nbn account hd import <mnemonicfile>
+
+Imports the BIP-39 mnemonic contained in <mnemonicfile> and prints the address
+of its first account.
+
+The mnemonic is saved in encrypted format, you are prompted for a password.
+`,
+					},
+					{
+						Name:      "derive",
+						Usage:     "Derive and pin accounts of a mnemonic wallet",
+						Action:    utils.MigrateFlags(hdWalletDerive),
+						ArgsUsage: "<url> <path> [<path>...]",
+						Flags: []cli.Flag{
+							utils.DataDirFlag,
+							utils.KeyStoreDirFlag,
+							utils.PasswordFileFlag,
+						},
+						Description: `
+    nbn account hd derive <url> <path> [<path>...]
+
+Derives the accounts at the given derivation paths of the wallet identified by
+its URL, as printed by 'nbn account list', and pins them into the wallet.
+
+Relative paths are appended to the default root path, e.g. "0'/0/5" derives
+m/44'/60'/0'/0/5.
+`,
+					},
+				},
+			},
 		},
 	}
 )
@@ -352,3 +428,90 @@ func accountImport(ctx *cli.Context) error {
 	fmt.Printf("Address: {%x}\n", acct.Address)
 	return nil
 }
+
+// hdKeyStore returns the HD keystore of the node defined by the CLI flags.
+func hdKeyStore(ctx *cli.Context) *hdkeystore.KeyStore {
+	stack, _ := makeConfigNode(ctx)
+	return stack.AccountManager().Backends(hdkeystore.KeyStoreType)[0].(*hdkeystore.KeyStore)
+}
+
+// hdWalletCreate creates a new mnemonic wallet into the HD keystore.
+func hdWalletCreate(ctx *cli.Context) error {
+	ks := hdKeyStore(ctx)
+	password := utils.GetPassPhraseWithList("Your new mnemonic is locked with a password. Please give a password. Do not forget this password.", true, 0, utils.MakePasswordList(ctx))
+
+	wallet, mnemonic, err := ks.NewWallet(password)
+	if err != nil {
+		utils.Fatalf("Failed to create wallet: %v", err)
+	}
+	fmt.Printf("\nYour new mnemonic was generated\n\n")
+	fmt.Printf("Mnemonic:                     %s\n\n", mnemonic)
+	fmt.Printf("Public address of account #0: %s\n", wallet.Accounts()[0].Address.Hex())
+	fmt.Printf("URL of the wallet:            %s\n\n", wallet.URL())
+	fmt.Printf("- You must NEVER share the mnemonic with anyone! It controls access to the funds of all derived accounts!\n")
+	fmt.Printf("- You must WRITE DOWN the mnemonic! Without it, the accounts cannot be recovered if the wallet file is lost!\n")
+	fmt.Printf("- You must REMEMBER your password! Without the password, it's impossible to decrypt the wallet file!\n\n")
+	return nil
+}
+
+// hdWalletImport imports a mnemonic from a file into the HD keystore.
+func hdWalletImport(ctx *cli.Context) error {
+	mnemonicfile := ctx.Args().First()
+	if len(mnemonicfile) == 0 {
+		utils.Fatalf("mnemonic file must be given as argument")
+	}
+	mnemonic, err := ioutil.ReadFile(mnemonicfile)
+	if err != nil {
+		utils.Fatalf("Could not read mnemonic file: %v", err)
+	}
+	ks := hdKeyStore(ctx)
+	password := utils.GetPassPhraseWithList("Your mnemonic is locked with a password. Please give a password. Do not forget this password.", true, 0, utils.MakePasswordList(ctx))
+
+	wallet, err := ks.ImportMnemonic(string(mnemonic), password)
+	if err != nil {
+		utils.Fatalf("Could not import the mnemonic: %v", err)
+	}
+	fmt.Printf("Address: {%x}\n", wallet.Accounts()[0].Address)
+	fmt.Printf("Wallet:  %s\n", wallet.URL())
+	return nil
+}
+
+// hdWalletDerive derives and pins accounts of a mnemonic wallet.
+func hdWalletDerive(ctx *cli.Context) error {
+	if len(ctx.Args()) < 2 {
+		utils.Fatalf("wallet URL and at least one derivation path must be given as arguments")
+	}
+	var paths []accounts.DerivationPath
+	for _, arg := range ctx.Args()[1:] {
+		path, err := accounts.ParseDerivationPath(arg)
+		if err != nil {
+			utils.Fatalf("Invalid derivation path %q: %v", arg, err)
+		}
+		paths = append(paths, path)
+	}
+	ks := hdKeyStore(ctx)
+
+	var wallet accounts.Wallet
+	for _, w := range ks.Wallets() {
+		if w.URL().String() == ctx.Args().First() {
+			wallet = w
+		}
+	}
+	if wallet == nil {
+		utils.Fatalf("Unknown wallet %s", ctx.Args().First())
+	}
+	password := utils.GetPassPhraseWithList("Please give the password of the mnemonic.", false, 0, utils.MakePasswordList(ctx))
+	if err := wallet.Open(password); err != nil {
+		utils.Fatalf("Could not open the wallet: %v", err)
+	}
+	defer wallet.Close()
+
+	for _, path := range paths {
+		account, err := wallet.Derive(path, true)
+		if err != nil {
+			utils.Fatalf("Could not derive account %s: %v", path, err)
+		}
+		fmt.Printf("Account: {%x} %s\n", account.Address, path)
+	}
+	return nil
+}
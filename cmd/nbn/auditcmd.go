@@ -0,0 +1,105 @@
+// Copyright 2021 The nbn Authors
+// This file is part of nbn.
+//
+// nbn is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// nbn is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with nbn. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/token/audit"
+	"github.com/token/cmd/utils"
+	"github.com/token/p2p/enode"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	auditNodeFlag = cli.StringFlag{
+		Name:  "node",
+		Usage: "Enode URL or public key of the node expected to have signed the log",
+	}
+	auditCommand = cli.Command{
+		Name:      "audit",
+		Usage:     "Validator audit log operations",
+		ArgsUsage: "",
+		Category:  "MISCELLANEOUS COMMANDS",
+		Description: `
+The audit log enabled by --auditlog records the blocks sealed by the node, the
+confirmations and custom transactions sent by its accounts and the slots missed
+by its signers. Each record is chained to the previous one by hash and signed by the
+node key.`,
+		Subcommands: []cli.Command{
+			{
+				Action:    utils.MigrateFlags(verifyAuditLog),
+				Name:      "verify",
+				Usage:     "Verify the integrity of an audit log",
+				ArgsUsage: "<file>",
+				Flags: []cli.Flag{
+					auditNodeFlag,
+				},
+				Description: `
+Checks that no record of the audit log was modified, reordered or removed, and
+that all of them were signed by the same node, by default the one which signed
+the first record. Records appended after the last one can't be told apart from
+a log that was truncated, compare the record count with a previous verification.`,
+			},
+		},
+	}
+)
+
+// verifyAuditLog checks the integrity of an audit log.
+func verifyAuditLog(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		utils.Fatalf("This command requires a single argument.")
+	}
+	var signer *ecdsa.PublicKey
+	if ctx.IsSet(auditNodeFlag.Name) {
+		node, err := enode.ParseV4(ctx.String(auditNodeFlag.Name))
+		if err != nil {
+			utils.Fatalf("Invalid node: %v", err)
+		}
+		signer = node.Pubkey()
+	}
+	file, err := os.Open(ctx.Args().First())
+	if err != nil {
+		utils.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	result, err := audit.Verify(file, signer)
+	if err != nil {
+		utils.Fatalf("Audit log verification failed: %v", err)
+	}
+	if result.Records == 0 {
+		fmt.Println("Audit log is empty")
+		return nil
+	}
+	fmt.Printf("Verified %d records signed by node %s\n", result.Records, enode.PubkeyToIDV4(result.Signer))
+	fmt.Printf("First record: %s\n", result.First)
+	fmt.Printf("Last record:  %s\n", result.Last)
+
+	kinds := make([]string, 0, len(result.Kinds))
+	for kind := range result.Kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Printf("  %-10s %d\n", kind, result.Kinds[kind])
+	}
+	return nil
+}
@@ -38,6 +38,7 @@ import (
 	"github.com/token/log"
 	"github.com/token/metrics"
 	"github.com/token/node"
+	"github.com/token/tracing"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -94,6 +95,9 @@ The dumpgenesis command dumps the genesis block configuration in JSON format to
 			utils.MetricsInfluxDBUsernameFlag,
 			utils.MetricsInfluxDBPasswordFlag,
 			utils.MetricsInfluxDBTagsFlag,
+			utils.TracingEnabledFlag,
+			utils.TracingEndpointFlag,
+			utils.TracingFileFlag,
 			utils.TxLookupLimitFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
@@ -121,6 +125,27 @@ Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
 if already existing. If the file ends with .gz, the output will
 be gzipped.`,
+	}
+	exportReceiptsCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportReceipts),
+		Name:      "export-receipts",
+		Usage:     "Export the receipts of a range of blocks into file",
+		ArgsUsage: "<filename> <blockNumFirst> <blockNumLast>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+			utils.SyncModeFlag,
+			utils.ReceiptsFormatFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+Requires a first argument of the file to write to and the first
+and last block of the range to export. The receipts are written
+including the fields derived from their block (block hash and
+number, transaction hash and index, gas used, contract address,
+log indices), either as an RLP stream (--format rlp) or as one
+JSON object per line (--format jsonl). If the file ends with .gz,
+the output will be gzipped.`,
 	}
 	importPreimagesCommand = cli.Command{
 		Action:    utils.MigrateFlags(importPreimages),
@@ -229,6 +254,9 @@ func importChain(ctx *cli.Context) error {
 	utils.SetupMetrics(ctx)
 	// Start system runtime metrics collection
 	go metrics.CollectProcessMetrics(3 * time.Second)
+	// Start span collection if enabled
+	utils.SetupTracing(ctx)
+	defer tracing.Stop()
 
 	stack, _ := makeConfigNode(ctx)
 	defer stack.Close()
@@ -338,6 +366,32 @@ func exportChain(ctx *cli.Context) error {
 	return nil
 }
 
+// exportReceipts exports the receipts of a block range into the specified file.
+func exportReceipts(ctx *cli.Context) error {
+	if len(ctx.Args()) < 3 {
+		utils.Fatalf("This command requires a file name and a block range.")
+	}
+	first, ferr := strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+	last, lerr := strconv.ParseUint(ctx.Args().Get(2), 10, 64)
+	if ferr != nil || lerr != nil {
+		utils.Fatalf("Export error in parsing parameters: block number not an integer\n")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, _ := utils.MakeChain(ctx, stack)
+	start := time.Now()
+
+	if head := chain.CurrentFastBlock(); last > head.NumberU64() {
+		utils.Fatalf("Export error: block number %d larger than head block %d\n", last, head.NumberU64())
+	}
+	if err := utils.ExportReceipts(chain, ctx.Args().First(), ctx.String(utils.ReceiptsFormatFlag.Name), first, last); err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	fmt.Printf("Export done in %v\n", time.Since(start))
+	return nil
+}
+
 // importPreimages imports preimage data from the specified file.
 func importPreimages(ctx *cli.Context) error {
 	if len(ctx.Args()) < 1 {
@@ -164,6 +164,13 @@ func makeFullNode(ctx *cli.Context) (*node.Node, ethapi.Backend) {
 	if cfg.Ethstats.URL != "" {
 		utils.RegisterEthStatsService(stack, backend, cfg.Ethstats.URL)
 	}
+	// Add the validator audit log if requested.
+	if path := ctx.GlobalString(utils.AuditLogFlag.Name); path != "" {
+		if eth == nil {
+			utils.Fatalf("Audit log does not work in light client mode.")
+		}
+		utils.RegisterAuditService(stack, eth, path)
+	}
 	return stack, backend
 }
 
@@ -17,6 +17,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -29,6 +30,7 @@ import (
 	"github.com/token/common/hexutil"
 	"github.com/token/console/prompt"
 	"github.com/token/core/rawdb"
+	"github.com/token/core/state"
 	"github.com/token/ethdb"
 	"github.com/token/log"
 	"github.com/token/trie"
@@ -62,6 +64,9 @@ Remove blockchain and state databases`,
 			dbPutCmd,
 			dbGetSlotsCmd,
 			dbDumpFreezerIndex,
+			dbConvertCmd,
+			dbPruneHistoryCmd,
+			dbMigrateStateCmd,
 		},
 	}
 	dbInspectCmd = cli.Command{
@@ -171,6 +176,70 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		},
 		Description: "This command displays information about the freezer index.",
 	}
+	dbConvertCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbConvert),
+		Name:      "convert",
+		Usage:     "Convert the chain database to a different key-value store engine",
+		ArgsUsage: "<leveldb|pebble>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.SyncModeFlag,
+			utils.MainnetFlag,
+			utils.TestnetFlag,
+			utils.CacheFlag,
+			utils.CacheDatabaseFlag,
+		},
+		Description: `This command copies every entry of the chain database into a new database
+of the requested engine, then swaps the two. The ancient store is moved over, the
+old database is kept next to the new one and can be removed once the node runs
+fine on the converted database.
+WARNING: This operation may take a very long time to finish and needs as much
+free disk space as the current database occupies.`,
+	}
+	keepHeadersFlag = cli.BoolFlag{
+		Name:  "keep-headers",
+		Usage: "Keep the headers of the pruned blocks",
+	}
+	dbPruneHistoryCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbPruneHistory),
+		Name:      "prune-history",
+		Usage:     "Delete the bodies and receipts of ancient blocks below a given number",
+		ArgsUsage: "<block number>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.SyncModeFlag,
+			utils.MainnetFlag,
+			utils.TestnetFlag,
+			keepHeadersFlag,
+		},
+		Description: `This command deletes the block bodies, receipts and transaction lookups of
+all the blocks below the given number from the ancient store, along with their
+headers unless --keep-headers is set. Only blocks already moved to the ancient
+store can be pruned, and the data is only freed on disk once a whole ancient data
+file is below the given number. The pruned history is reported as unavailable by
+the RPC APIs.
+WARNING: Pruned history can only be restored by resyncing the node.`,
+	}
+	dbMigrateStateCmd = cli.Command{
+		Action:    utils.MigrateFlags(dbMigrateState),
+		Name:      "migrate-state",
+		Usage:     "Convert the head state to another trie node scheme",
+		ArgsUsage: "<hash|path>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.SyncModeFlag,
+			utils.MainnetFlag,
+			utils.TestnetFlag,
+		},
+		Description: `This command converts the state of the head block to the given trie node
+scheme, which the node must then be started with through --state.scheme. The
+head state must be persisted, which is the case after a clean shutdown. Only the
+head state is converted: the historical states of the hash scheme are left in
+the database, run 'nbn snapshot prune-state' first to reclaim their space, while
+the rollback history of the path scheme is dropped.`,
+	}
 )
 
 func removeDB(ctx *cli.Context) error {
@@ -483,3 +552,161 @@ func freezerInspect(ctx *cli.Context) error {
 	}
 	return nil
 }
+
+// dbConvert migrates the chain database of the node to another key-value store
+// engine.
+func dbConvert(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	engine := ctx.Args().Get(0)
+	if engine != rawdb.DBLeveldb && engine != rawdb.DBPebble {
+		return fmt.Errorf("unknown database engine %q, want %q or %q", engine, rawdb.DBLeveldb, rawdb.DBPebble)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	name := "chaindata"
+	if ctx.GlobalString(utils.SyncModeFlag.Name) == "light" {
+		name = "lightchaindata"
+	}
+	var (
+		path     = stack.ResolvePath(name)
+		existing = rawdb.PreexistingDatabase(path)
+		target   = path + "." + engine + ".tmp"
+		backup   = path + "." + existing + ".bak"
+		cache    = ctx.GlobalInt(utils.CacheFlag.Name) * ctx.GlobalInt(utils.CacheDatabaseFlag.Name) / 100
+		handles  = utils.MakeDatabaseHandles()
+	)
+	switch {
+	case existing == "":
+		return fmt.Errorf("no database found at %s", path)
+	case existing == engine:
+		return fmt.Errorf("database at %s already uses %s", path, engine)
+	case common.FileExist(target):
+		return fmt.Errorf("leftover conversion target %s, remove it first", target)
+	case common.FileExist(backup):
+		return fmt.Errorf("leftover database backup %s, remove it first", backup)
+	}
+	// Copy over every entry from the old key-value store into the new one
+	src, err := rawdb.OpenKeyValueStore(existing, path, cache/2, handles/2, "", true)
+	if err != nil {
+		return err
+	}
+	dst, err := rawdb.OpenKeyValueStore(engine, target, cache/2, handles/2, "", false)
+	if err != nil {
+		src.Close()
+		return err
+	}
+	log.Info("Converting database", "path", path, "from", existing, "to", engine)
+	err = copyKeyValueStore(src, dst)
+	src.Close()
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	// Swap the databases, moving the ancient store over if it lives inside
+	if err := os.Rename(path, backup); err != nil {
+		return err
+	}
+	if err := os.Rename(target, path); err != nil {
+		return err
+	}
+	if ancient := filepath.Join(backup, "ancient"); common.FileExist(ancient) {
+		if err := os.Rename(ancient, filepath.Join(path, "ancient")); err != nil {
+			return err
+		}
+	}
+	log.Info("Database converted", "path", path, "engine", engine, "backup", backup)
+	return nil
+}
+
+// dbPruneHistory discards the history of the ancient blocks below a given number.
+func dbPruneHistory(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	tail, err := strconv.ParseUint(ctx.Args().Get(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid block number: %v", err)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, false)
+	defer db.Close()
+
+	return rawdb.PruneHistory(db, tail, ctx.Bool(keepHeadersFlag.Name))
+}
+
+// dbMigrateState converts the head state to the given trie node scheme.
+func dbMigrateState(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	scheme := ctx.Args().Get(0)
+	if scheme != rawdb.HashScheme && scheme != rawdb.PathScheme {
+		return fmt.Errorf("invalid state scheme %q", scheme)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, false)
+	defer db.Close()
+
+	head := rawdb.ReadHeadBlock(db)
+	if head == nil {
+		return errors.New("head block missing")
+	}
+	if current := rawdb.ReadStateScheme(db); current == scheme {
+		log.Info("State already stored with the requested scheme", "scheme", scheme)
+		return nil
+	}
+	if err := state.ConvertStateScheme(db, head.Root(), scheme); err != nil {
+		return fmt.Errorf("failed to convert head state %d [%x], start and cleanly stop the node first: %v", head.NumberU64(), head.Root(), err)
+	}
+	return nil
+}
+
+// copyKeyValueStore copies every entry of a key-value store into another one.
+func copyKeyValueStore(src ethdb.KeyValueStore, dst ethdb.KeyValueStore) error {
+	var (
+		it     = src.NewIterator(nil, nil)
+		batch  = dst.NewBatch()
+		count  uint64
+		size   common.StorageSize
+		start  = time.Now()
+		logged = time.Now()
+	)
+	defer it.Release()
+
+	for it.Next() {
+		if err := batch.Put(it.Key(), it.Value()); err != nil {
+			return err
+		}
+		count++
+		size += common.StorageSize(len(it.Key()) + len(it.Value()))
+
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Copying database entries", "count", count, "size", size, "key", fmt.Sprintf("%#x", it.Key()), "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Copied database entries", "count", count, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
@@ -28,7 +28,9 @@ import (
 	"time"
 
 	"github.com/token/accounts"
+	"github.com/token/accounts/hdkeystore"
 	"github.com/token/accounts/keystore"
+	"github.com/token/accounts/kms"
 	"github.com/token/cmd/utils"
 	"github.com/token/common"
 	"github.com/token/console/prompt"
@@ -43,6 +45,7 @@ import (
 	"github.com/token/node"
 	"github.com/token/params"
 	"github.com/token/rpc"
+	"github.com/token/tracing"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -64,9 +67,12 @@ var (
 		utils.BootnodesFlag,
 		utils.DataDirFlag,
 		utils.AncientFlag,
+		utils.DBEngineFlag,
 		utils.MinFreeDiskSpaceFlag,
 		utils.KeyStoreDirFlag,
 		utils.ExternalSignerFlag,
+		utils.KMSEndpointFlag,
+		utils.KMSTokenFileFlag,
 		utils.NoUSBFlag,
 		utils.USBFlag,
 		utils.SmartCardDaemonPathFlag,
@@ -90,11 +96,19 @@ var (
 		utils.TxPoolAccountQueueFlag,
 		utils.TxPoolGlobalQueueFlag,
 		utils.TxPoolLifetimeFlag,
+		utils.TxPoolSystemSlotsFlag,
+		utils.TxPoolSystemAccountSlotsFlag,
 		utils.SyncModeFlag,
 		utils.ExitWhenSyncedFlag,
 		utils.GCModeFlag,
 		utils.SnapshotFlag,
+		utils.StateSchemeFlag,
+		utils.StateHistoryFlag,
+		utils.StatePruneBloomSizeFlag,
+		utils.StatePruneThrottleFlag,
 		utils.TxLookupLimitFlag,
+		utils.TraceIndexFlag,
+		utils.TraceIndexTailFlag,
 		utils.LightServeFlag,
 		utils.LightIngressFlag,
 		utils.LightEgressFlag,
@@ -129,6 +143,7 @@ var (
 		utils.MinerExtraDataFlag,
 		utils.MinerRecommitIntervalFlag,
 		utils.MinerNoVerfiyFlag,
+		utils.MinerSystemGasFlag,
 		utils.NATFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
@@ -143,6 +158,7 @@ var (
 		utils.VMEnableDebugFlag,
 		utils.NetworkIdFlag,
 		utils.EthStatsURLFlag,
+		utils.AuditLogFlag,
 		utils.FakePoWFlag,
 		utils.NoCompactionFlag,
 		utils.GpoBlocksFlag,
@@ -179,6 +195,19 @@ var (
 		utils.WSApiFlag,
 		utils.WSAllowedOriginsFlag,
 		utils.WSPathPrefixFlag,
+		utils.HTTPAuthFlag,
+		utils.WSAuthFlag,
+		utils.AuthListenAddrFlag,
+		utils.AuthPortFlag,
+		utils.AuthVirtualHostsFlag,
+		utils.AuthApiFlag,
+		utils.JWTSecretFlag,
+		utils.JWTIssuedAtSkewFlag,
+		utils.RPCBatchItemLimitFlag,
+		utils.RPCResponseSizeLimitFlag,
+		utils.RPCMethodConcurrencyFlag,
+		utils.RPCRateLimitFlag,
+		utils.RPCRateBurstFlag,
 		utils.IPCDisabledFlag,
 		utils.IPCPathFlag,
 		utils.InsecureUnlockAllowedFlag,
@@ -198,6 +227,9 @@ var (
 		utils.MetricsInfluxDBUsernameFlag,
 		utils.MetricsInfluxDBPasswordFlag,
 		utils.MetricsInfluxDBTagsFlag,
+		utils.TracingEnabledFlag,
+		utils.TracingEndpointFlag,
+		utils.TracingFileFlag,
 	}
 
 	pbftFlags = []cli.Flag{
@@ -222,6 +254,7 @@ func init() {
 		initCommand,
 		importCommand,
 		exportCommand,
+		exportReceiptsCommand,
 		importPreimagesCommand,
 		exportPreimagesCommand,
 		removedbCommand,
@@ -248,6 +281,8 @@ func init() {
 		utils.ShowDeprecated,
 		// See snapshot.go
 		snapshotCommand,
+		// See auditcmd.go
+		auditCommand,
 	}
 	sort.Sort(cli.CommandsByName(app.Commands))
 
@@ -310,6 +345,9 @@ func prepare(ctx *cli.Context) {
 
 	// Start system runtime metrics collection
 	go metrics.CollectProcessMetrics(3 * time.Second)
+
+	// Start span collection if enabled
+	utils.SetupTracing(ctx)
 }
 
 // nbn is the main entry point into the system if no special subcommand is ran.
@@ -321,6 +359,8 @@ func nbn(ctx *cli.Context) error {
 	}
 
 	prepare(ctx)
+	defer tracing.Stop()
+
 	stack, backend := makeFullNode(ctx)
 	defer stack.Close()
 
@@ -479,6 +519,61 @@ func unlockAccounts(ctx *cli.Context, stack *node.Node) {
 	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
 	passwords := utils.MakePasswordList(ctx)
 	for i, account := range unlocks {
+		if unlockKMSAccount(stack, account) {
+			continue
+		}
+		if unlockHDAccount(stack, account, i, passwords) {
+			continue
+		}
 		unlockAccount(ks, account, i, passwords)
 	}
 }
+
+// unlockHDAccount unlocks the account if it's pinned into an HD keystore wallet,
+// by opening the wallet with the account's password. It returns whether the
+// account belongs to an HD wallet.
+func unlockHDAccount(stack *node.Node, address string, i int, passwords []string) bool {
+	if !common.IsHexAddress(address) {
+		return false
+	}
+	account := accounts.Account{Address: common.HexToAddress(address)}
+	for _, backend := range stack.AccountManager().Backends(hdkeystore.KeyStoreType) {
+		for _, wallet := range backend.Wallets() {
+			if !wallet.Contains(account) {
+				continue
+			}
+			var err error
+			for trials := 0; trials < 3; trials++ {
+				prompt := fmt.Sprintf("Unlocking HD wallet account %s | Attempt %d/%d", address, trials+1, 3)
+				password := utils.GetPassPhraseWithList(prompt, false, i, passwords)
+				if err = wallet.Open(password); err == nil || err == accounts.ErrWalletAlreadyOpen {
+					log.Info("Unlocked HD wallet account", "address", account.Address.Hex(), "wallet", wallet.URL())
+					return true
+				}
+				if err != keystore.ErrDecrypt {
+					// No need to prompt again if the error is not decryption-related.
+					break
+				}
+			}
+			// All trials expended to unlock account, bail out
+			utils.Fatalf("Failed to unlock HD wallet account %s (%v)", address, err)
+		}
+	}
+	return false
+}
+
+// unlockKMSAccount unlocks the account if its key is held by a key-management
+// service, returning whether it was.
+func unlockKMSAccount(stack *node.Node, address string) bool {
+	if !common.IsHexAddress(address) {
+		return false
+	}
+	addr := common.HexToAddress(address)
+	for _, backend := range stack.AccountManager().Backends(kms.BackendType) {
+		if err := backend.(*kms.Backend).Unlock(addr); err == nil {
+			log.Info("Unlocked key-management service account", "address", addr.Hex())
+			return true
+		}
+	}
+	return false
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/token/core/state/pruner"
 	"github.com/token/core/state/snapshot"
 	"github.com/token/crypto"
+	"github.com/token/ethdb"
 	"github.com/token/log"
 	"github.com/token/rlp"
 	"github.com/token/trie"
@@ -261,7 +262,7 @@ func traverseState(ctx *cli.Context) error {
 		root = headBlock.Root()
 		log.Info("Start traversing the state", "root", root, "number", headBlock.NumberU64())
 	}
-	triedb := trie.NewDatabase(chaindb)
+	triedb := trie.NewDatabaseWithConfig(chaindb, &trie.Config{Scheme: rawdb.ReadStateScheme(chaindb)})
 	t, err := trie.NewSecure(root, triedb)
 	if err != nil {
 		log.Error("Failed to open trie", "root", root, "err", err)
@@ -283,7 +284,7 @@ func traverseState(ctx *cli.Context) error {
 			return err
 		}
 		if acc.Root != emptyRoot {
-			storageTrie, err := trie.NewSecure(acc.Root, triedb)
+			storageTrie, err := trie.NewSecureWithOwner(common.BytesToHash(accIter.Key), acc.Root, triedb)
 			if err != nil {
 				log.Error("Failed to open storage trie", "root", acc.Root, "err", err)
 				return err
@@ -351,7 +352,8 @@ func traverseRawState(ctx *cli.Context) error {
 		root = headBlock.Root()
 		log.Info("Start traversing the state", "root", root, "number", headBlock.NumberU64())
 	}
-	triedb := trie.NewDatabase(chaindb)
+	scheme := rawdb.ReadStateScheme(chaindb)
+	triedb := trie.NewDatabaseWithConfig(chaindb, &trie.Config{Scheme: scheme})
 	t, err := trie.NewSecure(root, triedb)
 	if err != nil {
 		log.Error("Failed to open trie", "root", root, "err", err)
@@ -373,8 +375,7 @@ func traverseRawState(ctx *cli.Context) error {
 		if node != (common.Hash{}) {
 			// Check the present for non-empty hash node(embedded node doesn't
 			// have their own hash).
-			blob := rawdb.ReadTrieNode(chaindb, node)
-			if len(blob) == 0 {
+			if !hasTrieNode(chaindb, scheme, common.Hash{}, accIter.Path(), node) {
 				log.Error("Missing trie node(account)", "hash", node)
 				return errors.New("missing account")
 			}
@@ -389,7 +390,7 @@ func traverseRawState(ctx *cli.Context) error {
 				return errors.New("invalid account")
 			}
 			if acc.Root != emptyRoot {
-				storageTrie, err := trie.NewSecure(acc.Root, triedb)
+				storageTrie, err := trie.NewSecureWithOwner(common.BytesToHash(accIter.LeafKey()), acc.Root, triedb)
 				if err != nil {
 					log.Error("Failed to open storage trie", "root", acc.Root, "err", err)
 					return errors.New("missing storage trie")
@@ -402,8 +403,7 @@ func traverseRawState(ctx *cli.Context) error {
 					// Check the present for non-empty hash node(embedded node doesn't
 					// have their own hash).
 					if node != (common.Hash{}) {
-						blob := rawdb.ReadTrieNode(chaindb, node)
-						if len(blob) == 0 {
+						if !hasTrieNode(chaindb, scheme, common.BytesToHash(accIter.LeafKey()), storageIter.Path(), node) {
 							log.Error("Missing trie node(storage)", "hash", node)
 							return errors.New("missing storage")
 						}
@@ -440,6 +440,15 @@ func traverseRawState(ctx *cli.Context) error {
 	return nil
 }
 
+// hasTrieNode reports whether the trie node with the given hash is persisted at
+// the given path, under the state scheme of the database.
+func hasTrieNode(db ethdb.KeyValueReader, scheme string, owner common.Hash, path []byte, hash common.Hash) bool {
+	if scheme == rawdb.PathScheme {
+		return crypto.Keccak256Hash(rawdb.ReadTrieNodeByPath(db, owner, path)) == hash
+	}
+	return len(rawdb.ReadTrieNode(db, hash)) > 0
+}
+
 func parseRoot(input string) (common.Hash, error) {
 	var h common.Hash
 	if err := h.UnmarshalText([]byte(input)); err != nil {
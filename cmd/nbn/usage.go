@@ -36,6 +36,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			configFileFlag,
 			utils.DataDirFlag,
 			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.MinFreeDiskSpaceFlag,
 			utils.KeyStoreDirFlag,
 			utils.USBFlag,
@@ -47,7 +48,10 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.ExitWhenSyncedFlag,
 			utils.GCModeFlag,
 			utils.TxLookupLimitFlag,
+			utils.TraceIndexFlag,
+			utils.TraceIndexTailFlag,
 			utils.EthStatsURLFlag,
+			utils.AuditLogFlag,
 			utils.IdentityFlag,
 			utils.LightKDFFlag,
 			utils.WhitelistFlag,
@@ -101,6 +105,8 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.TxPoolAccountQueueFlag,
 			utils.TxPoolGlobalQueueFlag,
 			utils.TxPoolLifetimeFlag,
+			utils.TxPoolSystemSlotsFlag,
+			utils.TxPoolSystemAccountSlotsFlag,
 		},
 	},
 	{
@@ -123,6 +129,8 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.UnlockedAccountFlag,
 			utils.PasswordFileFlag,
 			utils.ExternalSignerFlag,
+			utils.KMSEndpointFlag,
+			utils.KMSTokenFileFlag,
 			utils.InsecureUnlockAllowedFlag,
 		},
 	},
@@ -144,6 +152,19 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.WSApiFlag,
 			utils.WSPathPrefixFlag,
 			utils.WSAllowedOriginsFlag,
+			utils.HTTPAuthFlag,
+			utils.WSAuthFlag,
+			utils.AuthListenAddrFlag,
+			utils.AuthPortFlag,
+			utils.AuthVirtualHostsFlag,
+			utils.AuthApiFlag,
+			utils.JWTSecretFlag,
+			utils.JWTIssuedAtSkewFlag,
+			utils.RPCBatchItemLimitFlag,
+			utils.RPCResponseSizeLimitFlag,
+			utils.RPCMethodConcurrencyFlag,
+			utils.RPCRateLimitFlag,
+			utils.RPCRateBurstFlag,
 			utils.GraphQLEnabledFlag,
 			utils.GraphQLCORSDomainFlag,
 			utils.GraphQLVirtualHostsFlag,
@@ -185,6 +206,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.MinerExtraDataFlag,
 			utils.MinerRecommitIntervalFlag,
 			utils.MinerNoVerfiyFlag,
+			utils.MinerSystemGasFlag,
 		},
 	},
 	{
@@ -239,6 +261,10 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 		Name: "MISC",
 		Flags: []cli.Flag{
 			utils.SnapshotFlag,
+			utils.StateSchemeFlag,
+			utils.StateHistoryFlag,
+			utils.StatePruneBloomSizeFlag,
+			utils.StatePruneThrottleFlag,
 			utils.BloomFilterSizeFlag,
 			cli.HelpFlag,
 			utils.CatalystFlag,
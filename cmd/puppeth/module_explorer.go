@@ -35,8 +35,8 @@ FROM puppeth/blockscout:latest
 ADD genesis.json /genesis.json
 RUN \
   echo 'nbn --cache 512 init /genesis.json' > explorer.sh && \
-  echo $'nbn --networkid {{.NetworkID}} --syncmode "full" --gcmode "archive" --port {{.EthPort}} --bootnodes {{.Bootnodes}} --ethstats \'{{.Ethstats}}\' --cache=512 --http --http.api "net,web3,eth,shh,debug" --http.corsdomain "*" --http.vhosts "*" --ws --ws.origins "*" --exitwhensynced' >> explorer.sh && \
-  echo $'exec nbn --networkid {{.NetworkID}} --syncmode "full" --gcmode "archive" --port {{.EthPort}} --bootnodes {{.Bootnodes}} --ethstats \'{{.Ethstats}}\' --cache=512 --http --http.api "net,web3,eth,shh,debug" --http.corsdomain "*" --http.vhosts "*" --ws --ws.origins "*" &' >> explorer.sh && \
+  echo $'nbn --networkid {{.NetworkID}} --syncmode "full" --gcmode "archive" --port {{.EthPort}} --bootnodes {{.Bootnodes}} --ethstats \'{{.Ethstats}}\' --cache=512 --http --http.api "net,web3,eth,shh,debug{{if .Alien}},alien{{end}}" --http.corsdomain "*" --http.vhosts "*" --ws --ws.origins "*" {{.SideChain}} --exitwhensynced' >> explorer.sh && \
+  echo $'exec nbn --networkid {{.NetworkID}} --syncmode "full" --gcmode "archive" --port {{.EthPort}} --bootnodes {{.Bootnodes}} --ethstats \'{{.Ethstats}}\' --cache=512 --http --http.api "net,web3,eth,shh,debug{{if .Alien}},alien{{end}}" --http.corsdomain "*" --http.vhosts "*" --ws --ws.origins "*" {{.SideChain}} &' >> explorer.sh && \
   echo '/usr/local/bin/docker-entrypoint.sh postgres &' >> explorer.sh && \
   echo 'sleep 5' >> explorer.sh && \
   echo 'mix do ecto.drop --force, ecto.create, ecto.migrate' >> explorer.sh && \
@@ -61,7 +61,8 @@ services:
         environment:
             - ETH_PORT={{.EthPort}}
             - ETH_NAME={{.EthName}}
-            - BLOCK_TRANSFORMER={{.Transformer}}{{if .VHost}}
+            - BLOCK_TRANSFORMER={{.Transformer}}
+            - MAIN_RPC={{.MainRPC}}{{if .VHost}}
             - VIRTUAL_HOST={{.VHost}}
             - VIRTUAL_PORT=4000{{end}}
         volumes:
@@ -89,6 +90,8 @@ func deployExplorer(client *sshClient, network string, bootnodes []string, confi
 		"Bootnodes": strings.Join(bootnodes, ","),
 		"Ethstats":  config.node.ethstats,
 		"EthPort":   config.node.port,
+		"Alien":     isClique == 2,
+		"SideChain": sideChainFlags(config.node),
 	})
 	files[filepath.Join(workdir, "Dockerfile")] = dockerfile.Bytes()
 
@@ -109,6 +112,7 @@ func deployExplorer(client *sshClient, network string, bootnodes []string, confi
 		"EthName":     config.node.ethstats[:strings.Index(config.node.ethstats, ":")],
 		"WebPort":     config.port,
 		"Transformer": transformer,
+		"MainRPC":     config.node.mainRPC,
 	})
 	files[filepath.Join(workdir, "docker-compose.yaml")] = composefile.Bytes()
 	files[filepath.Join(workdir, "genesis.json")] = config.node.genesis
@@ -144,6 +148,9 @@ func (info *explorerInfos) Report() map[string]string {
 		"nbn listener port ": strconv.Itoa(info.node.port),
 		"Ethstats username":       info.node.ethstats,
 	}
+	if info.node.mainRPC != "" {
+		report["Main chain RPC endpoint"] = info.node.mainRPC
+	}
 	return report
 }
 
@@ -187,6 +194,7 @@ func checkExplorer(client *sshClient, network string) (*explorerInfos, error) {
 			datadir:  infos.volumes["/opt/app/.nbn"],
 			port:     infos.portmap[infos.envvars["ETH_PORT"]+"/tcp"],
 			ethstats: infos.envvars["ETH_NAME"],
+			mainRPC:  infos.envvars["MAIN_RPC"],
 		},
 		dbdir: infos.volumes["/var/lib/postgresql/data"],
 		host:  host,
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -42,7 +43,7 @@ ADD genesis.json /genesis.json
 RUN \
   echo 'nbn --cache 512 init /genesis.json' > nbn.sh && \{{if .Unlock}}
 	echo 'mkdir -p /root/.nbn/keystore/ && cp /signer.json /root/.nbn/keystore/' >> nbn.sh && \{{end}}
-	echo $'exec nbn --networkid {{.NetworkID}} --cache 512 --port {{.Port}} --nat extip:{{.IP}} --maxpeers {{.Peers}} {{.LightFlag}} --ethstats \'{{.Ethstats}}\' {{if .Bootnodes}}--bootnodes {{.Bootnodes}}{{end}} {{if .Etherbase}}--miner.etherbase {{.Etherbase}} --mine --miner.threads 1{{end}} {{if .Unlock}}--unlock 0 --password /signer.pass --mine{{end}} --miner.gastarget {{.GasTarget}} --miner.gaslimit {{.GasLimit}} --miner.gasprice {{.GasPrice}}' >> nbn.sh
+	echo $'exec nbn --networkid {{.NetworkID}} --cache 512 --port {{.Port}} --nat extip:{{.IP}} --maxpeers {{.Peers}} {{.LightFlag}} --ethstats \'{{.Ethstats}}\' {{if .Bootnodes}}--bootnodes {{.Bootnodes}}{{end}} {{if .Etherbase}}--miner.etherbase {{.Etherbase}} --mine --miner.threads 1{{end}} {{if .Unlock}}--unlock 0 --password /signer.pass --mine{{end}} --miner.gastarget {{.GasTarget}} --miner.gaslimit {{.GasLimit}} --miner.gasprice {{.GasPrice}} {{.SideChain}}' >> nbn.sh
 
 ENTRYPOINT ["/bin/sh", "nbn.sh"]
 `
@@ -71,6 +72,7 @@ services:
       - GAS_TARGET={{.GasTarget}}
       - GAS_LIMIT={{.GasLimit}}
       - GAS_PRICE={{.GasPrice}}
+      - MAIN_RPC={{.MainRPC}}
     logging:
       driver: "json-file"
       options:
@@ -110,6 +112,7 @@ func deployNode(client *sshClient, network string, bootnodes []string, config *n
 		"GasLimit":  uint64(1000000 * config.gasLimit),
 		"GasPrice":  uint64(1000000000 * config.gasPrice),
 		"Unlock":    config.keyJSON != "",
+		"SideChain": sideChainFlags(config),
 	})
 	files[filepath.Join(workdir, "Dockerfile")] = dockerfile.Bytes()
 
@@ -128,6 +131,7 @@ func deployNode(client *sshClient, network string, bootnodes []string, config *n
 		"GasTarget":  config.gasTarget,
 		"GasLimit":   config.gasLimit,
 		"GasPrice":   config.gasPrice,
+		"MainRPC":    config.mainRPC,
 	})
 	files[filepath.Join(workdir, "docker-compose.yaml")] = composefile.Bytes()
 
@@ -167,6 +171,22 @@ type nodeInfos struct {
 	gasTarget  float64
 	gasLimit   float64
 	gasPrice   float64
+	mainRPC    string // Main chain RPC endpoint (host:port) of alien side chain nodes
+	period     uint64 // Block period of alien side chains, overridden by --sca.period
+}
+
+// sideChainFlags returns the command line flags needed by a node of an alien
+// side chain to reach its main chain, or nothing for any other network.
+func sideChainFlags(config *nodeInfos) string {
+	if config.mainRPC == "" {
+		return ""
+	}
+	host, port, err := net.SplitHostPort(config.mainRPC)
+	if err != nil {
+		log.Error("Invalid main chain RPC endpoint", "endpoint", config.mainRPC, "err", err)
+		return ""
+	}
+	return fmt.Sprintf("--sca --sca.mainrpcaddr %s --sca.mainrpcport %s --sca.period %d", host, port, config.period)
 }
 
 // Report converts the typed struct into a plain string->string map, containing
@@ -179,6 +199,9 @@ func (info *nodeInfos) Report() map[string]string {
 		"Peer count (light nodes)": strconv.Itoa(info.peersLight),
 		"Ethstats username":        info.ethstats,
 	}
+	if info.mainRPC != "" {
+		report["Main chain RPC endpoint"] = info.mainRPC
+	}
 	if info.gasTarget > 0 {
 		// Miner or signer node
 		report["Gas price (minimum accepted)"] = fmt.Sprintf("%0.3f GWei", info.gasPrice)
@@ -266,6 +289,7 @@ func checkNode(client *sshClient, network string, boot bool) (*nodeInfos, error)
 		gasTarget:  gasTarget,
 		gasLimit:   gasLimit,
 		gasPrice:   gasPrice,
+		mainRPC:    infos.envvars["MAIN_RPC"],
 	}
 	stats.enode = string(enode)
 
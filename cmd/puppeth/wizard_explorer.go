@@ -98,6 +98,13 @@ func (w *wizard) deployExplorer() {
 		fmt.Printf("What should the explorer be called on the stats page? (default = %s)\n", infos.node.ethstats)
 		infos.node.ethstats = w.readDefaultString(infos.node.ethstats) + ":" + w.conf.ethstats
 	}
+	// Alien side chain nodes need to reach the main chain to confirm their blocks
+	if alien := w.conf.Genesis.Config.Alien; alien != nil && alien.SideChain {
+		infos.node.mainRPC = w.readMainChainRPC(infos.node.mainRPC)
+		infos.node.period = alien.Period
+	} else {
+		infos.node.mainRPC = ""
+	}
 	// Try to deploy the explorer on the host
 	nocache := false
 	if existed {
@@ -30,6 +30,7 @@ import (
 	"time"
 
 	"github.com/token/common"
+	"github.com/token/consensus/alien"
 	"github.com/token/core"
 	"github.com/token/log"
 	"github.com/token/params"
@@ -158,6 +159,18 @@ func (w *wizard) makeGenesis() {
 			}
 		}
 
+		// Side chains and forks need to be decided before the network launches
+		fmt.Println()
+		fmt.Println("Is this a side chain of an existing alien main chain? (y/n) (default = no)")
+		genesis.Config.Alien.SideChain = w.readDefaultYesNo(false)
+
+		w.configureAlienForks(genesis.Config.Alien)
+
+		fmt.Println()
+		fmt.Println("Do you want to customize the alien system parameters? (y/n) (default = no)")
+		if w.readDefaultYesNo(false) {
+			w.configureAlienSystem(genesis.Config.Alien)
+		}
 		genesis.ExtraData = make([]byte, 32+65)
 
 	default:
@@ -298,6 +311,11 @@ func (w *wizard) manageGenesis() {
 		fmt.Printf("Which block should London come into effect? (default = %v)\n", w.conf.Genesis.Config.LondonBlock)
 		w.conf.Genesis.Config.LondonBlock = w.readDefaultBigInt(w.conf.Genesis.Config.LondonBlock)
 
+		if w.conf.Genesis.Config.Alien != nil {
+			// The system parameters seed the genesis snapshot, so they can only be
+			// chosen when creating the genesis, not on a running network
+			w.configureAlienForks(w.conf.Genesis.Config.Alien)
+		}
 		out, _ := json.MarshalIndent(w.conf.Genesis.Config, "", "  ")
 		fmt.Printf("Chain configuration updated:\n\n%s\n", out)
 
@@ -366,3 +384,110 @@ func saveGenesis(folder, network, client string, spec interface{}) {
 	}
 	log.Info("Saved genesis chain spec", "client", client, "path", path)
 }
+
+// configureAlienForks queries the user for the alien specific fork rules and
+// consensus switches.
+func (w *wizard) configureAlienForks(config *params.AlienConfig) {
+	def := "no"
+	if config.PBFTEnable {
+		def = "yes"
+	}
+	fmt.Println()
+	fmt.Printf("Should PBFT style block confirmation be enabled? (y/n) (default = %s)\n", def)
+	config.PBFTEnable = w.readDefaultYesNo(config.PBFTEnable)
+
+	fmt.Println()
+	fmt.Printf("Which block should Trantor come into effect? (default = %v)\n", config.TrantorBlock)
+	config.TrantorBlock = w.readDefaultBigInt(config.TrantorBlock)
+
+	fmt.Println()
+	fmt.Printf("Which block should Terminus come into effect? (default = %v)\n", config.TerminusBlock)
+	config.TerminusBlock = w.readDefaultBigInt(config.TerminusBlock)
+}
+
+// configureAlienSystem queries the user for the initial alien system parameters:
+// the manager accounts, the pledge and reward lock schedules and the PoF settings.
+func (w *wizard) configureAlienSystem(config *params.AlienConfig) {
+	if config.SystemConfig == nil {
+		config.SystemConfig = new(params.AlienSystemConfig)
+	}
+	cfg, builtin := config.SystemConfig, alien.DefaultSystemConfig()
+
+	cfg.Manager = w.readAlienManager("Which account may change the system managers?", cfg.Manager, *builtin.Manager)
+	cfg.ExchRateManager = w.readAlienManager("Which account may change the exchange rate?", cfg.ExchRateManager, *builtin.ExchRateManager)
+	cfg.SystemManager = w.readAlienManager("Which account may change deposits and lock parameters?", cfg.SystemManager, *builtin.SystemManager)
+	cfg.BandwidthManager = w.readAlienManager("Which account may punish PoF bandwidth?", cfg.BandwidthManager, *builtin.BandwidthManager)
+	cfg.PofReportManager = w.readAlienManager("Which account may report PoF flow?", cfg.PofReportManager, *builtin.PofReportManager)
+
+	exchRate := builtin.ExchRate
+	if cfg.ExchRate != 0 {
+		exchRate = cfg.ExchRate
+	}
+	fmt.Println()
+	fmt.Printf("What is the token to coin exchange ratio? (default = %d)\n", exchRate)
+	cfg.ExchRate = uint32(w.readDefaultInt(int(exchRate)))
+
+	deposit := builtin.CandidateDeposit
+	if cfg.CandidateDeposit != nil {
+		deposit = cfg.CandidateDeposit
+	}
+	tokens := new(big.Int).Div(deposit, big.NewInt(1e+18)).Int64()
+	fmt.Println()
+	fmt.Printf("How many tokens must be pledged to become a candidate? (default = %d)\n", tokens)
+	cfg.CandidateDeposit = new(big.Int).Mul(big.NewInt(int64(w.readDefaultInt(int(tokens)))), big.NewInt(1e+18))
+
+	commit := builtin.PosCommitPeriod
+	if cfg.PosCommitPeriod != nil {
+		commit = cfg.PosCommitPeriod
+	}
+	fmt.Println()
+	fmt.Printf("How many days are candidate pledges committed for? (default = %v)\n", commit)
+	cfg.PosCommitPeriod = w.readDefaultBigInt(commit)
+
+	cfg.CandidateLock = w.readAlienLock("candidate pledges", cfg.CandidateLock, builtin.CandidateLock)
+	cfg.PofLock = w.readAlienLock("PoF pledges", cfg.PofLock, builtin.PofLock)
+	cfg.RewardLock = w.readAlienLock("rewards", cfg.RewardLock, builtin.RewardLock)
+
+	price := builtin.PofBasePrice
+	if cfg.PofBasePrice != nil {
+		price = cfg.PofBasePrice
+	}
+	fmt.Println()
+	fmt.Printf("What is the PoF bandwidth base price (wei per Mbps)? (default = %v)\n", price)
+	cfg.PofBasePrice = w.readDefaultBigInt(price)
+}
+
+// readAlienManager asks for a system manager account, defaulting to the current
+// one or the built-in one if none was configured yet.
+func (w *wizard) readAlienManager(question string, current *common.Address, builtin common.Address) *common.Address {
+	def := builtin
+	if current != nil {
+		def = *current
+	}
+	fmt.Println()
+	fmt.Printf("%s (default = %s)\n", question, def.Hex())
+	address := w.readDefaultAddress(def)
+	return &address
+}
+
+// readAlienLock asks for a lock schedule in days, defaulting to the current one
+// or the built-in one if none was configured yet.
+func (w *wizard) readAlienLock(what string, current *params.AlienLockConfig, builtin *params.AlienLockConfig) *params.AlienLockConfig {
+	lock := *builtin
+	if current != nil {
+		lock = *current
+	}
+	fmt.Println()
+	fmt.Printf("How many days should %s stay locked before being released? (default = %d)\n", what, lock.LockPeriod/86400)
+	lock.LockPeriod = uint64(w.readDefaultInt(int(lock.LockPeriod/86400))) * 86400
+
+	fmt.Println()
+	fmt.Printf("Over how many days should %s be released? (default = %d)\n", what, lock.ReleasePeriod/86400)
+	lock.ReleasePeriod = uint64(w.readDefaultInt(int(lock.ReleasePeriod/86400))) * 86400
+
+	fmt.Println()
+	fmt.Printf("How many days between two releases of %s? (default = %d)\n", what, lock.Interval/86400)
+	lock.Interval = uint64(w.readDefaultInt(int(lock.Interval/86400))) * 86400
+
+	return &lock
+}
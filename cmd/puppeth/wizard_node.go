@@ -19,6 +19,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/token/accounts/keystore"
@@ -101,6 +102,13 @@ func (w *wizard) deployNode(boot bool) {
 		fmt.Printf("What should the node be called on the stats page? (default = %s)\n", infos.ethstats)
 		infos.ethstats = w.readDefaultString(infos.ethstats) + ":" + w.conf.ethstats
 	}
+	// Alien side chain nodes need to reach the main chain to confirm their blocks
+	if alien := w.conf.Genesis.Config.Alien; alien != nil && alien.SideChain {
+		infos.mainRPC = w.readMainChainRPC(infos.mainRPC)
+		infos.period = alien.Period
+	} else {
+		infos.mainRPC = ""
+	}
 	// If the node is a miner/signer, load up needed credentials
 	if !boot {
 		if w.conf.Genesis.Config.Ethash != nil {
@@ -183,3 +191,24 @@ func (w *wizard) deployNode(boot bool) {
 
 	w.networkStats()
 }
+
+// readMainChainRPC asks for the main chain RPC endpoint of an alien side chain
+// node, offering the previously configured one as the default.
+func (w *wizard) readMainChainRPC(current string) string {
+	for {
+		fmt.Println()
+		if current == "" {
+			fmt.Printf("Which main chain RPC endpoint should the side chain use? (host:port)\n")
+			current = w.readString()
+		} else {
+			fmt.Printf("Which main chain RPC endpoint should the side chain use? (default = %s)\n", current)
+			current = w.readDefaultString(current)
+		}
+		if _, _, err := net.SplitHostPort(current); err != nil {
+			log.Error("Invalid main chain RPC endpoint", "err", err)
+			current = ""
+			continue
+		}
+		return current
+	}
+}
@@ -19,6 +19,7 @@ package utils
 
 import (
 	"compress/gzip"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -269,6 +270,115 @@ func ExportAppendChain(blockchain *core.BlockChain, fn string, first uint64, las
 	return nil
 }
 
+// ExportedLog is the RLP layout of a log written by ExportReceipts. The block and
+// transaction it belongs to are carried by the enclosing receipt.
+type ExportedLog struct {
+	Address common.Address
+	Topics  []common.Hash
+	Data    []byte
+	Index   uint64
+}
+
+// ExportedReceipt is the RLP layout of a receipt written by ExportReceipts. On top
+// of the consensus fields it carries the fields derived from the enclosing block.
+type ExportedReceipt struct {
+	Type              uint8
+	PostState         []byte
+	Status            uint64
+	CumulativeGasUsed uint64
+	Logs              []*ExportedLog
+	TxHash            common.Hash
+	ContractAddress   common.Address
+	GasUsed           uint64
+	BlockHash         common.Hash
+	BlockNumber       uint64
+	TransactionIndex  uint64
+}
+
+// newExportedReceipt converts a receipt with derived fields into its export layout.
+func newExportedReceipt(receipt *types.Receipt) *ExportedReceipt {
+	exported := &ExportedReceipt{
+		Type:              receipt.Type,
+		PostState:         receipt.PostState,
+		Status:            receipt.Status,
+		CumulativeGasUsed: receipt.CumulativeGasUsed,
+		Logs:              make([]*ExportedLog, len(receipt.Logs)),
+		TxHash:            receipt.TxHash,
+		ContractAddress:   receipt.ContractAddress,
+		GasUsed:           receipt.GasUsed,
+		BlockHash:         receipt.BlockHash,
+		BlockNumber:       receipt.BlockNumber.Uint64(),
+		TransactionIndex:  uint64(receipt.TransactionIndex),
+	}
+	for i, l := range receipt.Logs {
+		exported.Logs[i] = &ExportedLog{Address: l.Address, Topics: l.Topics, Data: l.Data, Index: uint64(l.Index)}
+	}
+	return exported
+}
+
+// ExportReceipts exports the receipts of a range of canonical blocks into the
+// specified file, truncating any data already present in the file. Receipts are
+// written with their derived fields, either as a stream of RLP encoded
+// ExportedReceipt items (format "rlp") or as one JSON object per line ("jsonl").
+func ExportReceipts(blockchain *core.BlockChain, fn string, format string, first uint64, last uint64) error {
+	if format != "rlp" && format != "jsonl" {
+		return fmt.Errorf("unknown receipt export format %q", format)
+	}
+	if first > last {
+		return fmt.Errorf("first (%d) is greater than last (%d)", first, last)
+	}
+	log.Info("Exporting receipts", "file", fn, "format", format, "first", first, "last", last)
+
+	// Open the file handle and potentially wrap with a gzip stream
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var writer io.Writer = fh
+	if strings.HasSuffix(fn, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	encoder := json.NewEncoder(writer)
+
+	var (
+		count           int
+		start, reported = time.Now(), time.Now()
+	)
+	for nr := first; nr <= last; nr++ {
+		hash := blockchain.GetCanonicalHash(nr)
+		if hash == (common.Hash{}) {
+			return fmt.Errorf("export failed on #%d: not found", nr)
+		}
+		receipts := blockchain.GetReceiptsByHash(hash)
+		if receipts == nil {
+			if block := blockchain.GetBlock(hash, nr); block == nil || len(block.Transactions()) > 0 {
+				return fmt.Errorf("export failed on #%d: receipts not found", nr)
+			}
+		}
+		for _, receipt := range receipts {
+			switch format {
+			case "rlp":
+				err = rlp.Encode(writer, newExportedReceipt(receipt))
+			case "jsonl":
+				err = encoder.Encode(receipt)
+			}
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		if time.Since(reported) >= 8*time.Second {
+			log.Info("Exporting receipts", "block", nr, "receipts", count, "elapsed", common.PrettyDuration(time.Since(start)))
+			reported = time.Now()
+		}
+	}
+	log.Info("Exported receipts", "file", fn, "receipts", count, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
 // ImportPreimages imports a batch of exported hash preimages into the database.
 func ImportPreimages(db ethdb.Database, fn string) error {
 	log.Info("Importing preimages", "file", fn)
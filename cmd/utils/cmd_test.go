@@ -0,0 +1,62 @@
+// Copyright 2021 The nbn Authors
+// This file is part of nbn.
+//
+// nbn is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// nbn is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with nbn. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/token/common"
+	"github.com/token/core/types"
+	"github.com/token/rlp"
+)
+
+func TestExportedReceiptRLP(t *testing.T) {
+	receipt := &types.Receipt{
+		Type:              types.DynamicFeeTxType,
+		Status:            types.ReceiptStatusSuccessful,
+		CumulativeGasUsed: 42000,
+		Logs: []*types.Log{{
+			Address: common.Address{0x11},
+			Topics:  []common.Hash{{0x22}},
+			Data:    []byte{0x33},
+			Index:   3,
+		}},
+		TxHash:           common.Hash{0x44},
+		GasUsed:          21000,
+		BlockHash:        common.Hash{0x55},
+		BlockNumber:      big.NewInt(100),
+		TransactionIndex: 1,
+	}
+	exported := newExportedReceipt(receipt)
+
+	blob, err := rlp.EncodeToBytes(exported)
+	if err != nil {
+		t.Fatalf("failed to encode receipt: %v", err)
+	}
+	decoded := new(ExportedReceipt)
+	if err := rlp.DecodeBytes(blob, decoded); err != nil {
+		t.Fatalf("failed to decode receipt: %v", err)
+	}
+	if reblob, _ := rlp.EncodeToBytes(decoded); !bytes.Equal(reblob, blob) {
+		t.Fatalf("receipt mismatch:\nhave %x\nwant %x", reblob, blob)
+	}
+	if decoded.BlockNumber != 100 || decoded.TransactionIndex != 1 || decoded.Logs[0].Index != 3 {
+		t.Errorf("derived fields lost: block %d, index %d, log index %d", decoded.BlockNumber, decoded.TransactionIndex, decoded.Logs[0].Index)
+	}
+}
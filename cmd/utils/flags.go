@@ -36,6 +36,7 @@ import (
 	pcsclite "github.com/gballet/go-libpcsclite"
 	"github.com/token/accounts"
 	"github.com/token/accounts/keystore"
+	"github.com/token/audit"
 	"github.com/token/common"
 	"github.com/token/common/fdlimit"
 	"github.com/token/consensus"
@@ -68,7 +69,9 @@ import (
 	"github.com/token/p2p/nat"
 	"github.com/token/p2p/netutil"
 	"github.com/token/params"
+	"github.com/token/tracing"
 	gopsutil "github.com/shirou/gopsutil/mem"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -118,6 +121,11 @@ var (
 		Name:  "datadir.ancient",
 		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
 	}
+	DBEngineFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: "Backing database implementation to use ('leveldb' or 'pebble', default = engine of the existing database or leveldb)",
+		Value: "",
+	}
 	MinFreeDiskSpaceFlag = DirectoryFlag{
 		Name:  "datadir.minfreedisk",
 		Usage: "Minimum free disk space in MB, once reached triggers auto shut down (default = --cache.gc converted to MB, 0 = disabled)",
@@ -199,6 +207,11 @@ var (
 		Usage: "Max number of elements (0 = no limit)",
 		Value: 0,
 	}
+	ReceiptsFormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: "Receipt export format (rlp or jsonl)",
+		Value: "rlp",
+	}
 	defaultSyncMode = ethconfig.Defaults.SyncMode
 	SyncModeFlag    = TextMarshalerFlag{
 		Name:  "syncmode",
@@ -219,6 +232,34 @@ var (
 		Usage: "Number of recent blocks to maintain transactions index for (default = about one year, 0 = entire chain)",
 		Value: ethconfig.Defaults.TxLookupLimit,
 	}
+	TraceIndexFlag = cli.BoolFlag{
+		Name:  "trace.index",
+		Usage: "Maintain an index of the call traces of new blocks for the trace API",
+	}
+	TraceIndexTailFlag = cli.Uint64Flag{
+		Name:  "trace.tail",
+		Usage: "Oldest block to backfill the call trace index to in the background if set, needs the historical states",
+	}
+	StateSchemeFlag = cli.StringFlag{
+		Name:  "state.scheme",
+		Usage: `Scheme used to store the state trie nodes ("hash", "path")`,
+		Value: ethconfig.Defaults.StateScheme,
+	}
+	StateHistoryFlag = cli.Uint64Flag{
+		Name:  "state.history",
+		Usage: "Number of recent blocks the state can be rolled back to with the path scheme",
+		Value: ethconfig.Defaults.StateHistory,
+	}
+	StatePruneBloomSizeFlag = cli.Uint64Flag{
+		Name:  "state.prune.bloomsize",
+		Usage: "Megabytes of memory allocated to the bloom filter of the online state pruner",
+		Value: ethconfig.Defaults.StatePruneBloomSize,
+	}
+	StatePruneThrottleFlag = cli.DurationFlag{
+		Name:  "state.prune.throttle",
+		Usage: "Pause of the online state pruner between two deletion batches",
+		Value: ethconfig.Defaults.StatePruneThrottle,
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -371,6 +412,16 @@ var (
 		Usage: "Maximum amount of time non-executable transaction are queued",
 		Value: ethconfig.Defaults.TxPool.Lifetime,
 	}
+	TxPoolSystemSlotsFlag = cli.Uint64Flag{
+		Name:  "txpool.systemslots",
+		Usage: "Maximum number of consensus system transactions for all accounts",
+		Value: ethconfig.Defaults.TxPool.SystemSlots,
+	}
+	TxPoolSystemAccountSlotsFlag = cli.Uint64Flag{
+		Name:  "txpool.systemaccountslots",
+		Usage: "Maximum number of consensus system transactions permitted per account",
+		Value: ethconfig.Defaults.TxPool.SystemAccountSlots,
+	}
 	// Performance tuning settings
 	CacheFlag = cli.IntFlag{
 		Name:  "cache",
@@ -466,6 +517,11 @@ var (
 		Name:  "miner.noverify",
 		Usage: "Disable remote sealing verification",
 	}
+	MinerSystemGasFlag = cli.Uint64Flag{
+		Name:  "miner.systemgas",
+		Usage: "Gas reserved in each block for consensus system transactions (0 = disabled)",
+		Value: ethconfig.Defaults.Miner.SystemGasReserve,
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 		Name:  "unlock",
@@ -482,6 +538,16 @@ var (
 		Usage: "External signer (url or path to ipc file)",
 		Value: "",
 	}
+	KMSEndpointFlag = cli.StringFlag{
+		Name:  "kms",
+		Usage: "Key-management service URL providing additional signing accounts (unlocked with --unlock)",
+		Value: "",
+	}
+	KMSTokenFileFlag = cli.StringFlag{
+		Name:  "kms.tokenfile",
+		Usage: "File holding the bearer token authenticating with the key-management service",
+		Value: "",
+	}
 	VMEnableDebugFlag = cli.BoolFlag{
 		Name:  "vmdebug",
 		Usage: "Record information useful for VM and contract debugging",
@@ -505,6 +571,10 @@ var (
 		Name:  "ethstats",
 		Usage: "Reporting URL of a ethstats service (nodename:secret@host:port)",
 	}
+	AuditLogFlag = cli.StringFlag{
+		Name:  "auditlog",
+		Usage: "File to append the signed validator audit trail to (sealed blocks, confirmations, custom txs, missed slots)",
+	}
 	FakePoWFlag = cli.BoolFlag{
 		Name:  "fakepow",
 		Usage: "Disables proof-of-work verification",
@@ -599,6 +669,66 @@ var (
 		Usage: "HTTP path prefix on which JSON-RPC is served. Use '/' to serve on all paths.",
 		Value: "",
 	}
+	HTTPAuthFlag = cli.BoolFlag{
+		Name:  "http.auth",
+		Usage: "Require JWT authentication on the HTTP-RPC server",
+	}
+	WSAuthFlag = cli.BoolFlag{
+		Name:  "ws.auth",
+		Usage: "Require JWT authentication on the WS-RPC server",
+	}
+	AuthListenAddrFlag = cli.StringFlag{
+		Name:  "authrpc.addr",
+		Usage: "Listening address for the authenticated RPC server",
+		Value: node.DefaultAuthHost,
+	}
+	AuthPortFlag = cli.IntFlag{
+		Name:  "authrpc.port",
+		Usage: "Listening port for the authenticated RPC server",
+		Value: node.DefaultAuthPort,
+	}
+	AuthVirtualHostsFlag = cli.StringFlag{
+		Name:  "authrpc.vhosts",
+		Usage: "Comma separated list of virtual hostnames from which to accept requests on the authenticated RPC server (server enforced). Accepts '*' wildcard.",
+		Value: strings.Join(node.DefaultConfig.AuthVirtualHosts, ","),
+	}
+	AuthApiFlag = cli.StringFlag{
+		Name:  "authrpc.api",
+		Usage: "API's offered over the authenticated RPC server (HTTP and WS), the server is disabled if empty",
+		Value: "",
+	}
+	JWTSecretFlag = cli.StringFlag{
+		Name:  "authrpc.jwtsecret",
+		Usage: "Path to a hex encoded JWT secret to authenticate RPC requests with (generated if missing, default = inside the datadir)",
+		Value: "",
+	}
+	JWTIssuedAtSkewFlag = cli.DurationFlag{
+		Name:  "authrpc.jwtskew",
+		Usage: "Maximum difference between the issuance time of a JWT token and the local clock",
+		Value: node.DefaultConfig.JWTIssuedAtSkew,
+	}
+	RPCBatchItemLimitFlag = cli.IntFlag{
+		Name:  "rpc.batch-request-limit",
+		Usage: "Maximum number of requests in an HTTP or WS batch (0 = no limit)",
+	}
+	RPCResponseSizeLimitFlag = cli.IntFlag{
+		Name:  "rpc.batch-response-max-size",
+		Usage: "Maximum number of bytes returned for an HTTP or WS request or batch (0 = no limit)",
+	}
+	RPCMethodConcurrencyFlag = cli.StringFlag{
+		Name:  "rpc.method-concurrency",
+		Usage: "Comma separated list of method=limit pairs bounding the concurrent HTTP and WS calls of a method (e.g. eth_getLogs=4,debug_traceBlockByNumber=1)",
+		Value: "",
+	}
+	RPCRateLimitFlag = cli.Float64Flag{
+		Name:  "rpc.ratelimit",
+		Usage: "Number of HTTP and WS calls per second allowed per client IP or JWT subject (0 = no limit)",
+	}
+	RPCRateBurstFlag = cli.IntFlag{
+		Name:  "rpc.ratelimit.burst",
+		Usage: "Number of calls a client may burst above the RPC rate limit",
+		Value: 100,
+	}
 	ExecFlag = cli.StringFlag{
 		Name:  "exec",
 		Usage: "Execute JavaScript statement",
@@ -749,6 +879,19 @@ var (
 		Usage: "Comma-separated InfluxDB tags (key/values) attached to all measurements",
 		Value: metrics.DefaultConfig.InfluxDBTags,
 	}
+	TracingEnabledFlag = cli.BoolFlag{
+		Name:  "tracing",
+		Usage: "Enable OpenTelemetry tracing of RPC calls, block imports and syncing",
+	}
+	TracingEndpointFlag = cli.StringFlag{
+		Name:  "tracing.endpoint",
+		Usage: "OTLP/HTTP collector endpoint to export spans to",
+		Value: "http://localhost:4318",
+	}
+	TracingFileFlag = cli.StringFlag{
+		Name:  "tracing.file",
+		Usage: "Write spans as JSON encoded OTLP export requests to the file (or \"stdout\") instead of the collector",
+	}
 	EWASMInterpreterFlag = cli.StringFlag{
 		Name:  "vm.ewasm",
 		Usage: "External ewasm configuration (default = built-in interpreter)",
@@ -979,6 +1122,9 @@ func setHTTP(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(AllowUnprotectedTxs.Name) {
 		cfg.AllowUnprotectedTxs = ctx.GlobalBool(AllowUnprotectedTxs.Name)
 	}
+	if ctx.GlobalIsSet(HTTPAuthFlag.Name) {
+		cfg.HTTPAuth = ctx.GlobalBool(HTTPAuthFlag.Name)
+	}
 }
 
 // setGraphQL creates the GraphQL listener interface string from the set
@@ -1016,6 +1162,61 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(WSPathPrefixFlag.Name) {
 		cfg.WSPathPrefix = ctx.GlobalString(WSPathPrefixFlag.Name)
 	}
+	if ctx.GlobalIsSet(WSAuthFlag.Name) {
+		cfg.WSAuth = ctx.GlobalBool(WSAuthFlag.Name)
+	}
+}
+
+// setAuthRPC configures the authenticated RPC server and the JWT secret from
+// the set command line flags.
+func setAuthRPC(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(AuthListenAddrFlag.Name) {
+		cfg.AuthAddr = ctx.GlobalString(AuthListenAddrFlag.Name)
+	}
+	if ctx.GlobalIsSet(AuthPortFlag.Name) {
+		cfg.AuthPort = ctx.GlobalInt(AuthPortFlag.Name)
+	}
+	if ctx.GlobalIsSet(AuthVirtualHostsFlag.Name) {
+		cfg.AuthVirtualHosts = SplitAndTrim(ctx.GlobalString(AuthVirtualHostsFlag.Name))
+	}
+	if ctx.GlobalIsSet(AuthApiFlag.Name) {
+		cfg.AuthModules = SplitAndTrim(ctx.GlobalString(AuthApiFlag.Name))
+	}
+	if ctx.GlobalIsSet(JWTSecretFlag.Name) {
+		cfg.JWTSecret = ctx.GlobalString(JWTSecretFlag.Name)
+	}
+	if ctx.GlobalIsSet(JWTIssuedAtSkewFlag.Name) {
+		cfg.JWTIssuedAtSkew = ctx.GlobalDuration(JWTIssuedAtSkewFlag.Name)
+	}
+}
+
+// setRPCLimits configures the resource limits of the HTTP and WS RPC servers
+// from the command line flags.
+func setRPCLimits(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(RPCBatchItemLimitFlag.Name) {
+		cfg.RPCBatchItemLimit = ctx.GlobalInt(RPCBatchItemLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCResponseSizeLimitFlag.Name) {
+		cfg.RPCResponseSizeLimit = ctx.GlobalInt(RPCResponseSizeLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCMethodConcurrencyFlag.Name) {
+		cfg.RPCMethodConcurrency = make(map[string]int)
+		for _, entry := range SplitAndTrim(ctx.GlobalString(RPCMethodConcurrencyFlag.Name)) {
+			parts := strings.Split(entry, "=")
+			if len(parts) != 2 {
+				Fatalf("Option %q: invalid entry %q, want method=limit", RPCMethodConcurrencyFlag.Name, entry)
+			}
+			limit, err := strconv.Atoi(parts[1])
+			if err != nil || limit <= 0 {
+				Fatalf("Option %q: invalid limit %q for %s", RPCMethodConcurrencyFlag.Name, parts[1], parts[0])
+			}
+			cfg.RPCMethodConcurrency[strings.TrimSpace(parts[0])] = limit
+		}
+	}
+	if ctx.GlobalIsSet(RPCRateLimitFlag.Name) {
+		cfg.RPCRateLimit = ctx.GlobalFloat64(RPCRateLimitFlag.Name)
+		cfg.RPCRateBurst = ctx.GlobalInt(RPCRateBurstFlag.Name)
+	}
 }
 
 // setIPC creates an IPC path configuration from the set command line flags,
@@ -1215,6 +1416,19 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 		cfg.NoDiscovery = true
 		cfg.DiscoveryV5 = false
 	}
+	// A validator behind sentries must never be advertised to the network.
+	if len(cfg.SentryNodes) > 0 {
+		if ctx.GlobalIsSet(DiscoveryV5Flag.Name) && cfg.DiscoveryV5 {
+			Fatalf("Option %q is incompatible with sentry nodes", DiscoveryV5Flag.Name)
+		}
+		if ctx.GlobalIsSet(NATFlag.Name) && cfg.NAT != nil {
+			Fatalf("Option %q is incompatible with sentry nodes", NATFlag.Name)
+		}
+		log.Info("Running validator behind sentry nodes", "sentries", len(cfg.SentryNodes))
+		cfg.NoDiscovery = true
+		cfg.DiscoveryV5 = false
+		cfg.NAT = nil
+	}
 }
 
 // SetNodeConfig applies node-related command line flags to the config.
@@ -1224,13 +1438,22 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setHTTP(ctx, cfg)
 	setGraphQL(ctx, cfg)
 	setWS(ctx, cfg)
+	setAuthRPC(ctx, cfg)
+	setRPCLimits(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 	setDataDir(ctx, cfg)
+	setDBEngine(ctx, cfg)
 	setSmartCard(ctx, cfg)
 
 	if ctx.GlobalIsSet(ExternalSignerFlag.Name) {
 		cfg.ExternalSigner = ctx.GlobalString(ExternalSignerFlag.Name)
 	}
+	if ctx.GlobalIsSet(KMSEndpointFlag.Name) {
+		cfg.KMSEndpoint = ctx.GlobalString(KMSEndpointFlag.Name)
+	}
+	if ctx.GlobalIsSet(KMSTokenFileFlag.Name) {
+		cfg.KMSTokenFile = ctx.GlobalString(KMSTokenFileFlag.Name)
+	}
 
 	if ctx.GlobalIsSet(KeyStoreDirFlag.Name) {
 		cfg.KeyStoreDir = ctx.GlobalString(KeyStoreDirFlag.Name)
@@ -1295,6 +1518,20 @@ func setDataDir(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// setDBEngine configures the key-value store engine of the node databases from
+// the command line flags.
+func setDBEngine(ctx *cli.Context, cfg *node.Config) {
+	if !ctx.GlobalIsSet(DBEngineFlag.Name) {
+		return
+	}
+	switch engine := ctx.GlobalString(DBEngineFlag.Name); engine {
+	case rawdb.DBLeveldb, rawdb.DBPebble:
+		cfg.DBEngine = engine
+	default:
+		Fatalf("Option %q: unknown engine %q, want %q or %q", DBEngineFlag.Name, engine, rawdb.DBLeveldb, rawdb.DBPebble)
+	}
+}
+
 func setGPO(ctx *cli.Context, cfg *gasprice.Config, light bool) {
 	// If we are running the light client, apply another group
 	// settings for gas oracle.
@@ -1360,6 +1597,12 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolLifetimeFlag.Name) {
 		cfg.Lifetime = ctx.GlobalDuration(TxPoolLifetimeFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolSystemSlotsFlag.Name) {
+		cfg.SystemSlots = ctx.GlobalUint64(TxPoolSystemSlotsFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSystemAccountSlotsFlag.Name) {
+		cfg.SystemAccountSlots = ctx.GlobalUint64(TxPoolSystemAccountSlotsFlag.Name)
+	}
 }
 
 func setEthash(ctx *cli.Context, cfg *ethconfig.Config) {
@@ -1415,6 +1658,9 @@ func setMiner(ctx *cli.Context, cfg *miner.Config) {
 	if ctx.GlobalIsSet(MinerNoVerfiyFlag.Name) {
 		cfg.Noverify = ctx.GlobalBool(MinerNoVerfiyFlag.Name)
 	}
+	if ctx.GlobalIsSet(MinerSystemGasFlag.Name) {
+		cfg.SystemGasReserve = ctx.GlobalUint64(MinerSystemGasFlag.Name)
+	}
 }
 
 func setWhitelist(ctx *cli.Context, cfg *ethconfig.Config) {
@@ -1558,6 +1804,13 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(TraceIndexFlag.Name) {
+		cfg.TraceIndex = ctx.GlobalBool(TraceIndexFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceIndexTailFlag.Name) {
+		tail := ctx.GlobalUint64(TraceIndexTailFlag.Name)
+		cfg.TraceIndexTail = &tail
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
 	}
@@ -1582,6 +1835,38 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 			cfg.SnapshotCache = 0 // Disabled
 		}
 	}
+	if ctx.GlobalIsSet(StateSchemeFlag.Name) {
+		cfg.StateScheme = ctx.GlobalString(StateSchemeFlag.Name)
+	}
+	if cfg.StateScheme != rawdb.HashScheme && cfg.StateScheme != rawdb.PathScheme {
+		Fatalf("--%s must be either '%s' or '%s'", StateSchemeFlag.Name, rawdb.HashScheme, rawdb.PathScheme)
+	}
+	if cfg.StateScheme == rawdb.PathScheme {
+		if cfg.NoPruning {
+			Fatalf("--%s=%s is incompatible with --%s=archive", StateSchemeFlag.Name, rawdb.PathScheme, GCModeFlag.Name)
+		}
+		// State sync writes hash-keyed trie nodes, only full sync is supported
+		if cfg.SyncMode != downloader.FullSync {
+			if ctx.GlobalIsSet(SyncModeFlag.Name) {
+				Fatalf("--%s=%s requires --%s=full", StateSchemeFlag.Name, rawdb.PathScheme, SyncModeFlag.Name)
+			}
+			log.Info("Path state scheme requested, enabling full sync")
+			cfg.SyncMode = downloader.FullSync
+		}
+		// Light clients retrieve trie nodes by hash, which isn't supported
+		if cfg.LightServ > 0 {
+			Fatalf("--%s=%s is incompatible with --%s", StateSchemeFlag.Name, rawdb.PathScheme, LightServeFlag.Name)
+		}
+	}
+	if ctx.GlobalIsSet(StateHistoryFlag.Name) {
+		cfg.StateHistory = ctx.GlobalUint64(StateHistoryFlag.Name)
+	}
+	if ctx.GlobalIsSet(StatePruneBloomSizeFlag.Name) {
+		cfg.StatePruneBloomSize = ctx.GlobalUint64(StatePruneBloomSizeFlag.Name)
+	}
+	if ctx.GlobalIsSet(StatePruneThrottleFlag.Name) {
+		cfg.StatePruneThrottle = ctx.GlobalDuration(StatePruneThrottleFlag.Name)
+	}
 	if ctx.GlobalIsSet(DocRootFlag.Name) {
 		cfg.DocRoot = ctx.GlobalString(DocRootFlag.Name)
 	}
@@ -1711,7 +1996,7 @@ func RegisterEthService(stack *node.Node, cfg *ethconfig.Config) (ethapi.Backend
 		if err != nil {
 			Fatalf("Failed to register the nbn service: %v", err)
 		}
-		stack.RegisterAPIs(tracers.APIs(backend.ApiBackend))
+		stack.RegisterAPIs(tracers.APIs(backend.ApiBackend, nil))
 		return backend.ApiBackend, nil
 	}
 	backend, err := eth.New(stack, cfg)
@@ -1724,7 +2009,12 @@ func RegisterEthService(stack *node.Node, cfg *ethconfig.Config) (ethapi.Backend
 			Fatalf("Failed to create the LES server: %v", err)
 		}
 	}
-	stack.RegisterAPIs(tracers.APIs(backend.APIBackend))
+	var indexer *tracers.TraceIndexer
+	if cfg.TraceIndex {
+		indexer = tracers.NewTraceIndexer(backend.APIBackend, cfg.TraceIndexTail)
+		stack.RegisterLifecycle(indexer)
+	}
+	stack.RegisterAPIs(tracers.APIs(backend.APIBackend, indexer))
 	return backend.APIBackend, backend
 }
 
@@ -1736,6 +2026,14 @@ func RegisterEthStatsService(stack *node.Node, backend ethapi.Backend, url strin
 	}
 }
 
+// RegisterAuditService configures the validator audit log and registers it
+// against the node.
+func RegisterAuditService(stack *node.Node, backend audit.Backend, path string) {
+	if err := audit.New(stack, backend, path); err != nil {
+		Fatalf("Failed to register the audit service: %v", err)
+	}
+}
+
 // RegisterGraphQLService is a utility function to construct a new service and register it against a node.
 func RegisterGraphQLService(stack *node.Node, backend ethapi.Backend, cfg node.Config) {
 	if err := graphql.New(stack, backend, cfg.GraphQLCors, cfg.GraphQLVirtualHosts); err != nil {
@@ -1771,6 +2069,31 @@ func SetupMetrics(ctx *cli.Context) {
 	}
 }
 
+// SetupTracing enables span collection if requested, exporting spans to either
+// an OTLP collector or a local file. Spans still queued are exported by calling
+// tracing.Stop on shutdown.
+func SetupTracing(ctx *cli.Context) {
+	if !ctx.GlobalBool(TracingEnabledFlag.Name) {
+		return
+	}
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	if path := ctx.GlobalString(TracingFileFlag.Name); path != "" {
+		log.Info("Enabling tracing export to file", "path", path)
+		exporter, err = tracing.NewFileExporter(path)
+	} else {
+		endpoint := ctx.GlobalString(TracingEndpointFlag.Name)
+		log.Info("Enabling tracing export to OTLP collector", "endpoint", endpoint)
+		exporter, err = tracing.NewOTLPExporter(endpoint)
+	}
+	if err != nil {
+		Fatalf("Failed to set up tracing: %v", err)
+	}
+	tracing.Enable(exporter, "nbn")
+}
+
 func SplitTagsFlag(tagsFlag string) map[string]string {
 	tags := strings.Split(tagsFlag, ",")
 	tagsMap := map[string]string{}
@@ -1862,6 +2185,8 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 		TrieTimeLimit:       ethconfig.Defaults.TrieTimeout,
 		SnapshotLimit:       ethconfig.Defaults.SnapshotCache,
 		Preimages:           ctx.GlobalBool(CachePreimagesFlag.Name),
+		StateScheme:         ctx.GlobalString(StateSchemeFlag.Name),
+		StateHistory:        ctx.GlobalUint64(StateHistoryFlag.Name),
 	}
 	if cache.TrieDirtyDisabled && !cache.Preimages {
 		cache.Preimages = true
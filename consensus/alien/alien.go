@@ -19,6 +19,7 @@ package alien
 
 import (
 	"bytes"
+	"context"
 	"container/list"
 	"errors"
 	"fmt"
@@ -41,7 +42,9 @@ import (
 	"github.com/token/params"
 	"github.com/token/rlp"
 	"github.com/token/rpc"
+	"github.com/token/tracing"
 	"github.com/token/trie"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -162,6 +165,8 @@ type Alien struct {
 	signTxFn   SignTxFn            // Sign transaction function to sign tx
 	lock       sync.RWMutex        // Protects the signer fields
 	lcsc       uint64              // Last confirmed side chain
+	systemSnap *Snapshot           // Snapshot of the head classifying the system transactions
+	systemLock sync.Mutex          // Protects the system transaction snapshot
 }
 
 // SignerFn hashes and signs the data to be signed by a backing account.
@@ -395,7 +400,11 @@ func (a *Alien) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 				return nil, err
 			}
 			a.config.Period = chain.Config().Alien.Period
-			snap = newSnapshot(a.config, a.signatures, genesis.Hash(), genesisVotes, lcrs,a.db)
+			s, err := newSnapshot(a.config, a.signatures, genesis.Hash(), genesisVotes, lcrs,a.db)
+			if err != nil {
+				return nil, err
+			}
+			snap = s
 			if err := snap.store(a.db); err != nil {
 				return nil, err
 			}
@@ -796,9 +805,15 @@ func (a *Alien) GrantProfit(chain consensus.ChainHeaderReader, header *types.Hea
 
 // Finalize implements consensus.Engine, ensuring no uncles are set, nor block
 // rewards given.
-func (a *Alien) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt, grantProfit []consensus.GrantProfitRecord, gasReward *big.Int) error {
+func (a *Alien) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt, grantProfit []consensus.GrantProfitRecord, gasReward *big.Int) (err error) {
 	number := header.Number.Uint64()
 
+	_, span := tracing.Start(context.Background(), "alien.Finalize", tracing.Uint64("block.number", number), attribute.Int("txs", len(txs)))
+	defer func() {
+		tracing.SetError(span, err)
+		span.End()
+	}()
+
 	// Mix digest is reserved for now, set to empty
 	header.MixDigest = common.Hash{}
 
@@ -1066,13 +1081,10 @@ func (a *Alien) Seal(chain consensus.ChainHeaderReader, block *types.Block, resu
 	// correct the time
 	delay := time.Unix(int64(header.Time), 0).Sub(time.Now())
 
-	sighash, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeAlien, AlienRLP(header))
-	if err != nil {
-		return err
-	}
-
-	copy(header.Extra[len(header.Extra)-extraSeal:], sighash)
-	// Wait until sealing is terminated or delay timeout.
+	// Wait until sealing is terminated or delay timeout. The header is only signed
+	// once its slot arrived, so the precommitted and resubmitted blocks replaced
+	// in the meantime are never signed, which a signer refusing to double sign
+	// (like clef) would otherwise hold against the block actually published.
 	log.Trace("Waiting for slot to sign and propagate", "delay", common.PrettyDuration(delay))
 	go func() {
 		select {
@@ -1080,6 +1092,17 @@ func (a *Alien) Seal(chain consensus.ChainHeaderReader, block *types.Block, resu
 			return
 		case <-time.After(delay):
 		}
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		sighash, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeAlien, AlienRLP(header))
+		if err != nil {
+			log.Warn("Failed to sign block", "number", number, "sealhash", SealHash(header), "err", err)
+			return
+		}
+		copy(header.Extra[len(header.Extra)-extraSeal:], sighash)
 
 		select {
 		case results <- block.WithSeal(header):
@@ -1,6 +1,14 @@
 package alien
 
-import "math/big"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/token/common"
+	"github.com/token/params"
+)
 
 const (
 	checkpointInterval = 360              //360        // About N hours if config.period is N
@@ -27,6 +35,8 @@ const (
 	rewardLockParamPeriod      = 30 * 24 * 60 * 60
 	rewardLockParamRlsPeriod   = 365 * 24 * 60 * 60
 	rewardLockParamInterval    = 24 * 60 * 60
+
+	defaultExchRate = 10000 // Token to coin exchange ratio of the genesis snapshot
 	PosChangeManagerNumber=215907
 )
 
@@ -111,4 +121,132 @@ func  isDeletPofExitPledge(number uint64,period uint64) bool {
 }
 func isGEPosChangeManagerNumber(number uint64) bool{
 	return number >=PosChangeManagerNumber
-}
\ No newline at end of file
+}
+
+// DefaultSystemConfig returns the built-in system parameters of the genesis
+// snapshot, which apply to every field not overridden in the genesis spec.
+func DefaultSystemConfig() *params.AlienSystemConfig {
+	var (
+		manager          = managerAddressManager
+		exchRateManager  = managerAddressExchRate
+		systemManager    = managerAddressSystem
+		bandwidthManager = managerAddressWdthPnsh
+		pofReportManager = managerAddressPofReport
+	)
+	return &params.AlienSystemConfig{
+		Manager:          &manager,
+		ExchRateManager:  &exchRateManager,
+		SystemManager:    &systemManager,
+		BandwidthManager: &bandwidthManager,
+		PofReportManager: &pofReportManager,
+		ExchRate:         defaultExchRate,
+		CandidateDeposit: new(big.Int).Set(minCndPledgeBalance),
+		CandidateLock:    &params.AlienLockConfig{LockPeriod: signerPledgeLockParamPeriod, ReleasePeriod: signerPledgeLockParamRlsPeriod, Interval: signerPledgeLockParamInterval},
+		PofLock:          &params.AlienLockConfig{LockPeriod: pofPledgeLockParamPeriod, ReleasePeriod: pofPledgeLockParamRlsPeriod, Interval: pofPledgeLockParamInterval},
+		RewardLock:       &params.AlienLockConfig{LockPeriod: rewardLockParamPeriod, ReleasePeriod: rewardLockParamRlsPeriod, Interval: rewardLockParamInterval},
+		PofBasePrice:     new(big.Int).Set(pofDefaultBasePrice),
+		PosCommitPeriod:  new(big.Int).Set(posCommitPeriod),
+	}
+}
+
+// managerOfManagers returns the account allowed to change the system manager
+// addresses, honouring the genesis override if any.
+func (a *Alien) managerOfManagers() common.Address {
+	if cfg := a.config.SystemConfig; cfg != nil && cfg.Manager != nil {
+		return *cfg.Manager
+	}
+	return managerAddressManager
+}
+
+// errInvalidPeriod is returned if the genesis spec configures a zero block
+// period, which all the block based system parameters are derived from.
+var errInvalidPeriod = errors.New("invalid alien block period")
+
+// validateSystemConfig checks that the genesis system parameters can be converted
+// into the block based ones of the genesis snapshot with the given block period.
+func validateSystemConfig(period uint64, cfg *params.AlienSystemConfig) error {
+	if period == 0 {
+		return errInvalidPeriod
+	}
+	if cfg == nil {
+		return nil
+	}
+	deposits := map[string]*big.Int{
+		"candidate deposit": cfg.CandidateDeposit,
+		"pof base price":    cfg.PofBasePrice,
+		"pos commit period": cfg.PosCommitPeriod,
+	}
+	for name, value := range deposits {
+		if value != nil && value.Sign() < 0 {
+			return fmt.Errorf("invalid %s: %v", name, value)
+		}
+	}
+	locks := map[string]*params.AlienLockConfig{
+		"candidate": cfg.CandidateLock,
+		"pof":       cfg.PofLock,
+		"reward":    cfg.RewardLock,
+	}
+	for name, lock := range locks {
+		if lock == nil {
+			continue
+		}
+		if lock.LockPeriod/period > math.MaxUint32 || lock.ReleasePeriod/period > math.MaxUint32 {
+			return fmt.Errorf("invalid %s lock: periods exceed %d blocks", name, uint32(math.MaxUint32))
+		}
+		if lock.ReleasePeriod > 0 && (lock.Interval < period || lock.Interval > lock.ReleasePeriod) {
+			return fmt.Errorf("invalid %s lock: release interval %ds outside [%ds, %ds]", name, lock.Interval, period, lock.ReleasePeriod)
+		}
+	}
+	return nil
+}
+
+// applyGenesisSystemConfig overrides the built-in system parameters of the
+// genesis snapshot with the ones configured in the genesis spec, returning an
+// error if they are out of range.
+func (s *Snapshot) applyGenesisSystemConfig(cfg *params.AlienSystemConfig) error {
+	if err := validateSystemConfig(s.config.Period, cfg); err != nil {
+		return err
+	}
+	if cfg == nil {
+		return nil
+	}
+	managers := map[uint32]*common.Address{
+		sscEnumExchRate:   cfg.ExchRateManager,
+		sscEnumSystem:     cfg.SystemManager,
+		sscEnumWdthPnsh:   cfg.BandwidthManager,
+		sscEnumFlowReport: cfg.PofReportManager,
+	}
+	for who, address := range managers {
+		if address != nil {
+			s.SystemConfig.ManagerAddress[who] = *address
+		}
+	}
+	if cfg.ExchRate != 0 {
+		s.SystemConfig.ExchRate = cfg.ExchRate
+	}
+	if cfg.CandidateDeposit != nil {
+		s.SystemConfig.Deposit[0] = new(big.Int).Set(cfg.CandidateDeposit)
+	}
+	locks := map[uint32]*params.AlienLockConfig{
+		sscEnumCndLock: cfg.CandidateLock,
+		sscEnumPofLock: cfg.PofLock,
+		sscEnumRwdLock: cfg.RewardLock,
+	}
+	for who, lock := range locks {
+		if lock != nil {
+			s.SystemConfig.LockParameters[who] = &LockParameter{
+				LockPeriod: uint32(lock.LockPeriod / s.config.Period),
+				RlsPeriod:  uint32(lock.ReleasePeriod / s.config.Period),
+				Interval:   uint32(lock.Interval / s.config.Period),
+			}
+		}
+	}
+	if cfg.PofBasePrice != nil {
+		s.SystemConfig.Deposit[sscEnumPofWithinBasePricePeriod] = new(big.Int).Set(cfg.PofBasePrice)
+	}
+	if cfg.PosCommitPeriod != nil {
+		s.SystemConfig.Deposit[sscEnumPosCommitPeriod] = new(big.Int).Set(cfg.PosCommitPeriod)
+		s.SystemConfig.Deposit[sscEnumPofServicePeriod] = new(big.Int).Set(cfg.PosCommitPeriod)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package alien
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/token/consensus"
+	"github.com/token/core/types"
+)
+
+// BlockAudit implements consensus.AuditEngine, returning the signers punished for
+// missing their slots and the rewards and profits paid out by the header, all
+// recorded in its extra data.
+func (a *Alien) BlockAudit(header *types.Header) (*consensus.BlockAudit, error) {
+	if len(header.Extra) < extraVanity+extraSeal {
+		return nil, errors.New("extra-data too short")
+	}
+	var extra HeaderExtra
+	if err := decodeHeaderExtra(a.config, header.Number, header.Extra[extraVanity:len(header.Extra)-extraSeal], &extra); err != nil {
+		return nil, err
+	}
+	audit := &consensus.BlockAudit{Missed: extra.SignerMissing}
+	for _, reward := range extra.LockReward {
+		audit.Payouts = append(audit.Payouts, consensus.Payout{
+			Kind:   "reward",
+			Code:   reward.IsReward,
+			Target: reward.Target,
+			Amount: new(big.Int).Set(reward.Amount),
+		})
+	}
+	for _, grant := range extra.GrantProfit {
+		audit.Payouts = append(audit.Payouts, consensus.Payout{
+			Kind:   "grant",
+			Code:   grant.Which,
+			Target: grant.RevenueAddress,
+			Amount: new(big.Int).Set(grant.Amount),
+		})
+	}
+	return audit, nil
+}
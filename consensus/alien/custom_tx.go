@@ -1391,7 +1391,7 @@ func (a *Alien) processManagerAddress (currentManagerAddress []ManagerAddressRec
 		log.Warn("Config manager", "parameter number", len(txDataInfo))
 		return currentManagerAddress
 	}
-	if txSender.String() != managerAddressManager.String() {
+	if txSender.String() != a.managerOfManagers().String() {
 		log.Warn("Config manager", "manager", txSender)
 		return currentManagerAddress
 	}
@@ -0,0 +1,56 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package alien
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/token/core/types"
+)
+
+// SimSealer exposes the single signer of a simulated network to the external
+// tests, which can't import the simulator itself.
+type SimSealer struct {
+	node *simNode
+}
+
+// NewSimSealer creates a simulated network with a single signer of the given key.
+func NewSimSealer(t *testing.T, key *ecdsa.PrivateKey) *SimSealer {
+	return &SimSealer{node: newSimNetworkWithKeys(t, []*ecdsa.PrivateKey{key}).nodes[0]}
+}
+
+// Engine returns the engine of the signer.
+func (s *SimSealer) Engine() *Alien {
+	return s.node.engine
+}
+
+// Prepare assembles the next header of the signer for the given slot, the vanity
+// byte allowing distinct headers for the same slot.
+func (s *SimSealer) Prepare(vanity byte, slot uint64) (*types.Header, error) {
+	header, err := s.node.prepare(s.node.head, vanity)
+	if err != nil {
+		return nil, err
+	}
+	header.Time = slot
+	return header, nil
+}
+
+// Seal runs the engine's sealer on the header on top of the signer's chain.
+func (s *SimSealer) Seal(header *types.Header, results chan<- *types.Block, stop <-chan struct{}) error {
+	return s.node.engine.Seal(s.node, types.NewBlockWithHeader(header), results, stop)
+}
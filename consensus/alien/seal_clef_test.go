@@ -0,0 +1,133 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package alien_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/token/accounts"
+	"github.com/token/accounts/keystore"
+	"github.com/token/common"
+	"github.com/token/common/hexutil"
+	"github.com/token/consensus/alien"
+	"github.com/token/core/types"
+	"github.com/token/crypto"
+	"github.com/token/signer/core"
+	"github.com/token/signer/storage"
+)
+
+// approvingUI is a clef UI approving every signing request.
+type approvingUI struct {
+	core.UIClientAPI
+}
+
+func (approvingUI) ApproveSignData(request *core.SignDataRequest) (core.SignDataResponse, error) {
+	return core.SignDataResponse{Approved: true}, nil
+}
+
+func (approvingUI) ShowError(message string) {}
+func (approvingUI) ShowInfo(message string)  {}
+
+// newClefSigner creates a clef signer holding the given key and recording the
+// sealed headers in a double-sign history, returning the engine's signing
+// function backed by it.
+func newClefSigner(t *testing.T, key *ecdsa.PrivateKey) alien.SignerFn {
+	dir, err := ioutil.TempDir("", "alien-clef-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.ImportECDSA(key, "")
+	if err != nil {
+		t.Fatalf("failed to import key: %v", err)
+	}
+	credentials := storage.NewEphemeralStorage()
+	credentials.Put(account.Address.Hex(), "")
+
+	history, err := core.NewSignHistory("")
+	if err != nil {
+		t.Fatalf("failed to create signing history: %v", err)
+	}
+	api := core.NewSignerAPI(accounts.NewManager(&accounts.Config{}, ks), 1, true, approvingUI{}, nil, false, credentials, history)
+
+	return func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return api.SignData(context.Background(), mimeType, common.NewMixedcaseAddress(account.Address), hexutil.Encode(message))
+	}
+}
+
+// Tests that the blocks the worker replaces before their slot arrives are never
+// signed, so that a clef signer refusing to double sign seals the block that is
+// actually published. The worker seals an empty precommit first, interrupting
+// it with the filled block and that one with a resubmitted block holding more
+// transactions, all of them for the same number and slot.
+func TestSealWithClefHistory(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	sealer := alien.NewSimSealer(t, key)
+	signFn := newClefSigner(t, key)
+	sealer.Engine().Authorize(crypto.PubkeyToAddress(key.PublicKey), signFn, nil)
+
+	var (
+		slot    = uint64(time.Now().Unix()) + 2
+		headers []*types.Header
+	)
+	for vanity := byte(0); vanity < 3; vanity++ {
+		header, err := sealer.Prepare(vanity, slot)
+		if err != nil {
+			t.Fatalf("failed to prepare header: %v", err)
+		}
+		headers = append(headers, header)
+	}
+	results := make(chan *types.Block, 1)
+	stop := make(chan struct{})
+	for i, header := range headers {
+		if i > 0 {
+			close(stop) // Interrupt the previous task like the worker's taskLoop
+			stop = make(chan struct{})
+		}
+		if err := sealer.Seal(header, results, stop); err != nil {
+			t.Fatalf("failed to seal header %d: %v", i, err)
+		}
+	}
+	defer close(stop)
+
+	published := headers[len(headers)-1]
+	select {
+	case block := <-results:
+		if have, want := sealer.Engine().SealHash(block.Header()), sealer.Engine().SealHash(published); have != want {
+			t.Fatalf("sealed header mismatch: have %x, want %x", have, want)
+		}
+		signer, err := sealer.Engine().Author(block.Header())
+		if err != nil || signer != crypto.PubkeyToAddress(key.PublicKey) {
+			t.Fatalf("seal signer mismatch: have %x (%v)", signer, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("published block not sealed")
+	}
+	// The replaced blocks were never signed, clef refuses them from now on
+	_, err := signFn(accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}, accounts.MimetypeAlien, alien.AlienRLP(headers[0]))
+	if !errors.Is(err, core.ErrDoubleSign) {
+		t.Errorf("conflicting header error mismatch: have %v, want %v", err, core.ErrDoubleSign)
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package alien
+
+import (
+	"testing"
+)
+
+// Tests that a healthy network seals in-turn without punishing anyone and
+// confirms blocks right behind the head.
+func TestSimulationHealthy(t *testing.T) {
+	net := newSimNetwork(t, 4)
+	net.runLoops(3)
+
+	if !net.converged() {
+		t.Fatal("network did not converge")
+	}
+	for _, n := range net.nodes {
+		if have, want := n.head.Number.Uint64(), uint64(12); have != want {
+			t.Errorf("node %d: head mismatch: have %d, want %d", n.index, have, want)
+		}
+		if len(n.rejected) != 0 {
+			t.Errorf("node %d: rejected headers: %v", n.index, n.rejected)
+		}
+	}
+	snap := net.nodes[0].snapshot()
+	if len(snap.Punished) != 0 {
+		t.Errorf("signers punished: %v", snap.Punished)
+	}
+	if have, want := snap.ConfirmedNumber, snap.Number-1; have != want {
+		t.Errorf("confirmed number mismatch: have %d, want %d", have, want)
+	}
+	for signer, sealed := range net.nodes[0].sealers() {
+		if sealed != 3 {
+			t.Errorf("signer %x sealed %d blocks, want 3", signer, sealed)
+		}
+	}
+}
+
+// Tests that a signer going offline for a few loops is punished for its missed
+// slots, while the rest of the network keeps sealing and confirming, and that
+// the punishment recovers once it seals again.
+func TestSimulationOfflineSigner(t *testing.T) {
+	net := newSimNetwork(t, 4)
+	net.runLoops(2)
+
+	offline := net.nodes[2]
+	net.setOffline(offline.index, true)
+	net.runLoops(2)
+
+	if !net.converged() {
+		t.Fatal("online signers did not converge")
+	}
+	online := net.nodes[0]
+	snap := online.snapshot()
+	punished := snap.Punished[offline.addr]
+	if punished == 0 {
+		t.Fatalf("offline signer not punished: %v", snap.Punished)
+	}
+	for signer, credit := range snap.Punished {
+		if signer != offline.addr {
+			t.Errorf("online signer %x punished: %d", signer, credit)
+		}
+	}
+	if snap.ConfirmedNumber+1 < snap.Number {
+		t.Errorf("confirmations stalled: confirmed %d, head %d", snap.ConfirmedNumber, snap.Number)
+	}
+	// Bring the signer back and ensure it resyncs, seals and recovers
+	sealed := online.sealers()[offline.addr]
+	net.setOffline(offline.index, false)
+	net.runLoops(4)
+
+	if !net.converged() {
+		t.Fatal("network did not converge after the signer came back")
+	}
+	if online.sealers()[offline.addr] <= sealed {
+		t.Error("returning signer did not seal")
+	}
+	if have := online.snapshot().Punished[offline.addr]; have >= punished {
+		t.Errorf("punishment did not recover: have %d, had %d", have, punished)
+	}
+}
+
+// Tests that a partition splitting the signers in halves forks the chain and
+// leaves confirmations without a quorum, and that once healed the network
+// resolves the fork, punishing the signers whose blocks were dropped.
+func TestSimulationPartition(t *testing.T) {
+	net := newSimNetwork(t, 6)
+	net.runLoops(2)
+
+	split := net.nodes[0].head.Number.Uint64()
+	net.partition(0, 1, 2)
+	net.runLoops(2)
+
+	left, right := net.nodes[0], net.nodes[3]
+	for _, n := range net.nodes {
+		side := left
+		if n.index >= 3 {
+			side = right
+		}
+		if n.head.Hash() != side.head.Hash() {
+			t.Errorf("node %d diverged from its side of the partition", n.index)
+		}
+	}
+	if left.head.Hash() == right.head.Hash() {
+		t.Fatal("partitioned halves share the same head")
+	}
+	// Neither half holds more than 2/3 of the signers, so the confirmed number
+	// falls back to the oldest block of the confirmation window.
+	window := net.config.Alien.MaxSignerCount * 2 / 3
+	for _, n := range []*simNode{left, right} {
+		snap := n.snapshot()
+		if have, want := snap.ConfirmedNumber, snap.Number-window; have != want {
+			t.Errorf("node %d: confirmed number mismatch: have %d, want %d", n.index, have, want)
+		}
+	}
+	sealed := left.head.Number.Uint64() - split
+
+	// Heal the network and ensure a single chain wins
+	net.heal()
+	net.runLoops(1)
+
+	if !net.converged() {
+		t.Fatal("network did not converge after healing")
+	}
+	winner := net.nodes[0]
+	snap := winner.snapshot()
+	if have, want := snap.ConfirmedNumber, snap.Number-1; have != want {
+		t.Errorf("confirmations did not resume: have %d, want %d", have, want)
+	}
+	// All canonical blocks sealed during the partition come from a single side,
+	// whose opponents were punished for missing their slots.
+	sides := make(map[bool]bool)
+	for number := split + 1; number <= split+sealed; number++ {
+		sealer := winner.headers[winner.canonical[number]].Coinbase
+		for _, n := range net.nodes {
+			if n.addr == sealer {
+				sides[n.index < 3] = true
+			}
+		}
+	}
+	if len(sides) != 1 {
+		t.Fatalf("canonical chain mixes blocks of both partitions")
+	}
+	punished := 0
+	for _, n := range net.nodes {
+		if (n.index < 3) != sides[true] && snap.Punished[n.addr] > 0 {
+			punished++
+		}
+	}
+	if punished == 0 {
+		t.Errorf("signers of the dropped fork not punished: %v", snap.Punished)
+	}
+}
+
+// Tests that a signer with its clock slightly ahead keeps sealing, while one
+// ahead by more than the future block allowance has its blocks dropped and is
+// punished for missing its slots.
+func TestSimulationClockSkew(t *testing.T) {
+	t.Run("within-allowance", func(t *testing.T) {
+		net := newSimNetwork(t, 4)
+		net.nodes[1].skew = 1
+		net.runLoops(3)
+
+		if !net.converged() {
+			t.Fatal("network did not converge")
+		}
+		snap := net.nodes[0].snapshot()
+		if len(snap.Punished) != 0 {
+			t.Errorf("signers punished: %v", snap.Punished)
+		}
+		if net.nodes[0].sealers()[net.nodes[1].addr] == 0 {
+			t.Error("skewed signer did not seal")
+		}
+	})
+	t.Run("beyond-allowance", func(t *testing.T) {
+		net := newSimNetwork(t, 4)
+		skewed := net.nodes[1]
+		skewed.skew = 2 * simMaxFutureTime
+		net.runLoops(3)
+
+		honest := net.nodes[0]
+		for _, n := range net.nodes {
+			if n != skewed && n.head.Hash() != honest.head.Hash() {
+				t.Errorf("honest node %d diverged", n.index)
+			}
+		}
+		if honest.sealers()[skewed.addr] != 0 {
+			t.Error("blocks of skewed signer accepted")
+		}
+		if len(honest.rejected) == 0 {
+			t.Error("no blocks of skewed signer dropped")
+		}
+		if honest.snapshot().Punished[skewed.addr] == 0 {
+			t.Error("skewed signer not punished")
+		}
+	})
+}
+
+// Tests that a signer sealing conflicting blocks for its slots is detected, and
+// that the network resolves each fork to a single one of them once the next
+// signer extends either.
+func TestSimulationDoubleSign(t *testing.T) {
+	net := newSimNetwork(t, 4)
+	cheater := net.nodes[1]
+	cheater.doubleSign = true
+	net.runLoops(3)
+
+	cheater.doubleSign = false
+	net.runLoops(1)
+
+	if !net.converged() {
+		t.Fatal("network did not converge")
+	}
+	if len(net.equivocations) == 0 {
+		t.Fatal("double signing not detected")
+	}
+	canonical := net.nodes[0]
+	for _, eq := range net.equivocations {
+		if eq.signer != cheater.addr {
+			t.Errorf("honest signer %x detected as double signing", eq.signer)
+		}
+		hash := canonical.canonical[eq.first.Number.Uint64()]
+		if hash != eq.first.Hash() && hash != eq.second.Hash() {
+			t.Errorf("block %d: neither conflicting header canonical", eq.first.Number)
+		}
+	}
+	if punished := canonical.snapshot().Punished; len(punished) != 0 {
+		t.Errorf("signers punished: %v", punished)
+	}
+}
@@ -0,0 +1,580 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package alien
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/token/accounts"
+	"github.com/token/common"
+	"github.com/token/core/rawdb"
+	"github.com/token/core/types"
+	"github.com/token/crypto"
+	"github.com/token/params"
+)
+
+// This file contains an in-process network simulator for the alien engine. Each
+// simulated signer keeps its own header chain and runs the real engine to seal
+// and verify headers, while the simulator drives a virtual clock and injects
+// faults: signers going offline, network partitions, clock skew and double
+// signing. Block bodies and state are not simulated, so the consensus fields a
+// miner would derive from state are left empty.
+
+const (
+	simPeriod = 3 // Block period of the simulated networks
+
+	// simMaxFutureTime is the number of seconds a header may be ahead of the
+	// local clock to be queued for later import instead of being dropped,
+	// mirroring the future block queue of the blockchain.
+	simMaxFutureTime = 30
+)
+
+// simNetwork is a fully meshed network of alien signers.
+type simNetwork struct {
+	t       *testing.T
+	config  *params.ChainConfig
+	genesis *types.Header
+	votes   []*Vote
+	nodes   []*simNode
+	now     uint64          // Virtual wall clock time
+	severed map[[2]int]bool // Links cut by network partitions
+
+	sealed        map[simSlot]*types.Header // Headers sealed per signer and slot
+	equivocations []simEquivocation         // Double signing detected so far
+}
+
+// simSlot identifies a block sealing opportunity of a signer.
+type simSlot struct {
+	signer common.Address
+	number uint64
+	time   uint64
+}
+
+// simEquivocation is a pair of distinct headers sealed by the same signer for
+// the same slot.
+type simEquivocation struct {
+	signer        common.Address
+	first, second *types.Header
+}
+
+// simNode is a signer of the simulated network, implementing the chain reader
+// needed by the engine on top of its local header chain.
+type simNode struct {
+	net    *simNetwork
+	index  int
+	key    *ecdsa.PrivateKey
+	addr   common.Address
+	engine *Alien
+
+	headers   map[common.Hash]*types.Header
+	canonical map[uint64]common.Hash
+	head      *types.Header
+	future    []*types.Header                    // Headers ahead of the local clock
+	confirms  map[uint64]map[common.Address]bool // Confirmations received per block number
+	rejected  map[common.Hash]error              // Headers failing verification
+
+	offline    bool  // Whether the node neither seals nor communicates
+	skew       int64 // Offset of the local clock from the wall clock
+	doubleSign bool  // Whether the node seals two headers per slot
+}
+
+// newSimNetwork creates a network of the given number of genesis signers, all
+// of them online and connected.
+func newSimNetwork(t *testing.T, signers int) *simNetwork {
+	keys := make([]*ecdsa.PrivateKey, signers)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	return newSimNetworkWithKeys(t, keys)
+}
+
+// newSimNetworkWithKeys creates a network of genesis signers with the given keys.
+func newSimNetworkWithKeys(t *testing.T, keys []*ecdsa.PrivateKey) *simNetwork {
+	var (
+		start = uint64(time.Now().Add(-7*24*time.Hour).Unix()) / simPeriod * simPeriod
+		alien = &params.AlienConfig{
+			Period:           simPeriod,
+			Epoch:            defaultEpochLength,
+			MaxSignerCount:   uint64(len(keys)),
+			MinVoterBalance:  big.NewInt(1),
+			GenesisTimestamp: start,
+			TrantorBlock:     big.NewInt(0),
+		}
+		stake = new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether))
+		votes []*Vote
+	)
+	for i := range keys {
+		addr := crypto.PubkeyToAddress(keys[i].PublicKey)
+		alien.SelfVoteSigners = append(alien.SelfVoteSigners, common.UnprefixedAddress(addr))
+		votes = append(votes, &Vote{Voter: addr, Candidate: addr, Stake: stake})
+	}
+	net := &simNetwork{
+		t:      t,
+		config: &params.ChainConfig{ChainID: big.NewInt(1), Alien: alien},
+		genesis: &types.Header{
+			Number:     big.NewInt(0),
+			Time:       start - simPeriod,
+			Difficulty: new(big.Int).Set(defaultDifficulty),
+			UncleHash:  uncleHash,
+			Extra:      make([]byte, extraVanity+extraSeal),
+		},
+		votes:   votes,
+		now:     start - simPeriod,
+		severed: make(map[[2]int]bool),
+		sealed:  make(map[simSlot]*types.Header),
+	}
+	for i, key := range keys {
+		net.nodes = append(net.nodes, net.newNode(i, key))
+	}
+	return net
+}
+
+// newNode creates a signer starting from the genesis header.
+func (net *simNetwork) newNode(index int, key *ecdsa.PrivateKey) *simNode {
+	n := &simNode{
+		net:       net,
+		index:     index,
+		key:       key,
+		addr:      crypto.PubkeyToAddress(key.PublicKey),
+		engine:    New(net.config.Alien, rawdb.NewMemoryDatabase()),
+		headers:   map[common.Hash]*types.Header{net.genesis.Hash(): net.genesis},
+		canonical: map[uint64]common.Hash{0: net.genesis.Hash()},
+		head:      net.genesis,
+		confirms:  make(map[uint64]map[common.Address]bool),
+		rejected:  make(map[common.Hash]error),
+	}
+	n.engine.Authorize(n.addr, func(account accounts.Account, mimeType string, message []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(message), key)
+	}, nil)
+
+	// The genesis votes are fed into the first snapshot when sealing block 1
+	if _, err := n.engine.snapshot(n, 0, net.genesis.Hash(), nil, net.votes, defaultLoopCntRecalculateSigners); err != nil {
+		net.t.Fatalf("node %d: failed to create genesis snapshot: %v", index, err)
+	}
+	return n
+}
+
+// run advances the virtual clock by the given number of block periods, letting
+// every online node import its matured future headers and seal if in-turn.
+func (net *simNetwork) run(periods int) {
+	for i := 0; i < periods; i++ {
+		net.now += simPeriod
+		for _, n := range net.nodes {
+			if !n.offline {
+				n.importFuture()
+			}
+		}
+		for _, n := range net.nodes {
+			if !n.offline {
+				n.seal()
+			}
+		}
+	}
+	// Sealers waiting for a slot up to the next step have delivered their
+	// headers by then, import them so runs end with a consistent view.
+	net.now += simPeriod
+	for _, n := range net.nodes {
+		if !n.offline {
+			n.importFuture()
+		}
+	}
+	net.now -= simPeriod
+}
+
+// runLoops advances the virtual clock by the given number of signer loops.
+func (net *simNetwork) runLoops(loops int) {
+	net.run(loops * int(net.config.Alien.MaxSignerCount))
+}
+
+// connected returns whether two nodes can communicate.
+func (net *simNetwork) connected(a, b *simNode) bool {
+	if a.offline || b.offline {
+		return false
+	}
+	return !net.severed[[2]int{a.index, b.index}]
+}
+
+// partition cuts the links between the given group of nodes and the rest.
+func (net *simNetwork) partition(group ...int) {
+	inside := make(map[int]bool)
+	for _, i := range group {
+		inside[i] = true
+	}
+	for _, a := range net.nodes {
+		for _, b := range net.nodes {
+			if inside[a.index] != inside[b.index] {
+				net.severed[[2]int{a.index, b.index}] = true
+			}
+		}
+	}
+}
+
+// heal restores all links and lets every node sync with its peers.
+func (net *simNetwork) heal() {
+	net.severed = make(map[[2]int]bool)
+	net.sync()
+}
+
+// setOffline takes a node offline or brings it back, syncing it with its peers.
+func (net *simNetwork) setOffline(index int, offline bool) {
+	net.nodes[index].offline = offline
+	if !offline {
+		net.sync()
+	}
+}
+
+// sync exchanges the heads of all connected nodes, like peers do on connect.
+func (net *simNetwork) sync() {
+	for _, a := range net.nodes {
+		for _, b := range net.nodes {
+			if a != b && net.connected(a, b) {
+				b.receive(a.head, a)
+			}
+		}
+	}
+}
+
+// broadcast delivers a header to the peers of its sealer matching the filter.
+func (net *simNetwork) broadcast(from *simNode, header *types.Header, filter func(*simNode) bool) {
+	for _, n := range net.nodes {
+		if n != from && net.connected(from, n) && (filter == nil || filter(n)) {
+			n.receive(header, from)
+		}
+	}
+}
+
+// recordSeal tracks the headers sealed by each signer to detect double signing.
+func (net *simNetwork) recordSeal(header *types.Header) {
+	slot := simSlot{signer: header.Coinbase, number: header.Number.Uint64(), time: header.Time}
+	if first, ok := net.sealed[slot]; ok && first.Hash() != header.Hash() {
+		net.equivocations = append(net.equivocations, simEquivocation{signer: header.Coinbase, first: first, second: header})
+		return
+	}
+	net.sealed[slot] = header
+}
+
+// converged returns whether all online nodes share the same head.
+func (net *simNetwork) converged() bool {
+	var head common.Hash
+	for _, n := range net.nodes {
+		if n.offline {
+			continue
+		}
+		if head == (common.Hash{}) {
+			head = n.head.Hash()
+		} else if n.head.Hash() != head {
+			return false
+		}
+	}
+	return true
+}
+
+// clock returns the local time of the node.
+func (n *simNode) clock() uint64 {
+	return uint64(int64(n.net.now) + n.skew)
+}
+
+// seal assembles a header on top of the local head and seals it if the node is
+// in-turn, broadcasting it to its peers.
+func (n *simNode) seal() {
+	header, err := n.prepare(n.head, 0)
+	if err != nil {
+		n.net.t.Fatalf("node %d: failed to prepare header: %v", n.index, err)
+	}
+	if header.Time >= n.clock()+simPeriod {
+		return // The slot starts in a later step, which will cover it
+	}
+	sealed, err := n.sealHeader(header)
+	if err == errUnauthorized {
+		return // Not in-turn
+	}
+	if err != nil {
+		n.net.t.Fatalf("node %d: failed to seal header: %v", n.index, err)
+	}
+	if _, ok := n.headers[sealed.Hash()]; ok {
+		return // Already sealed this slot on this head
+	}
+	if !n.doubleSign {
+		n.net.recordSeal(sealed)
+		n.insert(sealed)
+		n.net.broadcast(n, sealed, nil)
+		return
+	}
+	// Seal a conflicting header for the same slot and split the network
+	header, err = n.prepare(n.head, 1)
+	if err != nil {
+		n.net.t.Fatalf("node %d: failed to prepare header: %v", n.index, err)
+	}
+	conflict, err := n.sealHeader(header)
+	if err != nil {
+		n.net.t.Fatalf("node %d: failed to seal conflicting header: %v", n.index, err)
+	}
+	n.net.recordSeal(sealed)
+	n.net.recordSeal(conflict)
+	n.insert(sealed)
+	n.net.broadcast(n, sealed, func(peer *simNode) bool { return peer.index%2 == 0 })
+	n.net.broadcast(n, conflict, func(peer *simNode) bool { return peer.index%2 == 1 })
+}
+
+// sealHeader runs the engine's sealer on the header.
+func (n *simNode) sealHeader(header *types.Header) (*types.Header, error) {
+	results := make(chan *types.Block, 1)
+	if err := n.engine.Seal(n, types.NewBlockWithHeader(header), results, nil); err != nil {
+		return nil, err
+	}
+	select {
+	case block := <-results:
+		return block.Header(), nil
+	case <-time.After(time.Second):
+		return nil, fmt.Errorf("sealing timed out")
+	}
+}
+
+// prepare assembles the consensus fields of a header on top of the parent the
+// way Finalize does, including the confirmations received by the node. The
+// vanity byte allows creating distinct headers for the same slot.
+func (n *simNode) prepare(parent *types.Header, vanity byte) (*types.Header, error) {
+	config := n.net.config.Alien
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		Coinbase:   n.addr,
+		Difficulty: new(big.Int).Set(defaultDifficulty),
+		UncleHash:  uncleHash,
+		Time:       parent.Time + config.Period,
+	}
+	if now := n.clock(); header.Time < now {
+		header.Time = now
+	}
+	number := header.Number.Uint64()
+
+	var (
+		parentExtra  HeaderExtra
+		currentExtra HeaderExtra
+	)
+	if number > 1 {
+		if err := decodeHeaderExtra(config, parent.Number, parent.Extra[extraVanity:len(parent.Extra)-extraSeal], &parentExtra); err != nil {
+			return nil, err
+		}
+		currentExtra.SignerQueue = parentExtra.SignerQueue
+		currentExtra.LoopStartTime = parentExtra.LoopStartTime
+
+		var grandParentExtra HeaderExtra
+		if number%config.MaxSignerCount == 1 {
+			grandParent := n.GetHeader(parent.ParentHash, number-2)
+			if err := decodeHeaderExtra(config, grandParent.Number, grandParent.Extra[extraVanity:len(grandParent.Extra)-extraSeal], &grandParentExtra); err != nil {
+				return nil, err
+			}
+		}
+		currentExtra.SignerMissing = getSignerMissingTrantor(parent.Coinbase, header.Coinbase, &parentExtra, &grandParentExtra)
+	}
+	snap, err := n.engine.snapshot(n, number-1, parent.Hash(), nil, nil, defaultLoopCntRecalculateSigners)
+	if err != nil {
+		return nil, err
+	}
+	// Include the confirmations of the signers in the recent signer queues
+	for confirmed, signers := range n.confirms {
+		if confirmed >= number || number-confirmed > config.MaxSignerCount {
+			continue
+		}
+		for signer := range signers {
+			currentExtra.CurrentBlockConfirmations = append(currentExtra.CurrentBlockConfirmations, Confirmation{
+				Signer:      signer,
+				BlockNumber: new(big.Int).SetUint64(confirmed),
+			})
+		}
+	}
+	sort.Slice(currentExtra.CurrentBlockConfirmations, func(i, j int) bool {
+		a, b := currentExtra.CurrentBlockConfirmations[i], currentExtra.CurrentBlockConfirmations[j]
+		if c := a.BlockNumber.Cmp(b.BlockNumber); c != 0 {
+			return c < 0
+		}
+		return a.Signer.Hash().Big().Cmp(b.Signer.Hash().Big()) < 0
+	})
+	currentExtra.ConfirmedBlockNumber = snap.getLastConfirmedBlockNumber(currentExtra.CurrentBlockConfirmations).Uint64()
+
+	if number == 1 {
+		currentExtra.LoopStartTime = config.GenesisTimestamp
+		for i := 0; i < int(config.MaxSignerCount); i++ {
+			currentExtra.SignerQueue = append(currentExtra.SignerQueue, common.Address(config.SelfVoteSigners[i%len(config.SelfVoteSigners)]))
+		}
+	} else if number%config.MaxSignerCount == 0 {
+		currentExtra.LoopStartTime = currentExtra.LoopStartTime + config.Period*config.MaxSignerCount
+		if currentExtra.SignerQueue, err = snap.copy().createSignerQueue(); err != nil {
+			return nil, err
+		}
+	}
+	grantProfit, err := snap.calPayProfit(n.engine.db, header)
+	if err != nil {
+		return nil, err
+	}
+	currentExtra.GrantProfitHash = snap.calGrantProfitHash(grantProfit)
+	currentExtra.CoinDataRoot = snap.Coin.Root()
+
+	enc, err := encodeHeaderExtra(config, header.Number, currentExtra)
+	if err != nil {
+		return nil, err
+	}
+	header.Extra = make([]byte, extraVanity, extraVanity+len(enc)+extraSeal)
+	header.Extra[0] = vanity
+	header.Extra = append(header.Extra, enc...)
+	header.Extra = append(header.Extra, make([]byte, extraSeal)...)
+	return header, nil
+}
+
+// receive handles a header delivered by a peer, fetching its missing ancestors
+// from the peer and queueing it if it is ahead of the local clock.
+func (n *simNode) receive(header *types.Header, from *simNode) {
+	if _, ok := n.headers[header.Hash()]; ok {
+		return
+	}
+	if _, ok := n.rejected[header.Hash()]; ok {
+		return
+	}
+	// Gather the unknown ancestors, like the downloader would
+	chain := []*types.Header{header}
+	for {
+		parent := chain[len(chain)-1]
+		if _, ok := n.headers[parent.ParentHash]; ok {
+			break
+		}
+		ancestor := from.headers[parent.ParentHash]
+		if ancestor == nil {
+			return
+		}
+		chain = append(chain, ancestor)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !n.enqueue(chain[i]) {
+			return
+		}
+	}
+}
+
+// enqueue imports a header or queues it if it is from the near future, dropping
+// it if too far ahead. It returns whether the header was imported.
+func (n *simNode) enqueue(header *types.Header) bool {
+	if now := n.clock(); header.Time > now {
+		if header.Time <= now+simMaxFutureTime {
+			n.future = append(n.future, header)
+		} else {
+			n.rejected[header.Hash()] = fmt.Errorf("header %d ahead of local clock by %ds", header.Number, header.Time-now)
+		}
+		return false
+	}
+	return n.importHeader(header)
+}
+
+// importFuture imports the queued headers which matured.
+func (n *simNode) importFuture() {
+	queued := n.future
+	n.future = nil
+
+	sort.Slice(queued, func(i, j int) bool { return queued[i].Number.Cmp(queued[j].Number) < 0 })
+	for _, header := range queued {
+		if _, ok := n.headers[header.ParentHash]; !ok {
+			n.future = append(n.future, header)
+			continue
+		}
+		if _, ok := n.headers[header.Hash()]; !ok {
+			n.enqueue(header)
+		}
+	}
+}
+
+// importHeader verifies a header with the engine and inserts it.
+func (n *simNode) importHeader(header *types.Header) bool {
+	if _, ok := n.headers[header.Hash()]; ok {
+		return true
+	}
+	if err := n.engine.VerifyHeader(n, header, true); err != nil {
+		n.rejected[header.Hash()] = err
+		return false
+	}
+	n.net.recordSeal(header)
+	n.insert(header)
+	return true
+}
+
+// insert adds a verified header to the local chain, switching to it if longer,
+// and confirms the new head.
+func (n *simNode) insert(header *types.Header) {
+	n.headers[header.Hash()] = header
+	if header.Number.Cmp(n.head.Number) <= 0 {
+		return
+	}
+	// Rewrite the canonical chain up to the common ancestor
+	for i := header.Number.Uint64() + 1; i <= n.head.Number.Uint64(); i++ {
+		delete(n.canonical, i)
+	}
+	for h := header; n.canonical[h.Number.Uint64()] != h.Hash(); h = n.headers[h.ParentHash] {
+		n.canonical[h.Number.Uint64()] = h.Hash()
+	}
+	n.head = header
+
+	// Send a confirmation of the new head to the reachable signers
+	number := header.Number.Uint64()
+	for _, peer := range n.net.nodes {
+		if peer == n || n.net.connected(n, peer) {
+			if peer.confirms[number] == nil {
+				peer.confirms[number] = make(map[common.Address]bool)
+			}
+			peer.confirms[number][n.addr] = true
+		}
+	}
+}
+
+// snapshot returns the snapshot at the head of the node.
+func (n *simNode) snapshot() *Snapshot {
+	snap, err := n.engine.snapshot(n, n.head.Number.Uint64(), n.head.Hash(), nil, nil, defaultLoopCntRecalculateSigners)
+	if err != nil {
+		n.net.t.Fatalf("node %d: failed to retrieve head snapshot: %v", n.index, err)
+	}
+	return snap
+}
+
+// sealers returns the number of canonical headers sealed by each signer.
+func (n *simNode) sealers() map[common.Address]int {
+	sealers := make(map[common.Address]int)
+	for number := uint64(1); number <= n.head.Number.Uint64(); number++ {
+		sealers[n.headers[n.canonical[number]].Coinbase]++
+	}
+	return sealers
+}
+
+func (n *simNode) Config() *params.ChainConfig  { return n.net.config }
+func (n *simNode) CurrentHeader() *types.Header { return n.head }
+
+func (n *simNode) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := n.headers[hash]; header != nil && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+func (n *simNode) GetHeaderByNumber(number uint64) *types.Header {
+	return n.headers[n.canonical[number]]
+}
+
+func (n *simNode) GetHeaderByHash(hash common.Hash) *types.Header {
+	return n.headers[hash]
+}
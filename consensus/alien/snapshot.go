@@ -19,6 +19,7 @@
 package alien
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/hashicorp/golang-lru"
@@ -29,6 +30,8 @@ import (
 	"github.com/token/log"
 	"github.com/token/params"
 	"github.com/token/rlp"
+	"github.com/token/tracing"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/sha3"
 	"math/big"
 	"sort"
@@ -230,7 +233,11 @@ var SCCurrentBlockReward = map[uint64]map[uint64]uint64{
 
 // newSnapshot creates a new snapshot with the specified startup parameters. only ever use if for
 // the genesis block.
-func newSnapshot(config *params.AlienConfig, sigcache *lru.ARCCache, hash common.Hash, votes []*Vote, lcrs uint64,db ethdb.Database) *Snapshot {
+func newSnapshot(config *params.AlienConfig, sigcache *lru.ARCCache, hash common.Hash, votes []*Vote, lcrs uint64,db ethdb.Database) (*Snapshot, error) {
+	// All the lock parameters below are derived from the block period
+	if config.Period == 0 {
+		return nil, errInvalidPeriod
+	}
 
 	snap := &Snapshot{
 		config:          config,
@@ -266,7 +273,7 @@ func newSnapshot(config *params.AlienConfig, sigcache *lru.ARCCache, hash common
 		PofHarvest:     big.NewInt(0),
 		Revenue:         NewLockProfitSnap(),
 		SystemConfig: SystemParameter{
-			ExchRate:       10000,
+			ExchRate:       defaultExchRate,
 			OffLine:        10000,
 			Deposit:        make(map[uint32]*big.Int),
 			QosConfig:      make(map[uint32]uint32),
@@ -336,9 +343,11 @@ func newSnapshot(config *params.AlienConfig, sigcache *lru.ARCCache, hash common
 	snap.SystemConfig.Deposit[sscEnumPosWithinCommitPeriod] = new(big.Int).Set(posWithinCommitPeriod)
 	snap.SystemConfig.Deposit[sscEnumPofWithinBasePricePeriod] = new(big.Int).Set(pofDefaultBasePrice)
 	snap.SystemConfig.Deposit[sscEnumPofServicePeriod] = new(big.Int).Set(posCommitPeriod)
-
+	if err := snap.applyGenesisSystemConfig(config.SystemConfig); err != nil {
+		return nil, err
+	}
 	snap.Coin,_ = NewCoin(common.Hash{},db)
-	return snap
+	return snap, nil
 }
 
 // loadSnapshot loads an existing snapshot from the database.
@@ -774,11 +783,17 @@ func (s *Snapshot) copy() *Snapshot {
 
 // apply creates a new authorization snapshot by applying the given headers to
 // the original one.
-func (s *Snapshot) apply(headers []*types.Header, db ethdb.Database) (*Snapshot, error) {
+func (s *Snapshot) apply(headers []*types.Header, db ethdb.Database) (_ *Snapshot, err error) {
 	// Allow passing in no headers for cleaner code
 	if len(headers) == 0 {
 		return s, nil
 	}
+	_, span := tracing.Start(context.Background(), "alien.snapshot.apply",
+		tracing.Uint64("block.number", headers[0].Number.Uint64()), attribute.Int("headers", len(headers)))
+	defer func() {
+		tracing.SetError(span, err)
+		span.End()
+	}()
 	// Sanity check that the headers can be applied
 	for i := 0; i < len(headers)-1; i++ {
 		if headers[i+1].Number.Uint64() != headers[i].Number.Uint64()+1 {
@@ -905,7 +920,7 @@ func (s *Snapshot) apply(headers []*types.Header, db ethdb.Database) (*Snapshot,
 	snap.Hash = headers[len(headers)-1].Hash()
 	snap.Revenue.Number = snap.Number
 	snap.Revenue.Hash = snap.Hash
-	err := snap.verifyTallyCnt()
+	err = snap.verifyTallyCnt()
 	if err != nil {
 		return nil, err
 	}
@@ -22,6 +22,7 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"math/big"
+	"reflect"
 	"testing"
 
 	"github.com/token/common"
@@ -1144,4 +1145,92 @@ func TestVoting(t *testing.T) {
 		}
 
 	}
-}
\ No newline at end of file
+}
+// Tests that system parameters configured in the genesis spec override the
+// built-in defaults of the genesis snapshot.
+func TestGenesisSystemConfig(t *testing.T) {
+	manager := common.HexToAddress("0x0000000000000000000000000000000000001337")
+	config := &params.AlienConfig{
+		Period:          3,
+		MinVoterBalance: big.NewInt(1),
+		SystemConfig: &params.AlienSystemConfig{
+			Manager:          &manager,
+			SystemManager:    &manager,
+			CandidateDeposit: big.NewInt(42),
+			PofLock:          &params.AlienLockConfig{LockPeriod: 30, ReleasePeriod: 60, Interval: 3},
+		},
+	}
+	snap, err := newSnapshot(config, nil, common.Hash{}, nil, 0, rawdb.NewMemoryDatabase())
+	if err != nil {
+		t.Fatalf("failed to create genesis snapshot: %v", err)
+	}
+
+	if have := snap.SystemConfig.ManagerAddress[sscEnumSystem]; have != manager {
+		t.Errorf("system manager mismatch: have %x, want %x", have, manager)
+	}
+	if have := snap.SystemConfig.ManagerAddress[sscEnumExchRate]; have != managerAddressExchRate {
+		t.Errorf("exchange rate manager mismatch: have %x, want %x", have, managerAddressExchRate)
+	}
+	if have := snap.SystemConfig.Deposit[0]; have.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("candidate deposit mismatch: have %v, want 42", have)
+	}
+	if have, want := *snap.SystemConfig.LockParameters[sscEnumPofLock], (LockParameter{LockPeriod: 10, RlsPeriod: 20, Interval: 1}); have != want {
+		t.Errorf("pof lock mismatch: have %+v, want %+v", have, want)
+	}
+	if have := snap.SystemConfig.LockParameters[sscEnumRwdLock].LockPeriod; have != rewardLockParamPeriod/3 {
+		t.Errorf("reward lock mismatch: have %d, want %d", have, rewardLockParamPeriod/3)
+	}
+	if have := (&Alien{config: config}).managerOfManagers(); have != manager {
+		t.Errorf("manager of managers mismatch: have %x, want %x", have, manager)
+	}
+}
+
+// Tests that the exported defaults describe the genesis snapshot built without
+// any system config override.
+func TestDefaultSystemConfig(t *testing.T) {
+	config := &params.AlienConfig{Period: 3, MinVoterBalance: big.NewInt(1)}
+	want, err := newSnapshot(config, nil, common.Hash{}, nil, 0, rawdb.NewMemoryDatabase())
+	if err != nil {
+		t.Fatalf("failed to create genesis snapshot: %v", err)
+	}
+	config.SystemConfig = DefaultSystemConfig()
+	have, err := newSnapshot(config, nil, common.Hash{}, nil, 0, rawdb.NewMemoryDatabase())
+	if err != nil {
+		t.Fatalf("failed to create configured genesis snapshot: %v", err)
+	}
+
+	if !reflect.DeepEqual(have.SystemConfig, want.SystemConfig) {
+		t.Errorf("system config mismatch:\nhave %+v\nwant %+v", have.SystemConfig, want.SystemConfig)
+	}
+}
+
+// Tests that genesis system configs the block based parameters can't be derived
+// from are rejected instead of crashing the genesis snapshot creation.
+func TestInvalidGenesisSystemConfig(t *testing.T) {
+	tests := []struct {
+		period uint64
+		config *params.AlienSystemConfig
+		valid  bool
+	}{
+		{3, nil, true},
+		{3, DefaultSystemConfig(), true},
+		{0, nil, false},
+		{0, DefaultSystemConfig(), false},
+		{3, &params.AlienSystemConfig{CandidateDeposit: big.NewInt(-1)}, false},
+		{3, &params.AlienSystemConfig{PosCommitPeriod: big.NewInt(-1)}, false},
+		{3, &params.AlienSystemConfig{PofLock: &params.AlienLockConfig{LockPeriod: 30}}, true},
+		{3, &params.AlienSystemConfig{PofLock: &params.AlienLockConfig{LockPeriod: 30, ReleasePeriod: 60, Interval: 2}}, false},
+		{3, &params.AlienSystemConfig{RewardLock: &params.AlienLockConfig{ReleasePeriod: 60, Interval: 61}}, false},
+		{1, &params.AlienSystemConfig{CandidateLock: &params.AlienLockConfig{LockPeriod: 1 << 32}}, false},
+	}
+	for i, tt := range tests {
+		config := &params.AlienConfig{Period: tt.period, MinVoterBalance: big.NewInt(1), SystemConfig: tt.config}
+		snap, err := newSnapshot(config, nil, common.Hash{}, nil, 0, rawdb.NewMemoryDatabase())
+		if tt.valid && (err != nil || snap == nil) {
+			t.Errorf("test %d: valid config rejected: %v", i, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("test %d: invalid config accepted", i)
+		}
+	}
+}
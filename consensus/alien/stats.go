@@ -0,0 +1,118 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package alien
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/token/common"
+	"github.com/token/consensus"
+	"github.com/token/core/types"
+)
+
+// SignerStatsExtra is the alien specific part of the signer status.
+type SignerStatsExtra struct {
+	Candidate bool          `json:"candidate"`          // Whether the local signer is a candidate
+	Punished  uint64        `json:"punished"`           // Punish credit accumulated by missing seals
+	Pledge    *big.Int      `json:"pledge"`             // PoS pledge of the local signer (own and entrusted)
+	PofMiner  *PofMinerStat `json:"pofMiner,omitempty"` // PoF pledge status, nil if not a PoF miner
+}
+
+// PofMinerStat is the pledge status of a PoF miner.
+type PofMinerStat struct {
+	Active    uint64   `json:"active"`
+	Status    uint64   `json:"status"` // 1 normal 2 exit
+	Pledge    *big.Int `json:"pledge"`
+	Bandwidth uint64   `json:"bandwidth"`
+	Price     *big.Int `json:"price"`
+}
+
+// SignerStats implements consensus.StatsEngine, returning the status of the
+// authorized signer on top of the given header. Missed slots are the ones the
+// blocks of the current loop punished the signer for.
+func (a *Alien) SignerStats(chain consensus.ChainHeaderReader, header *types.Header) (*consensus.SignerStats, error) {
+	snap, err := a.snapshot(chain, header.Number.Uint64(), header.Hash(), nil, nil, defaultLoopCntRecalculateSigners)
+	if err != nil {
+		return nil, err
+	}
+	a.lock.RLock()
+	signer := a.signer
+	a.lock.RUnlock()
+
+	stats := &consensus.SignerStats{
+		Engine:    "alien",
+		Signer:    signer,
+		Signers:   make([]common.Address, 0, len(snap.Signers)),
+		Confirmed: snap.ConfirmedNumber,
+	}
+	for _, s := range snap.Signers {
+		stats.Signers = append(stats.Signers, *s)
+	}
+	if signer == (common.Address{}) {
+		return stats, nil
+	}
+	if next := header.Time + snap.config.Period; next >= snap.LoopStartTime {
+		stats.InTurn = snap.inturn(signer, next)
+	}
+	extra := &SignerStatsExtra{
+		Candidate: snap.isCandidate(signer),
+		Punished:  snap.Punished[signer],
+		Pledge:    new(big.Int),
+	}
+	if stats.Missed, err = missedSlots(chain, header, snap, signer); err != nil {
+		return nil, err
+	}
+	if pledge, ok := snap.PosPledge[signer]; ok && pledge.TotalAmount != nil {
+		extra.Pledge.Set(pledge.TotalAmount)
+	}
+	if pledge, ok := snap.PofPledge[signer]; ok {
+		extra.PofMiner = &PofMinerStat{
+			Active:    pledge.Active,
+			Status:    pledge.PledgeStatus,
+			Pledge:    pledge.PledgeAmount,
+			Bandwidth: pledge.Bandwidth,
+			Price:     pledge.PofPrice,
+		}
+	}
+	stats.Extra = extra
+	return stats, nil
+}
+
+// missedSlots counts the slots the signer is recorded as missing by the blocks
+// of the current loop, walking back from the given header.
+func missedSlots(chain consensus.ChainHeaderReader, header *types.Header, snap *Snapshot, signer common.Address) (uint64, error) {
+	var missed uint64
+	for i := 0; i < len(snap.Signers) && header.Number.Sign() > 0 && header.Time >= snap.LoopStartTime; i++ {
+		if len(header.Extra) < extraVanity+extraSeal {
+			return 0, errors.New("extra-data too short")
+		}
+		var extra HeaderExtra
+		if err := decodeHeaderExtra(snap.config, header.Number, header.Extra[extraVanity:len(header.Extra)-extraSeal], &extra); err != nil {
+			return 0, err
+		}
+		for _, addr := range extra.SignerMissing {
+			if addr == signer {
+				missed++
+			}
+		}
+		if header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1); header == nil {
+			return 0, consensus.ErrUnknownAncestor
+		}
+	}
+	return missed, nil
+}
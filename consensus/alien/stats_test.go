@@ -0,0 +1,87 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package alien
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/token/common"
+	"github.com/token/consensus"
+	"github.com/token/core/types"
+	"github.com/token/params"
+)
+
+// statsChainReader is a header chain only serving headers by hash.
+type statsChainReader struct {
+	consensus.ChainHeaderReader
+	headers map[common.Hash]*types.Header
+}
+
+func (r *statsChainReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	return r.headers[hash]
+}
+
+// Tests that the missed slots of a signer are counted from the blocks of the
+// current loop only.
+func TestMissedSlots(t *testing.T) {
+	var (
+		config = &params.AlienConfig{Period: 3}
+		signer = common.Address{0x01}
+		other  = common.Address{0x02}
+		chain  = &statsChainReader{headers: make(map[common.Hash]*types.Header)}
+		parent = &types.Header{Number: big.NewInt(0)}
+	)
+	chain.headers[parent.Hash()] = parent
+
+	// Blocks 1-2 belong to the previous loop, 3-6 to the current one
+	missing := [][]common.Address{
+		{signer}, {signer, other}, {}, {signer}, {other}, {signer, signer},
+	}
+	for i, missed := range missing {
+		extra, err := encodeHeaderExtra(config, big.NewInt(int64(i+1)), HeaderExtra{SignerMissing: missed})
+		if err != nil {
+			t.Fatalf("failed to encode header extra: %v", err)
+		}
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     big.NewInt(int64(i + 1)),
+			Time:       uint64(i+1) * config.Period,
+			Extra:      append(append(make([]byte, extraVanity), extra...), make([]byte, extraSeal)...),
+		}
+		chain.headers[header.Hash()] = header
+		parent = header
+	}
+	snap := &Snapshot{
+		config:        config,
+		Signers:       []*common.Address{&signer, &other, &signer, &other, &signer, &other},
+		LoopStartTime: 3 * config.Period,
+	}
+	missed, err := missedSlots(chain, parent, snap, signer)
+	if err != nil {
+		t.Fatalf("failed to count missed slots: %v", err)
+	}
+	if missed != 3 {
+		t.Errorf("missed slots mismatch: have %d, want %d", missed, 3)
+	}
+	// The walk is bounded by the length of the loop
+	snap.LoopStartTime = 0
+	snap.Signers = snap.Signers[:2]
+	if missed, _ = missedSlots(chain, parent, snap, signer); missed != 2 {
+		t.Errorf("bounded missed slots mismatch: have %d, want %d", missed, 2)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package alien
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/token/common"
+	"github.com/token/consensus"
+	"github.com/token/core/types"
+)
+
+// IsSystemTransaction implements consensus.SystemTxEngine. Block confirmations
+// ("ufo:1:event:confirm:123"), side chain confirmations ("ufo:1:sc:confirm:...")
+// and PoF flow reports ("token:1:pofrpten:...") are treated as system
+// transactions, but only if the sender is allowed to submit them according to
+// the snapshot of the current head. Anybody else using the same payload is
+// handled as an ordinary transaction.
+func (a *Alien) IsSystemTransaction(chain consensus.ChainHeaderReader, tx *types.Transaction, sender common.Address) bool {
+	kind := systemTxKind(tx.Data())
+	if kind == systemTxNone {
+		return false
+	}
+	snap := a.systemTxSnapshot(chain)
+	if snap == nil {
+		return false
+	}
+	switch kind {
+	case systemTxConfirm:
+		// Confirmations are sent by the signer to itself (see worker.sendConfirmTx)
+		return tx.To() != nil && *tx.To() == sender && snap.isCandidate(sender)
+	case systemTxSCConfirm:
+		return snap.isCandidate(sender)
+	case systemTxPofReport:
+		_, ok := snap.PofPledge[sender]
+		return ok
+	}
+	return false
+}
+
+// systemTxSnapshot returns the snapshot of the current head, retrieving it once
+// per head since the miner and the transaction pool classify every pending
+// transaction against it.
+func (a *Alien) systemTxSnapshot(chain consensus.ChainHeaderReader) *Snapshot {
+	head := chain.CurrentHeader()
+	if head == nil {
+		return nil
+	}
+	hash := head.Hash()
+
+	a.systemLock.Lock()
+	defer a.systemLock.Unlock()
+
+	if a.systemSnap != nil && a.systemSnap.Hash == hash {
+		return a.systemSnap
+	}
+	snap, err := a.snapshot(chain, head.Number.Uint64(), hash, nil, nil, defaultLoopCntRecalculateSigners)
+	if err != nil || snap == nil {
+		return nil
+	}
+	a.systemSnap = snap
+	return snap
+}
+
+// IsCustomTx reports whether the transaction payload is one of the custom
+// transactions processed by the engine, prefixed with "ufo:", "token:" or "SSC:".
+func IsCustomTx(data []byte) bool {
+	txDataInfo := strings.SplitN(string(data), ":", ufoMinSplitLen)
+	if len(txDataInfo) < ufoMinSplitLen {
+		return false
+	}
+	switch txDataInfo[posPrefix] {
+	case ufoPrefix, tokenPrefix, sscPrefix:
+		return true
+	}
+	return false
+}
+
+// ConfirmedNumber returns the block number confirmed by a block confirmation
+// ("ufo:1:event:confirm:123"), or false if the payload isn't one.
+func ConfirmedNumber(data []byte) (uint64, bool) {
+	if systemTxKind(data) != systemTxConfirm {
+		return 0, false
+	}
+	txDataInfo := strings.Split(string(data), ":")
+	if len(txDataInfo) <= posEventConfirmNumber {
+		return 0, false
+	}
+	number, err := strconv.ParseUint(txDataInfo[posEventConfirmNumber], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return number, true
+}
+
+const (
+	systemTxNone = iota
+	systemTxConfirm
+	systemTxSCConfirm
+	systemTxPofReport
+)
+
+// systemTxKind classifies the custom tx payload without touching the snapshot,
+// so the common case of user transactions is rejected cheaply.
+func systemTxKind(data []byte) int {
+	if len(data) < len(ufoPrefix) {
+		return systemTxNone
+	}
+	txDataInfo := strings.Split(string(data), ":")
+	if len(txDataInfo) < ufoMinSplitLen || txDataInfo[posVersion] != ufoVersion {
+		return systemTxNone
+	}
+	switch txDataInfo[posPrefix] {
+	case ufoPrefix:
+		if len(txDataInfo) <= ufoMinSplitLen || txDataInfo[posEventConfirm] != ufoEventConfirm {
+			return systemTxNone
+		}
+		switch txDataInfo[posCategory] {
+		case ufoCategoryEvent:
+			return systemTxConfirm
+		case ufoCategorySC:
+			return systemTxSCConfirm
+		}
+	case tokenPrefix:
+		if txDataInfo[posCategory] == tokenEventPofReportEn {
+			return systemTxPofReport
+		}
+	}
+	return systemTxNone
+}
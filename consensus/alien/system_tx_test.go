@@ -0,0 +1,53 @@
+package alien
+
+import "testing"
+
+func TestSystemTxKind(t *testing.T) {
+	tests := []struct {
+		data string
+		kind int
+	}{
+		{"ufo:1:event:confirm:123", systemTxConfirm},
+		{"ufo:1:sc:confirm:0x01:12:34:loop:charging", systemTxSCConfirm},
+		{"token:1:pofrpten:1:0x01|0x02", systemTxPofReport},
+		{"ufo:1:event:vote", systemTxNone},
+		{"ufo:2:event:confirm:123", systemTxNone},
+		{"token:1:pofReq:0x01:100", systemTxNone},
+		{"SSC:1:Deposit:10:0", systemTxNone},
+		{"ufo", systemTxNone},
+		{"", systemTxNone},
+	}
+	for i, tt := range tests {
+		if kind := systemTxKind([]byte(tt.data)); kind != tt.kind {
+			t.Errorf("test %d (%q): kind mismatch: have %d, want %d", i, tt.data, kind, tt.kind)
+		}
+	}
+}
+
+func TestCustomTxClassifiers(t *testing.T) {
+	tests := []struct {
+		data      string
+		custom    bool
+		confirmed uint64
+		confirm   bool
+	}{
+		{"ufo:1:event:confirm:123", true, 123, true},
+		{"ufo:1:event:confirm:abc", true, 0, false},
+		{"ufo:1:sc:confirm:0x01:12:34:loop:charging", true, 0, false},
+		{"ufo:1:event:vote", true, 0, false},
+		{"token:1:pofReq:0x01:100", true, 0, false},
+		{"SSC:1:Deposit:10:0", true, 0, false},
+		{"foo:1:event:confirm:123", false, 0, false},
+		{"ufo:1", false, 0, false},
+		{"", false, 0, false},
+	}
+	for i, tt := range tests {
+		if custom := IsCustomTx([]byte(tt.data)); custom != tt.custom {
+			t.Errorf("test %d (%q): custom mismatch: have %v, want %v", i, tt.data, custom, tt.custom)
+		}
+		number, ok := ConfirmedNumber([]byte(tt.data))
+		if number != tt.confirmed || ok != tt.confirm {
+			t.Errorf("test %d (%q): confirmation mismatch: have %d %v, want %d %v", i, tt.data, number, ok, tt.confirmed, tt.confirm)
+		}
+	}
+}
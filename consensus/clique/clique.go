@@ -601,6 +601,30 @@ func (c *Clique) Authorize(signer common.Address, signFn SignerFn) {
 	c.signFn = signFn
 }
 
+// SignerStats implements consensus.StatsEngine, returning the status of the
+// authorized signer on top of the given header. Clique has no finality and does
+// not track missed slots, so the head is reported as confirmed.
+func (c *Clique) SignerStats(chain consensus.ChainHeaderReader, header *types.Header) (*consensus.SignerStats, error) {
+	snap, err := c.snapshot(chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.RLock()
+	signer := c.signer
+	c.lock.RUnlock()
+
+	stats := &consensus.SignerStats{
+		Engine:    "clique",
+		Signer:    signer,
+		Signers:   snap.signers(),
+		Confirmed: header.Number.Uint64(),
+	}
+	if _, authorized := snap.Signers[signer]; authorized {
+		stats.InTurn = snap.inturn(header.Number.Uint64()+1, signer)
+	}
+	return stats, nil
+}
+
 // Seal implements consensus.Engine, attempting to create a sealed block using
 // the local signing credentials.
 func (c *Clique) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
@@ -112,3 +112,41 @@ func TestReimportMirroredState(t *testing.T) {
 		t.Fatalf("chain head mismatch: have %d, want %d", head, 3)
 	}
 }
+
+func TestSignerStats(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		engine = New(params.AllCliqueProtocolChanges.Clique, db)
+	)
+	genspec := &core.Genesis{
+		ExtraData: make([]byte, extraVanity+common.AddressLength+extraSeal),
+		BaseFee:   big.NewInt(params.InitialBaseFee),
+	}
+	copy(genspec.ExtraData[extraVanity:], addr[:])
+	genspec.MustCommit(db)
+
+	chain, _ := core.NewBlockChain(db, nil, params.AllCliqueProtocolChanges, engine, vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	// Without an authorized signer only the signer set is reported
+	stats, err := engine.SignerStats(chain, chain.CurrentHeader())
+	if err != nil {
+		t.Fatalf("failed to retrieve signer stats: %v", err)
+	}
+	if len(stats.Signers) != 1 || stats.Signers[0] != addr {
+		t.Errorf("signers mismatch: have %v, want [%v]", stats.Signers, addr)
+	}
+	if stats.InTurn {
+		t.Errorf("unauthorized node reported in turn")
+	}
+	// The only signer is always in turn
+	engine.Authorize(addr, nil)
+	if stats, err = engine.SignerStats(chain, chain.CurrentHeader()); err != nil {
+		t.Fatalf("failed to retrieve signer stats: %v", err)
+	}
+	if stats.Signer != addr || !stats.InTurn {
+		t.Errorf("signer status mismatch: have %v (in turn %v), want %v (in turn true)", stats.Signer, stats.InTurn, addr)
+	}
+}
@@ -163,6 +163,58 @@ type Engine interface {
 	VerifyHeaderExtra(chain ChainHeaderReader, header *types.Header, verifyExtra []byte) error
 }
 
+// SystemTxEngine is an optional interface for consensus engines whose signers
+// exchange consensus data (block confirmations, reports) through ordinary
+// transactions. Transactions identified by the engine are given their own lane
+// in the transaction pool and reserved space in sealed blocks, independent of
+// the gas price they pay.
+type SystemTxEngine interface {
+	// IsSystemTransaction reports whether the transaction, sent by the given
+	// account, carries consensus data on top of the current chain head.
+	IsSystemTransaction(chain ChainHeaderReader, tx *types.Transaction, sender common.Address) bool
+}
+
+// SignerStats is the sealing status of the local signer as seen by a voting
+// based consensus engine. It is reported to monitoring services like ethstats.
+type SignerStats struct {
+	Engine    string           `json:"engine"`          // Name of the consensus engine
+	Signer    common.Address   `json:"signer"`          // Local signing account, zero if not sealing
+	Signers   []common.Address `json:"signers"`         // Signer queue of the current round
+	InTurn    bool             `json:"inTurn"`          // Whether the local signer is in turn for the next block
+	Missed    uint64           `json:"missed"`          // Slots missed by the local signer
+	Confirmed uint64           `json:"confirmed"`       // Highest block number confirmed by the signers
+	Extra     interface{}      `json:"extra,omitempty"` // Engine specific details
+}
+
+// StatsEngine is an optional interface for consensus engines able to report the
+// status of the local signer.
+type StatsEngine interface {
+	// SignerStats returns the status of the local signer on top of the given header.
+	SignerStats(chain ChainHeaderReader, header *types.Header) (*SignerStats, error)
+}
+
+// BlockAudit is the record of the punishments and payouts of a block, as seen by
+// a voting based consensus engine. It is appended to the node's audit log.
+type BlockAudit struct {
+	Missed  []common.Address `json:"missed,omitempty"`  // Signers punished for missing their slots
+	Payouts []Payout         `json:"payouts,omitempty"` // Rewards credited and profits granted by the block
+}
+
+// Payout is an amount credited to an account by a block.
+type Payout struct {
+	Kind   string         `json:"kind"` // Engine specific kind of the payout
+	Code   uint32         `json:"code"` // Engine specific subtype of the payout
+	Target common.Address `json:"target"`
+	Amount *big.Int       `json:"amount"`
+}
+
+// AuditEngine is an optional interface for consensus engines able to report the
+// punishments and payouts recorded in a block.
+type AuditEngine interface {
+	// BlockAudit returns the punishments and payouts recorded in the header.
+	BlockAudit(header *types.Header) (*BlockAudit, error)
+}
+
 // PoW is a consensus engine based on proof-of-work.
 type PoW interface {
 	Engine
@@ -18,6 +18,7 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -44,7 +45,9 @@ import (
 	"github.com/token/metrics"
 	"github.com/token/params"
 	"github.com/token/rlp"
+	"github.com/token/tracing"
 	"github.com/token/trie"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -129,6 +132,8 @@ type CacheConfig struct {
 	TrieTimeLimit       time.Duration // Time limit after which to flush the current in-memory trie to disk
 	SnapshotLimit       int           // Memory allowance (MB) to use for caching snapshot entries in memory
 	Preimages           bool          // Whether to store preimage of trie key to the disk
+	StateScheme         string        // Scheme used to store the state trie nodes, hash-based if empty
+	StateHistory        uint64        // Number of recent states the path-based scheme can be rolled back to
 
 	SnapshotWait bool // Wait for snapshot construction on startup. TODO(karalabe): This is a dirty hack for testing, nuke it
 }
@@ -225,15 +230,20 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	txLookupCache, _ := lru.New(txLookupCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
 
+	if err := checkStateScheme(db, cacheConfig.StateScheme); err != nil {
+		return nil, err
+	}
 	bc := &BlockChain{
 		chainConfig: chainConfig,
 		cacheConfig: cacheConfig,
 		db:          db,
 		triegc:      prque.New(nil),
 		stateCache: state.NewDatabaseWithConfig(db, &trie.Config{
-			Cache:     cacheConfig.TrieCleanLimit,
-			Journal:   cacheConfig.TrieCleanJournal,
-			Preimages: cacheConfig.Preimages,
+			Cache:        cacheConfig.TrieCleanLimit,
+			Journal:      cacheConfig.TrieCleanJournal,
+			Preimages:    cacheConfig.Preimages,
+			Scheme:       cacheConfig.StateScheme,
+			StateHistory: cacheConfig.StateHistory,
 		}),
 		quit:           make(chan struct{}),
 		shouldPreserve: shouldPreserve,
@@ -524,6 +534,13 @@ func (bc *BlockChain) SetHeadBeyondRoot(head uint64, root common.Hash) (uint64,
 					if root != (common.Hash{}) && !beyondRoot && newHeadBlock.Root() == root {
 						beyondRoot, rootNumber = true, newHeadBlock.NumberU64()
 					}
+					// The path-based scheme can roll the persisted state back to
+					// the recent blocks, making their state available again
+					if triedb := bc.stateCache.TrieDB(); triedb.Recoverable(newHeadBlock.Root()) {
+						if err := triedb.Recover(newHeadBlock.Root()); err != nil {
+							log.Error("Failed to roll back state", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash(), "err", err)
+						}
+					}
 					if _, err := state.New(newHeadBlock.Root(), bc.stateCache, bc.snaps); err != nil {
 						log.Trace("Block state missing, rewinding further", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash())
 						if pivot == nil || newHeadBlock.NumberU64() > *pivot {
@@ -700,6 +717,39 @@ func (bc *BlockChain) StateCache() state.Database {
 	return bc.stateCache
 }
 
+// CommitState flushes the state trie with the given root from the trie cache
+// to disk, in sync with block imports.
+func (bc *BlockChain) CommitState(root common.Hash) error {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	return bc.stateCache.TrieDB().Commit(root, false, nil)
+}
+
+// ArchiveMode returns whether the chain keeps every historical state, never
+// garbage collecting the trie nodes.
+func (bc *BlockChain) ArchiveMode() bool {
+	return bc.cacheConfig.TrieDirtyDisabled
+}
+
+// checkStateScheme ensures the state stored in the database uses the configured
+// trie node scheme. A database holding the genesis state only is converted.
+func checkStateScheme(db ethdb.Database, scheme string) error {
+	if scheme == "" {
+		scheme = rawdb.HashScheme
+	}
+	stored := rawdb.ReadStateScheme(db)
+	if stored == "" || stored == scheme {
+		return nil
+	}
+	head := rawdb.ReadHeadBlockHash(db)
+	if number := rawdb.ReadHeaderNumber(db, head); number != nil && *number == 0 {
+		log.Info("Converting genesis state", "from", stored, "to", scheme)
+		return state.ConvertStateScheme(db, rawdb.ReadHeader(db, head, 0).Root, scheme)
+	}
+	return fmt.Errorf("state stored with the %s scheme, run 'nbn db migrate-state %s' to use the %s scheme", stored, scheme, scheme)
+}
+
 // Reset purges the entire blockchain, restoring it to its genesis state.
 func (bc *BlockChain) Reset() error {
 	return bc.ResetWithGenesisBlock(bc.genesisBlock)
@@ -968,6 +1018,8 @@ func (bc *BlockChain) GetUnclesInChain(block *types.Block, length int) []*types.
 
 // TrieNode retrieves a blob of data associated with a trie node
 // either from ephemeral in-memory cache, or from persistent storage.
+// Under the path-based scheme persisted nodes can't be retrieved by hash
+// and trie.ErrHashLookup is returned.
 func (bc *BlockChain) TrieNode(hash common.Hash) ([]byte, error) {
 	return bc.stateCache.TrieDB().Node(hash)
 }
@@ -1015,7 +1067,16 @@ func (bc *BlockChain) Stop() {
 	//  - HEAD:     So we don't need to reprocess any blocks in the general case
 	//  - HEAD-1:   So we don't do large reorgs if our HEAD becomes an uncle
 	//  - HEAD-127: So we have a hard limit on the number of blocks reexecuted
-	if !bc.cacheConfig.TrieDirtyDisabled {
+	//
+	// The path-based scheme can only persist a single state, the head one, and
+	// relies on its history to roll back to the earlier ones.
+	if bc.stateCache.TrieDB().Scheme() == rawdb.PathScheme {
+		root := bc.CurrentBlock().Root()
+		log.Info("Writing cached state to disk", "block", bc.CurrentBlock().Number(), "hash", bc.CurrentBlock().Hash(), "root", root)
+		if err := bc.stateCache.TrieDB().Commit(root, true, nil); err != nil {
+			log.Error("Failed to commit recent state trie", "err", err)
+		}
+	} else if !bc.cacheConfig.TrieDirtyDisabled {
 		triedb := bc.stateCache.TrieDB()
 
 		for _, offset := range []uint64{0, 1, TriesInMemory - 1} {
@@ -1482,8 +1543,14 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	}
 	triedb := bc.stateCache.TrieDB()
 
-	// If we're running an archive node, always flush
-	if bc.cacheConfig.TrieDirtyDisabled {
+	// The path-based scheme keeps the recent states as diff layers and persists
+	// the older ones itself, overwriting the stale nodes
+	if triedb.Scheme() == rawdb.PathScheme {
+		if err := triedb.CapLayers(root, TriesInMemory); err != nil {
+			return NonStatTy, err
+		}
+	} else if bc.cacheConfig.TrieDirtyDisabled {
+		// If we're running an archive node, always flush
 		if err := triedb.Commit(root, false, nil); err != nil {
 			return NonStatTy, err
 		}
@@ -1674,6 +1741,10 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 	// Start a parallel signature recovery (signer will fluke on fork transition, minimal perf loss)
 	senderCacher.recoverFromBlocks(types.MakeSigner(bc.chainConfig, chain[0].Number()), chain)
 
+	ctx, span := tracing.Start(context.Background(), "core.insertChain",
+		tracing.Uint64("block.number", chain[0].NumberU64()), attribute.Int("blocks", len(chain)))
+	defer span.End()
+
 	var (
 		stats     = insertStats{startTime: mclock.Now()}
 		lastCanon *types.Block
@@ -1696,7 +1767,7 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 	defer close(abort)
 
 	// Peek the error for the first block to decide the directing import logic
-	it := newInsertIterator(chain, results, bc.validator)
+	it := newInsertIterator(ctx, chain, results, bc.validator)
 
 	block, err := it.next()
 
@@ -1864,7 +1935,10 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		}
 		// Process block using the parent state as reference point
 		substart := time.Now()
+		_, stage := tracing.Start(ctx, "execute", tracing.Uint64("block.number", block.NumberU64()), attribute.Int("txs", len(block.Transactions())))
 		receipts, logs, usedGas, err := bc.processor.Process(block, statedb, bc.vmConfig,verifySeals)
+		tracing.SetError(stage, err)
+		stage.End()
 		if err != nil {
 			bc.reportBlock(block, receipts, err)
 			atomic.StoreUint32(&followupInterrupt, 1)
@@ -1886,7 +1960,11 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 		// Validate the state using the default validator
 		substart = time.Now()
 
-		if err := bc.validator.ValidateState(block, statedb, receipts, usedGas); err != nil {
+		_, stage = tracing.Start(ctx, "validate", tracing.Uint64("block.number", block.NumberU64()))
+		err = bc.validator.ValidateState(block, statedb, receipts, usedGas)
+		tracing.SetError(stage, err)
+		stage.End()
+		if err != nil {
 			bc.reportBlock(block, receipts, err)
 			atomic.StoreUint32(&followupInterrupt, 1)
 			return it.index, err
@@ -1901,7 +1979,10 @@ func (bc *BlockChain) insertChain(chain types.Blocks, verifySeals bool) (int, er
 
 		// Write the block to the chain and get the status.
 		substart = time.Now()
+		_, stage = tracing.Start(ctx, "write", tracing.Uint64("block.number", block.NumberU64()))
 		status, err := bc.writeBlockWithState(block, receipts, logs, statedb, false)
+		tracing.SetError(stage, err)
+		stage.End()
 		atomic.StoreUint32(&followupInterrupt, 1)
 		if err != nil {
 			return it.index, err
@@ -17,12 +17,14 @@
 package core
 
 import (
+	"context"
 	"time"
 
 	"github.com/token/common"
 	"github.com/token/common/mclock"
 	"github.com/token/core/types"
 	"github.com/token/log"
+	"github.com/token/tracing"
 )
 
 // insertStats tracks and reports on block insertion.
@@ -80,7 +82,8 @@ func (st *insertStats) report(chain []*types.Block, index int, dirty common.Stor
 
 // insertIterator is a helper to assist during chain import.
 type insertIterator struct {
-	chain types.Blocks // Chain of blocks being iterated over
+	ctx   context.Context // Context carrying the import's span
+	chain types.Blocks    // Chain of blocks being iterated over
 
 	results <-chan error // Verification result sink from the consensus engine
 	errors  []error      // Header verification errors for the blocks
@@ -91,8 +94,9 @@ type insertIterator struct {
 
 // newInsertIterator creates a new iterator based on the given blocks, which are
 // assumed to be a contiguous chain.
-func newInsertIterator(chain types.Blocks, results <-chan error, validator Validator) *insertIterator {
+func newInsertIterator(ctx context.Context, chain types.Blocks, results <-chan error, validator Validator) *insertIterator {
 	return &insertIterator{
+		ctx:       ctx,
 		chain:     chain,
 		results:   results,
 		errors:    make([]error, 0, len(chain)),
@@ -111,14 +115,22 @@ func (it *insertIterator) next() (*types.Block, error) {
 	}
 	// Advance the iterator and wait for verification result if not yet done
 	it.index++
+	block := it.chain[it.index]
+
+	_, span := tracing.Start(it.ctx, "verify", tracing.Uint64("block.number", block.NumberU64()))
+	defer span.End()
+
 	if len(it.errors) <= it.index {
 		it.errors = append(it.errors, <-it.results)
 	}
 	if it.errors[it.index] != nil {
-		return it.chain[it.index], it.errors[it.index]
+		tracing.SetError(span, it.errors[it.index])
+		return block, it.errors[it.index]
 	}
 	// Block header valid, run body validation and return
-	return it.chain[it.index], it.validator.ValidateBody(it.chain[it.index])
+	err := it.validator.ValidateBody(block)
+	tracing.SetError(span, err)
+	return block, err
 }
 
 // peek returns the next block in the iterator, along with any potential validation
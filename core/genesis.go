@@ -178,9 +178,10 @@ func SetupGenesisBlockWithOverride(db ethdb.Database, genesis *Genesis, override
 		return genesis.Config, block.Hash(), nil
 	}
 	// We have the genesis block in database(perhaps in ancient database)
-	// but the corresponding state is missing.
+	// but the corresponding state is missing. The path-based scheme doesn't
+	// retain the genesis state once the chain progressed, skip the check.
 	header := rawdb.ReadHeader(db, stored, 0)
-	if _, err := state.New(header.Root, state.NewDatabaseWithConfig(db, nil), nil); err != nil {
+	if _, err := state.New(header.Root, state.NewDatabaseWithConfig(db, nil), nil); err != nil && rawdb.ReadStateScheme(db) != rawdb.PathScheme {
 		if genesis == nil {
 			genesis = DefaultGenesisBlock()
 		}
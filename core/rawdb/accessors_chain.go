@@ -252,6 +252,25 @@ func WriteTxIndexTail(db ethdb.KeyValueWriter, number uint64) {
 	}
 }
 
+// ReadTraceIndexTail retrieves the number of the oldest block whose call traces
+// have been indexed. If the entry is non-existent the indexer never ran.
+func ReadTraceIndexTail(db ethdb.KeyValueReader) *uint64 {
+	data, _ := db.Get(traceIndexTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteTraceIndexTail stores the number of the oldest block whose call traces
+// have been indexed into database.
+func WriteTraceIndexTail(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(traceIndexTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the trace index tail", "err", err)
+	}
+}
+
 // ReadFastTxLookupLimit retrieves the tx lookup limit used in fast sync.
 func ReadFastTxLookupLimit(db ethdb.KeyValueReader) *uint64 {
 	data, _ := db.Get(fastTxLookupLimitKey)
@@ -631,6 +650,35 @@ func DeleteReceipts(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
 	}
 }
 
+// HasBlockTraces verifies the existence of the call traces of a block.
+func HasBlockTraces(db ethdb.KeyValueReader, hash common.Hash, number uint64) bool {
+	has, err := db.Has(blockTracesKey(number, hash))
+	if !has || err != nil {
+		return false
+	}
+	return true
+}
+
+// ReadBlockTraces retrieves the encoded call traces of a block.
+func ReadBlockTraces(db ethdb.KeyValueReader, hash common.Hash, number uint64) []byte {
+	data, _ := db.Get(blockTracesKey(number, hash))
+	return data
+}
+
+// WriteBlockTraces stores the encoded call traces of a block into the database.
+func WriteBlockTraces(db ethdb.KeyValueWriter, hash common.Hash, number uint64, traces []byte) {
+	if err := db.Put(blockTracesKey(number, hash), traces); err != nil {
+		log.Crit("Failed to store block traces", "err", err)
+	}
+}
+
+// DeleteBlockTraces removes the call traces of a block.
+func DeleteBlockTraces(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
+	if err := db.Delete(blockTracesKey(number, hash)); err != nil {
+		log.Crit("Failed to delete block traces", "err", err)
+	}
+}
+
 // ReadBlock retrieves an entire block corresponding to the hash, assembling it
 // back from the stored header and body. If either the header or body could not
 // be retrieved nil is returned.
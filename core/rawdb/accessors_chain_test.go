@@ -29,6 +29,7 @@ import (
 
 	"github.com/token/common"
 	"github.com/token/core/types"
+	"github.com/token/ethdb"
 	"github.com/token/params"
 	"github.com/token/rlp"
 	"golang.org/x/crypto/sha3"
@@ -496,6 +497,87 @@ func TestAncientStorage(t *testing.T) {
 	}
 }
 
+// Tests that the history of ancient blocks can be pruned, optionally keeping the
+// headers, and that the pruned database can be reopened.
+func TestPruneHistory(t *testing.T) {
+	frdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	defer os.RemoveAll(frdir)
+
+	kvdb := NewMemoryDatabase()
+	db, err := NewDatabaseWithFreezer(kvdb, frdir, "", false)
+	if err != nil {
+		t.Fatalf("failed to create database with ancient backend: %v", err)
+	}
+	var blocks []*types.Block
+	for i := int64(0); i < 4; i++ {
+		block := types.NewBlockWithHeader(&types.Header{
+			Number:      big.NewInt(i),
+			Extra:       []byte("test block"),
+			UncleHash:   types.EmptyUncleHash,
+			TxHash:      types.EmptyRootHash,
+			ReceiptHash: types.EmptyRootHash,
+		})
+		WriteAncientBlock(db, block, nil, big.NewInt(100))
+		blocks = append(blocks, block)
+	}
+	// Keep the genesis and the head in the key-value store, as a live node does
+	initKeyValueStore := func(kvdb ethdb.KeyValueWriter) {
+		WriteCanonicalHash(kvdb, blocks[0].Hash(), 0)
+		WriteHeaderNumber(kvdb, blocks[3].Hash(), 3)
+		WriteHeadHeaderHash(kvdb, blocks[3].Hash())
+	}
+	initKeyValueStore(kvdb)
+
+	// Prune the bodies of the first two blocks, keeping the headers
+	if err := PruneHistory(db, 2, true); err != nil {
+		t.Fatalf("failed to prune history: %v", err)
+	}
+	if tail := ReadBlockHistoryTail(db); tail != 2 {
+		t.Fatalf("block history tail mismatch: have %d, want 2", tail)
+	}
+	if tail := ReadHeaderHistoryTail(db); tail != 0 {
+		t.Fatalf("header history tail mismatch: have %d, want 0", tail)
+	}
+	for i, block := range blocks {
+		hash, number := block.Hash(), block.NumberU64()
+		if blob := ReadBodyRLP(db, hash, number); (len(blob) > 0) != (i >= 2) {
+			t.Fatalf("block %d: body presence mismatch", i)
+		}
+		if blob := ReadReceiptsRLP(db, hash, number); (len(blob) > 0) != (i >= 2) {
+			t.Fatalf("block %d: receipts presence mismatch", i)
+		}
+		if blob := ReadHeaderRLP(db, hash, number); len(blob) == 0 {
+			t.Fatalf("block %d: header missing", i)
+		}
+	}
+	// Prune the headers too and check the pruning survives a restart
+	if err := PruneHistory(db, 2, false); err != nil {
+		t.Fatalf("failed to prune history: %v", err)
+	}
+	if err := PruneHistory(db, 5, false); err == nil {
+		t.Fatalf("pruned history beyond the ancient store")
+	}
+	db.Close()
+
+	kvdb = NewMemoryDatabase()
+	initKeyValueStore(kvdb)
+	if db, err = NewDatabaseWithFreezer(kvdb, frdir, "", false); err != nil {
+		t.Fatalf("failed to reopen pruned database: %v", err)
+	}
+	defer db.Close()
+	if tail := ReadHeaderHistoryTail(db); tail != 2 {
+		t.Fatalf("header history tail mismatch: have %d, want 2", tail)
+	}
+	for i, block := range blocks {
+		if blob := ReadHeaderRLP(db, block.Hash(), block.NumberU64()); (len(blob) > 0) != (i >= 2) {
+			t.Fatalf("block %d: header presence mismatch", i)
+		}
+	}
+}
+
 func TestCanonicalHashIteration(t *testing.T) {
 	var cases = []struct {
 		from, to uint64
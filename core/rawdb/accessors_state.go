@@ -94,3 +94,28 @@ func DeleteTrieNode(db ethdb.KeyValueWriter, hash common.Hash) {
 		log.Crit("Failed to delete trie node", "err", err)
 	}
 }
+
+// ReadOnlineStatePruning retrieves the database position an interrupted online
+// state pruning has to be resumed from, and whether a pruning is in progress.
+func ReadOnlineStatePruning(db ethdb.KeyValueReader) ([]byte, bool) {
+	data, err := db.Get(onlineStatePruningKey)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// WriteOnlineStatePruning stores the database position reached by a running
+// online state pruning.
+func WriteOnlineStatePruning(db ethdb.KeyValueWriter, position []byte) {
+	if err := db.Put(onlineStatePruningKey, position); err != nil {
+		log.Crit("Failed to store online state pruning progress", "err", err)
+	}
+}
+
+// DeleteOnlineStatePruning deletes the progress of a finished online state pruning.
+func DeleteOnlineStatePruning(db ethdb.KeyValueWriter) {
+	if err := db.Delete(onlineStatePruningKey); err != nil {
+		log.Crit("Failed to delete online state pruning progress", "err", err)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/token/common"
+	"github.com/token/crypto"
+	"github.com/token/ethdb"
+	"github.com/token/log"
+)
+
+// The schemes of the state trie node storage.
+const (
+	// HashScheme stores the trie nodes keyed by their hash. Stale nodes are never
+	// overwritten and must be pruned.
+	HashScheme = "hash"
+
+	// PathScheme stores the trie nodes keyed by their owner and path in the trie.
+	// Every path holds the node of the persisted state only, the stale nodes are
+	// overwritten or deleted as the state advances.
+	PathScheme = "path"
+)
+
+// ReadStateScheme reports the scheme of the state stored in the database, or an
+// empty string if the database holds no chain yet.
+func ReadStateScheme(db ethdb.KeyValueReader) string {
+	if len(ReadTrieNodeByPath(db, common.Hash{}, nil)) != 0 {
+		return PathScheme
+	}
+	if ok, _ := db.Has(persistentStateIDKey); ok {
+		return PathScheme
+	}
+	if ReadHeadBlockHash(db) == (common.Hash{}) {
+		return ""
+	}
+	return HashScheme
+}
+
+// IsHashTrieNode reports whether the database entry is a trie node stored by the
+// hash-based scheme, whose keys may start with the prefixes of the path-based one.
+func IsHashTrieNode(key []byte, value []byte) bool {
+	return len(key) == common.HashLength && bytes.Equal(key, crypto.Keccak256(value))
+}
+
+// ReadTrieNodeByPath retrieves the trie node stored at the given path of the
+// trie of the given owner, the zero owner being the account trie.
+func ReadTrieNodeByPath(db ethdb.KeyValueReader, owner common.Hash, path []byte) []byte {
+	data, _ := db.Get(trieNodeKey(owner, path))
+	return data
+}
+
+// WriteTrieNodeByPath stores the trie node at the given path of the trie of the
+// given owner.
+func WriteTrieNodeByPath(db ethdb.KeyValueWriter, owner common.Hash, path []byte, node []byte) {
+	if err := db.Put(trieNodeKey(owner, path), node); err != nil {
+		log.Crit("Failed to store trie node", "err", err)
+	}
+}
+
+// DeleteTrieNodeByPath deletes the trie node stored at the given path of the trie
+// of the given owner.
+func DeleteTrieNodeByPath(db ethdb.KeyValueWriter, owner common.Hash, path []byte) {
+	if err := db.Delete(trieNodeKey(owner, path)); err != nil {
+		log.Crit("Failed to delete trie node", "err", err)
+	}
+}
+
+// TrieNodePathKey returns the database key of the trie node stored at the given
+// path of the trie of the given owner.
+func TrieNodePathKey(owner common.Hash, path []byte) []byte {
+	return trieNodeKey(owner, path)
+}
+
+// ReadPersistentStateID retrieves the id of the state persisted by the path-based
+// trie database.
+func ReadPersistentStateID(db ethdb.KeyValueReader) uint64 {
+	data, _ := db.Get(persistentStateIDKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WritePersistentStateID stores the id of the state persisted by the path-based
+// trie database.
+func WritePersistentStateID(db ethdb.KeyValueWriter, id uint64) {
+	if err := db.Put(persistentStateIDKey, encodeBlockNumber(id)); err != nil {
+		log.Crit("Failed to store persistent state id", "err", err)
+	}
+}
+
+// DeletePersistentStateID deletes the id of the persisted state, when leaving
+// the path-based scheme.
+func DeletePersistentStateID(db ethdb.KeyValueWriter) {
+	if err := db.Delete(persistentStateIDKey); err != nil {
+		log.Crit("Failed to delete persistent state id", "err", err)
+	}
+}
+
+// ReadStateID retrieves the id of the state with the given root, if it was ever
+// persisted and its history is still retained.
+func ReadStateID(db ethdb.KeyValueReader, root common.Hash) *uint64 {
+	data, _ := db.Get(stateIDKey(root))
+	if len(data) != 8 {
+		return nil
+	}
+	id := binary.BigEndian.Uint64(data)
+	return &id
+}
+
+// WriteStateID stores the id of the state with the given root.
+func WriteStateID(db ethdb.KeyValueWriter, root common.Hash, id uint64) {
+	if err := db.Put(stateIDKey(root), encodeBlockNumber(id)); err != nil {
+		log.Crit("Failed to store state id", "err", err)
+	}
+}
+
+// DeleteStateID deletes the id of the state with the given root.
+func DeleteStateID(db ethdb.KeyValueWriter, root common.Hash) {
+	if err := db.Delete(stateIDKey(root)); err != nil {
+		log.Crit("Failed to delete state id", "err", err)
+	}
+}
+
+// ReadStateHistory retrieves the encoded history reverting the state with the
+// given id to its parent.
+func ReadStateHistory(db ethdb.KeyValueReader, id uint64) []byte {
+	data, _ := db.Get(stateHistoryKey(id))
+	return data
+}
+
+// WriteStateHistory stores the encoded history reverting the state with the
+// given id to its parent.
+func WriteStateHistory(db ethdb.KeyValueWriter, id uint64, history []byte) {
+	if err := db.Put(stateHistoryKey(id), history); err != nil {
+		log.Crit("Failed to store state history", "err", err)
+	}
+}
+
+// DeleteStateHistory deletes the history of the state with the given id.
+func DeleteStateHistory(db ethdb.KeyValueWriter, id uint64) {
+	if err := db.Delete(stateHistoryKey(id)); err != nil {
+		log.Crit("Failed to delete state history", "err", err)
+	}
+}
+
+// DeletePathState deletes all the trie nodes, state ids and histories stored by
+// the path-based scheme, when converting the database to the hash-based one.
+func DeletePathState(db ethdb.KeyValueStore) error {
+	// Drop the scheme markers first, so an interrupted deletion leaves behind
+	// some garbage only
+	batch := db.NewBatch()
+	DeleteTrieNodeByPath(batch, common.Hash{}, nil)
+	DeletePersistentStateID(batch)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	batch.Reset()
+
+	for _, prefix := range [][]byte{TrieNodeAccountPrefix, TrieNodeStoragePrefix, stateIDPrefix, stateHistoryPrefix} {
+		it := db.NewIterator(prefix, nil)
+		for it.Next() {
+			key := it.Key()
+			// The state id prefix is shared with the head markers, match the length
+			if bytes.Equal(prefix, stateIDPrefix) && len(key) != len(stateIDPrefix)+common.HashLength {
+				continue
+			}
+			if bytes.Equal(prefix, stateHistoryPrefix) && len(key) != len(stateHistoryPrefix)+8 {
+				continue
+			}
+			if IsHashTrieNode(key, it.Value()) {
+				continue
+			}
+			batch.Delete(key)
+			if batch.ValueSize() >= ethdb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					it.Release()
+					return err
+				}
+				batch.Reset()
+			}
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
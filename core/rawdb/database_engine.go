@@ -0,0 +1,92 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/token/ethdb"
+	"github.com/token/ethdb/leveldb"
+	"github.com/token/ethdb/pebble"
+	"github.com/token/log"
+)
+
+const (
+	// DBLeveldb is the identifier of the LevelDB key-value store engine.
+	DBLeveldb = "leveldb"
+
+	// DBPebble is the identifier of the Pebble key-value store engine.
+	DBPebble = "pebble"
+)
+
+// DefaultDBEngine is the key-value store engine used for new databases if none
+// is requested explicitly.
+const DefaultDBEngine = DBLeveldb
+
+// PreexistingDatabase checks whether a key-value store already exists in the
+// given directory and returns the engine it was created with, or the empty
+// string if there is none.
+func PreexistingDatabase(path string) string {
+	if _, err := os.Stat(filepath.Join(path, "CURRENT")); err != nil {
+		return "" // No pre-existing db
+	}
+	// Pebble keeps its options in OPTIONS-* files next to the manifest, LevelDB
+	// has no such files
+	if matches, _ := filepath.Glob(filepath.Join(path, "OPTIONS*")); len(matches) > 0 {
+		return DBPebble
+	}
+	return DBLeveldb
+}
+
+// OpenKeyValueStore opens the persistent key-value store in the given directory
+// with the requested engine. If no engine is requested, the one of the existing
+// store is used, or the default for a new one. Requesting an engine different
+// from the one of the existing store is an error.
+func OpenKeyValueStore(engine string, file string, cache int, handles int, namespace string, readonly bool) (ethdb.KeyValueStore, error) {
+	existing := PreexistingDatabase(file)
+	if engine != "" && existing != "" && engine != existing {
+		return nil, fmt.Errorf("db.engine choice was %v but found pre-existing %v database in specified data directory", engine, existing)
+	}
+	if engine == "" {
+		engine = existing
+	}
+	if engine == "" {
+		engine = DefaultDBEngine
+	}
+	switch engine {
+	case DBLeveldb:
+		log.Info("Using leveldb as the backing database")
+		return leveldb.New(file, cache, handles, namespace, readonly)
+	case DBPebble:
+		log.Info("Using pebble as the backing database")
+		return pebble.New(file, cache, handles, namespace, readonly)
+	default:
+		return nil, fmt.Errorf("unknown db.engine %q, want %q or %q", engine, DBLeveldb, DBPebble)
+	}
+}
+
+// NewPebbleDBDatabase creates a persistent key-value database backed by pebble
+// without a freezer moving immutable chain segments into cold storage.
+func NewPebbleDBDatabase(file string, cache int, handles int, namespace string, readonly bool) (ethdb.Database, error) {
+	db, err := pebble.New(file, cache, handles, namespace, readonly)
+	if err != nil {
+		return nil, err
+	}
+	return NewDatabase(db), nil
+}
@@ -15,3 +15,50 @@
 // along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
 
 package rawdb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Tests that the engine of an existing key-value store is detected and that it
+// can't be reopened with a different one.
+func TestKeyValueStoreEngine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rawdb-engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if engine := PreexistingDatabase(dir); engine != "" {
+		t.Fatalf("empty directory detected as %q", engine)
+	}
+	db, err := OpenKeyValueStore("", dir, 0, 0, "", false)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if engine := PreexistingDatabase(dir); engine != DefaultDBEngine {
+		t.Fatalf("engine mismatch: have %q, want %q", engine, DefaultDBEngine)
+	}
+	if _, err := OpenKeyValueStore(DBPebble, dir, 0, 0, "", false); err == nil {
+		t.Fatalf("reopened %s database with pebble", DefaultDBEngine)
+	}
+	if _, err := OpenKeyValueStore("rocksdb", t.TempDir(), 0, 0, "", false); err == nil {
+		t.Fatalf("opened database with unknown engine")
+	}
+	db, err = OpenKeyValueStore(DBLeveldb, dir, 0, 0, "", true)
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	if val, err := db.Get([]byte("key")); err != nil || string(val) != "value" {
+		t.Fatalf("value mismatch: have %q, %v", val, err)
+	}
+}
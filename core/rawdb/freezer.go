@@ -193,6 +193,15 @@ func (f *freezer) AncientSize(kind string) (uint64, error) {
 	return 0, errUnknownTable
 }
 
+// AncientTail returns the number of the first item of the specified category
+// that was not pruned from the freezer.
+func (f *freezer) AncientTail(kind string) (uint64, error) {
+	if table := f.tables[kind]; table != nil {
+		return atomic.LoadUint64(&table.tail), nil
+	}
+	return 0, errUnknownTable
+}
+
 // AppendAncient injects all binary blobs belong to block at the end of the
 // append-only immutable table files.
 //
@@ -260,6 +269,19 @@ func (f *freezer) TruncateAncients(items uint64) error {
 	return nil
 }
 
+// TruncateAncientTail discards the items of the specified category below the
+// provided number, keeping the numbering of the remaining items.
+func (f *freezer) TruncateAncientTail(kind string, tail uint64) error {
+	if f.readonly {
+		return errReadOnly
+	}
+	table := f.tables[kind]
+	if table == nil {
+		return errUnknownTable
+	}
+	return table.truncateTail(tail)
+}
+
 // Sync flushes all data tables to disk.
 func (f *freezer) Sync() error {
 	var errs []error
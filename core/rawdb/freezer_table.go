@@ -21,8 +21,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -78,6 +80,7 @@ type freezerTable struct {
 	// 64-bit aligned fields can be atomic. The struct is guaranteed to be so aligned,
 	// so take advantage of that (https://golang.org/pkg/sync/atomic/#pkg-note-BUG).
 	items uint64 // Number of items stored in the table (including items removed from tail)
+	tail  uint64 // Number of the first item not pruned from the tail of the table
 
 	noCompression bool   // if true, disables snappy compression. Note: does not work retroactively
 	maxFileSize   uint32 // Max file size for data-files
@@ -159,15 +162,7 @@ func newCustomTable(path string, name string, readMeter metrics.Meter, writeMete
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return nil, err
 	}
-	var idxName string
-	if noCompression {
-		// Raw idx
-		idxName = fmt.Sprintf("%s.ridx", name)
-	} else {
-		// Compressed idx
-		idxName = fmt.Sprintf("%s.cidx", name)
-	}
-	offsets, err := openFreezerFileForAppend(filepath.Join(path, idxName))
+	offsets, err := openFreezerFileForAppend(filepath.Join(path, indexFileName(name, noCompression)))
 	if err != nil {
 		return nil, err
 	}
@@ -199,12 +194,29 @@ func newCustomTable(path string, name string, readMeter metrics.Meter, writeMete
 	return tab, nil
 }
 
+// indexFileName returns the name of the index file of a table.
+func indexFileName(name string, noCompression bool) string {
+	if noCompression {
+		// Raw idx
+		return fmt.Sprintf("%s.ridx", name)
+	}
+	// Compressed idx
+	return fmt.Sprintf("%s.cidx", name)
+}
+
 // repair cross checks the head and the index file and truncates them to
 // be in sync with each other after a potential crash / data loss.
 func (t *freezerTable) repair() error {
 	// Create a temporary offset buffer to init files with and read indexEntry into
 	buffer := make([]byte, indexEntrySize)
 
+	// Load the pruned tail and drop any index rewrite interrupted by a crash
+	tail, err := readFreezerTail(t.tailFilePath())
+	if err != nil {
+		return err
+	}
+	os.Remove(t.indexFilePath() + ".tmp")
+
 	// If we've just created the files, initialize the index with the 0 indexEntry
 	stat, err := t.index.Stat()
 	if err != nil {
@@ -239,7 +251,18 @@ func (t *freezerTable) repair() error {
 
 	t.tailId = firstIndex.filenum
 	t.itemOffset = firstIndex.offset
+	if tail < uint64(t.itemOffset) {
+		tail = uint64(t.itemOffset)
+	}
+	t.tail = tail
 
+	// Delete any data files left over by an interrupted tail truncation
+	for num := t.tailId; num > 0; num-- {
+		if err := os.Remove(filepath.Join(t.path, t.fileName(num-1))); err != nil {
+			break
+		}
+		t.logger.Warn("Deleted dangling tail file", "file", num-1)
+	}
 	t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
 	lastIndex.unmarshalBinary(buffer)
 	t.head, err = t.openFile(lastIndex.filenum, openFreezerFileForAppend)
@@ -307,7 +330,14 @@ func (t *freezerTable) repair() error {
 	if err := t.preopen(); err != nil {
 		return err
 	}
-	t.logger.Debug("Chain freezer table opened", "items", t.items, "size", common.StorageSize(t.headBytes))
+	// Finish deleting the data files below the tail if the last truncation was
+	// interrupted before the index was rewritten
+	if t.tail > uint64(t.itemOffset) {
+		if err := t.deleteTailFiles(); err != nil {
+			return err
+		}
+	}
+	t.logger.Debug("Chain freezer table opened", "items", t.items, "tail", t.tail, "size", common.StorageSize(t.headBytes))
 	return nil
 }
 
@@ -393,6 +423,130 @@ func (t *freezerTable) truncate(items uint64) error {
 	return nil
 }
 
+// truncateTail discards all the items below the provided number. The items are
+// hidden at once, but as the index can only skip whole data files, a data file
+// is only deleted when all of its items are discarded.
+func (t *freezerTable) truncateTail(tail uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Ensure the table is still accessible and the tail moves forward
+	if t.index == nil || t.head == nil {
+		return errClosed
+	}
+	if items := atomic.LoadUint64(&t.items); tail > items {
+		return fmt.Errorf("tail beyond table items: tail %d, items %d", tail, items)
+	}
+	if tail <= atomic.LoadUint64(&t.tail) {
+		return nil
+	}
+	// Persist the new tail before touching any data, so an interrupted
+	// truncation can be completed when the table is reopened
+	if err := writeFreezerTail(t.tailFilePath(), tail); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&t.tail, tail)
+	t.logger.Info("Truncating freezer table tail", "tail", tail)
+
+	// Delete the data files below the tail and update the size counter
+	oldSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	if err := t.deleteTailFiles(); err != nil {
+		return err
+	}
+	newSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.sizeGauge.Dec(int64(oldSize - newSize))
+	return nil
+}
+
+// deleteTailFiles rewrites the index to start at the data file holding the tail
+// item and deletes all the data files before it. It assumes that the write-lock
+// is held by the caller.
+func (t *freezerTable) deleteTailFiles() error {
+	var (
+		buffer = make([]byte, indexEntrySize)
+		entry  indexEntry
+		failed error
+	)
+	// readEntry reads the index entry at the given position, the entry at
+	// position n+1 marks the end of the n-th item after the item offset
+	readEntry := func(pos uint64) indexEntry {
+		if _, err := t.index.ReadAt(buffer, int64(pos*indexEntrySize)); err != nil && failed == nil {
+			failed = err
+		}
+		entry.unmarshalBinary(buffer)
+		return entry
+	}
+	var (
+		items = atomic.LoadUint64(&t.items) - uint64(t.itemOffset)
+		tail  = atomic.LoadUint64(&t.tail) - uint64(t.itemOffset)
+		first = atomic.LoadUint32(&t.headId)
+	)
+	if tail < items {
+		first = readEntry(tail + 1).filenum
+	}
+	if first == t.tailId {
+		return failed
+	}
+	// Find the first item stored in the new tail file, it starts at offset zero
+	// as items never cross data files
+	start := uint64(sort.Search(int(tail), func(n int) bool {
+		return readEntry(uint64(n)+1).filenum >= first
+	}))
+	if failed != nil {
+		return failed
+	}
+	// Write the new index into a temporary file and swap it in atomically
+	path := t.indexFilePath()
+	index, err := os.OpenFile(path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	head := indexEntry{filenum: first, offset: t.itemOffset + uint32(start)}
+	if _, err := index.Write(head.marshallBinary()); err != nil {
+		index.Close()
+		return err
+	}
+	stat, err := t.index.Stat()
+	if err != nil {
+		index.Close()
+		return err
+	}
+	from := int64(start+1) * indexEntrySize
+	if _, err := io.Copy(index, io.NewSectionReader(t.index, from, stat.Size()-from)); err != nil {
+		index.Close()
+		return err
+	}
+	if err := index.Sync(); err != nil {
+		index.Close()
+		return err
+	}
+	index.Close()
+
+	t.index.Close()
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	if t.index, err = openFreezerFileForAppend(path); err != nil {
+		return err
+	}
+	// The index no longer references the old files, delete them
+	for num := t.tailId; num < first; num++ {
+		t.releaseFile(num)
+		if err := os.Remove(filepath.Join(t.path, t.fileName(num))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	t.tailId = first
+	t.itemOffset = head.offset
+	return nil
+}
+
 // Close closes all opened files.
 func (t *freezerTable) Close() error {
 	t.lock.Lock()
@@ -421,13 +575,7 @@ func (t *freezerTable) Close() error {
 func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error)) (f *os.File, err error) {
 	var exist bool
 	if f, exist = t.files[num]; !exist {
-		var name string
-		if t.noCompression {
-			name = fmt.Sprintf("%s.%04d.rdat", t.name, num)
-		} else {
-			name = fmt.Sprintf("%s.%04d.cdat", t.name, num)
-		}
-		f, err = opener(filepath.Join(t.path, name))
+		f, err = opener(filepath.Join(t.path, t.fileName(num)))
 		if err != nil {
 			return nil, err
 		}
@@ -436,6 +584,60 @@ func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error
 	return f, err
 }
 
+// fileName returns the name of the data file with the given number.
+func (t *freezerTable) fileName(num uint32) string {
+	if t.noCompression {
+		return fmt.Sprintf("%s.%04d.rdat", t.name, num)
+	}
+	return fmt.Sprintf("%s.%04d.cdat", t.name, num)
+}
+
+// indexFilePath returns the path of the index file of the table.
+func (t *freezerTable) indexFilePath() string {
+	return filepath.Join(t.path, indexFileName(t.name, t.noCompression))
+}
+
+// tailFilePath returns the path of the file tracking the pruned tail of the table.
+func (t *freezerTable) tailFilePath() string {
+	return filepath.Join(t.path, fmt.Sprintf("%s.tail", t.name))
+}
+
+// readFreezerTail loads the pruned tail of a table, zero if it was never pruned.
+func readFreezerTail(path string) (uint64, error) {
+	blob, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(blob) != 8 {
+		return 0, fmt.Errorf("invalid freezer tail file %s", path)
+	}
+	return binary.BigEndian.Uint64(blob), nil
+}
+
+// writeFreezerTail atomically persists the pruned tail of a table.
+func writeFreezerTail(path string, tail uint64) error {
+	blob := make([]byte, 8)
+	binary.BigEndian.PutUint64(blob, tail)
+
+	file, err := os.OpenFile(path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(blob); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	file.Close()
+	return os.Rename(path+".tmp", path)
+}
+
 // releaseFile closes a file, and removes it from the open file cache.
 // Assumes that the caller holds the write lock
 func (t *freezerTable) releaseFile(num uint32) {
@@ -605,8 +807,8 @@ func (t *freezerTable) retrieve(item uint64) ([]byte, error) {
 	if atomic.LoadUint64(&t.items) <= item {
 		return nil, errOutOfBounds
 	}
-	// Ensure the item was not deleted from the tail either
-	if uint64(t.itemOffset) > item {
+	// Ensure the item was not deleted or pruned from the tail either
+	if uint64(t.itemOffset) > item || atomic.LoadUint64(&t.tail) > item {
 		return nil, errOutOfBounds
 	}
 	startOffset, endOffset, filenum, err := t.getBounds(item - uint64(t.itemOffset))
@@ -629,7 +831,7 @@ func (t *freezerTable) retrieve(item uint64) ([]byte, error) {
 // has returns an indicator whether the specified number data
 // exists in the freezer table.
 func (t *freezerTable) has(number uint64) bool {
-	return atomic.LoadUint64(&t.items) > number
+	return atomic.LoadUint64(&t.items) > number && atomic.LoadUint64(&t.tail) <= number
 }
 
 // size returns the total data size in the freezer table.
@@ -692,3 +692,132 @@ func TestAppendTruncateParallel(t *testing.T) {
 		}
 	}
 }
+
+// TestFreezerTruncateTail tests that items below the tail are hidden at once and
+// their data files deleted once no retained item is stored in them.
+func TestFreezerTruncateTail(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("truncate-tail-%d", rand.Uint64())
+
+	// Write 6 x 20 bytes, splitting out into three files
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 6; x++ {
+		f.Append(uint64(x), getChunk(20, x))
+	}
+	check := func(f *freezerTable, tail uint64, items uint64) {
+		t.Helper()
+		for i := uint64(0); i < items; i++ {
+			got, err := f.Retrieve(i)
+			if i < tail {
+				if err == nil || f.has(i) {
+					t.Fatalf("item %d: expected pruned item", i)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("item %d: %v", i, err)
+			}
+			if exp := getChunk(20, int(i)); !bytes.Equal(got, exp) {
+				t.Fatalf("item %d: expected %x got %x", i, exp, got)
+			}
+			if !f.has(i) {
+				t.Fatalf("item %d: expected existing item", i)
+			}
+		}
+	}
+	// Prune into the middle of the second file, only the first can be deleted
+	if err := f.truncateTail(3); err != nil {
+		t.Fatal(err)
+	}
+	check(f, 3, 6)
+	if _, err := os.Stat(filepath.Join(os.TempDir(), fmt.Sprintf("%s.0000.rdat", fname))); !os.IsNotExist(err) {
+		t.Fatalf("expected first data file deleted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(os.TempDir(), fmt.Sprintf("%s.0001.rdat", fname))); err != nil {
+		t.Fatalf("expected second data file kept: %v", err)
+	}
+	if err := f.truncateTail(7); err == nil {
+		t.Fatal("expected error truncating beyond the items")
+	}
+	f.Append(6, getChunk(20, 6))
+	f.Close()
+
+	// Reopen the table and check that the tail and the items are retained
+	if f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true); err != nil {
+		t.Fatal(err)
+	}
+	if f.tail != 3 || f.tailId != 1 || f.itemOffset != 2 {
+		t.Fatalf("tail mismatch: have tail %d, file %d, offset %d", f.tail, f.tailId, f.itemOffset)
+	}
+	check(f, 3, 7)
+
+	// Prune all the items of the table, keeping the head file only
+	if err := f.truncateTail(7); err != nil {
+		t.Fatal(err)
+	}
+	check(f, 7, 7)
+	f.Append(7, getChunk(20, 7))
+	check(f, 7, 8)
+	f.Close()
+}
+
+// TestFreezerTruncateTailRepair tests that a tail truncation interrupted after
+// persisting the new tail is completed when the table is reopened.
+func TestFreezerTruncateTailRepair(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("truncate-tail-repair-%d", rand.Uint64())
+
+	// Write 6 x 20 bytes, splitting out into three files
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 6; x++ {
+		f.Append(uint64(x), getChunk(20, x))
+	}
+	f.Close()
+
+	// Simulate a crash after the tail was written, while rewriting the index
+	if err := writeFreezerTail(filepath.Join(os.TempDir(), fmt.Sprintf("%s.tail", fname)), 4); err != nil {
+		t.Fatal(err)
+	}
+	tmpIndex := filepath.Join(os.TempDir(), fmt.Sprintf("%s.ridx.tmp", fname))
+	if err := ioutil.WriteFile(tmpIndex, []byte{0xde, 0xad}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true); err != nil {
+		t.Fatal(err)
+	}
+	if f.tail != 4 || f.tailId != 2 || f.itemOffset != 4 {
+		t.Fatalf("tail mismatch: have tail %d, file %d, offset %d", f.tail, f.tailId, f.itemOffset)
+	}
+	for i := uint64(0); i < 6; i++ {
+		if _, err := f.Retrieve(i); (err == nil) != (i >= 4) {
+			t.Fatalf("item %d: unexpected retrieval result: %v", i, err)
+		}
+	}
+	f.Close()
+
+	for _, name := range []string{tmpIndex, filepath.Join(os.TempDir(), fmt.Sprintf("%s.0001.rdat", fname))} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("expected %s deleted: %v", name, err)
+		}
+	}
+	// Simulate a crash after the index was rewritten, leaving stale data files
+	stale := filepath.Join(os.TempDir(), fmt.Sprintf("%s.0001.rdat", fname))
+	if err := ioutil.WriteFile(stale, getChunk(40, 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("expected stale data file deleted: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"fmt"
+
+	"github.com/token/ethdb"
+	"github.com/token/log"
+)
+
+// PrunedHistoryError is returned when data is requested of a block whose history
+// was pruned from the ancient store.
+type PrunedHistoryError struct {
+	Kind   string // Kind of the pruned data (header, body, receipts)
+	Number uint64 // Number of the requested block
+	Tail   uint64 // Number of the first block still available
+}
+
+func (e *PrunedHistoryError) Error() string {
+	return fmt.Sprintf("%s of block #%d pruned from history, first available block is #%d", e.Kind, e.Number, e.Tail)
+}
+
+// ErrorCode returns the JSON error code for pruned history.
+func (e *PrunedHistoryError) ErrorCode() int { return 4444 }
+
+// ReadHeaderHistoryTail returns the number of the first block whose header was
+// not pruned from the ancient store, zero if the history is complete.
+func ReadHeaderHistoryTail(db ethdb.AncientReader) uint64 {
+	tail, _ := db.AncientTail(freezerHeaderTable)
+	return tail
+}
+
+// ReadBlockHistoryTail returns the number of the first block whose body and
+// receipts were not pruned from the ancient store, zero if the history is
+// complete.
+func ReadBlockHistoryTail(db ethdb.AncientReader) uint64 {
+	tail, _ := db.AncientTail(freezerBodiesTable)
+	return tail
+}
+
+// PruneHistory discards the bodies and receipts of all the blocks below the given
+// number from the ancient store, along with their transaction lookup entries.
+// Unless keepHeaders is set, the headers, hashes and total difficulties of the
+// blocks are discarded too. Only frozen blocks can be pruned.
+func PruneHistory(db ethdb.Database, tail uint64, keepHeaders bool) error {
+	frozen, err := db.Ancients()
+	if err != nil {
+		return err
+	}
+	if tail > frozen {
+		return fmt.Errorf("history tail #%d beyond the ancient store, frozen blocks: %d", tail, frozen)
+	}
+	// Remove the transaction lookups first, they can't be found without bodies
+	from := uint64(0)
+	if indexed := ReadTxIndexTail(db); indexed != nil {
+		from = *indexed
+	}
+	if from < tail {
+		UnindexTransactions(db, from, tail, nil)
+	}
+	kinds := []string{freezerBodiesTable, freezerReceiptTable}
+	if !keepHeaders {
+		kinds = append(kinds, freezerHashTable, freezerHeaderTable, freezerDifficultyTable)
+	}
+	for _, kind := range kinds {
+		if err := db.TruncateAncientTail(kind, tail); err != nil {
+			return err
+		}
+	}
+	log.Info("Pruned chain history", "tail", tail, "headers", !keepHeaders)
+	return nil
+}
@@ -66,6 +66,16 @@ var (
 	// txIndexTailKey tracks the oldest block whose transactions have been indexed.
 	txIndexTailKey = []byte("TransactionIndexTail")
 
+	// traceIndexTailKey tracks the oldest block whose call traces have been indexed.
+	traceIndexTailKey = []byte("TraceIndexTail")
+
+	// onlineStatePruningKey tracks the progress of an online state pruning.
+	onlineStatePruningKey = []byte("OnlineStatePruning")
+
+	// persistentStateIDKey tracks the id of the state persisted by the path-based
+	// trie database.
+	persistentStateIDKey = []byte("LastStateID")
+
 	// fastTxLookupLimitKey tracks the transaction lookup limit during fast sync.
 	fastTxLookupLimitKey = []byte("FastTransactionLookupLimit")
 
@@ -83,12 +93,18 @@ var (
 
 	blockBodyPrefix     = []byte("b") // blockBodyPrefix + num (uint64 big endian) + hash -> block body
 	blockReceiptsPrefix = []byte("r") // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
+	blockTracesPrefix   = []byte("T") // blockTracesPrefix + num (uint64 big endian) + hash -> block call traces
 
 	txLookupPrefix        = []byte("l") // txLookupPrefix + hash -> transaction/receipt lookup metadata
 	bloomBitsPrefix       = []byte("B") // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
 	SnapshotAccountPrefix = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
 	CodePrefix            = []byte("c") // CodePrefix + code hash -> account code
+	TrieNodeAccountPrefix = []byte("A") // TrieNodeAccountPrefix + hex path -> account trie node
+	TrieNodeStoragePrefix = []byte("O") // TrieNodeStoragePrefix + account hash + hex path -> storage trie node
+
+	stateIDPrefix      = []byte("L") // stateIDPrefix + state root -> state id (uint64 big endian)
+	stateHistoryPrefix = []byte("R") // stateHistoryPrefix + state id (uint64 big endian) -> state history
 
 	preimagePrefix = []byte("secure-key-")      // preimagePrefix + hash -> preimage
 	configPrefix   = []byte("nbn-config-") // config prefix for the db
@@ -177,6 +193,11 @@ func blockReceiptsKey(number uint64, hash common.Hash) []byte {
 	return append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
 }
 
+// blockTracesKey = blockTracesPrefix + num (uint64 big endian) + hash
+func blockTracesKey(number uint64, hash common.Hash) []byte {
+	return append(append(blockTracesPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
 // txLookupKey = txLookupPrefix + hash
 func txLookupKey(hash common.Hash) []byte {
 	return append(txLookupPrefix, hash.Bytes()...)
@@ -226,6 +247,26 @@ func IsCodeKey(key []byte) (bool, []byte) {
 	return false, nil
 }
 
+// trieNodeKey = TrieNodeAccountPrefix + path for account trie nodes, or
+// TrieNodeStoragePrefix + owner + path for storage trie nodes
+func trieNodeKey(owner common.Hash, path []byte) []byte {
+	if owner == (common.Hash{}) {
+		return append(append([]byte{}, TrieNodeAccountPrefix...), path...)
+	}
+	key := append(append([]byte{}, TrieNodeStoragePrefix...), owner.Bytes()...)
+	return append(key, path...)
+}
+
+// stateIDKey = stateIDPrefix + root
+func stateIDKey(root common.Hash) []byte {
+	return append(stateIDPrefix, root.Bytes()...)
+}
+
+// stateHistoryKey = stateHistoryPrefix + id (uint64 big endian)
+func stateHistoryKey(id uint64) []byte {
+	return append(stateHistoryPrefix, encodeBlockNumber(id)...)
+}
+
 // configKey = configPrefix + hash
 func configKey(hash common.Hash) []byte {
 	return append(configPrefix, hash.Bytes()...)
@@ -138,13 +138,22 @@ func (db *cachingDB) OpenTrie(root common.Hash) (Trie, error) {
 
 // OpenStorageTrie opens the storage trie of an account.
 func (db *cachingDB) OpenStorageTrie(addrHash, root common.Hash) (Trie, error) {
-	tr, err := trie.NewSecure(root, db.db)
+	tr, err := trie.NewSecureWithOwner(addrHash, root, db.db)
 	if err != nil {
 		return nil, err
 	}
 	return tr, nil
 }
 
+// committedNodes returns the nodes modified by the last commit of a trie backed
+// by the path-based scheme, nil otherwise.
+func committedNodes(t Trie) *trie.NodeSet {
+	if t, ok := t.(interface{ Committed() *trie.NodeSet }); ok {
+		return t.Committed()
+	}
+	return nil
+}
+
 // CopyTrie returns an independent copy of the given trie.
 func (db *cachingDB) CopyTrie(t Trie) Trie {
 	switch t := t.(type) {
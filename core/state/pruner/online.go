@@ -0,0 +1,482 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/token/common"
+	"github.com/token/common/hexutil"
+	"github.com/token/core/rawdb"
+	"github.com/token/core/state"
+	"github.com/token/core/state/snapshot"
+	"github.com/token/core/types"
+	"github.com/token/ethdb"
+	"github.com/token/log"
+	"github.com/token/metrics"
+	"github.com/token/trie"
+)
+
+const (
+	// onlinePruneLayers is the number of recent snapshot layers whose state is
+	// kept by the online pruner, the bottom-most one being the pruning target.
+	onlinePruneLayers = 128
+
+	// onlineHoldLimit is the maximum time the snapshot diff layers are held while
+	// collecting their changes. The chain can't flatten any layer meanwhile.
+	onlineHoldLimit = time.Minute
+)
+
+var (
+	onlinePrunedNodesMeter   = metrics.NewRegisteredMeter("state/prune/online/nodes", nil)
+	onlinePrunedSizeMeter    = metrics.NewRegisteredMeter("state/prune/online/size", nil)
+	onlinePruneProgressGauge = metrics.NewRegisteredGauge("state/prune/online/progress", nil)
+
+	// errPruningRunning is returned if a pruning is requested while another one
+	// is still running.
+	errPruningRunning = errors.New("state pruning already running")
+
+	// errPathScheme is returned if pruning is requested on a state stored with
+	// the path-based scheme, which deletes the stale trie nodes by itself.
+	errPathScheme = errors.New("state stored with the path scheme needs no pruning")
+
+	// errArchiveMode is returned if pruning is requested on an archive node, which
+	// is meant to keep every historical state.
+	errArchiveMode = errors.New("archive node keeps all historical states")
+
+	// errHoldExceeded is returned if collecting the changes of the snapshot diff
+	// layers takes longer than allowed.
+	errHoldExceeded = errors.New("snapshot layers held for too long")
+)
+
+// Stages of the online pruner.
+const (
+	OnlineStageIdle    = "idle"
+	OnlineStageBloom   = "bloom"
+	OnlineStagePruning = "pruning"
+	OnlineStageDone    = "done"
+	OnlineStageStopped = "stopped"
+	OnlineStageFailed  = "failed"
+)
+
+// OnlineChain is the chain access needed by the online pruner.
+type OnlineChain interface {
+	CurrentBlock() *types.Block
+	Snapshots() *snapshot.Tree
+	StateCache() state.Database
+	CommitState(root common.Hash) error
+	ArchiveMode() bool
+}
+
+// OnlineConfig are the settings of the online pruner.
+type OnlineConfig struct {
+	BloomSize uint64        // Megabytes of memory allocated to the state bloom
+	Throttle  time.Duration // Pause between two deletion batches
+}
+
+// OnlineProgress reports the state of the online pruner.
+type OnlineProgress struct {
+	Stage    string             `json:"stage"`
+	Root     common.Hash        `json:"root"`     // State root kept as the oldest state
+	Position hexutil.Bytes      `json:"position"` // Database key reached by the deletion
+	Percent  float64            `json:"percent"`  // Approximate share of the database scanned
+	Nodes    uint64             `json:"nodes"`    // Number of trie nodes deleted
+	Size     common.StorageSize `json:"size"`     // Size of the deleted trie nodes
+	Started  time.Time          `json:"started"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// OnlinePruner deletes the stale state trie nodes in the background, while the
+// node keeps importing blocks. The workflow is:
+//
+//   - commit the state of the bottom-most diff layer, the oldest state kept, to
+//     disk and collect the nodes changed by the newer layers, holding the
+//     snapshot tree for a bounded time only
+//   - fill the state bloom with the kept state read back from disk, which needs
+//     no snapshot layer, and every node the chain flushes meanwhile
+//   - iterate the database, deleting the trie nodes missing from the bloom in
+//     throttled batches
+//
+// Contract code is never deleted. The deletion progress is persisted, so that a
+// pruning interrupted by a stop, a shutdown or a crash resumes where it left off
+// when restarted, with a fresh bloom.
+type OnlinePruner struct {
+	db     ethdb.Database
+	chain  OnlineChain
+	config OnlineConfig
+
+	progress OnlineProgress
+	quit     chan struct{} // Quit channel of the running pruning, nil if idle or stopping
+	done     chan struct{} // Closed when the running pruning terminates
+	lock     sync.Mutex
+}
+
+// NewOnlinePruner creates an online pruner on top of the given chain. It does
+// nothing until started.
+func NewOnlinePruner(db ethdb.Database, chain OnlineChain, config OnlineConfig) *OnlinePruner {
+	if config.BloomSize < 256 {
+		log.Warn("Sanitizing bloomfilter size", "provided(MB)", config.BloomSize, "updated(MB)", 256)
+		config.BloomSize = 256
+	}
+	return &OnlinePruner{
+		db:       db,
+		chain:    chain,
+		config:   config,
+		progress: OnlineProgress{Stage: OnlineStageIdle},
+	}
+}
+
+// Resume restarts the pruning interrupted by the last shutdown, if any.
+func (p *OnlinePruner) Resume() error {
+	if _, ok := rawdb.ReadOnlineStatePruning(p.db); !ok {
+		return nil
+	}
+	log.Info("Resuming interrupted state pruning")
+	return p.Start()
+}
+
+// Start launches the pruning in the background.
+func (p *OnlinePruner) Start() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.done != nil {
+		return errPruningRunning
+	}
+	if p.chain.Snapshots() == nil {
+		return errors.New("state pruning requires snapshots")
+	}
+	if rawdb.ReadStateScheme(p.db) == rawdb.PathScheme {
+		return errPathScheme
+	}
+	if p.chain.ArchiveMode() {
+		return errArchiveMode
+	}
+	p.quit, p.done = make(chan struct{}), make(chan struct{})
+	p.progress = OnlineProgress{Stage: OnlineStageBloom, Started: time.Now()}
+
+	go p.run(p.quit, p.done)
+	return nil
+}
+
+// Stop interrupts the running pruning, if any, and waits for it to terminate.
+// The pruning resumes where it left off when started again.
+func (p *OnlinePruner) Stop() {
+	p.lock.Lock()
+	quit, done := p.quit, p.done
+	p.quit = nil
+	p.lock.Unlock()
+
+	if quit != nil {
+		close(quit)
+	}
+	if done != nil {
+		<-done
+	}
+}
+
+// Progress returns the state of the running or the last pruning.
+func (p *OnlinePruner) Progress() OnlineProgress {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.progress
+}
+
+// run executes a pruning, reporting its outcome once done.
+func (p *OnlinePruner) run(quit chan struct{}, done chan struct{}) {
+	defer close(done)
+
+	err := p.prune(quit)
+
+	p.lock.Lock()
+	switch {
+	case err == errPruningStopped:
+		p.progress.Stage = OnlineStageStopped
+		log.Info("State pruning stopped", "position", p.progress.Position)
+	case err != nil:
+		p.progress.Stage, p.progress.Error = OnlineStageFailed, err.Error()
+		log.Error("State pruning failed", "err", err)
+	default:
+		p.progress.Stage = OnlineStageDone
+	}
+	p.quit, p.done = nil, nil
+	p.lock.Unlock()
+}
+
+// errPruningStopped is returned internally if the pruning is interrupted.
+var errPruningStopped = errors.New("state pruning stopped")
+
+// prune constructs the state bloom and deletes every trie node missing from it.
+func (p *OnlinePruner) prune(quit chan struct{}) error {
+	stateBloom, err := newStateBloomWithSize(p.config.BloomSize)
+	if err != nil {
+		return err
+	}
+	bloom := &onlineBloom{bloom: stateBloom}
+
+	// Track the nodes flushed by the chain before looking at any state, so all
+	// the nodes of the states newer than the snapshot layers are kept
+	triedb := p.chain.StateCache().TrieDB()
+	triedb.SetWriteHook(bloom.record)
+	defer triedb.SetWriteHook(nil)
+
+	if err := p.fillBloom(bloom, triedb); err != nil {
+		return err
+	}
+	select {
+	case <-quit:
+		return errPruningStopped
+	default:
+	}
+	return p.deleteStale(bloom, quit)
+}
+
+// fillBloom adds the kept state, the nodes of the snapshot layers above it and
+// the genesis state to the bloom.
+func (p *OnlinePruner) fillBloom(bloom *onlineBloom, triedb *trie.Database) error {
+	target, err := p.fillBloomLayers(bloom, triedb)
+	if err != nil {
+		return err
+	}
+	// The kept state was committed to disk, iterate it from there so that the
+	// chain is free to flatten its snapshot layer while the bloom is filled
+	start := time.Now()
+	log.Info("Constructing state bloom", "root", target)
+	if err := extractState(p.db, target, bloom); err != nil {
+		return err
+	}
+	if err := extractGenesis(p.db, bloom); err != nil {
+		return err
+	}
+	log.Info("Constructed state bloom", "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// fillBloomLayers picks the bottom-most snapshot diff layer as the kept state,
+// commits it to disk and adds the nodes changed by the newer layers to the
+// bloom. The snapshot tree is held meanwhile, for a bounded time.
+func (p *OnlinePruner) fillBloomLayers(bloom *onlineBloom, triedb *trie.Database) (common.Hash, error) {
+	snaptree := p.chain.Snapshots()
+	release := snaptree.Hold()
+	defer release()
+
+	head := p.chain.CurrentBlock()
+	layers := snaptree.Snapshots(head.Root(), onlinePruneLayers, true)
+	if len(layers) == 0 {
+		return common.Hash{}, errors.New("no snapshot diff layers available")
+	}
+	target := layers[len(layers)-1].Root()
+
+	// Make sure the kept state is on disk, so that a restart after a crash never
+	// picks a state older than it, which may be partially deleted
+	if err := p.chain.CommitState(target); err != nil {
+		return common.Hash{}, err
+	}
+	if blob := rawdb.ReadTrieNode(p.db, target); len(blob) == 0 {
+		return common.Hash{}, errors.New("state of the bottom-most snapshot layer is not available")
+	}
+	p.lock.Lock()
+	p.progress.Root = target
+	p.lock.Unlock()
+
+	start := time.Now()
+	for _, layer := range layers[:len(layers)-1] {
+		if time.Since(start) > onlineHoldLimit {
+			return common.Hash{}, errHoldExceeded
+		}
+		if err := proveDiffLayer(snaptree, layer, triedb, bloom); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	log.Info("Collected snapshot layer changes", "root", target, "head", head.NumberU64(), "layers", len(layers), "elapsed", common.PrettyDuration(time.Since(start)))
+	return target, nil
+}
+
+// proveDiffLayer adds the trie nodes changed by a snapshot diff layer to the
+// bloom. The nodes of a state differing from its parent all lie on the paths
+// of the modified keys, collected here through their Merkle proofs.
+func proveDiffLayer(snaptree *snapshot.Tree, layer snapshot.Snapshot, triedb *trie.Database, bloom ethdb.KeyValueWriter) error {
+	accounts, storage, err := snaptree.Diff(layer.Root())
+	if err != nil {
+		return err
+	}
+	accTrie, err := trie.New(layer.Root(), triedb)
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		if err := accTrie.Prove(account[:], 0, bloom); err != nil {
+			return err
+		}
+	}
+	for account, slots := range storage {
+		data, err := layer.Account(account)
+		if err != nil {
+			return err
+		}
+		if data == nil || len(data.Root) == 0 || common.BytesToHash(data.Root) == emptyRoot {
+			continue
+		}
+		storageTrie, err := trie.New(common.BytesToHash(data.Root), triedb)
+		if err != nil {
+			return err
+		}
+		for _, slot := range slots {
+			if err := storageTrie.Prove(slot[:], 0, bloom); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteStale iterates the database from the persisted position and deletes
+// the trie nodes missing from the bloom.
+func (p *OnlinePruner) deleteStale(bloom *onlineBloom, quit chan struct{}) error {
+	position, _ := rawdb.ReadOnlineStatePruning(p.db)
+	rawdb.WriteOnlineStatePruning(p.db, position)
+
+	p.lock.Lock()
+	p.progress.Stage, p.progress.Position = OnlineStagePruning, common.CopyBytes(position)
+	p.lock.Unlock()
+
+	var (
+		count  uint64
+		size   common.StorageSize
+		start  = time.Now()
+		logged = time.Now()
+		keys   [][]byte
+		iter   = p.db.NewIterator(nil, position)
+	)
+	defer func() {
+		if iter != nil {
+			iter.Release()
+		}
+	}()
+
+	// flush deletes the collected keys, checking them against the bloom again
+	// to skip the nodes the chain wrote in the meantime
+	flush := func(next []byte) error {
+		batch := p.db.NewBatch()
+		bloom.lock.Lock()
+		for _, key := range keys {
+			if ok, _ := bloom.bloom.Contain(key); !ok {
+				batch.Delete(key)
+			}
+		}
+		rawdb.WriteOnlineStatePruning(batch, next)
+		err := batch.Write()
+		bloom.lock.Unlock()
+		if err != nil {
+			return err
+		}
+		keys = keys[:0]
+
+		percent := float64(binary.BigEndian.Uint64(common.RightPadBytes(next, 8))) / math.MaxUint64 * 100
+		onlinePruneProgressGauge.Update(int64(percent))
+
+		p.lock.Lock()
+		p.progress.Position, p.progress.Percent = common.CopyBytes(next), percent
+		p.progress.Nodes, p.progress.Size = count, size
+		p.lock.Unlock()
+		return nil
+	}
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != common.HashLength {
+			continue
+		}
+		if ok, _ := bloom.Contain(key); ok {
+			continue
+		}
+		count++
+		size += common.StorageSize(len(key) + len(iter.Value()))
+		onlinePrunedNodesMeter.Mark(1)
+		onlinePrunedSizeMeter.Mark(int64(len(key) + len(iter.Value())))
+		keys = append(keys, common.CopyBytes(key))
+
+		if len(keys)*common.HashLength < ethdb.IdealBatchSize {
+			continue
+		}
+		// Recreate the iterator after every batch to allow the underlying
+		// compactor to delete the entries
+		next := common.CopyBytes(key)
+		if err := flush(next); err != nil {
+			return err
+		}
+		iter.Release()
+		iter = nil
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning state data", "nodes", count, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		select {
+		case <-time.After(p.config.Throttle):
+		case <-quit:
+			return errPruningStopped
+		}
+		iter = p.db.NewIterator(nil, next)
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if err := flush([]byte{0xff}); err != nil {
+		return err
+	}
+	rawdb.DeleteOnlineStatePruning(p.db)
+	onlinePruneProgressGauge.Update(100)
+
+	log.Info("Pruned state data", "nodes", count, "size", size, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// onlineBloom is a state bloom safe for concurrent use, which also records the
+// nodes flushed by the chain while the pruning runs.
+type onlineBloom struct {
+	bloom *stateBloom
+	lock  sync.Mutex
+}
+
+// Put implements the KeyValueWriter interface, adding the key to the bloom.
+func (b *onlineBloom) Put(key []byte, value []byte) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.bloom.Put(key, value)
+}
+
+// Delete implements the KeyValueWriter interface, it is not supported.
+func (b *onlineBloom) Delete(key []byte) error { panic("not supported") }
+
+// Contain reports whether the key may be contained in the bloom.
+func (b *onlineBloom) Contain(key []byte) (bool, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.bloom.Contain(key)
+}
+
+// record adds a trie node flushed by the chain to the bloom.
+func (b *onlineBloom) record(hash common.Hash) {
+	b.Put(hash[:], nil)
+}
@@ -0,0 +1,318 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/token/common"
+	"github.com/token/core/rawdb"
+	"github.com/token/core/state"
+	"github.com/token/core/state/snapshot"
+	"github.com/token/core/types"
+	"github.com/token/crypto"
+	"github.com/token/ethdb"
+)
+
+// testCode is the contract code deployed in the genesis state.
+var testCode = []byte{0x60, 0x00}
+
+// testChain is a minimal chain whose blocks only change the state, flushing
+// every state to disk like an archive node would, so that stale nodes pile up.
+type testChain struct {
+	db      ethdb.Database
+	cache   state.Database
+	snaps   *snapshot.Tree
+	archive bool
+
+	head  *types.Block
+	roots []common.Hash // State roots of all the blocks, genesis first
+	lock  sync.Mutex
+}
+
+// newTestChain creates a chain with a genesis state of the given number of
+// accounts, each one with a few storage slots.
+func newTestChain(t *testing.T, accounts int) *testChain {
+	db := rawdb.NewMemoryDatabase()
+	cache := state.NewDatabase(db)
+
+	statedb, _ := state.New(common.Hash{}, cache, nil)
+	for i := 0; i < accounts; i++ {
+		addr := testAddress(i)
+		statedb.SetBalance(addr, big.NewInt(int64(i+1)))
+		for j := 0; j < 3; j++ {
+			statedb.SetState(addr, common.BigToHash(big.NewInt(int64(j))), common.BigToHash(big.NewInt(int64(i+j+1))))
+		}
+	}
+	statedb.SetCode(testAddress(0), testCode)
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit genesis state: %v", err)
+	}
+	if err := cache.TrieDB().Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to flush genesis state: %v", err)
+	}
+	genesis := types.NewBlockWithHeader(&types.Header{Number: new(big.Int), Root: root})
+	rawdb.WriteBlock(db, genesis)
+	rawdb.WriteCanonicalHash(db, genesis.Hash(), 0)
+
+	snaps, err := snapshot.New(db, cache.TrieDB(), 16, root, false, true, false)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	return &testChain{db: db, cache: cache, snaps: snaps, head: genesis, roots: []common.Hash{root}}
+}
+
+func testAddress(i int) common.Address {
+	var addr common.Address
+	binary.BigEndian.PutUint32(addr[:], uint32(i+1))
+	return addr
+}
+
+// importBlock modifies a few accounts and their storage on top of the head
+// state, and flushes the resulting state to disk.
+func (c *testChain) importBlock(t *testing.T, accounts int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	statedb, err := state.New(c.head.Root(), c.cache, c.snaps)
+	if err != nil {
+		t.Errorf("failed to open head state: %v", err)
+		return
+	}
+	number := c.head.NumberU64() + 1
+	for i := 0; i < 20; i++ {
+		addr := testAddress(int((number*7 + uint64(i)*13) % uint64(accounts)))
+		statedb.AddBalance(addr, big.NewInt(1))
+		statedb.SetState(addr, common.BigToHash(big.NewInt(int64(i%3))), common.BigToHash(new(big.Int).SetUint64(number)))
+	}
+	root, err := statedb.Commit(true)
+	if err != nil {
+		t.Errorf("failed to commit state: %v", err)
+		return
+	}
+	if err := c.cache.TrieDB().Commit(root, false, nil); err != nil {
+		t.Errorf("failed to flush state: %v", err)
+		return
+	}
+	c.head = types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(number), Root: root, ParentHash: c.head.Hash()})
+	c.roots = append(c.roots, root)
+}
+
+func (c *testChain) CurrentBlock() *types.Block {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.head
+}
+
+func (c *testChain) Snapshots() *snapshot.Tree  { return c.snaps }
+func (c *testChain) StateCache() state.Database { return c.cache }
+func (c *testChain) ArchiveMode() bool          { return c.archive }
+
+func (c *testChain) CommitState(root common.Hash) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.cache.TrieDB().Commit(root, false, nil)
+}
+
+// recentRoots returns the state roots of the head and the blocks before it
+// whose states are kept.
+func (c *testChain) recentRoots() []common.Hash {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]common.Hash{}, c.roots[len(c.roots)-onlinePruneLayers:]...)
+}
+
+// checkStates ensures that the states with the given roots are fully readable
+// from disk.
+func checkStates(t *testing.T, db ethdb.Database, roots []common.Hash) {
+	for _, root := range roots {
+		if err := extractState(db, root, discardWriter{}); err != nil {
+			t.Fatalf("state %x not readable: %v", root, err)
+		}
+	}
+	if err := extractGenesis(db, discardWriter{}); err != nil {
+		t.Fatalf("genesis state not readable: %v", err)
+	}
+	if code := rawdb.ReadCode(db, crypto.Keccak256Hash(testCode)); !bytes.Equal(code, testCode) {
+		t.Fatalf("contract code deleted")
+	}
+}
+
+type discardWriter struct{}
+
+func (discardWriter) Put(key []byte, value []byte) error { return nil }
+func (discardWriter) Delete(key []byte) error            { return nil }
+
+// newTestPruner creates an online pruner with a small bloom.
+func newTestPruner(chain *testChain, throttle time.Duration) *OnlinePruner {
+	return &OnlinePruner{
+		db:       chain.db,
+		chain:    chain,
+		config:   OnlineConfig{BloomSize: 4, Throttle: throttle},
+		progress: OnlineProgress{Stage: OnlineStageIdle},
+	}
+}
+
+// waitProgress waits until the progress of the pruner satisfies the condition.
+func waitProgress(t *testing.T, p *OnlinePruner, cond func(OnlineProgress) bool) OnlineProgress {
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		if progress := p.Progress(); cond(progress) {
+			return progress
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for pruning progress: %+v", p.Progress())
+	return OnlineProgress{}
+}
+
+func finished(progress OnlineProgress) bool {
+	return progress.Stage == OnlineStageDone || progress.Stage == OnlineStageFailed
+}
+
+// Tests that stale state is deleted while blocks keep being imported, and that
+// the recent states and the states imported meanwhile stay readable.
+func TestOnlinePrunerConcurrentImport(t *testing.T) {
+	const accounts = 1000
+
+	chain := newTestChain(t, accounts)
+	for i := 0; i < 2*onlinePruneLayers; i++ {
+		chain.importBlock(t, accounts)
+	}
+	pruner := newTestPruner(chain, 5*time.Millisecond)
+	if err := pruner.Start(); err != nil {
+		t.Fatalf("failed to start pruning: %v", err)
+	}
+	// Keep importing blocks until the pruning is done
+	var (
+		imported int
+		stop     = make(chan struct{})
+		done     = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				chain.importBlock(t, accounts)
+				imported++
+			}
+		}
+	}()
+	progress := waitProgress(t, pruner, finished)
+	close(stop)
+	<-done
+
+	if progress.Stage != OnlineStageDone {
+		t.Fatalf("pruning failed: %s", progress.Error)
+	}
+	if progress.Nodes == 0 {
+		t.Errorf("no stale nodes pruned")
+	}
+	if imported == 0 {
+		t.Errorf("no blocks imported during pruning")
+	}
+	if _, ok := rawdb.ReadOnlineStatePruning(chain.db); ok {
+		t.Errorf("pruning marker not deleted")
+	}
+	checkStates(t, chain.db, chain.recentRoots())
+
+	// The chain must keep building on the pruned state
+	for i := 0; i < 10; i++ {
+		chain.importBlock(t, accounts)
+	}
+	checkStates(t, chain.db, chain.recentRoots())
+}
+
+// Tests that a stopped pruning persists its position and completes once
+// resumed, even after more blocks were imported.
+func TestOnlinePrunerResume(t *testing.T) {
+	const accounts = 1000
+
+	chain := newTestChain(t, accounts)
+	for i := 0; i < 2*onlinePruneLayers; i++ {
+		chain.importBlock(t, accounts)
+	}
+	// Stop the pruning while it's waiting after its first deletion batch
+	pruner := newTestPruner(chain, time.Hour)
+	if err := pruner.Start(); err != nil {
+		t.Fatalf("failed to start pruning: %v", err)
+	}
+	waitProgress(t, pruner, func(progress OnlineProgress) bool {
+		return progress.Stage == OnlineStagePruning && len(progress.Position) > 0
+	})
+	pruner.Stop()
+
+	progress := pruner.Progress()
+	if progress.Stage != OnlineStageStopped {
+		t.Fatalf("stage mismatch: have %s, want %s", progress.Stage, OnlineStageStopped)
+	}
+	position, ok := rawdb.ReadOnlineStatePruning(chain.db)
+	if !ok {
+		t.Fatalf("pruning position not persisted")
+	}
+	if !bytes.Equal(position, progress.Position) {
+		t.Fatalf("persisted position mismatch: have %x, want %x", position, progress.Position)
+	}
+	checkStates(t, chain.db, chain.recentRoots())
+
+	for i := 0; i < 10; i++ {
+		chain.importBlock(t, accounts)
+	}
+	// Resume the pruning with a fresh pruner, as after a restart
+	pruner = newTestPruner(chain, 0)
+	if err := pruner.Resume(); err != nil {
+		t.Fatalf("failed to resume pruning: %v", err)
+	}
+	if progress := waitProgress(t, pruner, finished); progress.Stage != OnlineStageDone {
+		t.Fatalf("resumed pruning failed: %s", progress.Error)
+	}
+	if _, ok := rawdb.ReadOnlineStatePruning(chain.db); ok {
+		t.Errorf("pruning marker not deleted")
+	}
+	checkStates(t, chain.db, chain.recentRoots())
+
+	// Nothing is left to resume after completion
+	pruner = newTestPruner(chain, 0)
+	if err := pruner.Resume(); err != nil {
+		t.Fatalf("failed to resume pruning: %v", err)
+	}
+	if stage := pruner.Progress().Stage; stage != OnlineStageIdle {
+		t.Errorf("stage mismatch after completed pruning: have %s, want %s", stage, OnlineStageIdle)
+	}
+}
+
+// Tests that archive nodes refuse to prune their historical states.
+func TestOnlinePrunerArchive(t *testing.T) {
+	chain := newTestChain(t, 10)
+	chain.archive = true
+
+	if err := newTestPruner(chain, 0).Start(); err != errArchiveMode {
+		t.Fatalf("error mismatch: have %v, want %v", err, errArchiveMode)
+	}
+}
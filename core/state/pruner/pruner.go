@@ -90,6 +90,9 @@ func NewPruner(db ethdb.Database, datadir, trieCachePath string, bloomSize uint6
 	if headBlock == nil {
 		return nil, errors.New("Failed to load head block")
 	}
+	if rawdb.ReadStateScheme(db) == rawdb.PathScheme {
+		return nil, errPathScheme
+	}
 	snaptree, err := snapshot.New(db, trie.NewDatabase(db), 256, headBlock.Root(), false, false, false)
 	if err != nil {
 		return nil, err // The relevant snapshot(s) might not exist
@@ -402,7 +405,7 @@ func RecoverPruning(datadir string, db ethdb.Database, trieCachePath string) err
 
 // extractGenesis loads the genesis state and commits all the state entries
 // into the given bloomfilter.
-func extractGenesis(db ethdb.Database, stateBloom *stateBloom) error {
+func extractGenesis(db ethdb.Database, stateBloom ethdb.KeyValueWriter) error {
 	genesisHash := rawdb.ReadCanonicalHash(db, 0)
 	if genesisHash == (common.Hash{}) {
 		return errors.New("missing genesis hash")
@@ -411,7 +414,13 @@ func extractGenesis(db ethdb.Database, stateBloom *stateBloom) error {
 	if genesis == nil {
 		return errors.New("missing genesis block")
 	}
-	t, err := trie.NewSecure(genesis.Root(), trie.NewDatabase(db))
+	return extractState(db, genesis.Root(), stateBloom)
+}
+
+// extractState loads the state with the given root from disk and commits all
+// its entries, including the contract codes, into the given bloomfilter.
+func extractState(db ethdb.Database, root common.Hash, stateBloom ethdb.KeyValueWriter) error {
+	t, err := trie.NewSecure(root, trie.NewDatabase(db))
 	if err != nil {
 		return err
 	}
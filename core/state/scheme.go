@@ -0,0 +1,176 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/token/common"
+	"github.com/token/core/rawdb"
+	"github.com/token/crypto"
+	"github.com/token/ethdb"
+	"github.com/token/log"
+	"github.com/token/rlp"
+	"github.com/token/trie"
+)
+
+// ConvertStateScheme converts the state with the given root, which must be the
+// persisted one for the path-based scheme, to the given trie node scheme. The
+// source copies of the converted nodes are deleted, but the nodes of the other
+// states stored by the hash-based scheme are left untouched.
+func ConvertStateScheme(db ethdb.Database, root common.Hash, scheme string) error {
+	source := rawdb.ReadStateScheme(db)
+	if source == "" {
+		return errors.New("database contains no state")
+	}
+	if scheme != rawdb.HashScheme && scheme != rawdb.PathScheme {
+		return fmt.Errorf("unknown state scheme %q", scheme)
+	}
+	if source == scheme {
+		return nil
+	}
+	var (
+		srcdb    = trie.NewDatabaseWithConfig(db, &trie.Config{Scheme: source})
+		batch    = db.NewBatch()
+		rootBlob []byte
+		nodes    int
+		start    = time.Now()
+		logged   = time.Now()
+	)
+	// convert copies the current node of the iterator to the target scheme
+	convert := func(owner common.Hash, it trie.NodeIterator) error {
+		hash := it.Hash()
+		if hash == (common.Hash{}) {
+			return nil // Embedded nodes are stored within their parent
+		}
+		var blob []byte
+		if source == rawdb.PathScheme {
+			blob = rawdb.ReadTrieNodeByPath(db, owner, it.Path())
+		} else {
+			blob = rawdb.ReadTrieNode(db, hash)
+		}
+		if len(blob) == 0 {
+			return fmt.Errorf("missing trie node %x", hash)
+		}
+		if scheme == rawdb.PathScheme {
+			// The account root marks the database path-based, write it last so
+			// an interrupted conversion can be restarted
+			if owner == (common.Hash{}) && len(it.Path()) == 0 {
+				rootBlob = blob
+			} else {
+				rawdb.WriteTrieNodeByPath(batch, owner, it.Path(), blob)
+			}
+		} else {
+			rawdb.WriteTrieNode(batch, hash, blob)
+		}
+		nodes++
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Converting state", "scheme", scheme, "nodes", nodes, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+		return nil
+	}
+	accTrie, err := trie.New(root, srcdb)
+	if err != nil {
+		return err
+	}
+	accIter := accTrie.NodeIterator(nil)
+	for accIter.Next(true) {
+		if err := convert(common.Hash{}, accIter); err != nil {
+			return err
+		}
+		if !accIter.Leaf() {
+			continue
+		}
+		var acc Account
+		if err := rlp.DecodeBytes(accIter.LeafBlob(), &acc); err != nil {
+			return err
+		}
+		if acc.Root == emptyRoot {
+			continue
+		}
+		owner := common.BytesToHash(accIter.LeafKey())
+		storageTrie, err := trie.NewWithOwner(owner, acc.Root, srcdb)
+		if err != nil {
+			return err
+		}
+		storageIter := storageTrie.NodeIterator(nil)
+		for storageIter.Next(true) {
+			if err := convert(owner, storageIter); err != nil {
+				return err
+			}
+		}
+		if storageIter.Error() != nil {
+			return storageIter.Error()
+		}
+	}
+	if accIter.Error() != nil {
+		return accIter.Error()
+	}
+	if scheme == rawdb.PathScheme {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+		if rootBlob != nil {
+			rawdb.WriteTrieNodeByPath(batch, common.Hash{}, nil, rootBlob)
+		}
+		rawdb.WritePersistentStateID(batch, 0)
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	batch.Reset()
+
+	// Drop the source copies of the converted nodes
+	if source == rawdb.PathScheme {
+		if err := rawdb.DeletePathState(db); err != nil {
+			return err
+		}
+	} else {
+		for _, prefix := range [][]byte{rawdb.TrieNodeAccountPrefix, rawdb.TrieNodeStoragePrefix} {
+			it := db.NewIterator(prefix, nil)
+			for it.Next() {
+				if rawdb.IsHashTrieNode(it.Key(), it.Value()) {
+					continue
+				}
+				batch.Delete(crypto.Keccak256(it.Value()))
+				if batch.ValueSize() >= ethdb.IdealBatchSize {
+					if err := batch.Write(); err != nil {
+						it.Release()
+						return err
+					}
+					batch.Reset()
+				}
+			}
+			it.Release()
+		}
+		if err := batch.Write(); err != nil {
+			return err
+		}
+	}
+	log.Info("Converted state", "scheme", scheme, "root", root, "nodes", nodes, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
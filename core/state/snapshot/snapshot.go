@@ -162,6 +162,7 @@ type Tree struct {
 	triedb *trie.Database           // In-memory cache to access the trie through
 	cache  int                      // Megabytes permitted to use for read caches
 	layers map[common.Hash]snapshot // Collection of all known layers
+	held   int32                    // Number of holders preventing capping (atomic)
 	lock   sync.RWMutex
 }
 
@@ -319,6 +320,36 @@ func (t *Tree) Snapshots(root common.Hash, limits int, nodisk bool) []Snapshot {
 	return ret
 }
 
+// Diff returns the accounts changed by the diff layer with the given root, and
+// the storage slots changed in each of them, including the deleted ones.
+func (t *Tree) Diff(root common.Hash) ([]common.Hash, map[common.Hash][]common.Hash, error) {
+	diff, ok := t.Snapshot(root).(*diffLayer)
+	if !ok {
+		return nil, nil, fmt.Errorf("snapshot [%#x] is not a diff layer", root)
+	}
+	accounts := diff.AccountList()
+	storage := make(map[common.Hash][]common.Hash)
+	for _, account := range accounts {
+		if slots, _ := diff.StorageList(account); len(slots) > 0 {
+			storage[account] = slots
+		}
+	}
+	return accounts, storage, nil
+}
+
+// Hold prevents the diff layers from being capped until the returned release
+// function is called, so that iterations over a layer don't go stale. The layers
+// of all blocks imported meanwhile are kept in memory and flattened at once on
+// release, so holders must release the tree quickly.
+func (t *Tree) Hold() func() {
+	atomic.AddInt32(&t.held, 1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { atomic.AddInt32(&t.held, -1) })
+	}
+}
+
 // Update adds a new snapshot into the tree, if that can be linked to an existing
 // old parent. It is disallowed to insert a disk layer (the origin of all).
 func (t *Tree) Update(blockRoot common.Hash, parentRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
@@ -356,6 +387,10 @@ func (t *Tree) Update(blockRoot common.Hash, parentRoot common.Hash, destructs m
 // survival is only known *after* capping, we need to omit it from the count if
 // we want to ensure that *at least* the requested number of diff layers remain.
 func (t *Tree) Cap(root common.Hash, layers int) error {
+	// Keep all the layers around while they are held by somebody
+	if atomic.LoadInt32(&t.held) > 0 {
+		return nil
+	}
 	// Retrieve the head snapshot to cap from
 	snap := t.Snapshot(root)
 	if snap == nil {
@@ -423,3 +423,52 @@ func TestSnaphots(t *testing.T) {
 		}
 	}
 }
+
+// Tests that held snapshot trees don't cap their diff layers until released, and
+// that the changes of the diff layers are reported correctly.
+func TestHoldAndDiff(t *testing.T) {
+	base := &diskLayer{
+		diskdb: rawdb.NewMemoryDatabase(),
+		root:   common.HexToHash("0x01"),
+		cache:  fastcache.New(1024 * 500),
+	}
+	snaps := &Tree{
+		layers: map[common.Hash]snapshot{
+			base.root: base,
+		},
+	}
+	snaps.Update(common.HexToHash("0x02"), common.HexToHash("0x01"), nil, randomAccountSet("0xa1", "0xa2"), randomStorageSet(nil, nil, nil))
+	snaps.Update(common.HexToHash("0x03"), common.HexToHash("0x02"), nil, randomAccountSet("0xa3"),
+		randomStorageSet([]string{"0xa3"}, [][]string{{"0x01", "0x02"}}, nil))
+
+	accounts, storage, err := snaps.Diff(common.HexToHash("0x03"))
+	if err != nil {
+		t.Fatalf("failed to retrieve diff: %v", err)
+	}
+	if len(accounts) != 1 || accounts[0] != common.HexToHash("0xa3") {
+		t.Errorf("account list mismatch: have %x, want [%x]", accounts, common.HexToHash("0xa3"))
+	}
+	if slots := storage[common.HexToHash("0xa3")]; len(slots) != 2 {
+		t.Errorf("storage list mismatch: have %d slots, want 2", len(slots))
+	}
+	if _, _, err := snaps.Diff(common.HexToHash("0x01")); err == nil {
+		t.Errorf("expected error for disk layer diff")
+	}
+	// Capping a held tree must keep all the layers
+	release := snaps.Hold()
+	if err := snaps.Cap(common.HexToHash("0x03"), 0); err != nil {
+		t.Fatalf("failed to cap held tree: %v", err)
+	}
+	if n := len(snaps.layers); n != 3 {
+		t.Errorf("held layer count mismatch: have %d, want 3", n)
+	}
+	release()
+	release() // Releasing twice must not underflow the hold counter
+
+	if err := snaps.Cap(common.HexToHash("0x03"), 0); err != nil {
+		t.Fatalf("failed to cap released tree: %v", err)
+	}
+	if n := len(snaps.layers); n != 1 {
+		t.Errorf("released layer count mismatch: have %d, want 1", n)
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/token/crypto"
 	"github.com/token/metrics"
 	"github.com/token/rlp"
+	"github.com/token/trie"
 )
 
 var emptyCodeHash = crypto.Keccak256(nil)
@@ -90,6 +91,10 @@ type stateObject struct {
 	dirtyCode bool // true if the code was updated
 	suicided  bool
 	deleted   bool
+
+	// wipeStorage is set if the object replaced an existing account, whose
+	// storage must be wiped from the path-based trie database.
+	wipeStorage bool
 }
 
 // empty returns whether the account is considered empty.
@@ -162,7 +167,7 @@ func (s *stateObject) getTrie(db Database) Trie {
 		if s.data.Root != emptyRoot && s.db.prefetcher != nil {
 			// When the miner is creating the pending state, there is no
 			// prefetcher
-			s.trie = s.db.prefetcher.trie(s.data.Root)
+			s.trie = s.db.prefetcher.trie(s.addrHash, s.data.Root)
 		}
 		if s.trie == nil {
 			var err error
@@ -318,7 +323,7 @@ func (s *stateObject) finalise(prefetch bool) {
 		}
 	}
 	if s.db.prefetcher != nil && prefetch && len(slotsToPrefetch) > 0 && s.data.Root != emptyRoot {
-		s.db.prefetcher.prefetch(s.data.Root, slotsToPrefetch)
+		s.db.prefetcher.prefetch(s.addrHash, s.data.Root, slotsToPrefetch)
 	}
 	if len(s.dirtyStorage) > 0 {
 		s.dirtyStorage = make(Storage)
@@ -373,7 +378,7 @@ func (s *stateObject) updateTrie(db Database) Trie {
 		usedStorage = append(usedStorage, common.CopyBytes(key[:])) // Copy needed for closure
 	}
 	if s.db.prefetcher != nil {
-		s.db.prefetcher.used(s.data.Root, usedStorage)
+		s.db.prefetcher.used(s.addrHash, s.data.Root, usedStorage)
 	}
 	if len(s.pendingStorage) > 0 {
 		s.pendingStorage = make(Storage)
@@ -395,24 +400,26 @@ func (s *stateObject) updateRoot(db Database) {
 }
 
 // CommitTrie the storage trie of the object to db.
-// This updates the trie root.
-func (s *stateObject) CommitTrie(db Database) error {
+// This updates the trie root and returns the nodes modified under the
+// path-based scheme.
+func (s *stateObject) CommitTrie(db Database) (*trie.NodeSet, error) {
 	// If nothing changed, don't bother with hashing anything
 	if s.updateTrie(db) == nil {
-		return nil
+		return nil, nil
 	}
 	if s.dbErr != nil {
-		return s.dbErr
+		return nil, s.dbErr
 	}
 	// Track the amount of time wasted on committing the storage trie
 	if metrics.EnabledExpensive {
 		defer func(start time.Time) { s.db.StorageCommits += time.Since(start) }(time.Now())
 	}
 	root, err := s.trie.Commit(nil)
-	if err == nil {
-		s.data.Root = root
+	if err != nil {
+		return nil, err
 	}
-	return err
+	s.data.Root = root
+	return committedNodes(s.trie), nil
 }
 
 // AddBalance adds amount to s's balance.
@@ -465,6 +472,7 @@ func (s *stateObject) deepCopy(db *StateDB) *stateObject {
 	stateObject.suicided = s.suicided
 	stateObject.dirtyCode = s.dirtyCode
 	stateObject.deleted = s.deleted
+	stateObject.wipeStorage = s.wipeStorage
 	return stateObject
 }
 
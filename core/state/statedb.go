@@ -598,6 +598,7 @@ func (s *StateDB) createObject(addr common.Address) (newobj, prev *stateObject)
 	}
 	newobj = newObject(s, addr, Account{})
 	newobj.setNonce(0) // sets the object to dirty
+	newobj.wipeStorage = prev != nil
 	if prev == nil {
 		s.journal.append(createObjectChange{account: &addr})
 	} else {
@@ -825,7 +826,7 @@ func (s *StateDB) Finalise(deleteEmptyObjects bool) {
 		addressesToPrefetch = append(addressesToPrefetch, common.CopyBytes(addr[:])) // Copy needed for closure
 	}
 	if s.prefetcher != nil && len(addressesToPrefetch) > 0 {
-		s.prefetcher.prefetch(s.originalRoot, addressesToPrefetch)
+		s.prefetcher.prefetch(common.Hash{}, s.originalRoot, addressesToPrefetch)
 	}
 	// Invalidate journal because reverting across transactions is not allowed.
 	s.clearJournalAndRefund()
@@ -866,7 +867,7 @@ func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 	// _untouched_. We can check with the prefetcher, if it can give us a trie
 	// which has the same root, but also has some content loaded into it.
 	if prefetcher != nil {
-		if trie := prefetcher.trie(s.originalRoot); trie != nil {
+		if trie := prefetcher.trie(common.Hash{}, s.originalRoot); trie != nil {
 			s.trie = trie
 		}
 	}
@@ -880,7 +881,7 @@ func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 		usedAddrs = append(usedAddrs, common.CopyBytes(addr[:])) // Copy needed for closure
 	}
 	if prefetcher != nil {
-		prefetcher.used(s.originalRoot, usedAddrs)
+		prefetcher.used(common.Hash{}, s.originalRoot, usedAddrs)
 	}
 	if len(s.stateObjectsPending) > 0 {
 		s.stateObjectsPending = make(map[common.Address]struct{})
@@ -918,18 +919,36 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 	s.IntermediateRoot(deleteEmptyObjects)
 
 	// Commit objects to the trie, measuring the elapsed time
-	codeWriter := s.db.TrieDB().DiskDB().NewBatch()
+	var (
+		codeWriter = s.db.TrieDB().DiskDB().NewBatch()
+		pathScheme = s.db.TrieDB().Scheme() == rawdb.PathScheme
+		nodes      *trie.MergedNodeSet
+	)
+	if pathScheme {
+		nodes = trie.NewMergedNodeSet()
+	}
 	for addr := range s.stateObjectsDirty {
-		if obj := s.stateObjects[addr]; !obj.deleted {
+		obj := s.stateObjects[addr]
+		if pathScheme && (obj.deleted || obj.wipeStorage) {
+			nodes.Destruct(obj.addrHash)
+			obj.wipeStorage = false
+		}
+		if !obj.deleted {
 			// Write any contract code associated with the state object
 			if obj.code != nil && obj.dirtyCode {
 				rawdb.WriteCode(codeWriter, common.BytesToHash(obj.CodeHash()), obj.code)
 				obj.dirtyCode = false
 			}
 			// Write any storage changes in the state object to its storage trie
-			if err := obj.CommitTrie(s.db); err != nil {
+			set, err := obj.CommitTrie(s.db)
+			if err != nil {
 				return common.Hash{}, err
 			}
+			if set != nil {
+				if err := nodes.Merge(set); err != nil {
+					return common.Hash{}, err
+				}
+			}
 		}
 	}
 	if len(s.stateObjectsDirty) > 0 {
@@ -960,6 +979,19 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 	if metrics.EnabledExpensive {
 		s.AccountCommits += time.Since(start)
 	}
+	// Under the path-based scheme, hand the modified nodes over to the database
+	// as a new diff layer on top of the parent state
+	if pathScheme && err == nil {
+		if set := committedNodes(s.trie); set != nil {
+			if err := nodes.Merge(set); err != nil {
+				return common.Hash{}, err
+			}
+		}
+		if err := s.db.TrieDB().Update(root, s.originalRoot, nodes); err != nil {
+			return common.Hash{}, err
+		}
+		s.originalRoot = root
+	}
 	// If snapshotting is enabled, update the snapshot tree with this new version
 	if s.snap != nil {
 		if metrics.EnabledExpensive {
@@ -32,6 +32,8 @@ import (
 	"github.com/token/common"
 	"github.com/token/core/rawdb"
 	"github.com/token/core/types"
+	"github.com/token/crypto"
+	"github.com/token/trie"
 )
 
 // Tests that updating a state trie does not leak any database writes prior to
@@ -915,3 +917,110 @@ func TestStateDBAccessList(t *testing.T) {
 		t.Fatalf("expected empty, got %d", got)
 	}
 }
+
+// Tests that committing with the path-based scheme persists the nodes of the
+// latest state only, wiping the storage of destructed and recreated accounts.
+func TestPathSchemeCommit(t *testing.T) {
+	var (
+		diskdb = rawdb.NewMemoryDatabase()
+		db     = NewDatabaseWithConfig(diskdb, &trie.Config{Scheme: rawdb.PathScheme})
+		addrs  = []common.Address{{0x01}, {0x02}, {0x03}}
+	)
+	state, _ := New(common.Hash{}, db, nil)
+	for i, addr := range addrs {
+		state.SetBalance(addr, big.NewInt(int64(i+1)))
+		for j := 0; j < 16; j++ {
+			state.SetState(addr, common.Hash{byte(j)}, common.Hash{byte(i + 1), byte(j)})
+		}
+	}
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	// Destruct the first account, recreate the second one and shrink the third
+	state, _ = New(root, db, nil)
+	state.Suicide(addrs[0])
+	state.CreateAccount(addrs[1])
+	state.SetState(addrs[1], common.Hash{0xff}, common.Hash{0xff})
+	for j := 1; j < 16; j++ {
+		state.SetState(addrs[2], common.Hash{byte(j)}, common.Hash{})
+	}
+	if root, err = state.Commit(false); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := db.TrieDB().Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to persist state: %v", err)
+	}
+	// Every account must only have the nodes of its latest storage on disk
+	for i, want := range []int{0, 1, 1} {
+		prefix := rawdb.TrieNodePathKey(crypto.Keccak256Hash(addrs[i][:]), nil)
+		it := diskdb.NewIterator(prefix, nil)
+		have := 0
+		for it.Next() {
+			have++
+		}
+		it.Release()
+		if have != want {
+			t.Errorf("account %d: persisted storage node count mismatch: have %d, want %d", i, have, want)
+		}
+	}
+	// Reopen the state from disk and check its content
+	state, err = New(root, NewDatabaseWithConfig(diskdb, &trie.Config{Scheme: rawdb.PathScheme}), nil)
+	if err != nil {
+		t.Fatalf("failed to reopen state: %v", err)
+	}
+	if state.Exist(addrs[0]) {
+		t.Errorf("destructed account still exists")
+	}
+	if have := state.GetState(addrs[1], common.Hash{}); have != (common.Hash{}) {
+		t.Errorf("recreated account storage not wiped: have %x", have)
+	}
+	if have := state.GetState(addrs[1], common.Hash{0xff}); have != (common.Hash{0xff}) {
+		t.Errorf("recreated account storage mismatch: have %x, want %x", have, common.Hash{0xff})
+	}
+	if have, want := state.GetState(addrs[2], common.Hash{}), (common.Hash{3, 0}); have != want {
+		t.Errorf("shrunk account storage mismatch: have %x, want %x", have, want)
+	}
+}
+
+// Tests that the prefetcher binds storage tries to their owner, since accounts
+// with the same storage root have distinct nodes under the path-based scheme.
+func TestPathSchemePrefetcher(t *testing.T) {
+	var (
+		diskdb = rawdb.NewMemoryDatabase()
+		db     = NewDatabaseWithConfig(diskdb, &trie.Config{Scheme: rawdb.PathScheme})
+		addrs  = []common.Address{{0x01}, {0x02}}
+	)
+	state, _ := New(common.Hash{}, db, nil)
+	for _, addr := range addrs {
+		state.SetState(addr, common.Hash{0x01}, common.Hash{0x01})
+	}
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := db.TrieDB().Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to persist state: %v", err)
+	}
+	var (
+		owners  = []common.Hash{crypto.Keccak256Hash(addrs[0][:]), crypto.Keccak256Hash(addrs[1][:])}
+		storage = state.getStateObject(addrs[0]).data.Root
+	)
+	if storage != state.getStateObject(addrs[1]).data.Root {
+		t.Fatalf("storage root mismatch")
+	}
+	prefetcher := newTriePrefetcher(db, root, "")
+	defer prefetcher.close()
+
+	prefetcher.prefetch(owners[0], storage, [][]byte{common.Hash{0x01}.Bytes()})
+	if tr := prefetcher.trie(owners[1], storage); tr != nil {
+		t.Fatalf("storage trie delivered to another owner")
+	}
+	tr := prefetcher.trie(owners[0], storage)
+	if tr == nil {
+		t.Fatalf("prefetched storage trie missing")
+	}
+	if _, err := tr.TryGet(common.Hash{0x01}.Bytes()); err != nil {
+		t.Fatalf("failed to read prefetched storage: %v", err)
+	}
+}
@@ -84,6 +84,11 @@ var (
 	// than some meaningful limit a user might use. This is not a consensus error
 	// making the transaction invalid, rather a DOS protection.
 	ErrOversizedData = errors.New("oversized data")
+
+	// ErrSystemLaneFull is returned if a consensus system transaction is added
+	// while the pool or the sending account already holds the maximum number of
+	// system transactions permitted.
+	ErrSystemLaneFull = errors.New("system transaction lane is full")
 )
 
 var (
@@ -112,6 +117,11 @@ var (
 	underpricedTxMeter = metrics.NewRegisteredMeter("txpool/underpriced", nil)
 	overflowedTxMeter  = metrics.NewRegisteredMeter("txpool/overflowed", nil)
 
+	// Metrics for the consensus system transaction lane
+	systemValidMeter    = metrics.NewRegisteredMeter("txpool/system/valid", nil)
+	systemOverflowMeter = metrics.NewRegisteredMeter("txpool/system/overflowed", nil)
+	systemGauge         = metrics.NewRegisteredGauge("txpool/system", nil)
+
 	pendingGauge = metrics.NewRegisteredGauge("txpool/pending", nil)
 	queuedGauge  = metrics.NewRegisteredGauge("txpool/queued", nil)
 	localGauge   = metrics.NewRegisteredGauge("txpool/local", nil)
@@ -156,6 +166,9 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	SystemSlots        uint64 // Maximum number of consensus system transactions for all accounts
+	SystemAccountSlots uint64 // Maximum number of consensus system transactions permitted per account
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -173,6 +186,9 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	GlobalQueue:  1024,
 
 	Lifetime: 3 * time.Hour,
+
+	SystemSlots:        256,
+	SystemAccountSlots: 16,
 }
 
 // sanitize checks the provided user configurations and changes anything that's
@@ -211,6 +227,14 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool lifetime", "provided", conf.Lifetime, "updated", DefaultTxPoolConfig.Lifetime)
 		conf.Lifetime = DefaultTxPoolConfig.Lifetime
 	}
+	if conf.SystemSlots < 1 {
+		log.Warn("Sanitizing invalid txpool system slots", "provided", conf.SystemSlots, "updated", DefaultTxPoolConfig.SystemSlots)
+		conf.SystemSlots = DefaultTxPoolConfig.SystemSlots
+	}
+	if conf.SystemAccountSlots < 1 {
+		log.Warn("Sanitizing invalid txpool system account slots", "provided", conf.SystemAccountSlots, "updated", DefaultTxPoolConfig.SystemAccountSlots)
+		conf.SystemAccountSlots = DefaultTxPoolConfig.SystemAccountSlots
+	}
 	return conf
 }
 
@@ -240,8 +264,12 @@ type TxPool struct {
 	currentMaxGas uint64         // Current gas limit for transaction caps
 
 	locals  *accountSet // Set of local transaction to exempt from eviction rules
+	systems *accountSet // Set of consensus system transaction senders to exempt from eviction rules
 	journal *txJournal  // Journal of local transaction to back up to disk
 
+	systemTxFilter func(tx *types.Transaction, from common.Address) bool // Consensus system transaction identifier
+	systemTxLock   sync.RWMutex                                          // Protects the filter, which is used without the pool lock
+
 	pending map[common.Address]*txList   // All currently processable transactions
 	queue   map[common.Address]*txList   // Queued but non-processable transactions
 	beats   map[common.Address]time.Time // Last heartbeat from each known account
@@ -287,6 +315,7 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		gasPrice:        new(big.Int).SetUint64(config.PriceLimit),
 	}
 	pool.locals = newAccountSet(pool.signer)
+	pool.systems = newAccountSet(pool.signer)
 	for _, addr := range config.Locals {
 		log.Info("Setting new local account", "address", addr)
 		pool.locals.add(addr)
@@ -318,6 +347,22 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 	return pool
 }
 
+// SetSystemTxFilter installs the function used to identify consensus system
+// transactions. Such transactions bypass the gas price limits of the pool, are
+// never evicted as underpriced and are only capped by the system slot limits.
+func (pool *TxPool) SetSystemTxFilter(filter func(tx *types.Transaction, from common.Address) bool) {
+	pool.systemTxLock.Lock()
+	defer pool.systemTxLock.Unlock()
+
+	pool.systemTxFilter = filter
+}
+
+// IsSystemTx reports whether the pool holds the transaction with the given hash
+// in its consensus system lane.
+func (pool *TxPool) IsSystemTx(hash common.Hash) bool {
+	return pool.all.IsSystem(hash)
+}
+
 // loop is the transaction pool's main event loop, waiting for and reacting to
 // outside blockchain events as well as for various reporting and transaction
 // eviction events.
@@ -368,7 +413,7 @@ func (pool *TxPool) loop() {
 			pool.mu.Lock()
 			for addr := range pool.queue {
 				// Skip local transactions from the eviction mechanism
-				if pool.locals.contains(addr) {
+				if pool.exempt(addr) {
 					continue
 				}
 				// Any non-locals old enough should be removed
@@ -515,7 +560,7 @@ func (pool *TxPool) Pending(enforceTips bool) (map[common.Address]types.Transact
 		// If the miner requests tip enforcement, cap the lists now
 		if enforceTips && !pool.locals.contains(addr) {
 			for i, tx := range txs {
-				if tx.EffectiveGasTipIntCmp(pool.gasPrice, pool.priced.urgent.baseFee) < 0 {
+				if !pool.all.IsSystem(tx.Hash()) && tx.EffectiveGasTipIntCmp(pool.gasPrice, pool.priced.urgent.baseFee) < 0 {
 					txs = txs[:i]
 					break
 				}
@@ -622,8 +667,9 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 //
 // If a newly added transaction is marked as local, its sending account will be
 // whitelisted, preventing any associated transaction from being dropped out of the pool
-// due to pricing constraints.
-func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err error) {
+// due to pricing constraints. The same goes for consensus system transactions, which
+// must be classified by the caller without holding the pool lock.
+func (pool *TxPool) add(tx *types.Transaction, local bool, isSystem bool) (replaced bool, err error) {
 	// If the transaction is already known, discard it
 	hash := tx.Hash()
 	if pool.all.Get(hash) != nil {
@@ -635,16 +681,27 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 	// the sender is marked as local previously, treat it as the local transaction.
 	isLocal := local || pool.locals.containsTx(tx)
 
+	// Consensus system transactions are exempt from pricing rules just like
+	// the local ones, but are bounded by the system lane capacity instead.
+	exempt := isLocal || isSystem
+
 	// If the transaction fails basic validation, discard it
-	if err := pool.validateTx(tx, isLocal); err != nil {
+	if err := pool.validateTx(tx, exempt); err != nil {
 		log.Trace("Discarding invalid transaction", "hash", hash, "err", err)
 		invalidTxMeter.Mark(1)
 		return false, err
 	}
+	if isSystem {
+		if err := pool.validateSystemTx(tx); err != nil {
+			log.Trace("Discarding system transaction", "hash", hash, "err", err)
+			systemOverflowMeter.Mark(1)
+			return false, err
+		}
+	}
 	// If the transaction pool is full, discard underpriced transactions
 	if uint64(pool.all.Slots()+numSlots(tx)) > pool.config.GlobalSlots+pool.config.GlobalQueue {
 		// If the new transaction is underpriced, don't accept it
-		if !isLocal && pool.priced.Underpriced(tx) {
+		if !exempt && pool.priced.Underpriced(tx) {
 			log.Trace("Discarding underpriced transaction", "hash", hash, "gasTipCap", tx.GasTipCap(), "gasFeeCap", tx.GasFeeCap())
 			underpricedTxMeter.Mark(1)
 			return false, ErrUnderpriced
@@ -652,10 +709,10 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		// New transaction is better than our worse ones, make room for it.
 		// If it's a local transaction, forcibly discard all available transactions.
 		// Otherwise if we can't make enough room for new one, abort the operation.
-		drop, success := pool.priced.Discard(pool.all.Slots()-int(pool.config.GlobalSlots+pool.config.GlobalQueue)+numSlots(tx), isLocal)
+		drop, success := pool.priced.Discard(pool.all.Slots()-int(pool.config.GlobalSlots+pool.config.GlobalQueue)+numSlots(tx), exempt)
 
 		// Special case, we still can't make the room for the new remote one.
-		if !isLocal && !success {
+		if !exempt && !success {
 			log.Trace("Discarding overflown transaction", "hash", hash)
 			overflowedTxMeter.Mark(1)
 			return false, ErrTxPoolOverflow
@@ -682,8 +739,11 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 			pool.priced.Removed(1)
 			pendingReplaceMeter.Mark(1)
 		}
-		pool.all.Add(tx, isLocal)
-		pool.priced.Put(tx, isLocal)
+		pool.all.Add(tx, exempt)
+		pool.priced.Put(tx, exempt)
+		if isSystem {
+			pool.markSystemTx(from, hash)
+		}
 		pool.journalTx(from, tx)
 		pool.queueTxEvent(tx)
 		log.Trace("Pooled new executable transaction", "hash", hash, "from", from, "to", tx.To())
@@ -693,10 +753,13 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		return old != nil, nil
 	}
 	// New transaction isn't replacing a pending one, push into queue
-	replaced, err = pool.enqueueTx(hash, tx, isLocal, true)
+	replaced, err = pool.enqueueTx(hash, tx, exempt, true)
 	if err != nil {
 		return false, err
 	}
+	if isSystem {
+		pool.markSystemTx(from, hash)
+	}
 	// Mark local addresses and journal local transactions
 	if local && !pool.locals.contains(from) {
 		log.Info("Setting new local account", "address", from)
@@ -712,6 +775,110 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 	return replaced, nil
 }
 
+// systemTxs classifies the given transactions with the installed engine filter,
+// reporting which ones are consensus system transactions. The filter may need
+// to look up consensus state, so it's called before obtaining the pool lock on
+// the transaction insertion paths.
+func (pool *TxPool) systemTxs(txs []*types.Transaction) []bool {
+	pool.systemTxLock.RLock()
+	filter := pool.systemTxFilter
+	pool.systemTxLock.RUnlock()
+
+	systems := make([]bool, len(txs))
+	if filter == nil {
+		return systems
+	}
+	for i, tx := range txs {
+		if from, err := types.Sender(pool.signer, tx); err == nil {
+			systems[i] = filter(tx, from)
+		}
+	}
+	return systems
+}
+
+// markSystemTx tracks an inserted transaction in the system lane and exempts its
+// sender from the eviction rules. The transaction is accounted as local in the
+// lookup, so its sender must be treated as local by the truncation too. System
+// transactions are only sent by consensus participants, so the set stays small.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) markSystemTx(from common.Address, hash common.Hash) {
+	pool.all.MarkSystem(hash)
+	systemValidMeter.Mark(1)
+
+	if !pool.systems.contains(from) {
+		log.Debug("Setting new system transaction sender", "address", from)
+		pool.systems.add(from)
+	}
+}
+
+// pruneSystems drops the senders without any system transaction left in the
+// pending or queued lists from the eviction exemptions.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) pruneSystems() {
+	for addr := range pool.systems.accounts {
+		if !pool.hasSystemTx(pool.pending[addr]) && !pool.hasSystemTx(pool.queue[addr]) {
+			log.Debug("Removing system transaction sender", "address", addr)
+			pool.systems.remove(addr)
+		}
+	}
+}
+
+// hasSystemTx reports whether the list holds a system transaction.
+func (pool *TxPool) hasSystemTx(list *txList) bool {
+	if list == nil {
+		return false
+	}
+	for _, tx := range list.txs.items {
+		if pool.all.IsSystem(tx.Hash()) {
+			return true
+		}
+	}
+	return false
+}
+
+// exempt reports whether the transactions of the account are exempt from the
+// eviction rules, either because it's local or a consensus system transaction
+// sender.
+func (pool *TxPool) exempt(addr common.Address) bool {
+	return pool.locals.contains(addr) || pool.systems.contains(addr)
+}
+
+// validateSystemTx checks whether there is room left in the system lane, both
+// globally and for the sender of the transaction. A system transaction replacing
+// an existing one with the same nonce doesn't occupy any new room.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) validateSystemTx(tx *types.Transaction) error {
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	var (
+		account  uint64
+		replaces bool
+	)
+	for _, list := range []*txList{pool.pending[from], pool.queue[from]} {
+		if list == nil {
+			continue
+		}
+		for _, ptx := range list.txs.items {
+			if !pool.all.IsSystem(ptx.Hash()) {
+				continue
+			}
+			account++
+			if ptx.Nonce() == tx.Nonce() {
+				replaces = true
+			}
+		}
+	}
+	if replaces {
+		return nil
+	}
+	if account >= pool.config.SystemAccountSlots || uint64(pool.all.SystemCount()) >= pool.config.SystemSlots {
+		return ErrSystemLaneFull
+	}
+	return nil
+}
+
 // enqueueTx inserts a new transaction into the non-executable transaction queue.
 //
 // Note, this method assumes the pool lock is held!
@@ -875,9 +1042,12 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 		return errs
 	}
 
+	// Classify the consensus system transactions before obtaining the lock too
+	systems := pool.systemTxs(news)
+
 	// Process all the new transaction and merge any errors into the original slice
 	pool.mu.Lock()
-	newErrs, dirtyAddrs := pool.addTxsLocked(news, local)
+	newErrs, dirtyAddrs := pool.addTxsLocked(news, local, systems)
 	pool.mu.Unlock()
 
 	var nilSlot = 0
@@ -896,13 +1066,14 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 	return errs
 }
 
-// addTxsLocked attempts to queue a batch of transactions if they are valid.
+// addTxsLocked attempts to queue a batch of transactions if they are valid,
+// systems flagging the consensus system transactions among them.
 // The transaction pool lock must be held.
-func (pool *TxPool) addTxsLocked(txs []*types.Transaction, local bool) ([]error, *accountSet) {
+func (pool *TxPool) addTxsLocked(txs []*types.Transaction, local bool, systems []bool) ([]error, *accountSet) {
 	dirty := newAccountSet(pool.signer)
 	errs := make([]error, len(txs))
 	for i, tx := range txs {
-		replaced, err := pool.add(tx, local)
+		replaced, err := pool.add(tx, local, systems[i])
 		errs[i] = err
 		if err == nil && !replaced {
 			dirty.addTx(tx)
@@ -1140,6 +1311,9 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 			pool.priced.SetBaseFee(pendingBaseFee)
 		}
 	}
+	// Stop exempting the senders whose system transactions all left the pool
+	pool.pruneSystems()
+
 	// Ensure pool.queue and pool.pending sizes stay within the configured limits.
 	pool.truncatePending()
 	pool.truncateQueue()
@@ -1250,7 +1424,8 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	// Inject any transactions discarded due to reorgs
 	log.Debug("Reinjecting stale transactions", "count", len(reinject))
 	senderCacher.recover(pool.signer, reinject)
-	pool.addTxsLocked(reinject, false)
+	// Reorgs are rare enough to classify the reinjected transactions under the lock
+	pool.addTxsLocked(reinject, false, pool.systemTxs(reinject))
 
 	// Update all fork indicator by next pending block number.
 	next := new(big.Int).Add(newHead.Number, big.NewInt(1))
@@ -1301,7 +1476,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 
 		// Drop all transactions over the allowed limit
 		var caps types.Transactions
-		if !pool.locals.contains(addr) {
+		if !pool.exempt(addr) {
 			caps = list.Cap(int(pool.config.AccountQueue))
 			for _, tx := range caps {
 				hash := tx.Hash()
@@ -1342,7 +1517,7 @@ func (pool *TxPool) truncatePending() {
 	spammers := prque.New(nil)
 	for addr, list := range pool.pending {
 		// Only evict transactions from high rollers
-		if !pool.locals.contains(addr) && uint64(list.Len()) > pool.config.AccountSlots {
+		if !pool.exempt(addr) && uint64(list.Len()) > pool.config.AccountSlots {
 			spammers.Push(addr, int64(list.Len()))
 		}
 	}
@@ -1425,7 +1600,7 @@ func (pool *TxPool) truncateQueue() {
 	// Sort all accounts with queued transactions by heartbeat
 	addresses := make(addressesByHeartbeat, 0, len(pool.queue))
 	for addr := range pool.queue {
-		if !pool.locals.contains(addr) { // don't drop locals
+		if !pool.exempt(addr) { // don't drop locals and system transaction senders
 			addresses = append(addresses, addressByHeartbeat{addr, pool.beats[addr]})
 		}
 	}
@@ -1575,6 +1750,12 @@ func (as *accountSet) add(addr common.Address) {
 	as.cache = nil
 }
 
+// remove deletes an address from the set.
+func (as *accountSet) remove(addr common.Address) {
+	delete(as.accounts, addr)
+	as.cache = nil
+}
+
 // addTx adds the sender of tx into the set.
 func (as *accountSet) addTx(tx *types.Transaction) {
 	if addr, err := types.Sender(as.signer, tx); err == nil {
@@ -1620,6 +1801,7 @@ type txLookup struct {
 	lock    sync.RWMutex
 	locals  map[common.Hash]*types.Transaction
 	remotes map[common.Hash]*types.Transaction
+	systems map[common.Hash]struct{} // Subset of locals carrying consensus data
 }
 
 // newTxLookup returns a new txLookup structure.
@@ -1627,6 +1809,7 @@ func newTxLookup() *txLookup {
 	return &txLookup{
 		locals:  make(map[common.Hash]*types.Transaction),
 		remotes: make(map[common.Hash]*types.Transaction),
+		systems: make(map[common.Hash]struct{}),
 	}
 }
 
@@ -1704,6 +1887,38 @@ func (t *txLookup) RemoteCount() int {
 	return len(t.remotes)
 }
 
+// SystemCount returns the current number of consensus system transactions in
+// the lookup.
+func (t *txLookup) SystemCount() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return len(t.systems)
+}
+
+// IsSystem returns whether the transaction is tracked as a consensus system
+// transaction.
+func (t *txLookup) IsSystem(hash common.Hash) bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	_, ok := t.systems[hash]
+	return ok
+}
+
+// MarkSystem flags an already added transaction as a consensus system transaction.
+func (t *txLookup) MarkSystem(hash common.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.locals[hash]; !ok {
+		log.Error("No local transaction found to be marked as system", "hash", hash)
+		return
+	}
+	t.systems[hash] = struct{}{}
+	systemGauge.Update(int64(len(t.systems)))
+}
+
 // Slots returns the current number of slots used in the lookup.
 func (t *txLookup) Slots() int {
 	t.lock.RLock()
@@ -1745,6 +1960,10 @@ func (t *txLookup) Remove(hash common.Hash) {
 
 	delete(t.locals, hash)
 	delete(t.remotes, hash)
+	if _, ok := t.systems[hash]; ok {
+		delete(t.systems, hash)
+		systemGauge.Update(int64(len(t.systems)))
+	}
 }
 
 // RemoteToLocals migrates the transactions belongs to the given locals to locals
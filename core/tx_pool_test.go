@@ -17,6 +17,7 @@
 package core
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"errors"
 	"fmt"
@@ -432,14 +433,14 @@ func TestTransactionChainFork(t *testing.T) {
 	resetState()
 
 	tx := transaction(0, 100000, key)
-	if _, err := pool.add(tx, false); err != nil {
+	if _, err := pool.add(tx, false, false); err != nil {
 		t.Error("didn't expect error", err)
 	}
 	pool.removeTx(tx.Hash(), true)
 
 	// reset the pool's internal state
 	resetState()
-	if _, err := pool.add(tx, false); err != nil {
+	if _, err := pool.add(tx, false, false); err != nil {
 		t.Error("didn't expect error", err)
 	}
 }
@@ -466,10 +467,10 @@ func TestTransactionDoubleNonce(t *testing.T) {
 	tx3, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(100), 1000000, big.NewInt(1), nil), signer, key)
 
 	// Add the first two transaction, ensure higher priced stays only
-	if replace, err := pool.add(tx1, false); err != nil || replace {
+	if replace, err := pool.add(tx1, false, false); err != nil || replace {
 		t.Errorf("first transaction insert failed (%v) or reported replacement (%v)", err, replace)
 	}
-	if replace, err := pool.add(tx2, false); err != nil || !replace {
+	if replace, err := pool.add(tx2, false, false); err != nil || !replace {
 		t.Errorf("second transaction insert failed (%v) or not reported replacement (%v)", err, replace)
 	}
 	<-pool.requestPromoteExecutables(newAccountSet(signer, addr))
@@ -481,7 +482,7 @@ func TestTransactionDoubleNonce(t *testing.T) {
 	}
 
 	// Add the third transaction and ensure it's not saved (smaller price)
-	pool.add(tx3, false)
+	pool.add(tx3, false, false)
 	<-pool.requestPromoteExecutables(newAccountSet(signer, addr))
 	if pool.pending[addr].Len() != 1 {
 		t.Error("expected 1 pending transactions, got", pool.pending[addr].Len())
@@ -504,7 +505,7 @@ func TestTransactionMissingNonce(t *testing.T) {
 	addr := crypto.PubkeyToAddress(key.PublicKey)
 	testAddBalance(pool, addr, big.NewInt(100000000000000))
 	tx := transaction(1, 100000, key)
-	if _, err := pool.add(tx, false); err != nil {
+	if _, err := pool.add(tx, false, false); err != nil {
 		t.Error("didn't expect error", err)
 	}
 	if len(pool.pending) != 0 {
@@ -2541,3 +2542,158 @@ func BenchmarkInsertRemoteWithAllLocals(b *testing.B) {
 		pool.Stop()
 	}
 }
+
+// Tests that consensus system transactions identified by the engine bypass the
+// pool pricing rules, but are capped by the system lane limits.
+func TestTransactionSystemLane(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.config.SystemAccountSlots = 2
+	pool.config.SystemSlots = 3
+
+	pool.SetSystemTxFilter(func(tx *types.Transaction, from common.Address) bool {
+		return bytes.HasPrefix(tx.Data(), []byte("ufo:1:event:confirm"))
+	})
+	systemTx := func(nonce uint64, key *ecdsa.PrivateKey) *types.Transaction {
+		from := crypto.PubkeyToAddress(key.PublicKey)
+		tx, _ := types.SignTx(types.NewTransaction(nonce, from, big.NewInt(0), 100000, big.NewInt(1), []byte(fmt.Sprintf("ufo:1:event:confirm:%d", nonce))), types.HomesteadSigner{}, key)
+		return tx
+	}
+	other, _ := crypto.GenerateKey()
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000))
+	testAddBalance(pool, crypto.PubkeyToAddress(other.PublicKey), big.NewInt(1000000))
+
+	// Ordinary transactions paying the same price are rejected
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(1), other)); err != ErrUnderpriced {
+		t.Fatalf("ordinary transaction error mismatch: have %v, want %v", err, ErrUnderpriced)
+	}
+	// System transactions are accepted up to the per account limit
+	for i := uint64(0); i < 2; i++ {
+		tx := systemTx(i, key)
+		if err := pool.addRemoteSync(tx); err != nil {
+			t.Fatalf("system transaction %d rejected: %v", i, err)
+		}
+		if !pool.IsSystemTx(tx.Hash()) {
+			t.Fatalf("system transaction %d not tracked in system lane", i)
+		}
+	}
+	if err := pool.addRemoteSync(systemTx(2, key)); err != ErrSystemLaneFull {
+		t.Fatalf("account limit error mismatch: have %v, want %v", err, ErrSystemLaneFull)
+	}
+	// And up to the global limit
+	if err := pool.addRemoteSync(systemTx(0, other)); err != nil {
+		t.Fatalf("system transaction rejected: %v", err)
+	}
+	if err := pool.addRemoteSync(systemTx(1, other)); err != ErrSystemLaneFull {
+		t.Fatalf("global limit error mismatch: have %v, want %v", err, ErrSystemLaneFull)
+	}
+	// System transactions must survive tip enforcement
+	pending, _ := pool.Pending(true)
+	if len(pending[crypto.PubkeyToAddress(key.PublicKey)]) != 2 {
+		t.Errorf("pending system transactions mismatch: have %d, want %d", len(pending[crypto.PubkeyToAddress(key.PublicKey)]), 2)
+	}
+	if count := pool.all.SystemCount(); count != 3 {
+		t.Errorf("system transaction count mismatch: have %d, want %d", count, 3)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the senders of consensus system transactions are exempt from the
+// pending truncation just like the local ones.
+func TestTransactionSystemLaneTruncation(t *testing.T) {
+	t.Parallel()
+
+	// Create the pool to test the limit enforcement with
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.GlobalSlots = config.AccountSlots * 2
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	pool.SetSystemTxFilter(func(tx *types.Transaction, from common.Address) bool {
+		return bytes.HasPrefix(tx.Data(), []byte("ufo:1:event:confirm"))
+	})
+	system, _ := crypto.GenerateKey()
+	spammer, _ := crypto.GenerateKey()
+	balance := new(big.Int).Exp(big.NewInt(10), big.NewInt(30), nil)
+	testAddBalance(pool, crypto.PubkeyToAddress(system.PublicKey), balance)
+	testAddBalance(pool, crypto.PubkeyToAddress(spammer.PublicKey), balance)
+
+	// Both accounts exceed their pending allowance, one of them starting with a
+	// system transaction
+	price := new(big.Int).SetUint64(config.PriceLimit)
+	tx, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(0), 100000, big.NewInt(1), []byte("ufo:1:event:confirm:0")), types.HomesteadSigner{}, system)
+	txs := types.Transactions{tx}
+	for i := uint64(0); i < 2*config.AccountSlots; i++ {
+		txs = append(txs, pricedTransaction(i+1, 100000, price, system))
+		txs = append(txs, pricedTransaction(i, 100000, price, spammer))
+	}
+	for i, err := range pool.AddRemotesSync(txs) {
+		if err != nil {
+			t.Fatalf("transaction %d rejected: %v", i, err)
+		}
+	}
+	// Only the ordinary sender must be truncated
+	if pending := pool.pending[crypto.PubkeyToAddress(system.PublicKey)].Len(); pending != int(2*config.AccountSlots+1) {
+		t.Errorf("system sender pending transactions mismatch: have %d, want %d", pending, 2*config.AccountSlots+1)
+	}
+	if pending := pool.pending[crypto.PubkeyToAddress(spammer.PublicKey)].Len(); pending != int(config.AccountSlots) {
+		t.Errorf("spammer pending transactions mismatch: have %d, want %d", pending, config.AccountSlots)
+	}
+	if !pool.IsSystemTx(tx.Hash()) {
+		t.Errorf("system transaction not tracked in system lane")
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the senders of consensus system transactions lose their eviction
+// exemption once none of their system transactions is left in the pool.
+func TestTransactionSystemSenderPruning(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.SetSystemTxFilter(func(tx *types.Transaction, from common.Address) bool {
+		return bytes.HasPrefix(tx.Data(), []byte("ufo:1:event:confirm"))
+	})
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	testAddBalance(pool, from, new(big.Int).Exp(big.NewInt(10), big.NewInt(30), nil))
+
+	system, _ := types.SignTx(types.NewTransaction(0, from, big.NewInt(0), 100000, big.NewInt(1), []byte("ufo:1:event:confirm:0")), types.HomesteadSigner{}, key)
+	if err := pool.addRemoteSync(system); err != nil {
+		t.Fatalf("system transaction rejected: %v", err)
+	}
+	if err := pool.addRemoteSync(pricedTransaction(1, 100000, new(big.Int).SetUint64(pool.config.PriceLimit), key)); err != nil {
+		t.Fatalf("ordinary transaction rejected: %v", err)
+	}
+	if !pool.systems.contains(from) {
+		t.Fatalf("system transaction sender not exempt")
+	}
+	// Include the system transaction in a block, the sender must be pruned
+	testSetNonce(pool, from, 1)
+	<-pool.requestReset(nil, nil)
+
+	if pool.IsSystemTx(system.Hash()) {
+		t.Fatalf("included system transaction still tracked")
+	}
+	if pool.systems.contains(from) {
+		t.Errorf("sender without system transactions still exempt")
+	}
+	if pending := pool.pending[from].Len(); pending != 1 {
+		t.Errorf("pending transactions mismatch: have %d, want %d", pending, 1)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
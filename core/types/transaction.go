@@ -576,6 +576,85 @@ func (t *TransactionsByPriceAndNonce) Pop() {
 	heap.Pop(&t.heads)
 }
 
+// TxByTime implements both the sort and the heap interface, ordering transactions
+// by the time they were first seen locally.
+type TxByTime Transactions
+
+func (s TxByTime) Len() int           { return len(s) }
+func (s TxByTime) Less(i, j int) bool { return s[i].time.Before(s[j].time) }
+func (s TxByTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (s *TxByTime) Push(x interface{}) {
+	*s = append(*s, x.(*Transaction))
+}
+
+func (s *TxByTime) Pop() interface{} {
+	old := *s
+	n := len(old)
+	x := old[n-1]
+	*s = old[0 : n-1]
+	return x
+}
+
+// TransactionsByTimeAndNonce represents a set of transactions that can return
+// transactions in arrival order, regardless of the fees they pay, while still
+// honouring the nonce ordering of each account.
+type TransactionsByTimeAndNonce struct {
+	txs    map[common.Address]Transactions // Per account nonce-sorted list of transactions
+	heads  TxByTime                        // Next transaction for each unique account (time heap)
+	signer Signer                          // Signer for the set of transactions
+}
+
+// NewTransactionsByTimeAndNonce creates a transaction set that can retrieve
+// arrival time sorted transactions in a nonce-honouring way.
+//
+// Note, the input map is reowned so the caller should not interact any more with
+// if after providing it to the constructor.
+func NewTransactionsByTimeAndNonce(signer Signer, txs map[common.Address]Transactions) *TransactionsByTimeAndNonce {
+	heads := make(TxByTime, 0, len(txs))
+	for from, accTxs := range txs {
+		// Remove transaction if sender doesn't match from
+		if acc, _ := Sender(signer, accTxs[0]); acc != from {
+			delete(txs, from)
+			continue
+		}
+		heads = append(heads, accTxs[0])
+		txs[from] = accTxs[1:]
+	}
+	heap.Init(&heads)
+
+	return &TransactionsByTimeAndNonce{
+		txs:    txs,
+		heads:  heads,
+		signer: signer,
+	}
+}
+
+// Peek returns the earliest seen transaction.
+func (t *TransactionsByTimeAndNonce) Peek() *Transaction {
+	if len(t.heads) == 0 {
+		return nil
+	}
+	return t.heads[0]
+}
+
+// Shift replaces the current head with the next one from the same account.
+func (t *TransactionsByTimeAndNonce) Shift() {
+	acc, _ := Sender(t.signer, t.heads[0])
+	if txs, ok := t.txs[acc]; ok && len(txs) > 0 {
+		t.heads[0], t.txs[acc] = txs[0], txs[1:]
+		heap.Fix(&t.heads, 0)
+		return
+	}
+	heap.Pop(&t.heads)
+}
+
+// Pop removes the current head, *not* replacing it with the next one from the
+// same account.
+func (t *TransactionsByTimeAndNonce) Pop() {
+	heap.Pop(&t.heads)
+}
+
 // Message is a fully derived transaction and implements core.Message
 //
 // NOTE: In a future PR this will be removed.
@@ -405,6 +405,42 @@ func TestTransactionTimeSort(t *testing.T) {
 	}
 }
 
+// Tests that the arrival ordered transaction set ignores gas prices entirely,
+// while still honouring the nonce ordering of each account.
+func TestTransactionTimeAndNonceSort(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 5)
+	for i := 0; i < len(keys); i++ {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	signer := HomesteadSigner{}
+
+	// Later accounts pay more but are seen earlier
+	groups := map[common.Address]Transactions{}
+	for start, key := range keys {
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		for i := 0; i < 3; i++ {
+			tx, _ := SignTx(NewTransaction(uint64(i), common.Address{}, big.NewInt(100), 100, big.NewInt(int64(start+1)), nil), signer, key)
+			tx.time = time.Unix(0, int64(10*(len(keys)-start)+i))
+			groups[addr] = append(groups[addr], tx)
+		}
+	}
+	txset := NewTransactionsByTimeAndNonce(signer, groups)
+
+	txs := Transactions{}
+	for tx := txset.Peek(); tx != nil; tx = txset.Peek() {
+		txs = append(txs, tx)
+		txset.Shift()
+	}
+	if len(txs) != 3*len(keys) {
+		t.Fatalf("expected %d transactions, found %d", 3*len(keys), len(txs))
+	}
+	for i := 0; i+1 < len(txs); i++ {
+		if txs[i].time.After(txs[i+1].time) {
+			t.Errorf("invalid received time ordering: tx #%d (T=%v) > tx #%d (T=%v)", i, txs[i].time, i+1, txs[i+1].time)
+		}
+	}
+}
+
 // TestTransactionCoding tests serializing/de-serializing to/from rlp and JSON.
 func TestTransactionCoding(t *testing.T) {
 	key, err := crypto.GenerateKey()
@@ -34,6 +34,7 @@ import (
 	"github.com/token/core"
 	"github.com/token/core/rawdb"
 	"github.com/token/core/state"
+	"github.com/token/core/state/pruner"
 	"github.com/token/core/types"
 	"github.com/token/internal/ethapi"
 	"github.com/token/rlp"
@@ -315,6 +316,27 @@ func (api *PrivateDebugAPI) Preimage(ctx context.Context, hash common.Hash) (hex
 	return nil, errors.New("unknown preimage")
 }
 
+// StartStatePruning launches the online pruning of the stale state trie nodes
+// in the background. The node must be synced and run with snapshots.
+func (api *PrivateDebugAPI) StartStatePruning() error {
+	if !api.eth.Synced() {
+		return errors.New("state pruning requires a synced node")
+	}
+	return api.eth.statePruner.Start()
+}
+
+// StopStatePruning interrupts the running state pruning, which can be resumed
+// later by starting it again.
+func (api *PrivateDebugAPI) StopStatePruning() {
+	api.eth.statePruner.Stop()
+}
+
+// StatePruningStatus returns the progress of the running or the last state
+// pruning.
+func (api *PrivateDebugAPI) StatePruningStatus() pruner.OnlineProgress {
+	return api.eth.statePruner.Progress()
+}
+
 // BadBlockArgs represents the entries in the list returned when bad blocks are queried.
 type BadBlockArgs struct {
 	Hash  common.Hash            `json:"hash"`
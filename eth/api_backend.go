@@ -71,7 +71,13 @@ func (b *EthAPIBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumb
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock().Header(), nil
 	}
-	return b.eth.blockchain.GetHeaderByNumber(uint64(number)), nil
+	header := b.eth.blockchain.GetHeaderByNumber(uint64(number))
+	if header == nil {
+		if tail := rawdb.ReadHeaderHistoryTail(b.eth.ChainDb()); uint64(number) < tail {
+			return nil, &rawdb.PrunedHistoryError{Kind: "header", Number: uint64(number), Tail: tail}
+		}
+	}
+	return header, nil
 }
 
 func (b *EthAPIBackend) HeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, error) {
@@ -105,11 +111,40 @@ func (b *EthAPIBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumbe
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock(), nil
 	}
-	return b.eth.blockchain.GetBlockByNumber(uint64(number)), nil
+	block := b.eth.blockchain.GetBlockByNumber(uint64(number))
+	if block == nil {
+		if tail := rawdb.ReadBlockHistoryTail(b.eth.ChainDb()); uint64(number) < tail {
+			return nil, &rawdb.PrunedHistoryError{Kind: "body", Number: uint64(number), Tail: tail}
+		}
+	}
+	return block, nil
 }
 
 func (b *EthAPIBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
-	return b.eth.blockchain.GetBlockByHash(hash), nil
+	block := b.eth.blockchain.GetBlockByHash(hash)
+	if block == nil {
+		if err := b.prunedBlock(hash, "body"); err != nil {
+			return nil, err
+		}
+	}
+	return block, nil
+}
+
+// prunedBlock returns an error if the given kind of data of a known block is
+// missing because the history of the chain was pruned.
+func (b *EthAPIBackend) prunedBlock(hash common.Hash, kind string) error {
+	number := rawdb.ReadHeaderNumber(b.eth.ChainDb(), hash)
+	if number == nil {
+		return nil
+	}
+	if tail := rawdb.ReadBlockHistoryTail(b.eth.ChainDb()); *number < tail {
+		return &rawdb.PrunedHistoryError{Kind: kind, Number: *number, Tail: tail}
+	}
+	return nil
+}
+
+func (b *EthAPIBackend) PendingBlockAndReceipts() (*types.Block, types.Receipts) {
+	return b.eth.miner.PendingBlockAndReceipts()
 }
 
 func (b *EthAPIBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Block, error) {
@@ -126,6 +161,9 @@ func (b *EthAPIBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash r
 		}
 		block := b.eth.blockchain.GetBlock(hash, header.Number.Uint64())
 		if block == nil {
+			if err := b.prunedBlock(hash, "body"); err != nil {
+				return nil, err
+			}
 			return nil, errors.New("header found, but block body is missing")
 		}
 		return block, nil
@@ -173,7 +211,13 @@ func (b *EthAPIBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockN
 }
 
 func (b *EthAPIBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
-	return b.eth.blockchain.GetReceiptsByHash(hash), nil
+	receipts := b.eth.blockchain.GetReceiptsByHash(hash)
+	if receipts == nil {
+		if err := b.prunedBlock(hash, "receipts"); err != nil {
+			return nil, err
+		}
+	}
+	return receipts, nil
 }
 
 func (b *EthAPIBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
@@ -279,6 +323,10 @@ func (b *EthAPIBackend) SuggestGasTipCap(ctx context.Context) (*big.Int, error)
 	return b.gpo.SuggestTipCap(ctx)
 }
 
+func (b *EthAPIBackend) FeeHistory(ctx context.Context, blockCount int, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (firstBlock *big.Int, reward [][]*big.Int, baseFee []*big.Int, gasUsedRatio []float64, err error) {
+	return b.gpo.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
+}
+
 func (b *EthAPIBackend) ChainDb() ethdb.Database {
 	return b.eth.ChainDb()
 }
@@ -69,6 +69,7 @@ type Ethereum struct {
 	// Handlers
 	txPool             *core.TxPool
 	blockchain         *core.BlockChain
+	statePruner        *pruner.OnlinePruner
 	handler            *handler
 	ethDialCandidates  enode.Iterator
 	snapDialCandidates enode.Iterator
@@ -108,6 +109,18 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	if !config.SyncMode.IsValid() {
 		return nil, fmt.Errorf("invalid sync mode %d", config.SyncMode)
 	}
+	if config.StateScheme == rawdb.PathScheme {
+		if config.NoPruning {
+			return nil, errors.New("path state scheme is incompatible with archive mode")
+		}
+		if config.SyncMode != downloader.FullSync {
+			return nil, errors.New("path state scheme requires full sync")
+		}
+		// Light clients retrieve trie nodes by hash, which isn't supported
+		if config.LightServ > 0 {
+			return nil, errors.New("path state scheme can't serve light clients")
+		}
+	}
 	if config.Miner.GasPrice == nil || config.Miner.GasPrice.Cmp(common.Big0) <= 0 {
 		log.Warn("Sanitizing invalid miner gas price", "provided", config.Miner.GasPrice, "updated", ethconfig.Defaults.Miner.GasPrice)
 		config.Miner.GasPrice = new(big.Int).Set(ethconfig.Defaults.Miner.GasPrice)
@@ -195,6 +208,8 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 			TrieTimeLimit:       config.TrieTimeout,
 			SnapshotLimit:       config.SnapshotCache,
 			Preimages:           config.Preimages,
+			StateScheme:         config.StateScheme,
+			StateHistory:        config.StateHistory,
 		}
 	)
 	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, chainConfig, eth.engine, vmConfig, eth.shouldPreserve, &config.TxLookupLimit)
@@ -208,11 +223,20 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		rawdb.WriteChainConfig(chainDb, genesisHash, chainConfig)
 	}
 	eth.bloomIndexer.Start(eth.blockchain)
+	eth.statePruner = pruner.NewOnlinePruner(chainDb, eth.blockchain, pruner.OnlineConfig{
+		BloomSize: config.StatePruneBloomSize,
+		Throttle:  config.StatePruneThrottle,
+	})
 
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
 	}
 	eth.txPool = core.NewTxPool(config.TxPool, chainConfig, eth.blockchain)
+	if engine, ok := eth.engine.(consensus.SystemTxEngine); ok {
+		eth.txPool.SetSystemTxFilter(func(tx *types.Transaction, from common.Address) bool {
+			return engine.IsSystemTransaction(eth.blockchain, tx, from)
+		})
+	}
 
 	// Permit the downloader to use the trie cache allowance during fast sync
 	cacheLimit := cacheConfig.TrieCleanLimit + cacheConfig.TrieDirtyLimit + cacheConfig.SnapshotLimit
@@ -550,6 +574,11 @@ func (s *Ethereum) Start() error {
 	// Start the bloom bits servicing goroutines
 	s.startBloomHandlers(params.BloomBitsBlocks)
 
+	// Resume the state pruning interrupted by the last shutdown
+	if err := s.statePruner.Resume(); err != nil {
+		log.Warn("Failed to resume state pruning", "err", err)
+	}
+
 	// Figure out a max peers count based on the server limits
 	maxPeers := s.p2pServer.MaxPeers
 	if s.config.LightServ > 0 {
@@ -576,6 +605,8 @@ func (s *Ethereum) Stop() error {
 	close(s.closeBloomHandler)
 	s.txPool.Stop()
 	s.miner.Stop()
+	s.APIBackend.gpo.Stop()
+	s.statePruner.Stop()
 	s.blockchain.Stop()
 	s.engine.Close()
 	rawdb.PopUncleanShutdownMarker(s.chainDb)
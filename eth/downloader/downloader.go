@@ -18,6 +18,7 @@
 package downloader
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/big"
@@ -37,7 +38,9 @@ import (
 	"github.com/token/log"
 	"github.com/token/metrics"
 	"github.com/token/params"
+	"github.com/token/tracing"
 	"github.com/token/trie"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -107,7 +110,8 @@ type Downloader struct {
 	blockchain BlockChain
 
 	// Callbacks
-	dropPeer peerDropFn // Drops a peer for misbehaving
+	dropPeer        peerDropFn // Drops a peer for misbehaving
+	dropInvalidPeer peerDropFn // Drops a peer for delivering an invalid chain
 
 	// Status
 	synchroniseMock func(id string, hash common.Hash) error // Replacement for synchronise during testing
@@ -204,30 +208,36 @@ type BlockChain interface {
 }
 
 // New creates a new downloader to fetch hashes and blocks from remote peers.
-func New(checkpoint uint64, stateDb ethdb.Database, stateBloom *trie.SyncBloom, mux *event.TypeMux, chain BlockChain, lightchain LightChain, dropPeer peerDropFn) *Downloader {
+// Peers failing the validation of the delivered chain are dropped through
+// dropInvalidPeer, or through dropPeer like slow peers if it's nil.
+func New(checkpoint uint64, stateDb ethdb.Database, stateBloom *trie.SyncBloom, mux *event.TypeMux, chain BlockChain, lightchain LightChain, dropPeer peerDropFn, dropInvalidPeer peerDropFn) *Downloader {
 	if lightchain == nil {
 		lightchain = chain
 	}
+	if dropInvalidPeer == nil {
+		dropInvalidPeer = dropPeer
+	}
 	dl := &Downloader{
-		stateDB:        stateDb,
-		stateBloom:     stateBloom,
-		mux:            mux,
-		checkpoint:     checkpoint,
-		queue:          newQueue(blockCacheMaxItems, blockCacheInitialItems),
-		peers:          newPeerSet(),
-		blockchain:     chain,
-		lightchain:     lightchain,
-		dropPeer:       dropPeer,
-		headerCh:       make(chan dataPack, 1),
-		bodyCh:         make(chan dataPack, 1),
-		receiptCh:      make(chan dataPack, 1),
-		bodyWakeCh:     make(chan bool, 1),
-		receiptWakeCh:  make(chan bool, 1),
-		headerProcCh:   make(chan []*types.Header, 1),
-		quitCh:         make(chan struct{}),
-		stateCh:        make(chan dataPack),
-		SnapSyncer:     snap.NewSyncer(stateDb),
-		stateSyncStart: make(chan *stateSync),
+		stateDB:         stateDb,
+		stateBloom:      stateBloom,
+		mux:             mux,
+		checkpoint:      checkpoint,
+		queue:           newQueue(blockCacheMaxItems, blockCacheInitialItems),
+		peers:           newPeerSet(),
+		blockchain:      chain,
+		lightchain:      lightchain,
+		dropPeer:        dropPeer,
+		dropInvalidPeer: dropInvalidPeer,
+		headerCh:        make(chan dataPack, 1),
+		bodyCh:          make(chan dataPack, 1),
+		receiptCh:       make(chan dataPack, 1),
+		bodyWakeCh:      make(chan bool, 1),
+		receiptWakeCh:   make(chan bool, 1),
+		headerProcCh:    make(chan []*types.Header, 1),
+		quitCh:          make(chan struct{}),
+		stateCh:         make(chan dataPack),
+		SnapSyncer:      snap.NewSyncer(stateDb),
+		stateSyncStart:  make(chan *stateSync),
 		syncStatsState: stateSyncStats{
 			processed: rawdb.ReadFastTrieProgress(stateDb),
 		},
@@ -337,6 +347,9 @@ func (d *Downloader) Synchronise(id string, head common.Hash, td *big.Int, mode
 			// The dropPeer method is nil when `--copydb` is used for a local copy.
 			// Timeouts can occur if e.g. compaction hits at the wrong time, and can be ignored
 			log.Warn("Downloader wants to drop peer, but peerdrop-function is not set", "peer", id)
+		} else if errors.Is(err, errInvalidChain) || errors.Is(err, errBadPeer) || errors.Is(err, errInvalidAncestor) {
+			// The peer delivered data failing validation, not merely slow
+			d.dropInvalidPeer(id)
 		} else {
 			d.dropPeer(id)
 		}
@@ -458,6 +471,14 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		log.Debug("Synchronisation terminated", "elapsed", common.PrettyDuration(time.Since(start)))
 	}(time.Now())
 
+	ctx, span := tracing.Start(context.Background(), "downloader.sync", attribute.String("peer", p.id), attribute.String("mode", mode.String()))
+	defer func() {
+		if err != errCanceled {
+			tracing.SetError(span, err)
+		}
+		span.End()
+	}()
+
 	// Look up the sync boundaries: the common ancestor and the target block
 	latest, pivot, err := d.fetchHead(p)
 	if err != nil {
@@ -476,6 +497,7 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 	if err != nil {
 		return err
 	}
+	span.SetAttributes(tracing.Uint64("origin", origin), tracing.Uint64("height", height))
 	d.syncStatsLock.Lock()
 	if d.syncStatsChainHeight <= origin || d.syncStatsChainOrigin > origin {
 		d.syncStatsChainOrigin = origin
@@ -546,23 +568,37 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		d.syncInitHook(origin, height)
 	}
 	fetchers := []func() error{
-		func() error { return d.fetchHeaders(p, origin+1) }, // Headers are always retrieved
-		func() error { return d.fetchBodies(origin + 1) },   // Bodies are retrieved during normal and fast sync
-		func() error { return d.fetchReceipts(origin + 1) }, // Receipts are retrieved during fast sync
-		func() error { return d.processHeaders(origin+1, td) },
+		traceFetcher(ctx, "fetchHeaders", func() error { return d.fetchHeaders(p, origin+1) }),  // Headers are always retrieved
+		traceFetcher(ctx, "fetchBodies", func() error { return d.fetchBodies(origin + 1) }),     // Bodies are retrieved during normal and fast sync
+		traceFetcher(ctx, "fetchReceipts", func() error { return d.fetchReceipts(origin + 1) }), // Receipts are retrieved during fast sync
+		traceFetcher(ctx, "processHeaders", func() error { return d.processHeaders(origin+1, td) }),
 	}
 	if mode == FastSync {
 		d.pivotLock.Lock()
 		d.pivotHeader = pivot
 		d.pivotLock.Unlock()
 
-		fetchers = append(fetchers, func() error { return d.processFastSyncContent() })
+		fetchers = append(fetchers, traceFetcher(ctx, "processFastSyncContent", d.processFastSyncContent))
 	} else if mode == FullSync {
-		fetchers = append(fetchers, d.processFullSyncContent)
+		fetchers = append(fetchers, traceFetcher(ctx, "processFullSyncContent", d.processFullSyncContent))
 	}
 	return d.spawnSync(fetchers)
 }
 
+// traceFetcher wraps a sync fetcher to run within a span, child of the sync's.
+func traceFetcher(ctx context.Context, name string, fetcher func() error) func() error {
+	return func() error {
+		_, span := tracing.Start(ctx, name)
+		defer span.End()
+
+		err := fetcher()
+		if err != errCanceled {
+			tracing.SetError(span, err)
+		}
+		return err
+	}
+}
+
 // spawnSync runs d.process and all given fetcher functions to completion in
 // separate goroutines, returning the first error that appears.
 func (d *Downloader) spawnSync(fetchers []func() error) error {
@@ -53,6 +53,7 @@ type downloadTester struct {
 	stateDb ethdb.Database // Database used by the tester for syncing from peers
 	peerDb  ethdb.Database // Database of the peers containing all data
 	peers   map[string]*downloadTesterPeer
+	invalid map[string]bool // Peers dropped for failing validation
 
 	ownHashes   []common.Hash                  // Hash chain belonging to the tester
 	ownHeaders  map[common.Hash]*types.Header  // Headers belonging to the tester
@@ -74,6 +75,7 @@ func newTester() *downloadTester {
 		genesis:     testGenesis,
 		peerDb:      testDB,
 		peers:       make(map[string]*downloadTesterPeer),
+		invalid:     make(map[string]bool),
 		ownHashes:   []common.Hash{testGenesis.Hash()},
 		ownHeaders:  map[common.Hash]*types.Header{testGenesis.Hash(): testGenesis.Header()},
 		ownBlocks:   map[common.Hash]*types.Block{testGenesis.Hash(): testGenesis},
@@ -89,7 +91,7 @@ func newTester() *downloadTester {
 	tester.stateDb = rawdb.NewMemoryDatabase()
 	tester.stateDb.Put(testGenesis.Root().Bytes(), []byte{0x00})
 
-	tester.downloader = New(0, tester.stateDb, trie.NewSyncBloom(1, tester.stateDb), new(event.TypeMux), tester, nil, tester.dropPeer)
+	tester.downloader = New(0, tester.stateDb, trie.NewSyncBloom(1, tester.stateDb), new(event.TypeMux), tester, nil, tester.dropPeer, tester.dropInvalidPeer)
 	return tester
 }
 
@@ -410,6 +412,15 @@ func (dl *downloadTester) dropPeer(id string) {
 	dl.downloader.UnregisterPeer(id)
 }
 
+// dropInvalidPeer simulates a hard peer removal for failing validation.
+func (dl *downloadTester) dropInvalidPeer(id string) {
+	dl.lock.Lock()
+	dl.invalid[id] = true
+	dl.lock.Unlock()
+
+	dl.dropPeer(id)
+}
+
 // Snapshots implements the BlockChain interface for the downloader, but is a noop.
 func (dl *downloadTester) Snapshots() *snapshot.Tree {
 	return nil
@@ -1157,24 +1168,25 @@ func testBlockHeaderAttackerDropping(t *testing.T, protocol uint) {
 
 	// Define the disconnection requirement for individual hash fetch errors
 	tests := []struct {
-		result error
-		drop   bool
+		result  error
+		drop    bool
+		invalid bool // Whether the peer is dropped for failing validation
 	}{
-		{nil, false},                        // Sync succeeded, all is well
-		{errBusy, false},                    // Sync is already in progress, no problem
-		{errUnknownPeer, false},             // Peer is unknown, was already dropped, don't double drop
-		{errBadPeer, true},                  // Peer was deemed bad for some reason, drop it
-		{errStallingPeer, true},             // Peer was detected to be stalling, drop it
-		{errUnsyncedPeer, true},             // Peer was detected to be unsynced, drop it
-		{errNoPeers, false},                 // No peers to download from, soft race, no issue
-		{errTimeout, true},                  // No hashes received in due time, drop the peer
-		{errEmptyHeaderSet, true},           // No headers were returned as a response, drop as it's a dead end
-		{errPeersUnavailable, true},         // Nobody had the advertised blocks, drop the advertiser
-		{errInvalidAncestor, true},          // Agreed upon ancestor is not acceptable, drop the chain rewriter
-		{errInvalidChain, true},             // Hash chain was detected as invalid, definitely drop
-		{errInvalidBody, false},             // A bad peer was detected, but not the sync origin
-		{errInvalidReceipt, false},          // A bad peer was detected, but not the sync origin
-		{errCancelContentProcessing, false}, // Synchronisation was canceled, origin may be innocent, don't drop
+		{nil, false, false},                        // Sync succeeded, all is well
+		{errBusy, false, false},                    // Sync is already in progress, no problem
+		{errUnknownPeer, false, false},             // Peer is unknown, was already dropped, don't double drop
+		{errBadPeer, true, true},                   // Peer was deemed bad for some reason, drop it
+		{errStallingPeer, true, false},             // Peer was detected to be stalling, drop it
+		{errUnsyncedPeer, true, false},             // Peer was detected to be unsynced, drop it
+		{errNoPeers, false, false},                 // No peers to download from, soft race, no issue
+		{errTimeout, true, false},                  // No hashes received in due time, drop the peer
+		{errEmptyHeaderSet, true, false},           // No headers were returned as a response, drop as it's a dead end
+		{errPeersUnavailable, true, false},         // Nobody had the advertised blocks, drop the advertiser
+		{errInvalidAncestor, true, true},           // Agreed upon ancestor is not acceptable, drop the chain rewriter
+		{errInvalidChain, true, true},              // Hash chain was detected as invalid, definitely drop
+		{errInvalidBody, false, false},             // A bad peer was detected, but not the sync origin
+		{errInvalidReceipt, false, false},          // A bad peer was detected, but not the sync origin
+		{errCancelContentProcessing, false, false}, // Synchronisation was canceled, origin may be innocent, don't drop
 	}
 	// Run the tests and check disconnection status
 	tester := newTester()
@@ -1197,6 +1209,9 @@ func testBlockHeaderAttackerDropping(t *testing.T, protocol uint) {
 		if _, ok := tester.peers[id]; !ok != tt.drop {
 			t.Errorf("test %d: peer drop mismatch for %v: have %v, want %v", i, tt.result, !ok, tt.drop)
 		}
+		if invalid := tester.invalid[id]; invalid != tt.invalid {
+			t.Errorf("test %d: invalid peer drop mismatch for %v: have %v, want %v", i, tt.result, invalid, tt.invalid)
+		}
 	}
 }
 
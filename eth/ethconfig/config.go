@@ -31,6 +31,7 @@ import (
 	"github.com/token/consensus/clique"
 	"github.com/token/consensus/ethash"
 	"github.com/token/core"
+	"github.com/token/core/rawdb"
 	"github.com/token/eth/downloader"
 	"github.com/token/eth/gasprice"
 	"github.com/token/ethdb"
@@ -42,18 +43,22 @@ import (
 
 // FullNodeGPO contains default gasprice oracle settings for full node.
 var FullNodeGPO = gasprice.Config{
-	Blocks:      20,
-	Percentile:  60,
-	MaxPrice:    gasprice.DefaultMaxPrice,
-	IgnorePrice: gasprice.DefaultIgnorePrice,
+	Blocks:           20,
+	Percentile:       60,
+	MaxHeaderHistory: 1024,
+	MaxBlockHistory:  1024,
+	MaxPrice:         gasprice.DefaultMaxPrice,
+	IgnorePrice:      gasprice.DefaultIgnorePrice,
 }
 
 // LightClientGPO contains default gasprice oracle settings for light client.
 var LightClientGPO = gasprice.Config{
-	Blocks:      2,
-	Percentile:  60,
-	MaxPrice:    gasprice.DefaultMaxPrice,
-	IgnorePrice: gasprice.DefaultIgnorePrice,
+	Blocks:           2,
+	Percentile:       60,
+	MaxHeaderHistory: 300,
+	MaxBlockHistory:  5,
+	MaxPrice:         gasprice.DefaultMaxPrice,
+	IgnorePrice:      gasprice.DefaultIgnorePrice,
 }
 
 // Defaults contains default settings for use on the nbn main net.
@@ -79,11 +84,17 @@ var Defaults = Config{
 	TrieDirtyCache:          256,
 	TrieTimeout:             60 * time.Minute,
 	SnapshotCache:           102,
+	StateScheme:             rawdb.HashScheme,
+	StateHistory:            90000,
+	StatePruneBloomSize:     2048,
+	StatePruneThrottle:      100 * time.Millisecond,
 	Miner: miner.Config{
 		GasFloor: 30000000,
 		GasCeil:  30000000,
 		GasPrice: big.NewInt(params.GGasPrice),
 		Recommit: 3 * time.Second,
+
+		SystemGasReserve: 3000000,
 	},
 	TxPool:      core.DefaultTxPoolConfig,
 	RPCGasCap:   50000000,
@@ -132,7 +143,9 @@ type Config struct {
 	NoPruning  bool // Whether to disable pruning and flush everything to disk
 	NoPrefetch bool // Whether to disable prefetching and only load state on demand
 
-	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
+	TxLookupLimit  uint64  `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
+	TraceIndex     bool    `toml:",omitempty"` // Whether to index the call traces of new blocks
+	TraceIndexTail *uint64 `toml:",omitempty"` // Oldest block to backfill the call trace index to, nil to start at the head
 
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
@@ -164,6 +177,12 @@ type Config struct {
 	TrieTimeout             time.Duration
 	SnapshotCache           int
 	Preimages               bool
+	StateScheme             string `toml:",omitempty"` // Scheme of the state trie node storage ("hash" or "path")
+	StateHistory            uint64 `toml:",omitempty"` // Number of recent states the path-based scheme can roll back to
+
+	// Online state pruning options
+	StatePruneBloomSize uint64        `toml:",omitempty"` // Megabytes of memory allocated to the state bloom
+	StatePruneThrottle  time.Duration `toml:",omitempty"` // Pause between two deletion batches
 
 	// Mining options
 	Miner miner.Config
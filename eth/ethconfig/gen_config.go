@@ -26,6 +26,8 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		NoPruning               bool
 		NoPrefetch              bool
 		TxLookupLimit           uint64                 `toml:",omitempty"`
+		TraceIndex              bool                   `toml:",omitempty"`
+		TraceIndexTail          *uint64                `toml:",omitempty"`
 		Whitelist               map[uint64]common.Hash `toml:"-"`
 		LightServ               int                    `toml:",omitempty"`
 		LightIngress            int                    `toml:",omitempty"`
@@ -48,6 +50,10 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		TrieTimeout             time.Duration
 		SnapshotCache           int
 		Preimages               bool
+		StateScheme             string        `toml:",omitempty"`
+		StateHistory            uint64        `toml:",omitempty"`
+		StatePruneBloomSize     uint64        `toml:",omitempty"`
+		StatePruneThrottle      time.Duration `toml:",omitempty"`
 		Miner                   miner.Config
 		Ethash                  ethash.Config
 		TxPool                  core.TxPoolConfig
@@ -70,6 +76,8 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.NoPruning = c.NoPruning
 	enc.NoPrefetch = c.NoPrefetch
 	enc.TxLookupLimit = c.TxLookupLimit
+	enc.TraceIndex = c.TraceIndex
+	enc.TraceIndexTail = c.TraceIndexTail
 	enc.Whitelist = c.Whitelist
 	enc.LightServ = c.LightServ
 	enc.LightIngress = c.LightIngress
@@ -92,6 +100,10 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.TrieTimeout = c.TrieTimeout
 	enc.SnapshotCache = c.SnapshotCache
 	enc.Preimages = c.Preimages
+	enc.StateScheme = c.StateScheme
+	enc.StateHistory = c.StateHistory
+	enc.StatePruneBloomSize = c.StatePruneBloomSize
+	enc.StatePruneThrottle = c.StatePruneThrottle
 	enc.Miner = c.Miner
 	enc.Ethash = c.Ethash
 	enc.TxPool = c.TxPool
@@ -118,6 +130,8 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		NoPruning               *bool
 		NoPrefetch              *bool
 		TxLookupLimit           *uint64                `toml:",omitempty"`
+		TraceIndex              *bool                  `toml:",omitempty"`
+		TraceIndexTail          *uint64                `toml:",omitempty"`
 		Whitelist               map[uint64]common.Hash `toml:"-"`
 		LightServ               *int                   `toml:",omitempty"`
 		LightIngress            *int                   `toml:",omitempty"`
@@ -140,6 +154,10 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		TrieTimeout             *time.Duration
 		SnapshotCache           *int
 		Preimages               *bool
+		StateScheme             *string        `toml:",omitempty"`
+		StateHistory            *uint64        `toml:",omitempty"`
+		StatePruneBloomSize     *uint64        `toml:",omitempty"`
+		StatePruneThrottle      *time.Duration `toml:",omitempty"`
 		Miner                   *miner.Config
 		Ethash                  *ethash.Config
 		TxPool                  *core.TxPoolConfig
@@ -181,6 +199,12 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.TxLookupLimit != nil {
 		c.TxLookupLimit = *dec.TxLookupLimit
 	}
+	if dec.TraceIndex != nil {
+		c.TraceIndex = *dec.TraceIndex
+	}
+	if dec.TraceIndexTail != nil {
+		c.TraceIndexTail = dec.TraceIndexTail
+	}
 	if dec.Whitelist != nil {
 		c.Whitelist = dec.Whitelist
 	}
@@ -247,6 +271,18 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.Preimages != nil {
 		c.Preimages = *dec.Preimages
 	}
+	if dec.StateScheme != nil {
+		c.StateScheme = *dec.StateScheme
+	}
+	if dec.StateHistory != nil {
+		c.StateHistory = *dec.StateHistory
+	}
+	if dec.StatePruneBloomSize != nil {
+		c.StatePruneBloomSize = *dec.StatePruneBloomSize
+	}
+	if dec.StatePruneThrottle != nil {
+		c.StatePruneThrottle = *dec.StatePruneThrottle
+	}
 	if dec.Miner != nil {
 		c.Miner = *dec.Miner
 	}
@@ -0,0 +1,233 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/token/common"
+	"github.com/token/consensus/misc"
+	"github.com/token/core"
+	"github.com/token/core/types"
+	"github.com/token/event"
+	"github.com/token/params"
+	"github.com/token/rpc"
+	"github.com/token/trie"
+)
+
+// historyBackend is a synthetic chain of 33 blocks (0-32) with one dynamic fee
+// transaction per block, London activated at block 16.
+type historyBackend struct {
+	config   *params.ChainConfig
+	blocks   []*types.Block
+	receipts []types.Receipts
+	pending  bool // head block is served as the pending block
+	feed     event.Feed
+}
+
+func newHistoryBackend(pending bool) *historyBackend {
+	config := *params.TestChainConfig
+	config.LondonBlock = big.NewInt(16)
+
+	b := &historyBackend{config: &config, pending: pending}
+	var parent *types.Header
+	for i := 0; i <= 32; i++ {
+		header := &types.Header{
+			Number:   big.NewInt(int64(i)),
+			GasLimit: 8000000,
+		}
+		if parent != nil {
+			header.ParentHash = parent.Hash()
+			if config.IsLondon(header.Number) {
+				header.BaseFee = misc.CalcBaseFee(&config, parent)
+			}
+		}
+		var (
+			txs      types.Transactions
+			receipts types.Receipts
+		)
+		if i > 0 {
+			txs = append(txs, types.NewTx(&types.DynamicFeeTx{
+				ChainID:   config.ChainID,
+				Nonce:     uint64(i - 1),
+				To:        &common.Address{},
+				Gas:       30000,
+				GasFeeCap: big.NewInt(100 * params.GWei),
+				GasTipCap: big.NewInt(int64(i) * params.GWei),
+			}))
+			receipts = append(receipts, &types.Receipt{Status: types.ReceiptStatusSuccessful, GasUsed: params.TxGas, CumulativeGasUsed: params.TxGas})
+			header.GasUsed = params.TxGas
+		}
+		block := types.NewBlock(header, txs, nil, receipts, trie.NewStackTrie(nil))
+		b.blocks = append(b.blocks, block)
+		b.receipts = append(b.receipts, receipts)
+		parent = block.Header()
+	}
+	return b
+}
+
+func (b *historyBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	block, _ := b.BlockByNumber(ctx, number)
+	if block == nil {
+		return nil, nil
+	}
+	return block.Header(), nil
+}
+
+func (b *historyBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	if number == rpc.LatestBlockNumber {
+		number = rpc.BlockNumber(len(b.blocks) - 1)
+	}
+	if number < 0 || int(number) >= len(b.blocks) {
+		return nil, nil
+	}
+	return b.blocks[number], nil
+}
+
+func (b *historyBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	for i, block := range b.blocks {
+		if block.Hash() == hash {
+			return b.receipts[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (b *historyBackend) PendingBlockAndReceipts() (*types.Block, types.Receipts) {
+	if b.pending {
+		return b.blocks[len(b.blocks)-1], b.receipts[len(b.receipts)-1]
+	}
+	return nil, nil
+}
+
+func (b *historyBackend) ChainConfig() *params.ChainConfig {
+	return b.config
+}
+
+func (b *historyBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return b.feed.Subscribe(ch)
+}
+
+func TestFeeHistory(t *testing.T) {
+	var cases = []struct {
+		pending             bool
+		maxHeader, maxBlock int
+		count               int
+		last                rpc.BlockNumber
+		percent             []float64
+		expFirst            uint64
+		expCount            int
+		expErr              error
+	}{
+		{false, 1000, 1000, 10, 30, nil, 21, 10, nil},
+		{false, 1000, 1000, 10, 30, []float64{0, 10}, 21, 10, nil},
+		{false, 1000, 1000, 10, 30, []float64{20, 10}, 0, 0, errInvalidPercentile},
+		{false, 1000, 1000, 1000000000, 30, nil, 0, 31, nil},
+		{false, 1000, 1000, 1000000000, rpc.LatestBlockNumber, nil, 0, 33, nil},
+		{false, 1000, 1000, 10, 40, nil, 0, 0, errRequestBeyondHead},
+		{false, 20, 2, 100, rpc.LatestBlockNumber, nil, 13, 20, nil},
+		{false, 20, 2, 100, rpc.LatestBlockNumber, []float64{0, 10}, 31, 2, nil},
+		{false, 20, 2, 100, 32, []float64{0, 10}, 31, 2, nil},
+		{false, 1000, 1000, 1, rpc.PendingBlockNumber, nil, 0, 0, nil},
+		{false, 1000, 1000, 2, rpc.PendingBlockNumber, nil, 32, 1, nil},
+		{true, 1000, 1000, 2, rpc.PendingBlockNumber, nil, 31, 2, nil},
+		{true, 1000, 1000, 2, rpc.PendingBlockNumber, []float64{0, 10}, 31, 2, nil},
+	}
+	for i, c := range cases {
+		config := Config{
+			MaxHeaderHistory: c.maxHeader,
+			MaxBlockHistory:  c.maxBlock,
+		}
+		backend := newHistoryBackend(c.pending)
+		oracle := NewOracle(backend, config)
+
+		first, reward, baseFee, ratio, err := oracle.FeeHistory(context.Background(), c.count, c.last, c.percent)
+
+		expReward := c.expCount
+		if len(c.percent) == 0 {
+			expReward = 0
+		}
+		expBaseFee := c.expCount
+		if expBaseFee != 0 {
+			expBaseFee++
+		}
+
+		if first.Uint64() != c.expFirst {
+			t.Fatalf("Test case %d: first block mismatch, want %d, got %d", i, c.expFirst, first)
+		}
+		if len(reward) != expReward {
+			t.Fatalf("Test case %d: reward array length mismatch, want %d, got %d", i, expReward, len(reward))
+		}
+		if len(baseFee) != expBaseFee {
+			t.Fatalf("Test case %d: baseFee array length mismatch, want %d, got %d", i, expBaseFee, len(baseFee))
+		}
+		if len(ratio) != c.expCount {
+			t.Fatalf("Test case %d: gasUsedRatio array length mismatch, want %d, got %d", i, c.expCount, len(ratio))
+		}
+		if err != c.expErr && !errors.Is(err, c.expErr) {
+			t.Fatalf("Test case %d: error mismatch, want %v, got %v", i, c.expErr, err)
+		}
+	}
+}
+
+func TestFeeHistoryRewards(t *testing.T) {
+	backend := newHistoryBackend(false)
+	oracle := NewOracle(backend, Config{MaxHeaderHistory: 1000, MaxBlockHistory: 1000})
+
+	first, reward, baseFee, ratio, err := oracle.FeeHistory(context.Background(), 2, 20, []float64{50})
+	if err != nil {
+		t.Fatalf("failed to retrieve fee history: %v", err)
+	}
+	if first.Uint64() != 19 {
+		t.Fatalf("first block mismatch: have %d, want 19", first)
+	}
+	// Each block has a single transaction tipping its number in gwei
+	for i, want := range []int64{19, 20} {
+		if have := reward[i][0]; have.Cmp(big.NewInt(want*params.GWei)) != 0 {
+			t.Errorf("block %d: reward mismatch: have %v, want %v", want, have, want*params.GWei)
+		}
+		if have := ratio[i]; have != float64(params.TxGas)/8000000 {
+			t.Errorf("block %d: gas used ratio mismatch: have %v", want, have)
+		}
+	}
+	// The base fee of the block after the range is derived from the last one
+	if want := misc.CalcBaseFee(backend.config, backend.blocks[20].Header()); baseFee[2].Cmp(want) != 0 {
+		t.Errorf("next base fee mismatch: have %v, want %v", baseFee[2], want)
+	}
+	// A second query must be served from the cache with the same result
+	_, cached, _, _, _ := oracle.FeeHistory(context.Background(), 2, 20, []float64{50})
+	if cached[1][0].Cmp(reward[1][0]) != 0 {
+		t.Errorf("cached reward mismatch: have %v, want %v", cached[1][0], reward[1][0])
+	}
+}
+
+// Tests that stopping the oracle terminates its chain head subscription.
+func TestOracleStop(t *testing.T) {
+	backend := newHistoryBackend(false)
+	oracle := NewOracle(backend, Config{MaxHeaderHistory: 1000, MaxBlockHistory: 1000})
+
+	if n := backend.feed.Send(core.ChainHeadEvent{Block: backend.blocks[20]}); n != 1 {
+		t.Fatalf("subscriber count mismatch: have %d, want 1", n)
+	}
+	oracle.Stop()
+	if n := backend.feed.Send(core.ChainHeadEvent{Block: backend.blocks[20]}); n != 0 {
+		t.Fatalf("subscriber count after stop mismatch: have %d, want 0", n)
+	}
+}
@@ -184,7 +184,7 @@ func newHandler(config *handlerConfig) (*handler, error) {
 	if atomic.LoadUint32(&h.fastSync) == 1 && atomic.LoadUint32(&h.snapSync) == 0 {
 		h.stateBloom = trie.NewSyncBloom(config.BloomCache, config.Database)
 	}
-	h.downloader = downloader.New(h.checkpointNumber, config.Database, h.stateBloom, h.eventMux, h.chain, nil, h.removePeer)
+	h.downloader = downloader.New(h.checkpointNumber, config.Database, h.stateBloom, h.eventMux, h.chain, nil, h.removePeer, h.removeInvalidPeer)
 
 	// Construct the fetcher (short sync)
 	validator := func(header *types.Header) error {
@@ -219,7 +219,7 @@ func newHandler(config *handlerConfig) (*handler, error) {
 		}
 		return n, err
 	}
-	h.blockFetcher = fetcher.NewBlockFetcher(false, nil, h.chain.GetBlockByHash, validator, h.BroadcastBlock, heighter, nil, inserter, h.removePeer)
+	h.blockFetcher = fetcher.NewBlockFetcher(false, nil, h.chain.GetBlockByHash, validator, h.BroadcastBlock, heighter, nil, inserter, h.removeInvalidPeer)
 
 	fetchTx := func(peer string, hashes []common.Hash) error {
 		p := h.peers.peer(peer)
@@ -354,10 +354,22 @@ func (h *handler) runSnapExtension(peer *snap.Peer, handler snap.Handler) error
 	return handler(peer)
 }
 
-// removePeer requests disconnection of a peer.
+// removePeer requests disconnection of a peer dropped by the syncer for being
+// slow or out of sync, only a minor penalty is reported against it.
 func (h *handler) removePeer(id string) {
 	peer := h.peers.peer(id)
 	if peer != nil {
+		peer.Peer.Report(p2p.PenaltyMinor, "dropped by syncer")
+		peer.Peer.Disconnect(p2p.DiscUselessPeer)
+	}
+}
+
+// removeInvalidPeer requests disconnection of a peer which propagated or
+// delivered invalid blocks or headers, reporting a major penalty against it.
+func (h *handler) removeInvalidPeer(id string) {
+	peer := h.peers.peer(id)
+	if peer != nil {
+		peer.Peer.Report(p2p.PenaltyMajor, "invalid block or header")
 		peer.Peer.Disconnect(p2p.DiscUselessPeer)
 	}
 }
@@ -448,8 +460,15 @@ func (h *handler) BroadcastBlock(block *types.Block, propagate bool) {
 			log.Error("Propagating dangling block", "number", block.Number(), "hash", hash)
 			return
 		}
-		// Send the block to a subset of our peers
-		transfer := peers[:int(math.Sqrt(float64(len(peers))))]
+		// Send the block to a subset of our peers, always including the sentries
+		// and validators. Blocks sealed by a validator are sent to all peers.
+		var transfer []*ethPeer
+		if origin, ok := block.ReceivedFrom.(*eth.Peer); ok && origin.Validator() {
+			transfer = peers
+		} else {
+			priority, others := splitPriorityPeers(peers)
+			transfer = append(priority, others[:int(math.Sqrt(float64(len(others))))]...)
+		}
 		for _, peer := range transfer {
 			peer.AsyncSendNewBlock(block, td)
 		}
@@ -466,7 +485,8 @@ func (h *handler) BroadcastBlock(block *types.Block, propagate bool) {
 }
 
 // BroadcastTransactions will propagate a batch of transactions
-// - To a square root of all peers
+// - To all sentries and validators
+// - To a square root of all other peers
 // - And, separately, as announcements to all peers which are not known to
 // already have the given transaction.
 func (h *handler) BroadcastTransactions(txs types.Transactions) {
@@ -482,10 +502,11 @@ func (h *handler) BroadcastTransactions(txs types.Transactions) {
 	)
 	// Broadcast transactions to a batch of peers not knowing about it
 	for _, tx := range txs {
-		peers := h.peers.peersWithoutTransaction(tx.Hash())
-		// Send the tx unconditionally to a subset of our peers
+		priority, peers := splitPriorityPeers(h.peers.peersWithoutTransaction(tx.Hash()))
+		// Send the tx unconditionally to the sentries, validators and a subset of
+		// our other peers
 		numDirect := int(math.Sqrt(float64(len(peers))))
-		for _, peer := range peers[:numDirect] {
+		for _, peer := range append(priority, peers[:numDirect]...) {
 			txset[peer] = append(txset[peer], tx.Hash())
 		}
 		// For the remaining peers, send announcement only
@@ -508,6 +529,19 @@ func (h *handler) BroadcastTransactions(txs types.Transactions) {
 		"tx packs", directPeers, "broadcast txs", directCount)
 }
 
+// splitPriorityPeers separates the sentries and validators, which blocks and
+// transactions are relayed to with priority, from the rest of the peers.
+func splitPriorityPeers(peers []*ethPeer) (priority, others []*ethPeer) {
+	for _, peer := range peers {
+		if peer.Sentry() || peer.Validator() {
+			priority = append(priority, peer)
+		} else {
+			others = append(others, peer)
+		}
+	}
+	return priority, others
+}
+
 // minedBroadcastLoop sends mined blocks to connected peers.
 func (h *handler) minedBroadcastLoop() {
 	defer h.wg.Done()
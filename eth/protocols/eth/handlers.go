@@ -21,6 +21,7 @@ import (
 	"fmt"
 
 	"github.com/token/common"
+	"github.com/token/core/rawdb"
 	"github.com/token/core/types"
 	"github.com/token/log"
 	"github.com/token/rlp"
@@ -199,6 +200,10 @@ func answerGetNodeDataQuery(backend Backend, query GetNodeDataPacket, peer *Peer
 	var (
 		bytes int
 		nodes [][]byte
+
+		// The path-based scheme can't look persisted trie nodes up by hash,
+		// only serve the contract codes
+		codesOnly = backend.Chain().StateCache().TrieDB().Scheme() == rawdb.PathScheme
 	)
 	for lookups, hash := range query {
 		if bytes >= softResponseLimit || len(nodes) >= maxNodeDataServe ||
@@ -210,7 +215,13 @@ func answerGetNodeDataQuery(backend Backend, query GetNodeDataPacket, peer *Peer
 			// Only lookup the trie node if there's chance that we actually have it
 			continue
 		}
-		entry, err := backend.Chain().TrieNode(hash)
+		var (
+			entry []byte
+			err   error
+		)
+		if !codesOnly {
+			entry, err = backend.Chain().TrieNode(hash)
+		}
 		if len(entry) == 0 || err != nil {
 			// Read the contract code with prefix only to save unnecessary lookups.
 			entry, err = backend.Chain().ContractCodeWithPrefix(hash)
@@ -18,6 +18,7 @@ package snap
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"time"
 
@@ -122,6 +123,9 @@ func handle(backend Backend, peer *Peer) error {
 	for {
 		if err := handleMessage(backend, peer); err != nil {
 			peer.Log().Debug("Message handling failed in `snap`", "err", err)
+			if errors.Is(err, errDecode) || errors.Is(err, errMsgTooLarge) || errors.Is(err, errInvalidMsgCode) {
+				peer.Report(p2p.PenaltyMajor, err.Error())
+			}
 			return err
 		}
 	}
@@ -323,7 +327,7 @@ func handleMessage(backend Backend, peer *Peer) error {
 				if err := rlp.DecodeBytes(accTrie.Get(account[:]), &acc); err != nil {
 					return p2p.Send(peer.rw, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
 				}
-				stTrie, err := trie.New(acc.Root, backend.Chain().StateCache().TrieDB())
+				stTrie, err := trie.NewWithOwner(account, acc.Root, backend.Chain().StateCache().TrieDB())
 				if err != nil {
 					return p2p.Send(peer.rw, StorageRangesMsg, &StorageRangesPacket{ID: req.ID})
 				}
@@ -472,7 +476,7 @@ func handleMessage(backend Backend, peer *Peer) error {
 				if err != nil {
 					break
 				}
-				stTrie, err := trie.NewSecure(common.BytesToHash(account.Root), triedb)
+				stTrie, err := trie.NewSecureWithOwner(common.BytesToHash(pathset[0]), common.BytesToHash(account.Root), triedb)
 				loads++ // always account database reads, even for failures
 				if err != nil {
 					break
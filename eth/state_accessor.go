@@ -23,6 +23,7 @@ import (
 
 	"github.com/token/common"
 	"github.com/token/core"
+	"github.com/token/core/rawdb"
 	"github.com/token/core/state"
 	"github.com/token/core/types"
 	"github.com/token/core/vm"
@@ -59,7 +60,13 @@ func (eth *Ethereum) stateAtBlock(block *types.Block, reexec uint64, base *state
 
 		// Create an ephemeral trie.Database for isolating the live one. Otherwise
 		// the internal junks created by tracing will be persisted into the disk.
-		database = state.NewDatabaseWithConfig(eth.chainDb, &trie.Config{Cache: 16})
+		// The path-based scheme can only serve the recent states of the live one,
+		// whose diff layers are kept in memory.
+		if eth.blockchain.StateCache().TrieDB().Scheme() == rawdb.PathScheme {
+			database = eth.blockchain.StateCache()
+		} else {
+			database = state.NewDatabaseWithConfig(eth.chainDb, &trie.Config{Cache: 16})
+		}
 
 		// If we didn't check the dirty database, do check the clean one, otherwise
 		// we would rewind past a persisted block (specific corner case is chain
@@ -853,8 +853,9 @@ func (api *API) traceTx(ctx context.Context, message core.Message, txctx *txTrac
 	}
 }
 
-// APIs return the collection of RPC services the tracer package offers.
-func APIs(backend Backend) []rpc.API {
+// APIs return the collection of RPC services the tracer package offers. The
+// trace indexer is optional, flat call traces are re-executed without it.
+func APIs(backend Backend, indexer *TraceIndexer) []rpc.API {
 	// Append all the local APIs and return
 	return []rpc.API{
 		{
@@ -863,5 +864,11 @@ func APIs(backend Backend) []rpc.API {
 			Service:   NewAPI(backend),
 			Public:    false,
 		},
+		{
+			Namespace: "trace",
+			Version:   "1.0",
+			Service:   NewTraceAPI(backend, indexer),
+			Public:    false,
+		},
 	}
 }
@@ -0,0 +1,382 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/token/common"
+	"github.com/token/common/hexutil"
+	"github.com/token/core/vm"
+)
+
+// callFrame is a single call of the call tree built by callTracer. Its JSON form
+// matches the output of the JavaScript callTracer.
+type callFrame struct {
+	Type    string          `json:"type"`
+	From    common.Address  `json:"from"`
+	To      common.Address  `json:"to"`
+	Input   hexutil.Bytes   `json:"input"`
+	Output  *hexutil.Bytes  `json:"output,omitempty"`
+	Gas     *hexutil.Uint64 `json:"gas,omitempty"`
+	GasUsed *hexutil.Uint64 `json:"gasUsed,omitempty"`
+	Value   *hexutil.Big    `json:"value,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Calls   []*callFrame    `json:"calls,omitempty"`
+
+	// Bookkeeping while the call is running
+	gasIn, gasCost uint64
+	outOff, outLen uint64
+}
+
+// callTracer is a native port of the JavaScript callTracer, collecting the tree
+// of internal calls made by a transaction. The tree is the basis of the flat
+// trace format served by the trace API.
+type callTracer struct {
+	callstack   []*callFrame
+	descended   bool
+	precompiles map[common.Address]struct{}
+	env         *vm.EVM
+}
+
+// newCallTracer creates a call tracer for a single transaction.
+func newCallTracer() *callTracer {
+	return &callTracer{callstack: []*callFrame{{}}}
+}
+
+func uint64Ptr(n uint64) *hexutil.Uint64 {
+	h := hexutil.Uint64(n)
+	return &h
+}
+
+func bytesPtr(b []byte) *hexutil.Bytes {
+	h := hexutil.Bytes(b)
+	return &h
+}
+
+// memorySlice copies a chunk of the memory, returning nothing if the requested
+// range is out of bounds.
+func memorySlice(mem *vm.Memory, off, size uint64) []byte {
+	if size == 0 || off+size < off || off+size > uint64(mem.Len()) {
+		return []byte{}
+	}
+	return mem.GetCopy(int64(off), int64(size))
+}
+
+// stackUint64 returns an item of the stack, saturated to 64 bits.
+func stackUint64(stack *vm.Stack, n int) uint64 {
+	item := stack.Back(n)
+	if !item.IsUint64() {
+		return ^uint64(0)
+	}
+	return item.Uint64()
+}
+
+// CaptureStart implements vm.Tracer, initializing the outermost call.
+func (t *callTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.env = env
+	t.precompiles = make(map[common.Address]struct{})
+	for _, addr := range vm.ActivePrecompiles(env.ChainConfig().Rules(env.Context.BlockNumber)) {
+		t.precompiles[addr] = struct{}{}
+	}
+	root := t.callstack[0]
+	root.Type = "CALL"
+	if create {
+		root.Type = "CREATE"
+	}
+	root.From, root.To = from, to
+	root.Input = common.CopyBytes(input)
+	root.Gas = uint64Ptr(gas)
+	if value != nil {
+		root.Value = (*hexutil.Big)(new(big.Int).Set(value))
+	} else {
+		root.Value = (*hexutil.Big)(new(big.Int))
+	}
+}
+
+// CaptureState implements vm.Tracer, tracking the calls entered and left.
+func (t *callTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if err != nil {
+		t.CaptureFault(env, pc, op, gas, cost, scope, depth, err)
+		return
+	}
+	var (
+		stack  = scope.Stack
+		memory = scope.Memory
+		self   = scope.Contract.Address()
+	)
+	switch op {
+	case vm.CREATE, vm.CREATE2:
+		// A new contract is being created, add to the call stack
+		t.callstack = append(t.callstack, &callFrame{
+			Type:    op.String(),
+			From:    self,
+			Input:   memorySlice(memory, stackUint64(stack, 1), stackUint64(stack, 2)),
+			Value:   (*hexutil.Big)(stack.Back(0).ToBig()),
+			gasIn:   gas,
+			gasCost: cost,
+		})
+		t.descended = true
+		return
+
+	case vm.SELFDESTRUCT:
+		// A contract is being self destructed, gather that as a subcall too
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, &callFrame{
+			Type:    op.String(),
+			From:    self,
+			To:      common.Address(stack.Back(0).Bytes20()),
+			Input:   []byte{},
+			Gas:     uint64Ptr(gas),
+			GasUsed: uint64Ptr(cost),
+			Value:   (*hexutil.Big)(env.StateDB.GetBalance(self)),
+		})
+		return
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		// A new method invocation is being done, skip pre-compiles as those are
+		// just fancy opcodes
+		to := common.Address(stack.Back(1).Bytes20())
+		if _, ok := t.precompiles[to]; ok {
+			return
+		}
+		off := 1
+		if op == vm.DELEGATECALL || op == vm.STATICCALL {
+			off = 0
+		}
+		call := &callFrame{
+			Type:    op.String(),
+			From:    self,
+			To:      to,
+			Input:   memorySlice(memory, stackUint64(stack, 2+off), stackUint64(stack, 3+off)),
+			gasIn:   gas,
+			gasCost: cost,
+			outOff:  stackUint64(stack, 4+off),
+			outLen:  stackUint64(stack, 5+off),
+		}
+		if op == vm.CALL || op == vm.CALLCODE {
+			call.Value = (*hexutil.Big)(stack.Back(2).ToBig())
+		}
+		t.callstack = append(t.callstack, call)
+		t.descended = true
+		return
+	}
+	// If we've just descended into an inner call, retrieve it's true allowance. It
+	// needs to be extracted from within the call as there may be funky gas dynamics
+	// with regard to requested and actually given gas (2300 stipend, 63/64 rule).
+	if t.descended {
+		if depth >= len(t.callstack) {
+			t.callstack[len(t.callstack)-1].Gas = uint64Ptr(gas)
+		}
+		t.descended = false
+	}
+	if op == vm.REVERT {
+		t.callstack[len(t.callstack)-1].Error = "execution reverted"
+		return
+	}
+	if depth == len(t.callstack)-1 {
+		// Pop off the last call and get the execution results
+		call := t.callstack[len(t.callstack)-1]
+		t.callstack = t.callstack[:len(t.callstack)-1]
+
+		ret := stack.Back(0)
+		if call.Type == "CREATE" || call.Type == "CREATE2" {
+			call.GasUsed = uint64Ptr(call.gasIn - call.gasCost - gas)
+			if !ret.IsZero() {
+				call.To = common.Address(ret.Bytes20())
+				call.Output = bytesPtr(env.StateDB.GetCode(call.To))
+			} else if call.Error == "" {
+				call.Error = "internal failure"
+			}
+		} else {
+			if call.Gas != nil {
+				call.GasUsed = uint64Ptr(call.gasIn - call.gasCost + uint64(*call.Gas) - gas)
+			}
+			if !ret.IsZero() {
+				call.Output = bytesPtr(memorySlice(memory, call.outOff, call.outLen))
+			} else if call.Error == "" {
+				call.Error = "internal failure"
+			}
+		}
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, call)
+	}
+}
+
+// CaptureFault implements vm.Tracer, flattening the failed call into its parent.
+func (t *callTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	// If the topmost call already reverted, don't handle the additional fault again
+	if t.callstack[len(t.callstack)-1].Error != "" {
+		return
+	}
+	call := t.callstack[len(t.callstack)-1]
+	t.callstack = t.callstack[:len(t.callstack)-1]
+	call.Error = err.Error()
+
+	// Consume all available gas
+	if call.Gas != nil {
+		call.GasUsed = call.Gas
+	}
+	if len(t.callstack) > 0 {
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, call)
+		return
+	}
+	// Last call failed too, leave it in the stack
+	t.callstack = append(t.callstack, call)
+}
+
+// CaptureEnd implements vm.Tracer, finalizing the outermost call.
+func (t *callTracer) CaptureEnd(output []byte, gasUsed uint64, _ time.Duration, err error) {
+	root := t.callstack[0]
+	root.GasUsed = uint64Ptr(gasUsed)
+	root.Output = bytesPtr(common.CopyBytes(output))
+	if root.Error == "" && err != nil {
+		root.Error = err.Error()
+	}
+	if root.Error != "" && (root.Error != "execution reverted" || len(output) == 0) {
+		root.Output = nil
+	}
+}
+
+// result returns the call tree of the traced transaction.
+func (t *callTracer) result() *callFrame {
+	return t.callstack[0]
+}
+
+// FlatCallAction is the action of a flat call trace. Calls fill in the call
+// fields, creations the init code and self destructs the refund fields.
+type FlatCallAction struct {
+	CallType      string          `json:"callType,omitempty"`
+	From          *common.Address `json:"from,omitempty"`
+	To            *common.Address `json:"to,omitempty"`
+	Gas           *hexutil.Uint64 `json:"gas,omitempty"`
+	Input         *hexutil.Bytes  `json:"input,omitempty"`
+	Init          *hexutil.Bytes  `json:"init,omitempty"`
+	Value         *hexutil.Big    `json:"value,omitempty"`
+	Address       *common.Address `json:"address,omitempty"`
+	RefundAddress *common.Address `json:"refundAddress,omitempty"`
+	Balance       *hexutil.Big    `json:"balance,omitempty"`
+}
+
+// FlatCallResult is the outcome of a successful call or creation.
+type FlatCallResult struct {
+	GasUsed *hexutil.Uint64 `json:"gasUsed,omitempty"`
+	Output  *hexutil.Bytes  `json:"output,omitempty"`
+	Address *common.Address `json:"address,omitempty"`
+	Code    *hexutil.Bytes  `json:"code,omitempty"`
+}
+
+// FlatCallTrace is a single call of a transaction in the flat (Parity style)
+// trace format. The position of the call in the call tree is given by its trace
+// address, the path of call indices leading to it from the outermost call.
+type FlatCallTrace struct {
+	Action              FlatCallAction  `json:"action"`
+	BlockHash           common.Hash     `json:"blockHash"`
+	BlockNumber         uint64          `json:"blockNumber"`
+	Error               string          `json:"error,omitempty"`
+	Result              *FlatCallResult `json:"result"`
+	Subtraces           int             `json:"subtraces"`
+	TraceAddress        []int           `json:"traceAddress"`
+	TransactionHash     common.Hash     `json:"transactionHash"`
+	TransactionPosition uint64          `json:"transactionPosition"`
+	Type                string          `json:"type"`
+}
+
+// sender returns the account the traced call originates from.
+func (t *FlatCallTrace) sender() common.Address {
+	if t.Action.From != nil {
+		return *t.Action.From
+	}
+	if t.Action.Address != nil {
+		return *t.Action.Address
+	}
+	return common.Address{}
+}
+
+// recipient returns the account the traced call is directed at, which is the
+// new contract for creations and the refund address for self destructs.
+func (t *FlatCallTrace) recipient() common.Address {
+	switch {
+	case t.Action.To != nil:
+		return *t.Action.To
+	case t.Result != nil && t.Result.Address != nil:
+		return *t.Result.Address
+	case t.Action.RefundAddress != nil:
+		return *t.Action.RefundAddress
+	}
+	return common.Address{}
+}
+
+// flattenCalls converts a call tree into flat call traces, outermost call first
+// and the inner calls in depth first order.
+func flattenCalls(root *callFrame, txctx *txTraceContext, number uint64) []*FlatCallTrace {
+	var (
+		traces []*FlatCallTrace
+		walk   func(frame *callFrame, address []int)
+	)
+	walk = func(frame *callFrame, address []int) {
+		trace := &FlatCallTrace{
+			BlockHash:           txctx.block,
+			BlockNumber:         number,
+			Error:               frame.Error,
+			Subtraces:           len(frame.Calls),
+			TraceAddress:        address,
+			TransactionHash:     txctx.hash,
+			TransactionPosition: uint64(txctx.index),
+		}
+		from, to := frame.From, frame.To
+		switch frame.Type {
+		case "CREATE", "CREATE2":
+			init := frame.Input
+			trace.Type = "create"
+			trace.Action = FlatCallAction{From: &from, Gas: frame.Gas, Init: &init, Value: frame.Value}
+			if frame.Error == "" {
+				var code hexutil.Bytes
+				if frame.Output != nil {
+					code = *frame.Output
+				}
+				trace.Result = &FlatCallResult{GasUsed: frame.GasUsed, Address: &to, Code: &code}
+			}
+		case "SELFDESTRUCT":
+			trace.Type = "suicide"
+			trace.Action = FlatCallAction{Address: &from, RefundAddress: &to, Balance: frame.Value}
+		default:
+			input := frame.Input
+			trace.Type = "call"
+			trace.Action = FlatCallAction{CallType: strings.ToLower(frame.Type), From: &from, To: &to, Gas: frame.Gas, Input: &input, Value: frame.Value}
+			if trace.Action.Value == nil {
+				trace.Action.Value = (*hexutil.Big)(new(big.Int))
+			}
+			if frame.Error == "" {
+				output := hexutil.Bytes{}
+				if frame.Output != nil {
+					output = *frame.Output
+				}
+				trace.Result = &FlatCallResult{GasUsed: frame.GasUsed, Output: &output}
+			}
+		}
+		traces = append(traces, trace)
+		for i, call := range frame.Calls {
+			walk(call, append(append([]int{}, address...), i))
+		}
+	}
+	walk(root, []int{})
+	return traces
+}
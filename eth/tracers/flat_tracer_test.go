@@ -0,0 +1,171 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/token/common"
+	"github.com/token/common/hexutil"
+	"github.com/token/core"
+	"github.com/token/core/rawdb"
+	"github.com/token/core/types"
+	"github.com/token/core/vm"
+	"github.com/token/rlp"
+	"github.com/token/tests"
+)
+
+// Tests that the native call tracer produces the same call trees as the
+// JavaScript callTracer on the call tracer test suite.
+func TestNativeCallTracer(t *testing.T) {
+	files, err := ioutil.ReadDir("testdata")
+	if err != nil {
+		t.Fatalf("failed to retrieve tracer test suite: %v", err)
+	}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "call_tracer_") {
+			continue
+		}
+		file := file // capture range variable
+		t.Run(camel(strings.TrimSuffix(strings.TrimPrefix(file.Name(), "call_tracer_"), ".json")), func(t *testing.T) {
+			t.Parallel()
+
+			blob, err := ioutil.ReadFile(filepath.Join("testdata", file.Name()))
+			if err != nil {
+				t.Fatalf("failed to read testcase: %v", err)
+			}
+			test := new(callTracerTest)
+			if err := json.Unmarshal(blob, test); err != nil {
+				t.Fatalf("failed to parse testcase: %v", err)
+			}
+			tx := new(types.Transaction)
+			if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
+				t.Fatalf("failed to parse testcase input: %v", err)
+			}
+			signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
+			origin, _ := signer.Sender(tx)
+			txContext := vm.TxContext{
+				Origin:   origin,
+				GasPrice: tx.GasPrice(),
+			}
+			context := vm.BlockContext{
+				CanTransfer: core.CanTransfer,
+				Transfer:    core.Transfer,
+				Coinbase:    test.Context.Miner,
+				BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
+				Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
+				Difficulty:  (*big.Int)(test.Context.Difficulty),
+				GasLimit:    uint64(test.Context.GasLimit),
+			}
+			_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), test.Genesis.Alloc, false)
+
+			tracer := newCallTracer()
+			evm := vm.NewEVM(context, txContext, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+
+			msg, err := tx.AsMessage(signer, nil)
+			if err != nil {
+				t.Fatalf("failed to prepare transaction for tracing: %v", err)
+			}
+			st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+			if _, err = st.TransitionDb(); err != nil {
+				t.Fatalf("failed to execute transaction: %v", err)
+			}
+			// Retrieve the trace result and compare against the etalon
+			res, err := json.Marshal(tracer.result())
+			if err != nil {
+				t.Fatalf("failed to marshal trace result: %v", err)
+			}
+			ret := new(callTrace)
+			if err := json.Unmarshal(res, ret); err != nil {
+				t.Fatalf("failed to unmarshal trace result: %v", err)
+			}
+			if !jsonEqual(ret, test.Result) {
+				t.Fatalf("trace mismatch: \nhave %+v\nwant %+v", ret, test.Result)
+			}
+		})
+	}
+}
+
+// Tests that call trees are flattened depth first with the right trace addresses
+// and action types.
+func TestFlattenCalls(t *testing.T) {
+	var (
+		alice = common.HexToAddress("0x01")
+		bob   = common.HexToAddress("0x02")
+		carol = common.HexToAddress("0x03")
+		gas   = hexutil.Uint64(1000)
+	)
+	root := &callFrame{
+		Type: "CALL", From: alice, To: bob, Gas: &gas, GasUsed: &gas, Value: (*hexutil.Big)(big.NewInt(1)),
+		Calls: []*callFrame{
+			{
+				Type: "CREATE", From: bob, To: carol, Input: []byte{0x60}, Output: bytesPtr([]byte{0x00}), Gas: &gas, GasUsed: &gas,
+				Calls: []*callFrame{
+					{Type: "SELFDESTRUCT", From: carol, To: alice, Value: (*hexutil.Big)(big.NewInt(2))},
+				},
+			},
+			{Type: "STATICCALL", From: bob, To: alice, Gas: &gas, Error: "execution reverted"},
+		},
+	}
+	txctx := &txTraceContext{index: 3, hash: common.HexToHash("0xaa"), block: common.HexToHash("0xbb")}
+	traces := flattenCalls(root, txctx, 7)
+
+	want := []struct {
+		typ       string
+		address   []int
+		subtraces int
+		from, to  common.Address
+		result    bool
+	}{
+		{"call", []int{}, 2, alice, bob, true},
+		{"create", []int{0}, 1, bob, carol, true},
+		{"suicide", []int{0, 0}, 0, carol, alice, false},
+		{"call", []int{1}, 0, bob, alice, false},
+	}
+	if len(traces) != len(want) {
+		t.Fatalf("trace count mismatch: have %d, want %d", len(traces), len(want))
+	}
+	for i, trace := range traces {
+		if trace.Type != want[i].typ {
+			t.Errorf("trace %d: type mismatch: have %s, want %s", i, trace.Type, want[i].typ)
+		}
+		if !reflect.DeepEqual(trace.TraceAddress, want[i].address) {
+			t.Errorf("trace %d: address mismatch: have %v, want %v", i, trace.TraceAddress, want[i].address)
+		}
+		if trace.Subtraces != want[i].subtraces {
+			t.Errorf("trace %d: subtraces mismatch: have %d, want %d", i, trace.Subtraces, want[i].subtraces)
+		}
+		if trace.sender() != want[i].from || trace.recipient() != want[i].to {
+			t.Errorf("trace %d: accounts mismatch: have %x -> %x, want %x -> %x", i, trace.sender(), trace.recipient(), want[i].from, want[i].to)
+		}
+		if (trace.Result != nil) != want[i].result {
+			t.Errorf("trace %d: result presence mismatch: have %v, want %v", i, trace.Result != nil, want[i].result)
+		}
+		if trace.BlockNumber != 7 || trace.TransactionPosition != 3 || trace.TransactionHash != txctx.hash || trace.BlockHash != txctx.block {
+			t.Errorf("trace %d: context mismatch", i)
+		}
+	}
+	if traces[3].Action.CallType != "staticcall" || traces[3].Error != "execution reverted" {
+		t.Errorf("static call mismatch: have %s %q", traces[3].Action.CallType, traces[3].Error)
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/token/common"
+	"github.com/token/core"
+	"github.com/token/core/state"
+	"github.com/token/core/types"
+	"github.com/token/core/vm"
+	"github.com/token/rpc"
+)
+
+const (
+	// maxTraceFilterRange is the maximum number of blocks a single trace_filter
+	// request is allowed to span. Traces are only indexed by block, not by
+	// account, so every block of the range is read and scanned.
+	maxTraceFilterRange = 1000
+
+	// maxTraceFilterReplay is the maximum number of blocks a single trace_filter
+	// request is allowed to re-execute because their traces are not indexed.
+	maxTraceFilterReplay = 100
+)
+
+// TraceFilterArgs are the criteria of the trace_filter request. A trace matches
+// if its sender is in FromAddress and its recipient is in ToAddress, an empty
+// list matching any account.
+type TraceFilterArgs struct {
+	FromBlock   *rpc.BlockNumber `json:"fromBlock"`
+	ToBlock     *rpc.BlockNumber `json:"toBlock"`
+	FromAddress []common.Address `json:"fromAddress"`
+	ToAddress   []common.Address `json:"toAddress"`
+	After       *uint64          `json:"after"`
+	Count       *uint64          `json:"count"`
+}
+
+// TraceAPI is the collection of flat call trace APIs exposed over the trace
+// namespace. Blocks are served from the trace index if the node maintains one,
+// and re-executed otherwise.
+type TraceAPI struct {
+	api     *API
+	indexer *TraceIndexer
+}
+
+// NewTraceAPI creates a new API definition for the flat call trace methods of
+// the nbn service. The indexer is optional.
+func NewTraceAPI(backend Backend, indexer *TraceIndexer) *TraceAPI {
+	return &TraceAPI{api: NewAPI(backend), indexer: indexer}
+}
+
+// Block returns the flat call traces of all the transactions in a block.
+func (api *TraceAPI) Block(ctx context.Context, number rpc.BlockNumber) ([]*FlatCallTrace, error) {
+	block, err := api.api.blockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return api.blockTraces(ctx, block)
+}
+
+// Transaction returns the flat call traces of a single transaction.
+func (api *TraceAPI) Transaction(ctx context.Context, hash common.Hash) ([]*FlatCallTrace, error) {
+	_, blockHash, blockNumber, index, err := api.api.backend.GetTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	// It shouldn't happen in practice.
+	if blockNumber == 0 {
+		return nil, errors.New("genesis is not traceable")
+	}
+	if traces := api.indexed(blockHash, blockNumber); traces != nil {
+		var result []*FlatCallTrace
+		for _, trace := range traces {
+			if trace.TransactionHash == hash {
+				result = append(result, trace)
+			}
+		}
+		return result, nil
+	}
+	block, err := api.api.blockByNumberAndHash(ctx, rpc.BlockNumber(blockNumber), blockHash)
+	if err != nil {
+		return nil, err
+	}
+	msg, vmctx, statedb, err := api.api.backend.StateAtTransaction(ctx, block, int(index), defaultTraceReexec)
+	if err != nil {
+		return nil, err
+	}
+	txctx := &txTraceContext{
+		index: int(index),
+		hash:  hash,
+		block: blockHash,
+	}
+	return api.api.traceTxFlat(msg, txctx, vmctx, statedb, blockNumber)
+}
+
+// Filter returns the flat call traces matching the given criteria within a
+// range of blocks. Indexed blocks are read from the database, the rest need to
+// be re-executed, which is only done for a limited number of blocks. As there
+// is no index by account, the range is limited to 1000 blocks, longer ranges
+// have to be split into several requests.
+func (api *TraceAPI) Filter(ctx context.Context, args TraceFilterArgs) ([]*FlatCallTrace, error) {
+	from, err := api.resolveNumber(ctx, args.FromBlock, rpc.EarliestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	to, err := api.resolveNumber(ctx, args.ToBlock, rpc.LatestBlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if from > to {
+		return nil, fmt.Errorf("invalid block range %d - %d", from, to)
+	}
+	if to-from >= maxTraceFilterRange {
+		return nil, fmt.Errorf("block range %d - %d exceeds the limit of %d blocks", from, to, maxTraceFilterRange)
+	}
+	var (
+		froms   = make(map[common.Address]struct{})
+		tos     = make(map[common.Address]struct{})
+		skip    uint64
+		result  = []*FlatCallTrace{}
+		replays int
+		size    int
+	)
+	// Stop collecting traces once they exceed the response size limit, the
+	// server would reject them anyway
+	budget, limited := rpc.ResponseSizeBudget(ctx)
+	for _, addr := range args.FromAddress {
+		froms[addr] = struct{}{}
+	}
+	for _, addr := range args.ToAddress {
+		tos[addr] = struct{}{}
+	}
+	if args.After != nil {
+		skip = *args.After
+	}
+	for number := from; number <= to; number++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		block, err := api.api.blockByNumber(ctx, rpc.BlockNumber(number))
+		if err != nil {
+			return nil, err
+		}
+		traces := api.indexed(block.Hash(), number)
+		if traces == nil && block.Transactions().Len() > 0 {
+			if replays++; replays > maxTraceFilterReplay {
+				return nil, fmt.Errorf("too many unindexed blocks to re-execute, limit is %d", maxTraceFilterReplay)
+			}
+			if traces, err = api.api.traceBlockFlat(ctx, block); err != nil {
+				return nil, err
+			}
+		}
+		for _, trace := range traces {
+			if len(froms) > 0 {
+				if _, ok := froms[trace.sender()]; !ok {
+					continue
+				}
+			}
+			if len(tos) > 0 {
+				if _, ok := tos[trace.recipient()]; !ok {
+					continue
+				}
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			result = append(result, trace)
+			if limited {
+				enc, err := json.Marshal(trace)
+				if err != nil {
+					return nil, err
+				}
+				if size += len(enc) + 1; size > budget {
+					return nil, fmt.Errorf("traces exceed the response size limit of %d bytes", budget)
+				}
+			}
+			if args.Count != nil && uint64(len(result)) >= *args.Count {
+				return result, nil
+			}
+		}
+	}
+	return result, nil
+}
+
+// resolveNumber converts an optional block number of a filter into an absolute
+// number, using the given default if it's missing.
+func (api *TraceAPI) resolveNumber(ctx context.Context, number *rpc.BlockNumber, def rpc.BlockNumber) (uint64, error) {
+	if number == nil {
+		number = &def
+	}
+	if *number == rpc.PendingBlockNumber {
+		return 0, errors.New("pending block is not traceable")
+	}
+	header, err := api.api.backend.HeaderByNumber(ctx, *number)
+	if err != nil {
+		return 0, err
+	}
+	if header == nil {
+		return 0, fmt.Errorf("block #%d not found", *number)
+	}
+	return header.Number.Uint64(), nil
+}
+
+// blockTraces returns the flat call traces of a block, either from the index or
+// by re-executing it.
+func (api *TraceAPI) blockTraces(ctx context.Context, block *types.Block) ([]*FlatCallTrace, error) {
+	if traces := api.indexed(block.Hash(), block.NumberU64()); traces != nil {
+		return traces, nil
+	}
+	return api.api.traceBlockFlat(ctx, block)
+}
+
+// indexed returns the flat call traces of a block stored by the trace indexer,
+// or nil if the block is not indexed.
+func (api *TraceAPI) indexed(hash common.Hash, number uint64) []*FlatCallTrace {
+	if api.indexer == nil {
+		return nil
+	}
+	return readBlockTraces(api.api.backend.ChainDb(), hash, number)
+}
+
+// traceBlockFlat re-executes all the transactions of a block, returning their
+// flat call traces in order.
+func (api *API) traceBlockFlat(ctx context.Context, block *types.Block) ([]*FlatCallTrace, error) {
+	traces := []*FlatCallTrace{}
+	if block.NumberU64() == 0 || block.Transactions().Len() == 0 {
+		return traces, nil
+	}
+	parent, err := api.blockByNumberAndHash(ctx, rpc.BlockNumber(block.NumberU64()-1), block.ParentHash())
+	if err != nil {
+		return nil, err
+	}
+	statedb, err := api.backend.StateAtBlock(ctx, parent, defaultTraceReexec, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		signer    = types.MakeSigner(api.backend.ChainConfig(), block.Number())
+		blockCtx  = core.NewEVMBlockContext(block.Header(), api.chainContext(ctx), nil)
+		blockHash = block.Hash()
+	)
+	for i, tx := range block.Transactions() {
+		msg, _ := tx.AsMessage(signer, block.BaseFee())
+		txctx := &txTraceContext{
+			index: i,
+			hash:  tx.Hash(),
+			block: blockHash,
+		}
+		res, err := api.traceTxFlat(msg, txctx, blockCtx, statedb, block.NumberU64())
+		if err != nil {
+			return nil, err
+		}
+		traces = append(traces, res...)
+
+		// Finalize the state so any modifications are written to the trie
+		// Only delete empty objects if EIP158/161 (a.k.a Spurious Dragon) is in effect
+		statedb.Finalise(api.backend.ChainConfig().IsEIP158(block.Number()))
+	}
+	return traces, nil
+}
+
+// traceTxFlat executes a single transaction on top of the given state with the
+// call tracer, returning its flat call traces.
+func (api *API) traceTxFlat(message core.Message, txctx *txTraceContext, vmctx vm.BlockContext, statedb *state.StateDB, number uint64) ([]*FlatCallTrace, error) {
+	var (
+		tracer = newCallTracer()
+		vmenv  = vm.NewEVM(vmctx, core.NewEVMTxContext(message), statedb, api.backend.ChainConfig(), vm.Config{Debug: true, Tracer: tracer, NoBaseFee: true})
+	)
+	// Call Prepare to clear out the statedb access list
+	statedb.Prepare(txctx.hash, txctx.block, txctx.index)
+
+	if _, err := core.ApplyMessage(vmenv, message, new(core.GasPool).AddGas(message.Gas())); err != nil {
+		return nil, fmt.Errorf("tracing failed: %w", err)
+	}
+	return flattenCalls(tracer.result(), txctx, number), nil
+}
@@ -0,0 +1,434 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/token/common"
+	"github.com/token/common/hexutil"
+	"github.com/token/core"
+	"github.com/token/core/rawdb"
+	"github.com/token/core/types"
+	"github.com/token/ethdb"
+	"github.com/token/event"
+	"github.com/token/log"
+	"github.com/token/rlp"
+	"github.com/token/rpc"
+)
+
+// errMissingBlock is returned if a block to index is missing from the database.
+var errMissingBlock = errors.New("missing block")
+
+// IndexerBackend is the chain access needed by the trace indexer on top of the
+// tracing backend.
+type IndexerBackend interface {
+	Backend
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+}
+
+// TraceIndexer keeps the flat call traces of every canonical block from the
+// moment it was first enabled, so that trace_filter can be answered without
+// re-executing history. If a tail is configured, older blocks are backfilled
+// in the background down to it.
+//
+// Traces are stored per block hash, making reorgs a matter of indexing the new
+// canonical blocks. The traces of the blocks reorged out are deleted when their
+// height is indexed again.
+type TraceIndexer struct {
+	api     *API
+	backend IndexerBackend
+	tail    *uint64 // Oldest block to backfill, nil to only index new blocks
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewTraceIndexer creates a trace indexer on top of the given backend, which
+// backfills the blocks down to the given tail if it's not nil. It does nothing
+// until started.
+func NewTraceIndexer(backend IndexerBackend, tail *uint64) *TraceIndexer {
+	return &TraceIndexer{
+		api:     NewAPI(backend),
+		backend: backend,
+		tail:    tail,
+		quit:    make(chan struct{}),
+	}
+}
+
+// Start implements node.Lifecycle, starting the indexing of new chain heads.
+func (ti *TraceIndexer) Start() error {
+	ti.wg.Add(1)
+	go ti.loop()
+	return nil
+}
+
+// Stop implements node.Lifecycle, terminating the indexing.
+func (ti *TraceIndexer) Stop() error {
+	close(ti.quit)
+	ti.wg.Wait()
+	return nil
+}
+
+// loop indexes the chain whenever a new head arrives.
+func (ti *TraceIndexer) loop() {
+	defer ti.wg.Done()
+
+	heads := make(chan core.ChainHeadEvent, 16)
+	sub := ti.backend.SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	db := ti.backend.ChainDb()
+	head, err := ti.backend.HeaderByNumber(context.Background(), rpc.LatestBlockNumber)
+	if err != nil || head == nil {
+		log.Error("Failed to retrieve chain head for trace indexing", "err", err)
+		return
+	}
+	tail := rawdb.ReadTraceIndexTail(db)
+	if tail == nil {
+		number := head.Number.Uint64()
+		rawdb.WriteTraceIndexTail(db, number)
+		tail = &number
+	}
+	log.Info("Started call trace indexer", "tail", *tail)
+	ti.index(head, *tail)
+
+	// Backfill the older blocks independently from the new heads
+	if ti.tail != nil && *ti.tail < *tail {
+		ti.wg.Add(1)
+		go ti.backfill(*tail, *ti.tail)
+	}
+	for {
+		select {
+		case ev := <-heads:
+			ti.index(ev.Block.Header(), *tail)
+		case <-sub.Err():
+			return
+		case <-ti.quit:
+			return
+		}
+	}
+}
+
+// index stores the call traces of all the canonical blocks up to the given head
+// that are not indexed yet, down to the tail of the index.
+func (ti *TraceIndexer) index(head *types.Header, tail uint64) {
+	var (
+		db      = ti.backend.ChainDb()
+		pending []common.Hash
+		number  = head.Number.Uint64()
+		hash    = head.Hash()
+	)
+	// Walk back from the head until an indexed block is found, collecting every
+	// block that was added or reorged in
+	for number >= tail && number > 0 && !rawdb.HasBlockTraces(db, hash, number) {
+		pending = append(pending, hash)
+		header := rawdb.ReadHeader(db, hash, number)
+		if header == nil {
+			break
+		}
+		number, hash = number-1, header.ParentHash
+	}
+	if len(pending) == 0 {
+		return
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for i := len(pending) - 1; i >= 0; i-- {
+		select {
+		case <-ti.quit:
+			return
+		default:
+		}
+		number := head.Number.Uint64() - uint64(i)
+		if err := ti.indexBlock(pending[i], number); err != nil {
+			log.Warn("Failed to index block traces", "number", number, "hash", pending[i], "err", err)
+			return
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Indexing call traces", "number", number, "remaining", i, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	log.Debug("Indexed call traces", "blocks", len(pending), "head", head.Number, "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// backfill indexes the canonical blocks below the tail of the index, newest
+// first, moving the tail along so an interrupted backfill resumes where it
+// stopped. The parent states of the blocks must be available for re-execution.
+func (ti *TraceIndexer) backfill(tail uint64, target uint64) {
+	defer ti.wg.Done()
+
+	var (
+		db     = ti.backend.ChainDb()
+		start  = time.Now()
+		logged = time.Now()
+	)
+	log.Info("Backfilling call traces", "from", tail, "to", target)
+	for number := tail; number > target; {
+		select {
+		case <-ti.quit:
+			return
+		default:
+		}
+		number--
+		hash := rawdb.ReadCanonicalHash(db, number)
+		if err := ti.indexBlock(hash, number); err != nil {
+			log.Warn("Failed to backfill block traces", "number", number, "hash", hash, "err", err)
+			return
+		}
+		rawdb.WriteTraceIndexTail(db, number)
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Backfilling call traces", "number", number, "remaining", number-target, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	log.Info("Backfilled call traces", "tail", target, "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// indexBlock traces the block with the given hash and number and stores its
+// call traces.
+func (ti *TraceIndexer) indexBlock(hash common.Hash, number uint64) error {
+	db := ti.backend.ChainDb()
+	block := rawdb.ReadBlock(db, hash, number)
+	if block == nil {
+		return errMissingBlock
+	}
+	traces, err := ti.api.traceBlockFlat(context.Background(), block)
+	if err != nil {
+		return err
+	}
+	return writeBlockTraces(db, hash, number, traces)
+}
+
+// storedFlatCallTrace is the storage encoding of a flat call trace. The optional
+// fields present in the trace are flagged in Fields, and the block is implied by
+// the database key.
+type storedFlatCallTrace struct {
+	Type          string
+	CallType      string
+	Fields        uint64
+	From          common.Address
+	To            common.Address
+	Gas           uint64
+	Input         []byte
+	Init          []byte
+	Value         *big.Int
+	Address       common.Address
+	RefundAddress common.Address
+	Balance       *big.Int
+	GasUsed       uint64
+	Output        []byte
+	ResultAddress common.Address
+	Code          []byte
+	Error         string
+	Subtraces     uint64
+	TraceAddress  []uint64
+	TxHash        common.Hash
+	TxPosition    uint64
+}
+
+// Flags of the optional fields present in a stored flat call trace.
+const (
+	traceFrom = 1 << iota
+	traceTo
+	traceGas
+	traceInput
+	traceInit
+	traceValue
+	traceAddress
+	traceRefundAddress
+	traceBalance
+	traceResult
+	traceGasUsed
+	traceOutput
+	traceResultAddress
+	traceCode
+)
+
+// writeBlockTraces stores the flat call traces of a block, and deletes those of
+// the other blocks at the same height, which were reorged out.
+func writeBlockTraces(db ethdb.Database, hash common.Hash, number uint64, traces []*FlatCallTrace) error {
+	stored := make([]storedFlatCallTrace, len(traces))
+	for i, trace := range traces {
+		stored[i] = encodeFlatCallTrace(trace)
+	}
+	blob, err := rlp.EncodeToBytes(stored)
+	if err != nil {
+		return err
+	}
+	batch := db.NewBatch()
+	for _, other := range rawdb.ReadAllHashes(db, number) {
+		if other != hash {
+			rawdb.DeleteBlockTraces(batch, other, number)
+		}
+	}
+	rawdb.WriteBlockTraces(batch, hash, number, blob)
+	return batch.Write()
+}
+
+// readBlockTraces retrieves the flat call traces of a block from the database.
+// Indexed blocks without calls are stored as empty lists, so nil is returned
+// only if the block is missing from the index.
+func readBlockTraces(db ethdb.KeyValueReader, hash common.Hash, number uint64) []*FlatCallTrace {
+	data := rawdb.ReadBlockTraces(db, hash, number)
+	if len(data) == 0 {
+		return nil
+	}
+	var stored []storedFlatCallTrace
+	if err := rlp.DecodeBytes(data, &stored); err != nil {
+		log.Error("Invalid block traces RLP", "hash", hash, "err", err)
+		return nil
+	}
+	traces := make([]*FlatCallTrace, len(stored))
+	for i := range stored {
+		traces[i] = decodeFlatCallTrace(&stored[i], hash, number)
+	}
+	return traces
+}
+
+// encodeFlatCallTrace converts a flat call trace into its storage encoding.
+func encodeFlatCallTrace(trace *FlatCallTrace) storedFlatCallTrace {
+	stored := storedFlatCallTrace{
+		Type:       trace.Type,
+		CallType:   trace.Action.CallType,
+		Error:      trace.Error,
+		Subtraces:  uint64(trace.Subtraces),
+		TxHash:     trace.TransactionHash,
+		TxPosition: trace.TransactionPosition,
+	}
+	for _, index := range trace.TraceAddress {
+		stored.TraceAddress = append(stored.TraceAddress, uint64(index))
+	}
+	action := &trace.Action
+	if action.From != nil {
+		stored.Fields, stored.From = stored.Fields|traceFrom, *action.From
+	}
+	if action.To != nil {
+		stored.Fields, stored.To = stored.Fields|traceTo, *action.To
+	}
+	if action.Gas != nil {
+		stored.Fields, stored.Gas = stored.Fields|traceGas, uint64(*action.Gas)
+	}
+	if action.Input != nil {
+		stored.Fields, stored.Input = stored.Fields|traceInput, *action.Input
+	}
+	if action.Init != nil {
+		stored.Fields, stored.Init = stored.Fields|traceInit, *action.Init
+	}
+	if action.Value != nil {
+		stored.Fields, stored.Value = stored.Fields|traceValue, action.Value.ToInt()
+	}
+	if action.Address != nil {
+		stored.Fields, stored.Address = stored.Fields|traceAddress, *action.Address
+	}
+	if action.RefundAddress != nil {
+		stored.Fields, stored.RefundAddress = stored.Fields|traceRefundAddress, *action.RefundAddress
+	}
+	if action.Balance != nil {
+		stored.Fields, stored.Balance = stored.Fields|traceBalance, action.Balance.ToInt()
+	}
+	if result := trace.Result; result != nil {
+		stored.Fields |= traceResult
+		if result.GasUsed != nil {
+			stored.Fields, stored.GasUsed = stored.Fields|traceGasUsed, uint64(*result.GasUsed)
+		}
+		if result.Output != nil {
+			stored.Fields, stored.Output = stored.Fields|traceOutput, *result.Output
+		}
+		if result.Address != nil {
+			stored.Fields, stored.ResultAddress = stored.Fields|traceResultAddress, *result.Address
+		}
+		if result.Code != nil {
+			stored.Fields, stored.Code = stored.Fields|traceCode, *result.Code
+		}
+	}
+	return stored
+}
+
+// decodeFlatCallTrace converts a stored flat call trace of the given block back
+// into a flat call trace.
+func decodeFlatCallTrace(stored *storedFlatCallTrace, hash common.Hash, number uint64) *FlatCallTrace {
+	trace := &FlatCallTrace{
+		Action:              FlatCallAction{CallType: stored.CallType},
+		BlockHash:           hash,
+		BlockNumber:         number,
+		Error:               stored.Error,
+		Subtraces:           int(stored.Subtraces),
+		TraceAddress:        make([]int, len(stored.TraceAddress)),
+		TransactionHash:     stored.TxHash,
+		TransactionPosition: stored.TxPosition,
+		Type:                stored.Type,
+	}
+	for i, index := range stored.TraceAddress {
+		trace.TraceAddress[i] = int(index)
+	}
+	has := func(field uint64) bool { return stored.Fields&field != 0 }
+
+	action := &trace.Action
+	if has(traceFrom) {
+		action.From = &stored.From
+	}
+	if has(traceTo) {
+		action.To = &stored.To
+	}
+	if has(traceGas) {
+		action.Gas = (*hexutil.Uint64)(&stored.Gas)
+	}
+	if has(traceInput) {
+		action.Input = (*hexutil.Bytes)(&stored.Input)
+	}
+	if has(traceInit) {
+		action.Init = (*hexutil.Bytes)(&stored.Init)
+	}
+	if has(traceValue) {
+		action.Value = (*hexutil.Big)(stored.Value)
+	}
+	if has(traceAddress) {
+		action.Address = &stored.Address
+	}
+	if has(traceRefundAddress) {
+		action.RefundAddress = &stored.RefundAddress
+	}
+	if has(traceBalance) {
+		action.Balance = (*hexutil.Big)(stored.Balance)
+	}
+	if has(traceResult) {
+		result := new(FlatCallResult)
+		if has(traceGasUsed) {
+			result.GasUsed = (*hexutil.Uint64)(&stored.GasUsed)
+		}
+		if has(traceOutput) {
+			result.Output = (*hexutil.Bytes)(&stored.Output)
+		}
+		if has(traceResultAddress) {
+			result.Address = &stored.ResultAddress
+		}
+		if has(traceCode) {
+			result.Code = (*hexutil.Bytes)(&stored.Code)
+		}
+		trace.Result = result
+	}
+	return trace
+}
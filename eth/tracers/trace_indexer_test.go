@@ -0,0 +1,103 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/token/common"
+	"github.com/token/common/hexutil"
+	"github.com/token/core/rawdb"
+	"github.com/token/core/types"
+)
+
+// Tests that the flat call traces are stored and retrieved unchanged, including
+// the zero values of optional fields.
+func TestBlockTracesStorage(t *testing.T) {
+	var (
+		alice = common.HexToAddress("0x01")
+		bob   = common.HexToAddress("0x02")
+		carol = common.HexToAddress("0x03")
+		gas   = hexutil.Uint64(1000)
+		zero  = hexutil.Uint64(0)
+	)
+	root := &callFrame{
+		Type: "CALL", From: alice, To: bob, Input: []byte{0x01, 0x02}, Gas: &gas, GasUsed: &zero, Value: (*hexutil.Big)(big.NewInt(0)),
+		Calls: []*callFrame{
+			{
+				Type: "CREATE", From: bob, To: carol, Input: []byte{0x60}, Output: bytesPtr([]byte{0x00}), Gas: &gas, GasUsed: &gas,
+				Calls: []*callFrame{
+					{Type: "SELFDESTRUCT", From: carol, To: alice, Value: (*hexutil.Big)(big.NewInt(2))},
+				},
+			},
+			{Type: "STATICCALL", From: bob, To: alice, Gas: &zero, Error: "execution reverted"},
+			{Type: "CALL", From: bob, To: carol, Output: bytesPtr(nil)},
+		},
+	}
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		hash   = common.HexToHash("0xbb")
+		txctx  = &txTraceContext{index: 3, hash: common.HexToHash("0xaa"), block: hash}
+		traces = flattenCalls(root, txctx, 7)
+	)
+	if err := writeBlockTraces(db, hash, 7, traces); err != nil {
+		t.Fatalf("failed to write traces: %v", err)
+	}
+	stored := readBlockTraces(db, hash, 7)
+	have, _ := json.Marshal(stored)
+	want, _ := json.Marshal(traces)
+	if string(have) != string(want) {
+		t.Fatalf("stored traces mismatch:\nhave %s\nwant %s", have, want)
+	}
+	// Blocks without calls are indexed as empty lists
+	empty := common.HexToHash("0xcc")
+	if err := writeBlockTraces(db, empty, 8, []*FlatCallTrace{}); err != nil {
+		t.Fatalf("failed to write empty traces: %v", err)
+	}
+	if traces := readBlockTraces(db, empty, 8); traces == nil || len(traces) != 0 {
+		t.Errorf("empty traces mismatch: have %v, want empty list", traces)
+	}
+	if traces := readBlockTraces(db, common.HexToHash("0xdd"), 8); traces != nil {
+		t.Errorf("traces of unindexed block: have %v, want nil", traces)
+	}
+}
+
+// Tests that indexing a block deletes the traces of the blocks reorged out at
+// the same height.
+func TestBlockTracesReorg(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+
+	reorged := &types.Header{Number: big.NewInt(5), Extra: []byte("reorged")}
+	canonical := &types.Header{Number: big.NewInt(5), Extra: []byte("canonical")}
+	rawdb.WriteHeader(db, reorged)
+	rawdb.WriteHeader(db, canonical)
+
+	if err := writeBlockTraces(db, reorged.Hash(), 5, []*FlatCallTrace{}); err != nil {
+		t.Fatalf("failed to write traces: %v", err)
+	}
+	if err := writeBlockTraces(db, canonical.Hash(), 5, []*FlatCallTrace{}); err != nil {
+		t.Fatalf("failed to write traces: %v", err)
+	}
+	if rawdb.HasBlockTraces(db, reorged.Hash(), 5) {
+		t.Errorf("traces of reorged out block not deleted")
+	}
+	if !rawdb.HasBlockTraces(db, canonical.Hash(), 5) {
+		t.Errorf("traces of canonical block missing")
+	}
+}
@@ -81,6 +81,10 @@ type AncientReader interface {
 
 	// AncientSize returns the ancient size of the specified category.
 	AncientSize(kind string) (uint64, error)
+
+	// AncientTail returns the number of the first item of the specified category
+	// that was not pruned from the ancient store.
+	AncientTail(kind string) (uint64, error)
 }
 
 // AncientWriter contains the methods required to write to immutable ancient data.
@@ -92,6 +96,10 @@ type AncientWriter interface {
 	// TruncateAncients discards all but the first n ancient data from the ancient store.
 	TruncateAncients(n uint64) error
 
+	// TruncateAncientTail discards the ancient data of the specified category
+	// below the given number from the ancient store.
+	TruncateAncientTail(kind string, tail uint64) error
+
 	// Sync flushes all in-memory ancient store data to disk.
 	Sync() error
 }
@@ -18,6 +18,7 @@ package dbtest
 
 import (
 	"bytes"
+	"fmt"
 	"reflect"
 	"sort"
 	"testing"
@@ -313,6 +314,79 @@ func TestDatabaseSuite(t *testing.T, New func() ethdb.KeyValueStore) {
 		}
 	})
 
+	t.Run("Snapshot", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		snapshotter, ok := db.(ethdb.Snapshotter)
+		if !ok {
+			t.Skip("database does not support snapshots")
+		}
+		initial := map[string]string{"k1": "v1", "k2": "v2", "k3": "v3"}
+		for k, v := range initial {
+			if err := db.Put([]byte(k), []byte(v)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		snap, err := snapshotter.NewSnapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer snap.Release()
+
+		// Mutations after the snapshot must not be visible through it
+		if err := db.Put([]byte("k1"), []byte("v1-new")); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Delete([]byte("k2")); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put([]byte("k4"), []byte("v4")); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range initial {
+			got, err := snap.Get([]byte(k))
+			if err != nil {
+				t.Fatalf("snapshot get %q failed: %v", k, err)
+			}
+			if !bytes.Equal(got, []byte(v)) {
+				t.Errorf("snapshot value mismatch for %q: got %q, want %q", k, got, v)
+			}
+		}
+		if has, err := snap.Has([]byte("k4")); err != nil || has {
+			t.Errorf("snapshot contains key added later: has %v, err %v", has, err)
+		}
+		if _, err := snap.Get([]byte("k4")); err == nil {
+			t.Errorf("snapshot returned key added later")
+		}
+	})
+
+	t.Run("Compact", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		for i := 0; i < 100; i++ {
+			key := []byte(fmt.Sprintf("key-%03d", i))
+			if err := db.Put(key, key); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i < 100; i += 2 {
+			if err := db.Delete([]byte(fmt.Sprintf("key-%03d", i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Compact(nil, nil); err != nil {
+			t.Fatalf("full compaction failed: %v", err)
+		}
+		if err := db.Compact([]byte("key-010"), []byte("key-020")); err != nil {
+			t.Fatalf("range compaction failed: %v", err)
+		}
+		it := db.NewIterator(nil, nil)
+		if got := len(iterateKeys(it)); got != 50 {
+			t.Errorf("key count mismatch after compaction: got %d, want 50", got)
+		}
+	})
 }
 
 func iterateKeys(it ethdb.Iterator) []string {
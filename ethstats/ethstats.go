@@ -43,6 +43,7 @@ import (
 	"github.com/token/miner"
 	"github.com/token/node"
 	"github.com/token/p2p"
+	"github.com/token/params"
 	"github.com/token/rpc"
 	"github.com/gorilla/websocket"
 )
@@ -65,6 +66,8 @@ type backend interface {
 	SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription
 	CurrentHeader() *types.Header
 	HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error)
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+	ChainConfig() *params.ChainConfig
 	GetTd(ctx context.Context, hash common.Hash) *big.Int
 	Stats() (pending int, queued int)
 	Downloader() *downloader.Downloader
@@ -333,6 +336,12 @@ func (s *Service) loop(chainHeadCh chan core.ChainHeadEvent, txEventCh chan core
 					if err = s.reportPending(conn); err != nil {
 						log.Warn("Post-block transaction stats report failed", "err", err)
 					}
+					// Signer queues rotate with every block, keep them fresh
+					if _, ok := s.engine.(consensus.StatsEngine); ok {
+						if err = s.reportStats(conn); err != nil {
+							log.Warn("Post-block node stats report failed", "err", err)
+						}
+					}
 				case <-txCh:
 					if err = s.reportPending(conn); err != nil {
 						log.Warn("Transaction stats report failed", "err", err)
@@ -759,6 +768,10 @@ type nodeStats struct {
 	Peers    int  `json:"peers"`
 	GasPrice int  `json:"gasPrice"`
 	Uptime   int  `json:"uptime"`
+
+	// Signer is the optional status of the local signer, reported by voting
+	// based consensus engines (alien, clique).
+	Signer *consensus.SignerStats `json:"signer,omitempty"`
 }
 
 // reportStats retrieves various stats about the node at the networking and
@@ -799,6 +812,7 @@ func (s *Service) reportStats(conn *connWrapper) error {
 			GasPrice: gasprice,
 			Syncing:  syncing,
 			Uptime:   100,
+			Signer:   s.signerStats(),
 		},
 	}
 	report := map[string][]interface{}{
@@ -806,3 +820,50 @@ func (s *Service) reportStats(conn *connWrapper) error {
 	}
 	return conn.WriteJSON(report)
 }
+
+// signerStats retrieves the status of the local signer if the consensus engine
+// supports reporting it, or nil otherwise.
+func (s *Service) signerStats() *consensus.SignerStats {
+	engine, ok := s.engine.(consensus.StatsEngine)
+	if !ok {
+		return nil
+	}
+	header := s.backend.CurrentHeader()
+	if header == nil {
+		return nil
+	}
+	stats, err := engine.SignerStats(&chainReader{s.backend}, header)
+	if err != nil {
+		log.Debug("Failed to retrieve signer stats", "err", err)
+		return nil
+	}
+	return stats
+}
+
+// chainReader adapts the stats backend to the header reader interface used by
+// the consensus engines.
+type chainReader struct {
+	backend backend
+}
+
+func (r *chainReader) Config() *params.ChainConfig { return r.backend.ChainConfig() }
+
+func (r *chainReader) CurrentHeader() *types.Header { return r.backend.CurrentHeader() }
+
+func (r *chainReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	header := r.GetHeaderByHash(hash)
+	if header == nil || header.Number.Uint64() != number {
+		return nil
+	}
+	return header
+}
+
+func (r *chainReader) GetHeaderByNumber(number uint64) *types.Header {
+	header, _ := r.backend.HeaderByNumber(context.Background(), rpc.BlockNumber(number))
+	return header
+}
+
+func (r *chainReader) GetHeaderByHash(hash common.Hash) *types.Header {
+	header, _ := r.backend.HeaderByHash(context.Background(), hash)
+	return header
+}
@@ -81,6 +81,41 @@ func (s *PublicnbnAPI) MaxPriorityFeePerGas(ctx context.Context) (*hexutil.Big,
 	return (*hexutil.Big)(tipcap), err
 }
 
+type feeHistoryResult struct {
+	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+	Reward       [][]*hexutil.Big `json:"reward,omitempty"`
+	BaseFee      []*hexutil.Big   `json:"baseFeePerGas,omitempty"`
+	GasUsedRatio []float64        `json:"gasUsedRatio"`
+}
+
+// FeeHistory returns the fee market history.
+func (s *PublicnbnAPI) FeeHistory(ctx context.Context, blockCount rpc.DecimalOrHex, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (*feeHistoryResult, error) {
+	oldest, reward, baseFee, gasUsed, err := s.b.FeeHistory(ctx, int(blockCount), lastBlock, rewardPercentiles)
+	if err != nil {
+		return nil, err
+	}
+	results := &feeHistoryResult{
+		OldestBlock:  (*hexutil.Big)(oldest),
+		GasUsedRatio: gasUsed,
+	}
+	if reward != nil {
+		results.Reward = make([][]*hexutil.Big, len(reward))
+		for i, w := range reward {
+			results.Reward[i] = make([]*hexutil.Big, len(w))
+			for j, v := range w {
+				results.Reward[i][j] = (*hexutil.Big)(v)
+			}
+		}
+	}
+	if baseFee != nil {
+		results.BaseFee = make([]*hexutil.Big, len(baseFee))
+		for i, v := range baseFee {
+			results.BaseFee[i] = (*hexutil.Big)(v)
+		}
+	}
+	return results, nil
+}
+
 // Syncing returns false in case the node is currently not syncing with the network. It can be up to date or has not
 // yet received the latest block headers from its pears. In case it is synchronizing:
 // - startingBlock: block number this node started to synchronise from
@@ -716,6 +751,48 @@ func (s *PublicBlockChainAPI) GetBlockByHash(ctx context.Context, hash common.Ha
 	return nil, err
 }
 
+// GetBlockReceipts returns the receipts of all transactions in the given block,
+// in the same format as eth_getTransactionReceipt. It returns nil if the block
+// is not found.
+func (s *PublicBlockChainAPI) GetBlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]map[string]interface{}, error) {
+	var (
+		block    *types.Block
+		receipts types.Receipts
+		err      error
+	)
+	if number, ok := blockNrOrHash.Number(); ok && number == rpc.PendingBlockNumber {
+		// Pending receipts are only known by the miner
+		block, receipts = s.b.PendingBlockAndReceipts()
+		if block == nil {
+			return nil, nil
+		}
+	} else {
+		block, err = s.b.BlockByNumberOrHash(ctx, blockNrOrHash)
+		if block == nil || err != nil {
+			return nil, err
+		}
+		if receipts, err = s.b.GetReceipts(ctx, block.Hash()); err != nil {
+			return nil, err
+		}
+	}
+	txs := block.Transactions()
+	if len(txs) != len(receipts) {
+		return nil, fmt.Errorf("receipts length mismatch: %d vs %d", len(txs), len(receipts))
+	}
+	var (
+		signer  = types.MakeSigner(s.b.ChainConfig(), block.Number())
+		baseFee *big.Int
+	)
+	if s.b.ChainConfig().IsLondon(block.Number()) {
+		baseFee = block.BaseFee()
+	}
+	result := make([]map[string]interface{}, len(receipts))
+	for i, receipt := range receipts {
+		result[i] = marshalReceipt(receipt, block.Hash(), block.NumberU64(), signer, txs[i], uint64(i), baseFee)
+	}
+	return result, nil
+}
+
 // GetUncleByBlockNumberAndIndex returns the uncle block for the given block hash and index. When fullTx is true
 // all transactions in the block are returned in full detail, otherwise only the transaction hash is returned.
 func (s *PublicBlockChainAPI) GetUncleByBlockNumberAndIndex(ctx context.Context, blockNr rpc.BlockNumber, index hexutil.Uint) (map[string]interface{}, error) {
@@ -943,6 +1020,170 @@ func (s *PublicBlockChainAPI) Call(ctx context.Context, args TransactionArgs, bl
 	return result.Return(), result.Err
 }
 
+// BlockOverrides is the collection of block context fields to override during
+// the simulation of message calls.
+type BlockOverrides struct {
+	Number   *hexutil.Big    `json:"number"`
+	Time     *hexutil.Uint64 `json:"time"`
+	GasLimit *hexutil.Uint64 `json:"gasLimit"`
+	Coinbase *common.Address `json:"coinbase"`
+	BaseFee  *hexutil.Big    `json:"baseFee"`
+}
+
+// Apply overrides the header fields of the block the calls are executed in. The
+// coinbase is part of the EVM context only, see ApplyCoinbase.
+func (diff *BlockOverrides) Apply(header *types.Header) {
+	if diff == nil {
+		return
+	}
+	if diff.Number != nil {
+		header.Number = new(big.Int).Set(diff.Number.ToInt())
+	}
+	if diff.Time != nil {
+		header.Time = uint64(*diff.Time)
+	}
+	if diff.GasLimit != nil {
+		header.GasLimit = uint64(*diff.GasLimit)
+	}
+	if diff.BaseFee != nil {
+		header.BaseFee = new(big.Int).Set(diff.BaseFee.ToInt())
+	}
+}
+
+// BundleCall is a single message call of a simulated call bundle, along with the
+// state overrides to apply right before executing it.
+type BundleCall struct {
+	Transaction    TransactionArgs `json:"transaction"`
+	StateOverrides *StateOverride  `json:"stateOverrides"`
+}
+
+// BundleCallResult is the outcome of a single message call of a bundle.
+type BundleCallResult struct {
+	ReturnValue hexutil.Bytes  `json:"returnValue"`
+	Logs        []*types.Log   `json:"logs"`
+	GasUsed     hexutil.Uint64 `json:"gasUsed"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// DoCallMany executes a sequence of message calls on top of the given block, each
+// call seeing the state changes of the previous ones. A failing call does not
+// abort the bundle, its error is reported in its result instead.
+func DoCallMany(ctx context.Context, b Backend, calls []BundleCall, blockNrOrHash rpc.BlockNumberOrHash, blockOverrides *BlockOverrides, timeout time.Duration, globalGasCap uint64) ([]*BundleCallResult, error) {
+	defer func(start time.Time) {
+		log.Debug("Executing EVM call bundle finished", "calls", len(calls), "runtime", time.Since(start))
+	}(time.Now())
+
+	state, header, err := b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	// The block author is recovered from the seal, so it needs to be resolved
+	// before the header is modified
+	coinbase, err := b.Engine().Author(header)
+	if err != nil {
+		coinbase = header.Coinbase
+	}
+	if blockOverrides != nil && blockOverrides.Coinbase != nil {
+		coinbase = *blockOverrides.Coinbase
+	}
+	header = types.CopyHeader(header)
+	blockOverrides.Apply(header)
+
+	// Setup context so it may be cancelled the calls have completed
+	// or, in case of unmetered gas, setup a context with a timeout.
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	var (
+		results     = make([]*BundleCallResult, 0, len(calls))
+		blockHash   = header.Hash()
+		deleteEmpty = b.ChainConfig().IsEIP158(header.Number)
+	)
+	for i, call := range calls {
+		if err := call.StateOverrides.Apply(state); err != nil {
+			return nil, fmt.Errorf("call %d: %w", i, err)
+		}
+		msg, err := call.Transaction.ToMessage(globalGasCap, header.BaseFee)
+		if err != nil {
+			return nil, fmt.Errorf("call %d: %w", i, err)
+		}
+		evm, vmError, err := b.GetEVM(ctx, msg, state, header, &vm.Config{NoBaseFee: true})
+		if err != nil {
+			return nil, err
+		}
+		evm.Context.Coinbase = coinbase
+
+		// Wait for the context to be done and cancel the evm. Even if the
+		// EVM has finished, cancelling may be done (repeatedly)
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				evm.Cancel()
+			case <-done:
+			}
+		}()
+		// Logs are collected per call, keyed by a hash derived from its position
+		txHash := common.BigToHash(big.NewInt(int64(i)))
+		state.Prepare(txHash, blockHash, i)
+
+		result, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(math.MaxUint64))
+		close(done)
+		if err := vmError(); err != nil {
+			return nil, err
+		}
+		// If the timer caused an abort, return an appropriate error message
+		if evm.Cancelled() {
+			return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
+		}
+		res := &BundleCallResult{Logs: []*types.Log{}}
+		switch {
+		case err != nil:
+			res.Error = fmt.Sprintf("err: %v (supplied gas %d)", err, msg.Gas())
+		default:
+			res.GasUsed = hexutil.Uint64(result.UsedGas)
+			res.ReturnValue = result.Return()
+			if len(result.Revert()) > 0 {
+				res.ReturnValue = result.Revert()
+				res.Error = newRevertError(result).Error()
+			} else if result.Err != nil {
+				res.Error = result.Err.Error()
+			}
+			for _, l := range state.GetLogs(txHash) {
+				l.TxHash = common.Hash{} // Calls are not transactions, drop the placeholder
+				res.Logs = append(res.Logs, l)
+			}
+		}
+		results = append(results, res)
+
+		// Finalize the state so the next call sees a clean slate
+		state.Finalise(deleteEmpty)
+	}
+	return results, nil
+}
+
+// CallMany executes a bundle of message calls on top of the given block, each
+// call seeing the state changes of the previous ones. Every call may override
+// parts of the state before it is executed, the block context can be overridden
+// for the whole bundle.
+//
+// Note, this function doesn't make any changes in the state/blockchain and is
+// useful to preview the outcome of a sequence of transactions. Only the EVM
+// execution is simulated: the effects of the alien custom transactions (the
+// colon separated data payloads such as votes, pledges and side chain
+// confirmations), which the engine applies when finalizing the block, are not.
+func (s *PublicBlockChainAPI) CallMany(ctx context.Context, calls []BundleCall, blockNrOrHash rpc.BlockNumberOrHash, blockOverrides *BlockOverrides) ([]*BundleCallResult, error) {
+	if len(calls) == 0 {
+		return nil, errors.New("empty call bundle")
+	}
+	return DoCallMany(ctx, s.b, calls, blockNrOrHash, blockOverrides, 5*time.Second, s.b.RPCGasCap())
+}
+
 func DoEstimateGas(ctx context.Context, b Backend, args TransactionArgs, blockNrOrHash rpc.BlockNumberOrHash, gasCap uint64) (hexutil.Uint64, error) {
 	// Binary search the gas requirement, as it may be higher than the amount used
 	var (
@@ -1572,12 +1813,27 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	// Derive the sender.
 	bigblock := new(big.Int).SetUint64(blockNumber)
 	signer := types.MakeSigner(s.b.ChainConfig(), bigblock)
+
+	var baseFee *big.Int
+	if s.b.ChainConfig().IsLondon(bigblock) {
+		header, err := s.b.HeaderByHash(ctx, blockHash)
+		if err != nil {
+			return nil, err
+		}
+		baseFee = header.BaseFee
+	}
+	return marshalReceipt(receipt, blockHash, blockNumber, signer, tx, index, baseFee), nil
+}
+
+// marshalReceipt marshals a transaction receipt into a JSON object. The base fee
+// is only set for blocks after London.
+func marshalReceipt(receipt *types.Receipt, blockHash common.Hash, blockNumber uint64, signer types.Signer, tx *types.Transaction, index uint64, baseFee *big.Int) map[string]interface{} {
 	from, _ := types.Sender(signer, tx)
 
 	fields := map[string]interface{}{
 		"blockHash":         blockHash,
 		"blockNumber":       hexutil.Uint64(blockNumber),
-		"transactionHash":   hash,
+		"transactionHash":   tx.Hash(),
 		"transactionIndex":  hexutil.Uint64(index),
 		"from":              from,
 		"to":                tx.To(),
@@ -1589,14 +1845,10 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 		"type":              hexutil.Uint(tx.Type()),
 	}
 	// Assign the effective gas price paid
-	if !s.b.ChainConfig().IsLondon(bigblock) {
+	if baseFee == nil {
 		fields["effectiveGasPrice"] = hexutil.Uint64(tx.GasPrice().Uint64())
 	} else {
-		header, err := s.b.HeaderByHash(ctx, blockHash)
-		if err != nil {
-			return nil, err
-		}
-		gasPrice := new(big.Int).Add(header.BaseFee, tx.EffectiveGasTipValue(header.BaseFee))
+		gasPrice := new(big.Int).Add(baseFee, tx.EffectiveGasTipValue(baseFee))
 		fields["effectiveGasPrice"] = hexutil.Uint64(gasPrice.Uint64())
 	}
 	// Assign receipt status or post state.
@@ -1612,7 +1864,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	if receipt.ContractAddress != (common.Address{}) {
 		fields["contractAddress"] = receipt.ContractAddress
 	}
-	return fields, nil
+	return fields
 }
 
 // sign is a helper function that signs a transaction with the private key of the given address.
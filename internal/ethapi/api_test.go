@@ -0,0 +1,235 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/token/common"
+	"github.com/token/common/hexutil"
+	"github.com/token/consensus"
+	"github.com/token/consensus/ethash"
+	"github.com/token/core"
+	"github.com/token/core/rawdb"
+	"github.com/token/core/state"
+	"github.com/token/core/types"
+	"github.com/token/core/vm"
+	"github.com/token/params"
+	"github.com/token/rpc"
+)
+
+var (
+	// counterCode increments the first storage slot and returns its new value.
+	counterCode = hexutil.MustDecode("0x60005460010180600055600052600060206000a160206000f3")
+
+	// contextCode returns the block number, timestamp and coinbase.
+	contextCode = hexutil.MustDecode("0x43600052426020524160405260606000f3")
+
+	// loopCode loops forever.
+	loopCode = hexutil.MustDecode("0x5b600056")
+
+	counterAddr = common.Address{0x01}
+	contextAddr = common.Address{0x02}
+	loopAddr    = common.Address{0x03}
+)
+
+// callTestBackend is a Backend serving a single block, only implementing the
+// methods needed to simulate calls.
+type callTestBackend struct {
+	Backend
+
+	db     state.Database
+	root   common.Hash
+	header *types.Header
+	engine consensus.Engine
+}
+
+func newCallTestBackend(t *testing.T) *callTestBackend {
+	db := state.NewDatabase(rawdb.NewMemoryDatabase())
+	statedb, _ := state.New(common.Hash{}, db, nil)
+	statedb.SetCode(counterAddr, counterCode)
+	statedb.SetCode(contextAddr, contextCode)
+	statedb.SetCode(loopAddr, loopCode)
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	return &callTestBackend{
+		db:   db,
+		root: root,
+		header: &types.Header{
+			Number:     big.NewInt(10),
+			Time:       100,
+			GasLimit:   10000000,
+			Difficulty: big.NewInt(1),
+			Coinbase:   common.Address{0xcc},
+			Root:       root,
+		},
+		engine: ethash.NewFaker(),
+	}
+}
+
+func (b *callTestBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error) {
+	statedb, err := state.New(b.root, b.db, nil)
+	return statedb, b.header, err
+}
+
+func (b *callTestBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmConfig *vm.Config) (*vm.EVM, func() error, error) {
+	context := core.NewEVMBlockContext(header, b, nil)
+	return vm.NewEVM(context, core.NewEVMTxContext(msg), state, b.ChainConfig(), *vmConfig), func() error { return nil }, nil
+}
+
+func (b *callTestBackend) ChainConfig() *params.ChainConfig { return params.TestChainConfig }
+func (b *callTestBackend) Engine() consensus.Engine         { return b.engine }
+func (b *callTestBackend) RPCGasCap() uint64                { return 25000000 }
+
+func (b *callTestBackend) GetHeader(hash common.Hash, number uint64) *types.Header { return nil }
+
+func callTo(addr common.Address) BundleCall {
+	return BundleCall{Transaction: TransactionArgs{To: &addr}}
+}
+
+func callMany(t *testing.T, b *callTestBackend, calls []BundleCall, overrides *BlockOverrides) []*BundleCallResult {
+	results, err := DoCallMany(context.Background(), b, calls, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), overrides, 5*time.Second, b.RPCGasCap())
+	if err != nil {
+		t.Fatalf("failed to execute call bundle: %v", err)
+	}
+	if len(results) != len(calls) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(results), len(calls))
+	}
+	return results
+}
+
+// Tests that every call of a bundle sees the state changes of the previous ones,
+// and that the bundle doesn't modify the state of the block.
+func TestCallManyStateVisibility(t *testing.T) {
+	b := newCallTestBackend(t)
+
+	results := callMany(t, b, []BundleCall{callTo(counterAddr), callTo(counterAddr), callTo(counterAddr)}, nil)
+	for i, res := range results {
+		if res.Error != "" {
+			t.Fatalf("call %d failed: %s", i, res.Error)
+		}
+		if have, want := new(big.Int).SetBytes(res.ReturnValue).Uint64(), uint64(i+1); have != want {
+			t.Errorf("call %d: counter mismatch: have %d, want %d", i, have, want)
+		}
+		if len(res.Logs) != 1 || res.Logs[0].Address != counterAddr || res.Logs[0].TxIndex != uint(i) {
+			t.Errorf("call %d: logs mismatch: %v", i, res.Logs)
+		}
+		if res.GasUsed == 0 {
+			t.Errorf("call %d: no gas used", i)
+		}
+	}
+	// A new bundle starts from the state of the block again
+	results = callMany(t, b, []BundleCall{callTo(counterAddr)}, nil)
+	if have := new(big.Int).SetBytes(results[0].ReturnValue).Uint64(); have != 1 {
+		t.Errorf("counter of new bundle mismatch: have %d, want %d", have, 1)
+	}
+}
+
+// Tests that the state overrides of a call apply on top of the changes of the
+// previous calls, and are seen by the following ones.
+func TestCallManyStateOverrides(t *testing.T) {
+	b := newCallTestBackend(t)
+
+	override := callTo(counterAddr)
+	override.StateOverrides = &StateOverride{
+		counterAddr: OverrideAccount{StateDiff: &map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(10))}},
+	}
+	results := callMany(t, b, []BundleCall{callTo(counterAddr), override, callTo(counterAddr)}, nil)
+	for i, want := range []uint64{1, 11, 12} {
+		if results[i].Error != "" {
+			t.Fatalf("call %d failed: %s", i, results[i].Error)
+		}
+		if have := new(big.Int).SetBytes(results[i].ReturnValue).Uint64(); have != want {
+			t.Errorf("call %d: counter mismatch: have %d, want %d", i, have, want)
+		}
+	}
+	// Invalid overrides abort the whole bundle
+	invalid := callTo(counterAddr)
+	invalid.StateOverrides = &StateOverride{
+		counterAddr: OverrideAccount{State: &map[common.Hash]common.Hash{}, StateDiff: &map[common.Hash]common.Hash{}},
+	}
+	_, err := DoCallMany(context.Background(), b, []BundleCall{callTo(counterAddr), invalid}, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), nil, 5*time.Second, b.RPCGasCap())
+	if err == nil || !strings.HasPrefix(err.Error(), "call 1:") {
+		t.Errorf("invalid override error mismatch: have %v, want call 1 error", err)
+	}
+}
+
+// Tests that the block overrides apply to all the calls of a bundle.
+func TestCallManyBlockOverrides(t *testing.T) {
+	b := newCallTestBackend(t)
+
+	check := func(res *BundleCallResult, number uint64, timestamp uint64, coinbase common.Address) {
+		t.Helper()
+		if res.Error != "" {
+			t.Fatalf("call failed: %s", res.Error)
+		}
+		if have := new(big.Int).SetBytes(res.ReturnValue[:32]).Uint64(); have != number {
+			t.Errorf("block number mismatch: have %d, want %d", have, number)
+		}
+		if have := new(big.Int).SetBytes(res.ReturnValue[32:64]).Uint64(); have != timestamp {
+			t.Errorf("block timestamp mismatch: have %d, want %d", have, timestamp)
+		}
+		if have := common.BytesToAddress(res.ReturnValue[64:96]); have != coinbase {
+			t.Errorf("coinbase mismatch: have %x, want %x", have, coinbase)
+		}
+	}
+	results := callMany(t, b, []BundleCall{callTo(contextAddr)}, nil)
+	check(results[0], 10, 100, b.header.Coinbase)
+
+	var (
+		number    = hexutil.Big(*big.NewInt(20))
+		timestamp = hexutil.Uint64(200)
+		coinbase  = common.Address{0xdd}
+	)
+	overrides := &BlockOverrides{Number: &number, Time: &timestamp, Coinbase: &coinbase}
+	results = callMany(t, b, []BundleCall{callTo(contextAddr), callTo(contextAddr)}, overrides)
+	for _, res := range results {
+		check(res, 20, 200, coinbase)
+	}
+	if b.header.Number.Uint64() != 10 || b.header.Time != 100 {
+		t.Errorf("block header modified by overrides")
+	}
+}
+
+// Tests that failing calls are reported without aborting the bundle, while a
+// timeout aborts it.
+func TestCallManyErrors(t *testing.T) {
+	b := newCallTestBackend(t)
+
+	// A call running out of gas fails on its own
+	gas := hexutil.Uint64(30000)
+	failing := callTo(loopAddr)
+	failing.Transaction.Gas = &gas
+	results := callMany(t, b, []BundleCall{callTo(counterAddr), failing, callTo(counterAddr)}, nil)
+	if results[1].Error == "" {
+		t.Errorf("out of gas call succeeded")
+	}
+	if have := new(big.Int).SetBytes(results[2].ReturnValue).Uint64(); results[2].Error != "" || have != 2 {
+		t.Errorf("call after failure mismatch: have %d (%s), want %d", have, results[2].Error, 2)
+	}
+	// A call exceeding the timeout aborts the bundle
+	_, err := DoCallMany(context.Background(), b, []BundleCall{callTo(counterAddr), callTo(loopAddr)}, rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber), nil, 50*time.Millisecond, 0)
+	if err == nil || !strings.Contains(err.Error(), "execution aborted") {
+		t.Errorf("timeout error mismatch: have %v, want execution aborted", err)
+	}
+}
@@ -387,6 +387,7 @@ func (s *Lightnbn) Stop() error {
 	s.blockchain.Stop()
 	s.handler.stop()
 	s.txPool.Stop()
+	s.ApiBackend.gpo.Stop()
 	s.engine.Close()
 	s.pruner.close()
 	s.eventMux.Stop()
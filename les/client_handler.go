@@ -74,7 +74,7 @@ func newClientHandler(ulcServers []string, ulcFraction int, checkpoint *params.T
 		height = (checkpoint.SectionIndex+1)*params.CHTFrequency - 1
 	}
 	handler.fetcher = newLightFetcher(backend.blockchain, backend.engine, backend.peers, handler.ulc, backend.chainDb, backend.reqDist, handler.synchronise)
-	handler.downloader = downloader.New(height, backend.chainDb, nil, backend.eventMux, nil, backend.blockchain, handler.removePeer)
+	handler.downloader = downloader.New(height, backend.chainDb, nil, backend.eventMux, nil, backend.blockchain, handler.removePeer, nil)
 	handler.backend.peers.subscribe((*downloaderPeerNotify)(handler))
 	return handler
 }
@@ -154,6 +154,7 @@ func (h *clientHandler) handle(p *serverPeer) error {
 		if err := h.handleMsg(p); err != nil {
 			p.Log().Debug("Light nbn message handling failed", "err", err)
 			p.fcServer.DumpLogs()
+			reportInvalidMsg(p.Peer, err)
 			return err
 		}
 	}
@@ -17,6 +17,7 @@
 package les
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"sync"
@@ -37,8 +38,31 @@ import (
 	"github.com/token/params"
 )
 
+// respError is a protocol error carrying its error code.
+type respError struct {
+	code errCode
+	msg  string
+}
+
+func (e *respError) Error() string {
+	return fmt.Sprintf("%v - %v", e.code, e.msg)
+}
+
 func errResp(code errCode, format string, v ...interface{}) error {
-	return fmt.Errorf("%v - %v", code, fmt.Sprintf(format, v...))
+	return &respError{code: code, msg: fmt.Sprintf(format, v...)}
+}
+
+// reportInvalidMsg penalizes the peer if the message handling error stems from
+// a malformed message.
+func reportInvalidMsg(p *p2p.Peer, err error) {
+	var resp *respError
+	if !errors.As(err, &resp) {
+		return
+	}
+	switch resp.code {
+	case ErrMsgTooLarge, ErrDecode, ErrInvalidMsgCode:
+		p.Report(p2p.PenaltyMajor, err.Error())
+	}
 }
 
 type chainReader interface {
@@ -177,6 +177,7 @@ func (h *serverHandler) handle(p *clientPeer) error {
 		}
 		if err := h.handleMsg(p, &wg); err != nil {
 			p.Log().Debug("Light nbn message handling failed", "err", err)
+			reportInvalidMsg(p.Peer, err)
 			return err
 		}
 	}
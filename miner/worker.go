@@ -33,6 +33,7 @@ import (
 	"github.com/token/core/types"
 	"github.com/token/event"
 	"github.com/token/log"
+	"github.com/token/metrics"
 	"github.com/token/params"
 	"github.com/token/trie"
 )
@@ -77,6 +78,20 @@ const (
 	staleThreshold = 7
 )
 
+var (
+	// Metrics for the consensus system transaction lane
+	systemTxMeter  = metrics.NewRegisteredMeter("miner/system/txs", nil)
+	systemGasGauge = metrics.NewRegisteredGauge("miner/system/gas", nil)
+)
+
+// txIterator is an ordered set of pending transactions consumed by the worker
+// when filling a block.
+type txIterator interface {
+	Peek() *types.Transaction
+	Shift()
+	Pop()
+}
+
 // environment is the worker's current environment and holds all of the current state information.
 type environment struct {
 	signer types.Signer
@@ -163,9 +178,10 @@ type worker struct {
 	pendingMu    sync.RWMutex
 	pendingTasks map[common.Hash]*task
 
-	snapshotMu    sync.RWMutex // The lock used to protect the block snapshot and state snapshot
-	snapshotBlock *types.Block
-	snapshotState *state.StateDB
+	snapshotMu       sync.RWMutex // The lock used to protect the block snapshot and state snapshot
+	snapshotBlock    *types.Block
+	snapshotReceipts types.Receipts
+	snapshotState    *state.StateDB
 
 	// atomic status counters
 	running int32 // The indicator whether the consensus engine is running or not.
@@ -286,6 +302,14 @@ func (w *worker) pendingBlock() *types.Block {
 	return w.snapshotBlock
 }
 
+// pendingBlockAndReceipts returns pending block and corresponding receipts.
+func (w *worker) pendingBlockAndReceipts() (*types.Block, types.Receipts) {
+	// return a snapshot to avoid contention on currentMu mutex
+	w.snapshotMu.RLock()
+	defer w.snapshotMu.RUnlock()
+	return w.snapshotBlock, w.snapshotReceipts
+}
+
 // start sets the running status as 1 and triggers new work submitting.
 func (w *worker) start() {
 	atomic.StoreInt32(&w.running, 1)
@@ -745,6 +769,7 @@ func (w *worker) updateSnapshot() {
 		w.current.receipts,
 		trie.NewStackTrie(nil),
 	)
+	w.snapshotReceipts = copyReceipts(w.current.receipts)
 	w.snapshotState = w.current.state.Copy()
 }
 
@@ -804,7 +829,7 @@ log.Warn("commitTransaction", "gasWard", w.current.GasReward)
 	return receipt.Logs, nil
 }
 
-func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coinbase common.Address, interrupt *int32) bool {
+func (w *worker) commitTransactions(txs txIterator, coinbase common.Address, interrupt *int32) bool {
 	// Short circuit if current is nil
 	if w.current == nil {
 		return true
@@ -1032,6 +1057,28 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		w.updateSnapshot()
 		return
 	}
+	// Fill the reserved block space with the consensus system transactions first,
+	// in arrival order, then release the unused reserve to the other lanes, which
+	// also get the system transactions that didn't fit.
+	if reserve := w.systemGasReserve(header.GasLimit); reserve > 0 {
+		w.current.gasPool = new(core.GasPool).AddGas(reserve)
+		if systemTxs := w.splitSystemTxs(pending); len(systemTxs) > 0 {
+			heads := make(map[common.Address]types.Transactions, len(systemTxs))
+			for from, txs := range systemTxs {
+				heads[from] = txs
+			}
+			tcount := w.current.tcount
+			txs := types.NewTransactionsByTimeAndNonce(w.current.signer, heads)
+			if w.commitTransactions(txs, w.coinbase, interrupt) {
+				return
+			}
+			systemTxMeter.Mark(int64(w.current.tcount - tcount))
+			systemGasGauge.Update(int64(reserve - w.current.gasPool.Gas()))
+
+			w.mergeSystemTxs(pending, systemTxs)
+		}
+		w.current.gasPool.AddGas(header.GasLimit - reserve)
+	}
 	// Split the pending transactions into locals and remotes
 	localTxs, remoteTxs := make(map[common.Address]types.Transactions), pending
 	for _, account := range w.eth.TxPool().Locals() {
@@ -1055,6 +1102,59 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 	w.commit(uncles, w.fullTaskHook, true, tstart)
 }
 
+// systemGasReserve returns the gas reserved for the consensus system lane in a
+// block with the given gas limit, or zero if the engine has no such lane.
+func (w *worker) systemGasReserve(gasLimit uint64) uint64 {
+	if _, ok := w.engine.(consensus.SystemTxEngine); !ok {
+		return 0
+	}
+	if w.config.SystemGasReserve > gasLimit {
+		return gasLimit
+	}
+	return w.config.SystemGasReserve
+}
+
+// splitSystemTxs moves the leading consensus system transactions of every account
+// out of the pending set, so they are committed ahead of the gas price ordered
+// lanes. Only a leading run can be moved without violating the nonce ordering.
+func (w *worker) splitSystemTxs(pending map[common.Address]types.Transactions) map[common.Address]types.Transactions {
+	engine := w.engine.(consensus.SystemTxEngine)
+
+	systemTxs := make(map[common.Address]types.Transactions)
+	for from, txs := range pending {
+		n := 0
+		for n < len(txs) && engine.IsSystemTransaction(w.chain, txs[n], from) {
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		systemTxs[from] = txs[:n]
+		if n == len(txs) {
+			delete(pending, from)
+		} else {
+			pending[from] = txs[n:]
+		}
+	}
+	return systemTxs
+}
+
+// mergeSystemTxs moves the consensus system transactions that weren't included
+// by the system lane back in front of the pending transactions of their account,
+// so they can still be included by the gas price ordered lanes.
+func (w *worker) mergeSystemTxs(pending map[common.Address]types.Transactions, systemTxs map[common.Address]types.Transactions) {
+	for from, txs := range systemTxs {
+		nonce := w.current.state.GetNonce(from)
+		for len(txs) > 0 && txs[0].Nonce() < nonce {
+			txs = txs[1:]
+		}
+		if len(txs) == 0 {
+			continue
+		}
+		pending[from] = append(append(types.Transactions{}, txs...), pending[from]...)
+	}
+}
+
 // commit runs any post-transaction state modifications, assembles the final block
 // and commits new work if consensus engine is running.
 func (w *worker) commit(uncles []*types.Header, interval func(), update bool, start time.Time) error {
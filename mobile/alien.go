@@ -0,0 +1,270 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+// Contains wrappers for the alien consensus custom transactions and APIs.
+
+package nbn
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/token/common"
+	"github.com/token/common/hexutil"
+	"github.com/token/consensus/alien"
+)
+
+// Alien custom transactions are plain transactions carrying a colon separated
+// payload in their data field. Votes must be sent to the candidate voted for,
+// all other operations are usually sent by the account to itself.
+const (
+	alienUfoPrefix   = "ufo"
+	alienTokenPrefix = "token"
+	alienVersion     = "1"
+)
+
+// Revenue types of device bindings.
+const (
+	AlienRevenuePos = 0 // Revenue of a PoS signer
+	AlienRevenuePof = 1 // Revenue of a PoF miner
+)
+
+// alienAddress encodes an address the way the alien custom tx parsers expect.
+func alienAddress(address *Address) string {
+	return common.Bytes2Hex(address.address[:])
+}
+
+// NewAlienVoteData returns the payload of a vote transaction. The transaction
+// votes for its recipient with the balance of its sender.
+func NewAlienVoteData() []byte {
+	return []byte(fmt.Sprintf("%s:%s:event:vote", alienUfoPrefix, alienVersion))
+}
+
+// NewAlienCandidatePledgeData returns the payload pledging the candidate deposit
+// for a new PoS signer. The sender becomes the manager of the signer.
+func NewAlienCandidatePledgeData(miner *Address) (data []byte, _ error) {
+	if miner == nil {
+		return nil, errors.New("miner address is required")
+	}
+	return []byte(fmt.Sprintf("%s:%s:CandReq:%s", alienTokenPrefix, alienVersion, alienAddress(miner))), nil
+}
+
+// NewAlienCandidateExitData returns the payload withdrawing the pledge of a PoS
+// signer managed by the sender.
+func NewAlienCandidateExitData(miner *Address) (data []byte, _ error) {
+	if miner == nil {
+		return nil, errors.New("miner address is required")
+	}
+	return []byte(fmt.Sprintf("%s:%s:CandExit:%s", alienTokenPrefix, alienVersion, alienAddress(miner))), nil
+}
+
+// NewAlienEntrustData returns the payload entrusting amount wei to a PoS signer.
+func NewAlienEntrustData(miner *Address, amount *BigInt) (data []byte, _ error) {
+	if miner == nil || amount == nil {
+		return nil, errors.New("miner address and amount are required")
+	}
+	if amount.bigint.Sign() <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+	return []byte(fmt.Sprintf("%s:%s:CandEntrust:%s:%s", alienTokenPrefix, alienVersion, alienAddress(miner), hexutil.EncodeBig(amount.bigint))), nil
+}
+
+// NewAlienEntrustExitData returns the payload withdrawing an entrusted pledge
+// from a PoS signer. The pledge is identified by the hash of the transaction
+// which created it.
+func NewAlienEntrustExitData(miner *Address, pledge *Hash) (data []byte, _ error) {
+	if miner == nil || pledge == nil {
+		return nil, errors.New("miner address and pledge hash are required")
+	}
+	return []byte(fmt.Sprintf("%s:%s:CandETExit:%s:%s", alienTokenPrefix, alienVersion, alienAddress(miner), pledge.hash.Hex())), nil
+}
+
+// NewAlienDeviceBindData returns the payload binding a device to a revenue
+// address. If revenue is nil, the revenue goes to the sender.
+func NewAlienDeviceBindData(device *Address, revenueType int, revenue *Address) (data []byte, _ error) {
+	return newAlienDeviceBind("Bind", device, revenueType, revenue)
+}
+
+// NewAlienDeviceRebindData returns the payload moving the revenue of a bound
+// device to another address.
+func NewAlienDeviceRebindData(device *Address, revenueType int, revenue *Address) (data []byte, _ error) {
+	if revenue == nil {
+		return nil, errors.New("revenue address is required")
+	}
+	return newAlienDeviceBind("Rebind", device, revenueType, revenue)
+}
+
+// NewAlienDeviceUnbindData returns the payload removing the binding of a device.
+func NewAlienDeviceUnbindData(device *Address, revenueType int) (data []byte, _ error) {
+	return newAlienDeviceBind("Unbind", device, revenueType, nil)
+}
+
+func newAlienDeviceBind(category string, device *Address, revenueType int, revenue *Address) ([]byte, error) {
+	if device == nil {
+		return nil, errors.New("device address is required")
+	}
+	if revenueType != AlienRevenuePos && revenueType != AlienRevenuePof {
+		return nil, fmt.Errorf("unknown revenue type %d", revenueType)
+	}
+	// Contract and multi signature addresses are not supported by the engine yet
+	var zero Address
+	payload := fmt.Sprintf("%s:%s:%s:%s:%d:%s:%s", alienTokenPrefix, alienVersion, category,
+		alienAddress(device), revenueType, alienAddress(&zero), alienAddress(&zero))
+	if revenue != nil {
+		payload += ":" + alienAddress(revenue)
+	}
+	return []byte(payload), nil
+}
+
+// NewAlienPofRequestData returns the payload pledging for a PoF miner with the
+// given bandwidth (Mbps) and price (wei per Mbps).
+func NewAlienPofRequestData(miner *Address, bandwidth int64, price *BigInt) (data []byte, _ error) {
+	if miner == nil || price == nil {
+		return nil, errors.New("miner address and price are required")
+	}
+	if bandwidth <= 0 {
+		return nil, errors.New("bandwidth must be positive")
+	}
+	return []byte(fmt.Sprintf("%s:%s:pofReq:%s:%s:%s", alienTokenPrefix, alienVersion,
+		alienAddress(miner), strconv.FormatInt(bandwidth, 16), price.bigint.String())), nil
+}
+
+// NewAlienPofExitData returns the payload withdrawing the pledge of a PoF miner.
+func NewAlienPofExitData(miner *Address) (data []byte, _ error) {
+	if miner == nil {
+		return nil, errors.New("miner address is required")
+	}
+	return []byte(fmt.Sprintf("%s:%s:pofExit:%s", alienTokenPrefix, alienVersion, alienAddress(miner))), nil
+}
+
+// AlienLockRelease is a single locked pledge or reward and its release schedule.
+type AlienLockRelease struct {
+	item *alien.PledgeItem
+}
+
+// GetAmount returns the locked amount.
+func (r *AlienLockRelease) GetAmount() *BigInt { return alienBigInt(r.item.Amount) }
+
+// GetPayment returns the amount already released.
+func (r *AlienLockRelease) GetPayment() *BigInt { return alienBigInt(r.item.Playment) }
+
+// GetType returns the kind of the lock (signer reward, PoF reward, pledge exit, ...).
+func (r *AlienLockRelease) GetType() int { return int(r.item.PledgeType) }
+
+// GetStartBlock returns the block number the lock started at.
+func (r *AlienLockRelease) GetStartBlock() int64 { return int64(r.item.StartHigh) }
+
+// GetLockPeriod returns the number of blocks before the release starts.
+func (r *AlienLockRelease) GetLockPeriod() int64 { return int64(r.item.LockPeriod) }
+
+// GetReleasePeriod returns the number of blocks over which the amount is released.
+func (r *AlienLockRelease) GetReleasePeriod() int64 { return int64(r.item.RlsPeriod) }
+
+// GetInterval returns the number of blocks between two releases.
+func (r *AlienLockRelease) GetInterval() int64 { return int64(r.item.Interval) }
+
+// GetRevenue returns the address receiving the released amount.
+func (r *AlienLockRelease) GetRevenue() *Address { return &Address{r.item.RevenueAddress} }
+
+// alienBigInt wraps a possibly missing RPC quantity.
+func alienBigInt(x *big.Int) *BigInt {
+	if x == nil {
+		return NewBigInt(0)
+	}
+	return &BigInt{new(big.Int).Set(x)}
+}
+
+// AlienLockReleases represents the locked items of an account.
+type AlienLockReleases struct {
+	rewards map[uint32]*big.Int
+	items   []*alien.PledgeItem
+}
+
+// Size returns the number of locked items.
+func (r *AlienLockReleases) Size() int {
+	return len(r.items)
+}
+
+// Get returns the locked item at the given index.
+func (r *AlienLockReleases) Get(index int) (release *AlienLockRelease, _ error) {
+	if index < 0 || index >= len(r.items) {
+		return nil, errors.New("index out of bounds")
+	}
+	return &AlienLockRelease{r.items[index]}, nil
+}
+
+// GetRewardBalance returns the reward of the given type accumulated but not yet
+// locked.
+func (r *AlienLockReleases) GetRewardBalance(kind int) *BigInt {
+	return alienBigInt(r.rewards[uint32(kind)])
+}
+
+// GetAlienCoinBalance returns the alien coin balance of the given account.
+// The block number can be <0, in which case the balance is taken from the latest known block.
+func (ec *nbnClient) GetAlienCoinBalance(ctx *Context, account *Address, number int64) (balance *BigInt, _ error) {
+	var result alien.SnapshotAddrCoin
+	var err error
+	if number < 0 {
+		err = ec.rpc.CallContext(ctx.context, &result, "alien_getCoinBalance", account.address)
+	} else {
+		err = ec.rpc.CallContext(ctx.context, &result, "alien_getCoinBalanceAtNumber", account.address, uint64(number))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return alienBigInt(result.AddrCoinBal), nil
+}
+
+// GetAlienLockReleases returns the locked pledges and rewards of the given account.
+// The part selects a single lock ("rewardlock", "poflock", "inspirelock", "pofexit"
+// or "posexit"), or all of them if empty. The block number can be <0, in which case
+// the locks are taken from the latest known block.
+func (ec *nbnClient) GetAlienLockReleases(ctx *Context, account *Address, part string, number int64) (releases *AlienLockReleases, _ error) {
+	if number < 0 {
+		head, err := ec.client.BlockNumber(ctx.context)
+		if err != nil {
+			return nil, err
+		}
+		number = int64(head)
+	}
+	var result alien.SnapshotRelease
+	if err := ec.rpc.CallContext(ctx.context, &result, "alien_getSnapshotReleaseAtNumber", uint64(number), part); err != nil {
+		return nil, err
+	}
+	releases = &AlienLockReleases{rewards: make(map[uint32]*big.Int)}
+
+	data, ok := result.Revenue[account.address]
+	if !ok {
+		return releases, nil
+	}
+	releases.rewards = data.RewardBalance
+	for _, items := range data.LockBalance {
+		for _, item := range items {
+			releases.items = append(releases.items, item)
+		}
+	}
+	// Maps have no order, present the locks oldest first
+	sort.Slice(releases.items, func(i, j int) bool {
+		if releases.items[i].StartHigh != releases.items[j].StartHigh {
+			return releases.items[i].StartHigh < releases.items[j].StartHigh
+		}
+		return releases.items[i].PledgeType < releases.items[j].PledgeType
+	})
+	return releases, nil
+}
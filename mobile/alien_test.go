@@ -0,0 +1,59 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package nbn
+
+import (
+	"testing"
+
+	"github.com/token/common"
+)
+
+func TestAlienCustomTxData(t *testing.T) {
+	miner := &Address{common.HexToAddress("0xbec92229b1bd96919c8ffc993171fa6504121dc6")}
+	revenue := &Address{common.HexToAddress("0x0ff6e773ff893ff39ed9352160889df13bdfc896")}
+	hash := &Hash{common.HexToHash("0x01")}
+
+	mustData := func(data []byte, err error) string {
+		if err != nil {
+			t.Fatalf("failed to build payload: %v", err)
+		}
+		return string(data)
+	}
+	tests := []struct {
+		have, want string
+	}{
+		{string(NewAlienVoteData()), "ufo:1:event:vote"},
+		{mustData(NewAlienCandidatePledgeData(miner)), "token:1:CandReq:bec92229b1bd96919c8ffc993171fa6504121dc6"},
+		{mustData(NewAlienEntrustData(miner, NewBigInt(256))), "token:1:CandEntrust:bec92229b1bd96919c8ffc993171fa6504121dc6:0x100"},
+		{mustData(NewAlienEntrustExitData(miner, hash)), "token:1:CandETExit:bec92229b1bd96919c8ffc993171fa6504121dc6:0x0000000000000000000000000000000000000000000000000000000000000001"},
+		{mustData(NewAlienDeviceBindData(miner, AlienRevenuePof, nil)), "token:1:Bind:bec92229b1bd96919c8ffc993171fa6504121dc6:1:0000000000000000000000000000000000000000:0000000000000000000000000000000000000000"},
+		{mustData(NewAlienDeviceRebindData(miner, AlienRevenuePos, revenue)), "token:1:Rebind:bec92229b1bd96919c8ffc993171fa6504121dc6:0:0000000000000000000000000000000000000000:0000000000000000000000000000000000000000:0ff6e773ff893ff39ed9352160889df13bdfc896"},
+		{mustData(NewAlienPofRequestData(miner, 100, NewBigInt(976562500000))), "token:1:pofReq:bec92229b1bd96919c8ffc993171fa6504121dc6:64:976562500000"},
+		{mustData(NewAlienPofExitData(miner)), "token:1:pofExit:bec92229b1bd96919c8ffc993171fa6504121dc6"},
+	}
+	for i, tt := range tests {
+		if tt.have != tt.want {
+			t.Errorf("test %d: payload mismatch: have %q, want %q", i, tt.have, tt.want)
+		}
+	}
+	if _, err := NewAlienEntrustData(miner, NewBigInt(0)); err == nil {
+		t.Errorf("expected error for zero entrust amount")
+	}
+	if _, err := NewAlienDeviceBindData(miner, 7, nil); err == nil {
+		t.Errorf("expected error for unknown revenue type")
+	}
+}
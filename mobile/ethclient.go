@@ -23,17 +23,22 @@ import (
 
 	"github.com/token/core/types"
 	"github.com/token/ethclient"
+	"github.com/token/rpc"
 )
 
 // nbnClient provides access to the nbn APIs.
 type nbnClient struct {
 	client *ethclient.Client
+	rpc    *rpc.Client // Raw client for the consensus specific APIs
 }
 
 // NewnbnClient connects a client to the given URL.
 func NewnbnClient(rawurl string) (client *nbnClient, _ error) {
-	rawClient, err := ethclient.Dial(rawurl)
-	return &nbnClient{rawClient}, err
+	rawClient, err := rpc.Dial(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return &nbnClient{ethclient.NewClient(rawClient), rawClient}, nil
 }
 
 // GetBlockByHash returns the given full block.
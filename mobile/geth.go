@@ -213,7 +213,7 @@ func (n *Node) GetnbnClient() (client *nbnClient, _ error) {
 	if err != nil {
 		return nil, err
 	}
-	return &nbnClient{ethclient.NewClient(rpc)}, nil
+	return &nbnClient{ethclient.NewClient(rpc), rpc}, nil
 }
 
 // GetNodeInfo gathers and returns a collection of metadata known about the host.
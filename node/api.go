@@ -19,7 +19,10 @@ package node
 import (
 	"context"
 	"fmt"
+	"net"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/token/common/hexutil"
 	"github.com/token/crypto"
@@ -125,6 +128,83 @@ func (api *privateAdminAPI) RemoveTrustedPeer(url string) (bool, error) {
 	return true, nil
 }
 
+// BanPeer bans a remote node, given either as an enode URL or as a plain IP
+// address, for the given number of seconds, disconnecting it if connected. The
+// p2p server's default ban duration is used if none is given.
+func (api *privateAdminAPI) BanPeer(target string, seconds *uint64, reason *string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	var (
+		duration time.Duration
+		why      = "banned by admin"
+	)
+	if seconds != nil {
+		duration = time.Duration(*seconds) * time.Second
+	}
+	if reason != nil {
+		why = *reason
+	}
+	if ip := net.ParseIP(target); ip != nil {
+		return true, server.BanIP(ip, duration, why)
+	}
+	node, err := enode.Parse(enode.ValidSchemes, target)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode or IP: %v", err)
+	}
+	return true, server.BanPeer(node, duration, why)
+}
+
+// UnbanPeer lifts the ban of a remote node, given either as an enode URL or as
+// a plain IP address.
+func (api *privateAdminAPI) UnbanPeer(target string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	if ip := net.ParseIP(target); ip != nil {
+		return true, server.UnbanIP(ip)
+	}
+	node, err := enode.Parse(enode.ValidSchemes, target)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode or IP: %v", err)
+	}
+	return true, server.UnbanPeer(node)
+}
+
+// BanInfo is a node ID or IP ban in force.
+type BanInfo struct {
+	ID     string    `json:"id,omitempty"`
+	IP     string    `json:"ip,omitempty"`
+	Expiry time.Time `json:"expiry"`
+	Reason string    `json:"reason"`
+}
+
+// ListBans returns the node ID and IP bans in force.
+func (api *privateAdminAPI) ListBans() ([]BanInfo, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	bans := server.Bans()
+	infos := make([]BanInfo, 0, len(bans))
+	for _, ban := range bans {
+		info := BanInfo{Expiry: ban.Expiry, Reason: ban.Reason}
+		if ban.IP != nil {
+			info.IP = ban.IP.String()
+		} else {
+			info.ID = ban.ID.String()
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Expiry.Before(infos[j].Expiry) })
+	return infos, nil
+}
+
 // PeerEvents creates an RPC subscription which receives peer events from the
 // node's p2p.Server
 func (api *privateAdminAPI) PeerEvents(ctx context.Context) (*rpc.Subscription, error) {
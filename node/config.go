@@ -25,10 +25,13 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/token/accounts"
 	"github.com/token/accounts/external"
+	"github.com/token/accounts/hdkeystore"
 	"github.com/token/accounts/keystore"
+	"github.com/token/accounts/kms"
 	"github.com/token/accounts/scwallet"
 	"github.com/token/accounts/usbwallet"
 	"github.com/token/common"
@@ -45,6 +48,7 @@ const (
 	datadirStaticNodes     = "static-nodes.json"  // Path within the datadir to the static node list
 	datadirTrustedNodes    = "trusted-nodes.json" // Path within the datadir to the trusted node list
 	datadirNodeDatabase    = "nodes"              // Path within the datadir to store the node infos
+	datadirJWTSecret       = "jwtsecret"          // Path within the datadir to the RPC authentication secret
 )
 
 // Config represents a small collection of configuration values to fine tune the
@@ -70,6 +74,11 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// DBEngine is the key-value store engine ("leveldb" or "pebble") of the
+	// databases opened by the node. Existing databases are opened with the
+	// engine they were created with if it's left empty.
+	DBEngine string `toml:",omitempty"`
+
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
@@ -85,6 +94,14 @@ type Config struct {
 	// ExternalSigner specifies an external URI for a clef-type signer
 	ExternalSigner string `toml:",omitempty"`
 
+	// KMSEndpoint is the URL of a key-management service whose keys are made
+	// available as accounts, next to the local ones.
+	KMSEndpoint string `toml:",omitempty"`
+
+	// KMSTokenFile is the path of the file holding the bearer token authenticating
+	// with the key-management service.
+	KMSTokenFile string `toml:",omitempty"`
+
 	// UseLightweightKDF lowers the memory and CPU requirements of the key store
 	// scrypt KDF at the expense of security.
 	UseLightweightKDF bool `toml:",omitempty"`
@@ -171,6 +188,67 @@ type Config struct {
 	// private APIs to untrusted users is a major security risk.
 	WSExposeAll bool `toml:",omitempty"`
 
+	// HTTPAuth requires every request to the HTTP RPC server to be authenticated
+	// with a JSON web token signed by the JWT secret.
+	HTTPAuth bool `toml:",omitempty"`
+
+	// WSAuth requires every websocket RPC connection to be authenticated with a
+	// JSON web token signed by the JWT secret.
+	WSAuth bool `toml:",omitempty"`
+
+	// AuthAddr is the host interface on which to start the authenticated RPC
+	// server, serving both HTTP and websocket requests.
+	AuthAddr string `toml:",omitempty"`
+
+	// AuthPort is the TCP port number on which to start the authenticated RPC
+	// server.
+	AuthPort int `toml:",omitempty"`
+
+	// AuthVirtualHosts is the list of virtual hostnames which are allowed on incoming
+	// requests to the authenticated RPC server.
+	AuthVirtualHosts []string `toml:",omitempty"`
+
+	// AuthModules is a list of API modules to expose via the authenticated RPC
+	// server. The server is only started if the list is non-empty, the modules
+	// are served regardless of whether they are public.
+	AuthModules []string `toml:",omitempty"`
+
+	// JWTSecret is the path to the hex encoded secret used to authenticate RPC
+	// requests. If the file doesn't exist, a new secret is generated into it. It
+	// defaults to a file in the data directory.
+	JWTSecret string `toml:",omitempty"`
+
+	// JWTIssuedAtSkew is the maximum difference allowed between the issuance time
+	// of a JWT token and the local clock, in either direction. Zero selects the
+	// default of one minute.
+	JWTIssuedAtSkew time.Duration `toml:",omitempty"`
+
+	// RPCBatchItemLimit is the maximum number of requests in a batch served over
+	// HTTP or WebSocket. Zero means no limit.
+	RPCBatchItemLimit int `toml:",omitempty"`
+
+	// RPCResponseSizeLimit is the maximum number of bytes of results returned for
+	// a single request or batch over HTTP or WebSocket. Zero means no limit.
+	//
+	// The limit only caps what is sent over the wire: results are checked while
+	// being encoded, after the method assembled them. Only handlers consulting
+	// rpc.ResponseSizeBudget stop early, the memory and time spent on oversized
+	// results of other methods are not bounded by it.
+	RPCResponseSizeLimit int `toml:",omitempty"`
+
+	// RPCMethodConcurrency limits the number of calls of the given methods served
+	// concurrently over HTTP or WebSocket, calls above the limit being rejected.
+	RPCMethodConcurrency map[string]int `toml:",omitempty"`
+
+	// RPCRateLimit is the number of calls per second a single client may make over
+	// HTTP or WebSocket. Clients are told apart by the subject of their JSON web
+	// token if authenticated, and by their IP address otherwise. Zero means no
+	// limit.
+	RPCRateLimit float64 `toml:",omitempty"`
+
+	// RPCRateBurst is the number of calls a client may burst above the rate limit.
+	RPCRateBurst int `toml:",omitempty"`
+
 	// GraphQLCors is the Cross-Origin Resource Sharing header to send to requesting
 	// clients. Please be aware that CORS is a browser enforced security, it's fully
 	// useless for custom HTTP clients.
@@ -488,6 +566,7 @@ func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
 		// we can have both, but it's very confusing for the user to see the same
 		// accounts in both externally and locally, plus very racey.
 		backends = append(backends, keystore.NewKeyStore(keydir, scryptN, scryptP))
+		backends = append(backends, hdkeystore.NewKeyStore(filepath.Join(keydir, hdkeystore.KeyStoreDir), scryptN, scryptP))
 		if conf.USB {
 			// Start a USB hub for Ledger hardware wallets
 			if ledgerhub, err := usbwallet.NewLedgerHub(); err != nil {
@@ -517,6 +596,22 @@ func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
 			}
 		}
 	}
+	if len(conf.KMSEndpoint) > 0 {
+		log.Info("Using key-management service", "url", conf.KMSEndpoint)
+		var token string
+		if conf.KMSTokenFile != "" {
+			blob, err := ioutil.ReadFile(conf.KMSTokenFile)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to read key-management service token: %v", err)
+			}
+			token = strings.TrimSpace(string(blob))
+		}
+		if kmsapi, err := kms.NewBackend(conf.KMSEndpoint, token); err == nil {
+			backends = append(backends, kmsapi)
+		} else {
+			return nil, "", fmt.Errorf("error connecting to key-management service: %v", err)
+		}
+	}
 
 	return accounts.NewManager(&accounts.Config{InsecureUnlockAllowed: conf.InsecureUnlockAllowed}, backends...), ephemeral, nil
 }
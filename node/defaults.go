@@ -34,6 +34,8 @@ const (
 	DefaultWSPort      = 8546        // Default TCP port for the websocket RPC server
 	DefaultGraphQLHost = "localhost" // Default host interface for the GraphQL server
 	DefaultGraphQLPort = 8547        // Default TCP port for the GraphQL server
+	DefaultAuthHost    = "localhost" // Default host interface for the authenticated RPC server
+	DefaultAuthPort    = 8551        // Default TCP port for the authenticated RPC server
 )
 
 // DefaultConfig contains reasonable default settings.
@@ -45,6 +47,10 @@ var DefaultConfig = Config{
 	HTTPTimeouts:        rpc.DefaultHTTPTimeouts,
 	WSPort:              DefaultWSPort,
 	WSModules:           []string{"net", "web3"},
+	AuthAddr:            DefaultAuthHost,
+	AuthPort:            DefaultAuthPort,
+	AuthVirtualHosts:    []string{"localhost"},
+	JWTIssuedAtSkew:     defaultJWTIssuedAtSkew,
 	GraphQLVirtualHosts: []string{"localhost"},
 	P2P: p2p.Config{
 		ListenAddr: ":30303",
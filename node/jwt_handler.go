@@ -0,0 +1,214 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package node
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/token/common"
+	"github.com/token/common/hexutil"
+	"github.com/token/rpc"
+)
+
+const (
+	// jwtSecretLength is the length of the HS256 secret in bytes.
+	jwtSecretLength = 32
+
+	// defaultJWTIssuedAtSkew is the default maximum difference allowed between the
+	// issuance time of a token and the local clock, in either direction.
+	defaultJWTIssuedAtSkew = 60 * time.Second
+)
+
+var (
+	errMissingToken   = errors.New("missing token")
+	errMalformedToken = errors.New("malformed token")
+	errTokenSignature = errors.New("invalid token signature")
+	errTokenAlgorithm = errors.New("unsupported token algorithm")
+	errTokenIssuedAt  = errors.New("token issuance time out of range")
+	errTokenExpired   = errors.New("token expired")
+)
+
+// jwtHeader is the JOSE header of a JSON web token.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// jwtClaims are the registered claims of a JSON web token checked by the node.
+// The issuance time is mandatory, it limits the time a token can be replayed.
+type jwtClaims struct {
+	IssuedAt  *int64 `json:"iat"`
+	ExpiresAt *int64 `json:"exp,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+}
+
+// jwtHandler is a http.Handler which only passes on requests carrying a valid
+// HS256 JSON web token in their Authorization header.
+type jwtHandler struct {
+	secret []byte
+	skew   time.Duration // Maximum clock difference to the token issuance time
+	next   http.Handler
+}
+
+// newJWTHandler wraps the given handler with JWT authentication, accepting tokens
+// issued within skew of the local time. A zero skew selects the default.
+func newJWTHandler(secret []byte, skew time.Duration, next http.Handler) http.Handler {
+	if skew <= 0 {
+		skew = defaultJWTIssuedAtSkew
+	}
+	return &jwtHandler{secret: secret, skew: skew, next: next}
+}
+
+// ServeHTTP implements http.Handler, rejecting unauthenticated requests. The
+// subject of the token, if any, identifies the client for rate limiting.
+func (h *jwtHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		http.Error(w, errMissingToken.Error(), http.StatusUnauthorized)
+		return
+	}
+	claims, err := verifyJWT(h.secret, token, time.Now(), h.skew)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if claims.Subject != "" {
+		r = r.WithContext(rpc.WithClientKey(r.Context(), "jwt:"+claims.Subject))
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// verifyJWT checks the signature and issuance time of an HS256 JSON web token,
+// returning its claims if valid.
+func verifyJWT(secret []byte, token string, now time.Time, skew time.Duration) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errMalformedToken
+	}
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "HS256" {
+		return nil, errTokenAlgorithm
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errMalformedToken
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errTokenSignature
+	}
+	var claims jwtClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims.IssuedAt == nil {
+		return nil, errTokenIssuedAt
+	}
+	issued := time.Unix(*claims.IssuedAt, 0)
+	if issued.Before(now.Add(-skew)) || issued.After(now.Add(skew)) {
+		return nil, errTokenIssuedAt
+	}
+	if claims.ExpiresAt != nil && !now.Before(time.Unix(*claims.ExpiresAt, 0)) {
+		return nil, errTokenExpired
+	}
+	return &claims, nil
+}
+
+// decodeJWTSegment decodes a base64url encoded JSON segment of a token.
+func decodeJWTSegment(segment string, v interface{}) error {
+	blob, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errMalformedToken
+	}
+	if err := json.Unmarshal(blob, v); err != nil {
+		return errMalformedToken
+	}
+	return nil
+}
+
+// NewJWTToken creates an HS256 JSON web token issued at the given time, to be
+// sent as a bearer token to an authenticated RPC endpoint.
+func NewJWTToken(secret []byte, issued time.Time) string {
+	header, _ := json.Marshal(jwtHeader{Alg: "HS256", Typ: "JWT"})
+	iat := issued.Unix()
+	claims, _ := json.Marshal(jwtClaims{IssuedAt: &iat})
+
+	payload := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ReadJWTSecret loads the hex encoded HS256 secret from the given file.
+func ReadJWTSecret(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := hexutil.Decode("0x" + strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT secret in %s: %v", path, err)
+	}
+	if len(secret) != jwtSecretLength {
+		return nil, fmt.Errorf("invalid JWT secret length in %s: have %d bytes, want %d", path, len(secret), jwtSecretLength)
+	}
+	return secret, nil
+}
+
+// obtainJWTSecret loads the JWT secret from the configured file, generating and
+// persisting a new one if the file doesn't exist yet.
+func (n *Node) obtainJWTSecret() ([]byte, error) {
+	path := n.config.JWTSecret
+	if path == "" {
+		path = n.config.ResolvePath(datadirJWTSecret)
+	}
+	if path == "" {
+		return nil, errors.New("no JWT secret file configured for an ephemeral node")
+	}
+	if common.FileExist(path) {
+		n.log.Info("Loaded JWT secret file", "path", path)
+		return ReadJWTSecret(path)
+	}
+	secret := make([]byte, jwtSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, []byte(hexutil.Encode(secret)), 0600); err != nil {
+		return nil, err
+	}
+	n.log.Warn("Generated new JWT secret", "path", path)
+	return secret, nil
+}
@@ -54,6 +54,7 @@ type Node struct {
 	rpcAPIs       []rpc.API   // List of APIs currently provided by the node
 	http          *httpServer //
 	ws            *httpServer //
+	httpAuth      *httpServer // Authenticated RPC server for the selected namespaces
 	ipc           *ipcServer  // Stores information about the ipc http server
 	inprocHandler *rpc.Server // In-process RPC request handler to process the API requests
 
@@ -146,6 +147,7 @@ func New(conf *Config) (*Node, error) {
 	// Configure RPC servers.
 	node.http = newHTTPServer(node.log, conf.HTTPTimeouts)
 	node.ws = newHTTPServer(node.log, rpc.DefaultHTTPTimeouts)
+	node.httpAuth = newHTTPServer(node.log, conf.HTTPTimeouts)
 	node.ipc = newIPCServer(node.log, conf.IPCEndpoint())
 
 	return node, nil
@@ -348,6 +350,22 @@ func (n *Node) startRPC() error {
 		}
 	}
 
+	// Load the JWT secret if any of the endpoints needs authentication.
+	var secret []byte
+	if n.config.HTTPAuth || n.config.WSAuth || len(n.config.AuthModules) > 0 {
+		var err error
+		if secret, err = n.obtainJWTSecret(); err != nil {
+			return err
+		}
+	}
+	limits := rpc.Limits{
+		BatchItems:        n.config.RPCBatchItemLimit,
+		ResponseBytes:     n.config.RPCResponseSizeLimit,
+		MethodConcurrency: n.config.RPCMethodConcurrency,
+		RateLimit:         n.config.RPCRateLimit,
+		RateBurst:         n.config.RPCRateBurst,
+	}
+
 	// Configure HTTP.
 	if n.config.HTTPHost != "" {
 		config := httpConfig{
@@ -355,6 +373,10 @@ func (n *Node) startRPC() error {
 			Vhosts:             n.config.HTTPVirtualHosts,
 			Modules:            n.config.HTTPModules,
 			prefix:             n.config.HTTPPathPrefix,
+			limits:             limits,
+		}
+		if n.config.HTTPAuth {
+			config.jwtSecret, config.jwtSkew = secret, n.config.JWTIssuedAtSkew
 		}
 		if err := n.http.setListenAddr(n.config.HTTPHost, n.config.HTTPPort); err != nil {
 			return err
@@ -371,6 +393,10 @@ func (n *Node) startRPC() error {
 			Modules: n.config.WSModules,
 			Origins: n.config.WSOrigins,
 			prefix:  n.config.WSPathPrefix,
+			limits:  limits,
+		}
+		if n.config.WSAuth {
+			config.jwtSecret, config.jwtSkew = secret, n.config.JWTIssuedAtSkew
 		}
 		if err := server.setListenAddr(n.config.WSHost, n.config.WSPort); err != nil {
 			return err
@@ -380,10 +406,39 @@ func (n *Node) startRPC() error {
 		}
 	}
 
+	// Configure the authenticated server, serving the selected modules over
+	// both HTTP and WebSocket.
+	if len(n.config.AuthModules) > 0 {
+		if err := n.httpAuth.setListenAddr(n.config.AuthAddr, n.config.AuthPort); err != nil {
+			return err
+		}
+		if err := n.httpAuth.enableRPC(n.rpcAPIs, httpConfig{
+			Modules:   n.config.AuthModules,
+			Vhosts:    n.config.AuthVirtualHosts,
+			jwtSecret: secret,
+			jwtSkew:   n.config.JWTIssuedAtSkew,
+			limits:    limits,
+		}); err != nil {
+			return err
+		}
+		if err := n.httpAuth.enableWS(n.rpcAPIs, wsConfig{
+			Modules:   n.config.AuthModules,
+			Origins:   n.config.WSOrigins,
+			jwtSecret: secret,
+			jwtSkew:   n.config.JWTIssuedAtSkew,
+			limits:    limits,
+		}); err != nil {
+			return err
+		}
+	}
+
 	if err := n.http.start(); err != nil {
 		return err
 	}
-	return n.ws.start()
+	if err := n.ws.start(); err != nil {
+		return err
+	}
+	return n.httpAuth.start()
 }
 
 func (n *Node) wsServerForPort(port int) *httpServer {
@@ -396,6 +451,7 @@ func (n *Node) wsServerForPort(port int) *httpServer {
 func (n *Node) stopRPC() {
 	n.http.stop()
 	n.ws.stop()
+	n.httpAuth.stop()
 	n.ipc.stop()
 	n.stopInProc()
 }
@@ -538,6 +594,12 @@ func (n *Node) WSEndpoint() string {
 	return "ws://" + n.ws.listenAddr() + n.ws.wsConfig.prefix
 }
 
+// AuthEndpoint returns the URL of the authenticated RPC server, serving both
+// HTTP and WebSocket requests.
+func (n *Node) AuthEndpoint() string {
+	return "http://" + n.httpAuth.listenAddr()
+}
+
 // EventMux retrieves the event multiplexer used by all the network services in
 // the current protocol stack.
 func (n *Node) EventMux() *event.TypeMux {
@@ -559,7 +621,10 @@ func (n *Node) OpenDatabase(name string, cache, handles int, namespace string, r
 	if n.config.DataDir == "" {
 		db = rawdb.NewMemoryDatabase()
 	} else {
-		db, err = rawdb.NewLevelDBDatabase(n.ResolvePath(name), cache, handles, namespace, readonly)
+		var kvdb ethdb.KeyValueStore
+		if kvdb, err = rawdb.OpenKeyValueStore(n.config.DBEngine, n.ResolvePath(name), cache, handles, namespace, readonly); err == nil {
+			db = rawdb.NewDatabase(kvdb)
+		}
 	}
 
 	if err == nil {
@@ -592,7 +657,12 @@ func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer,
 		case !filepath.IsAbs(freezer):
 			freezer = n.ResolvePath(freezer)
 		}
-		db, err = rawdb.NewLevelDBDatabaseWithFreezer(root, cache, handles, freezer, namespace, readonly)
+		var kvdb ethdb.KeyValueStore
+		if kvdb, err = rawdb.OpenKeyValueStore(n.config.DBEngine, root, cache, handles, namespace, readonly); err == nil {
+			if db, err = rawdb.NewDatabaseWithFreezer(kvdb, freezer, namespace, readonly); err != nil {
+				kvdb.Close()
+			}
+		}
 	}
 
 	if err == nil {
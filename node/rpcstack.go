@@ -28,6 +28,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/token/log"
 	"github.com/token/rpc"
@@ -39,14 +40,20 @@ type httpConfig struct {
 	Modules            []string
 	CorsAllowedOrigins []string
 	Vhosts             []string
-	prefix             string // path prefix on which to mount http handler
+	prefix             string        // path prefix on which to mount http handler
+	jwtSecret          []byte        // optional JWT secret to authenticate requests with
+	jwtSkew            time.Duration // maximum clock difference to the JWT issuance time
+	limits             rpc.Limits    // resource limits of the served requests
 }
 
 // wsConfig is the JSON-RPC/Websocket configuration
 type wsConfig struct {
-	Origins []string
-	Modules []string
-	prefix  string // path prefix on which to mount ws handler
+	Origins   []string
+	Modules   []string
+	prefix    string        // path prefix on which to mount ws handler
+	jwtSecret []byte        // optional JWT secret to authenticate connections with
+	jwtSkew   time.Duration // maximum clock difference to the JWT issuance time
+	limits    rpc.Limits    // resource limits of the served requests
 }
 
 type rpcHandler struct {
@@ -280,12 +287,13 @@ func (h *httpServer) enableRPC(apis []rpc.API, config httpConfig) error {
 
 	// Create RPC server and handler.
 	srv := rpc.NewServer()
+	srv.SetLimits(config.limits)
 	if err := RegisterApisFromWhitelist(apis, config.Modules, srv, false); err != nil {
 		return err
 	}
 	h.httpConfig = config
 	h.httpHandler.Store(&rpcHandler{
-		Handler: NewHTTPHandlerStack(srv, config.CorsAllowedOrigins, config.Vhosts),
+		Handler: newHTTPHandlerStack(srv, config.CorsAllowedOrigins, config.Vhosts, config.jwtSecret, config.jwtSkew),
 		server:  srv,
 	})
 	return nil
@@ -312,12 +320,17 @@ func (h *httpServer) enableWS(apis []rpc.API, config wsConfig) error {
 
 	// Create RPC server and handler.
 	srv := rpc.NewServer()
+	srv.SetLimits(config.limits)
 	if err := RegisterApisFromWhitelist(apis, config.Modules, srv, false); err != nil {
 		return err
 	}
 	h.wsConfig = config
+	handler := srv.WebsocketHandler(config.Origins)
+	if len(config.jwtSecret) > 0 {
+		handler = newJWTHandler(config.jwtSecret, config.jwtSkew, handler)
+	}
 	h.wsHandler.Store(&rpcHandler{
-		Handler: srv.WebsocketHandler(config.Origins),
+		Handler: handler,
 		server:  srv,
 	})
 	return nil
@@ -363,6 +376,18 @@ func isWebsocket(r *http.Request) bool {
 
 // NewHTTPHandlerStack returns wrapped http-related handlers
 func NewHTTPHandlerStack(srv http.Handler, cors []string, vhosts []string) http.Handler {
+	return newHTTPHandlerStack(srv, cors, vhosts, nil, 0)
+}
+
+// newHTTPHandlerStack is like NewHTTPHandlerStack, additionally requiring the
+// requests to be authenticated with a JWT token signed by the secret, if given,
+// and issued within the skew of the local time.
+func newHTTPHandlerStack(srv http.Handler, cors []string, vhosts []string, jwtSecret []byte, jwtSkew time.Duration) http.Handler {
+	// Authenticate the requests within the CORS-handler, so preflight requests
+	// are answered without a token
+	if len(jwtSecret) > 0 {
+		srv = newJWTHandler(jwtSecret, jwtSkew, srv)
+	}
 	// Wrap the CORS-handler within a host-handler
 	handler := newCorsHandler(srv, cors)
 	handler = newVHostHandler(vhosts, handler)
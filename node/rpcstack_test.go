@@ -24,6 +24,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/token/internal/testlog"
 	"github.com/token/log"
@@ -58,6 +59,71 @@ func TestVhosts(t *testing.T) {
 	assert.Equal(t, resp2.StatusCode, http.StatusForbidden)
 }
 
+// TestJWT makes sure requests are authenticated if a JWT secret is configured.
+func TestJWT(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x42}, jwtSecretLength)
+	srv := createAndStartServer(t, &httpConfig{jwtSecret: secret}, true, &wsConfig{Origins: []string{"*"}, jwtSecret: secret})
+	defer srv.stop()
+	httpURL := "http://" + srv.listenAddr()
+	wsURL := "ws://" + srv.listenAddr()
+
+	bearer := func(secret []byte, issued time.Time) string {
+		return "Bearer " + NewJWTToken(secret, issued)
+	}
+	resp := rpcRequest(t, httpURL, "Authorization", bearer(secret, time.Now()))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	for i, auth := range []string{
+		"",
+		"Bearer bad.token",
+		bearer(secret, time.Now().Add(-2*defaultJWTIssuedAtSkew)),
+		bearer(secret, time.Now().Add(2*defaultJWTIssuedAtSkew)),
+		bearer(bytes.Repeat([]byte{0x43}, jwtSecretLength), time.Now()),
+	} {
+		var resp *http.Response
+		if auth == "" {
+			resp = rpcRequest(t, httpURL)
+		} else {
+			resp = rpcRequest(t, httpURL, "Authorization", auth)
+		}
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "test %d", i)
+	}
+	// Check the websocket handshake too
+	headers := make(http.Header)
+	headers.Set("Authorization", bearer(secret, time.Now()))
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, headers)
+	assert.NoError(t, err)
+	if conn != nil {
+		conn.Close()
+	}
+	assert.Error(t, wsRequest(t, wsURL, ""))
+}
+
+// TestJWTIssuedAtSkew makes sure the accepted issuance times of tokens follow the
+// configured skew.
+func TestJWTIssuedAtSkew(t *testing.T) {
+	var (
+		secret = bytes.Repeat([]byte{0x42}, jwtSecretLength)
+		now    = time.Now()
+	)
+	for i, tt := range []struct {
+		skew   time.Duration
+		issued time.Time
+		ok     bool
+	}{
+		{0, now.Add(-defaultJWTIssuedAtSkew / 2), true},
+		{0, now.Add(-2 * defaultJWTIssuedAtSkew), false},
+		{5 * time.Second, now.Add(-10 * time.Second), false},
+		{5 * time.Second, now.Add(10 * time.Second), false},
+		{5 * time.Second, now.Add(3 * time.Second), true},
+		{5 * time.Minute, now.Add(-2 * defaultJWTIssuedAtSkew), true},
+	} {
+		h := newJWTHandler(secret, tt.skew, nil).(*jwtHandler)
+		_, err := verifyJWT(secret, NewJWTToken(secret, tt.issued), now, h.skew)
+		assert.Equal(t, tt.ok, err == nil, "test %d: %v", i, err)
+	}
+}
+
 type originTest struct {
 	spec    string
 	expOk   []string
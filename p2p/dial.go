@@ -130,10 +130,11 @@ type dialScheduler struct {
 type dialSetupFunc func(net.Conn, connFlag, *enode.Node) error
 
 type dialConfig struct {
-	self           enode.ID         // our own ID
-	maxDialPeers   int              // maximum number of dialed peers
-	maxActiveDials int              // maximum number of active dials
-	netRestrict    *netutil.Netlist // IP whitelist, disabled if nil
+	self           enode.ID               // our own ID
+	maxDialPeers   int                    // maximum number of dialed peers
+	maxActiveDials int                    // maximum number of active dials
+	netRestrict    *netutil.Netlist       // IP whitelist, disabled if nil
+	banned         func(*enode.Node) bool // ban check of dynamic dials, disabled if nil
 	resolver       nodeResolver
 	dialer         NodeDialer
 	log            log.Logger
@@ -407,6 +408,11 @@ func (d *dialScheduler) checkDial(n *enode.Node) error {
 	if d.history.contains(string(n.ID().Bytes())) {
 		return errRecentlyDialed
 	}
+	// Static nodes and sentries are configured by the operator, they're exempt
+	// from the bans like trusted peers are after the handshake
+	if _, static := d.static[n.ID()]; !static && d.banned != nil && d.banned(n) {
+		return errBanned
+	}
 	return nil
 }
 
@@ -152,6 +152,30 @@ func TestDialSchedNetRestrict(t *testing.T) {
 	})
 }
 
+// This test checks that banned nodes are only dialed if they're static.
+func TestDialSchedBanned(t *testing.T) {
+	t.Parallel()
+
+	nodes := []*enode.Node{
+		newNode(uintID(0x01), "127.0.0.1:30303"),
+		newNode(uintID(0x02), "127.0.0.2:30303"),
+	}
+	config := dialConfig{
+		banned:         func(*enode.Node) bool { return true },
+		maxActiveDials: 10,
+		maxDialPeers:   10,
+	}
+	runDialTest(t, config, []dialTestRound{
+		{
+			update: func(d *dialScheduler) {
+				d.addStatic(nodes[1])
+			},
+			discovered:   nodes[:1],
+			wantNewDials: nodes[1:],
+		},
+	})
+}
+
 // This test checks that static dials work and obey the limits.
 func TestDialSchedStaticDial(t *testing.T) {
 	t.Parallel()
@@ -53,6 +53,12 @@ const (
 	// Local information is keyed by ID only, the full key is "local:<ID>:seq".
 	// Use localItemKey to create those keys.
 	dbLocalSeq = "seq"
+
+	// Bans are keyed by node ID or IP, the full key is "ban:id:<ID>" or "ban:ip:<IP>".
+	// They live outside the node prefix to survive the expiration of unseen nodes.
+	dbBanPrefix   = "ban:"
+	dbBanIDPrefix = "ban:id:"
+	dbBanIPPrefix = "ban:ip:"
 )
 
 const (
@@ -437,6 +443,91 @@ func (db *DB) storeLocalSeq(id ID, n uint64) {
 	db.storeUint64(localItemKey(id, dbLocalSeq), n)
 }
 
+// Ban is a ban of a node ID or of an IP address stored in the node database.
+type Ban struct {
+	ID     ID        // Banned node ID, zero for IP bans
+	IP     net.IP    // Banned IP address, nil for node ID bans
+	Expiry time.Time // Time after which the ban is lifted
+	Reason string    // Reason of the ban, for display purposes
+}
+
+// banEntry is the database encoding of a ban.
+type banEntry struct {
+	Expiry uint64
+	Reason string
+}
+
+// banKey returns the database key of a ban.
+func banKey(ban Ban) ([]byte, error) {
+	if ban.IP != nil {
+		ip16 := ban.IP.To16()
+		if ip16 == nil {
+			return nil, errInvalidIP
+		}
+		return append([]byte(dbBanIPPrefix), ip16...), nil
+	}
+	return append([]byte(dbBanIDPrefix), ban.ID[:]...), nil
+}
+
+// StoreBan stores a node ID or IP ban, replacing any previous one of the same
+// node ID or IP.
+func (db *DB) StoreBan(ban Ban) error {
+	key, err := banKey(ban)
+	if err != nil {
+		return err
+	}
+	blob, err := rlp.EncodeToBytes(&banEntry{Expiry: uint64(ban.Expiry.Unix()), Reason: ban.Reason})
+	if err != nil {
+		return err
+	}
+	return db.lvl.Put(key, blob, nil)
+}
+
+// DeleteBan deletes the ban of the node ID or IP of the given ban.
+func (db *DB) DeleteBan(ban Ban) error {
+	key, err := banKey(ban)
+	if err != nil {
+		return err
+	}
+	return db.lvl.Delete(key, nil)
+}
+
+// Bans retrieves all bans which did not expire yet, deleting the expired ones.
+func (db *DB) Bans() []Ban {
+	var (
+		now  = time.Now()
+		bans []Ban
+		it   = db.lvl.NewIterator(util.BytesPrefix([]byte(dbBanPrefix)), nil)
+	)
+	defer it.Release()
+
+	for it.Next() {
+		var entry banEntry
+		if err := rlp.DecodeBytes(it.Value(), &entry); err != nil {
+			db.lvl.Delete(it.Key(), nil)
+			continue
+		}
+		ban := Ban{Expiry: time.Unix(int64(entry.Expiry), 0), Reason: entry.Reason}
+		if !ban.Expiry.After(now) {
+			db.lvl.Delete(it.Key(), nil)
+			continue
+		}
+		switch key := it.Key(); {
+		case bytes.HasPrefix(key, []byte(dbBanIDPrefix)) && len(key) == len(dbBanIDPrefix)+len(ID{}):
+			copy(ban.ID[:], key[len(dbBanIDPrefix):])
+		case bytes.HasPrefix(key, []byte(dbBanIPPrefix)) && len(key) == len(dbBanIPPrefix)+net.IPv6len:
+			ban.IP = append(net.IP{}, key[len(dbBanIPPrefix):]...)
+			if ip4 := ban.IP.To4(); ip4 != nil {
+				ban.IP = ip4
+			}
+		default:
+			continue
+		}
+		bans = append(bans, ban)
+	}
+	return bans
+}
+
 // QuerySeeds retrieves random nodes to be used as potential seed nodes
 // for bootstrapping.
 func (db *DB) QuerySeeds(n int, maxAge time.Duration) []*Node {
@@ -473,3 +473,39 @@ func TestDBExpireV5(t *testing.T) {
 	db.UpdateFindFailsV5(ID{}, ip, 4)
 	db.expireNodes()
 }
+
+// This test checks that bans are stored, listed until their expiry and survive
+// the expiration of unseen nodes.
+func TestDBBans(t *testing.T) {
+	db, _ := OpenDB("")
+	defer db.Close()
+
+	var (
+		idBan      = Ban{ID: keytestID, Expiry: time.Now().Add(time.Hour), Reason: "bad block"}
+		ipBan      = Ban{IP: net.IP{127, 0, 0, 1}, Expiry: time.Now().Add(time.Hour), Reason: "bad block"}
+		expiredBan = Ban{IP: net.IP{127, 0, 0, 2}, Expiry: time.Now().Add(-time.Second)}
+	)
+	for _, ban := range []Ban{idBan, ipBan, expiredBan} {
+		if err := db.StoreBan(ban); err != nil {
+			t.Fatalf("failed to store ban: %v", err)
+		}
+	}
+	db.expireNodes()
+
+	bans := db.Bans()
+	if len(bans) != 2 {
+		t.Fatalf("ban count mismatch: have %d, want 2", len(bans))
+	}
+	if bans[0].ID != idBan.ID || bans[0].IP != nil || bans[0].Reason != idBan.Reason {
+		t.Errorf("node ID ban mismatch: have %+v, want %+v", bans[0], idBan)
+	}
+	if !bans[1].IP.Equal(ipBan.IP) || bans[1].ID != (ID{}) || bans[1].Expiry.Unix() != ipBan.Expiry.Unix() {
+		t.Errorf("IP ban mismatch: have %+v, want %+v", bans[1], ipBan)
+	}
+	if err := db.DeleteBan(Ban{ID: keytestID}); err != nil {
+		t.Fatalf("failed to delete ban: %v", err)
+	}
+	if bans := db.Bans(); len(bans) != 1 || bans[0].IP == nil {
+		t.Fatalf("bans mismatch after deletion: %+v", bans)
+	}
+}
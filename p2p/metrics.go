@@ -41,6 +41,11 @@ var (
 	egressConnectMeter  = metrics.NewRegisteredMeter("p2p/dials", nil)
 	egressTrafficMeter  = metrics.NewRegisteredMeter(egressMeterName, nil)
 	activePeerGauge     = metrics.NewRegisteredGauge("p2p/peers", nil)
+
+	penaltyMeter     = metrics.NewRegisteredMeter("p2p/penalties", nil)
+	banMeter         = metrics.NewRegisteredMeter("p2p/bans", nil)
+	activeBanGauge   = metrics.NewRegisteredGauge("p2p/bans/active", nil)
+	rejectedBanMeter = metrics.NewRegisteredMeter("p2p/bans/rejected", nil)
 )
 
 // meteredConn is a wrapper around a net.Conn that meters both the
@@ -31,6 +31,7 @@ import (
 	"github.com/token/metrics"
 	"github.com/token/p2p/enode"
 	"github.com/token/p2p/enr"
+	"github.com/token/p2p/netutil"
 	"github.com/token/rlp"
 )
 
@@ -117,6 +118,9 @@ type Peer struct {
 	// events receives message send / receive events if set
 	events   *event.Feed
 	testPipe *MsgPipeRW // for testing
+
+	// reputation receives the penalties reported for the peer if set
+	reputation *reputation
 }
 
 // NewPeer returns a peer for testing purposes.
@@ -205,6 +209,18 @@ func (p *Peer) Disconnect(reason DiscReason) {
 	}
 }
 
+// Report penalizes the peer for misbehaving. Once the penalties reported for the
+// peer reach the ban threshold, its node ID and IP are banned and the peer is
+// disconnected. Trusted peers are never banned.
+func (p *Peer) Report(penalty int, reason string) {
+	if p.reputation == nil || p.rw.is(trustedConn) {
+		return
+	}
+	if p.reputation.report(p.ID(), netutil.AddrIP(p.RemoteAddr()), penalty, reason) {
+		p.Disconnect(DiscUselessPeer)
+	}
+}
+
 // String implements fmt.Stringer.
 func (p *Peer) String() string {
 	id := p.ID()
@@ -216,6 +232,18 @@ func (p *Peer) Inbound() bool {
 	return p.rw.is(inboundConn)
 }
 
+// Sentry returns true if the peer is one of the sentries shielding the local
+// validator.
+func (p *Peer) Sentry() bool {
+	return p.rw.is(sentryConn)
+}
+
+// Validator returns true if the peer is a validator the local node is a sentry
+// for.
+func (p *Peer) Validator() bool {
+	return p.rw.is(validatorConn)
+}
+
 func newPeer(log log.Logger, conn *conn, protocols []Protocol) *Peer {
 	protomap := matchProtocols(protocols, conn.caps, conn)
 	p := &Peer{
@@ -485,6 +513,8 @@ type PeerInfo struct {
 		Inbound       bool   `json:"inbound"`
 		Trusted       bool   `json:"trusted"`
 		Static        bool   `json:"static"`
+		Sentry        bool   `json:"sentry,omitempty"`
+		Validator     bool   `json:"validator,omitempty"`
 	} `json:"network"`
 	Protocols map[string]interface{} `json:"protocols"` // Sub-protocol specific metadata fields
 }
@@ -512,6 +542,8 @@ func (p *Peer) Info() *PeerInfo {
 	info.Network.Inbound = p.rw.is(inboundConn)
 	info.Network.Trusted = p.rw.is(trustedConn)
 	info.Network.Static = p.rw.is(staticDialedConn)
+	info.Network.Sentry = p.rw.is(sentryConn)
+	info.Network.Validator = p.rw.is(validatorConn)
 
 	// Gather all the running protocol infos
 	for _, proto := range p.running {
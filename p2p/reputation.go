@@ -0,0 +1,261 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/token/common/mclock"
+	"github.com/token/log"
+	"github.com/token/p2p/enode"
+	"github.com/token/p2p/netutil"
+)
+
+// Penalties reported by protocol handlers for misbehaving peers. Peers are banned
+// once their decaying sum of penalties reaches PenaltyFatal.
+const (
+	// PenaltyMinor is reported for misbehaviour honest peers may occasionally
+	// exhibit too, e.g. relaying invalid transactions.
+	PenaltyMinor = 5
+
+	// PenaltyMajor is reported for misbehaviour which is most likely deliberate,
+	// e.g. undecodable messages or chain segments failing validation.
+	PenaltyMajor = 50
+
+	// PenaltyFatal is reported for misbehaviour which warrants an immediate ban,
+	// e.g. propagating blocks with invalid seals.
+	PenaltyFatal = 100
+)
+
+const (
+	// penaltyHalfLife is the time after which a penalty is decayed to half.
+	penaltyHalfLife = 10 * time.Minute
+
+	// defaultBanDuration is the time misbehaving peers are banned for if the
+	// server configuration does not specify it.
+	defaultBanDuration = time.Hour
+
+	// maxTrackedScores is the number of peer scores after which the fully decayed
+	// ones are dropped.
+	maxTrackedScores = 1024
+)
+
+var errBanned = errors.New("banned")
+
+// peerScore is the decaying sum of penalties reported for a node.
+type peerScore struct {
+	value   float64
+	updated mclock.AbsTime
+}
+
+// decay returns the value of the score at the given time.
+func (s *peerScore) decay(now mclock.AbsTime) float64 {
+	elapsed := time.Duration(now - s.updated)
+	return s.value * math.Exp2(-float64(elapsed)/float64(penaltyHalfLife))
+}
+
+// reputation tracks the penalties of misbehaving peers and bans their node ID and
+// IP once their score reaches the threshold. Bans are persisted in the node
+// database to survive restarts.
+type reputation struct {
+	db       *enode.DB
+	clock    mclock.Clock
+	duration time.Duration
+	log      log.Logger
+
+	scores map[enode.ID]*peerScore
+	ids    map[enode.ID]enode.Ban
+	ips    map[string]enode.Ban
+	lock   sync.Mutex
+}
+
+// newReputation creates a reputation tracker, loading the bans stored in the
+// node database.
+func newReputation(db *enode.DB, clock mclock.Clock, duration time.Duration, log log.Logger) *reputation {
+	if duration == 0 {
+		duration = defaultBanDuration
+	}
+	r := &reputation{
+		db:       db,
+		clock:    clock,
+		duration: duration,
+		log:      log,
+		scores:   make(map[enode.ID]*peerScore),
+		ids:      make(map[enode.ID]enode.Ban),
+		ips:      make(map[string]enode.Ban),
+	}
+	for _, ban := range db.Bans() {
+		if ban.IP != nil {
+			r.ips[ban.IP.String()] = ban
+		} else {
+			r.ids[ban.ID] = ban
+		}
+	}
+	activeBanGauge.Update(int64(len(r.ids) + len(r.ips)))
+	return r
+}
+
+// report adds a penalty to the score of a node, banning its node ID and IP if
+// the score reaches the ban threshold. It returns whether the node got banned.
+func (r *reputation) report(id enode.ID, ip net.IP, penalty int, reason string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	penaltyMeter.Mark(int64(penalty))
+
+	now := r.clock.Now()
+	score, ok := r.scores[id]
+	if !ok {
+		if len(r.scores) >= maxTrackedScores {
+			r.pruneScores(now)
+		}
+		score = new(peerScore)
+		r.scores[id] = score
+	}
+	score.value = score.decay(now) + float64(penalty)
+	score.updated = now
+
+	if score.value < PenaltyFatal {
+		r.log.Debug("Penalized misbehaving peer", "id", id, "penalty", penalty, "score", int(score.value), "reason", reason)
+		return false
+	}
+	delete(r.scores, id)
+
+	expiry := time.Now().Add(r.duration)
+	r.ban(enode.Ban{ID: id, Expiry: expiry, Reason: reason})
+
+	// Ban the IP too unless in a LAN, where it may be shared by honest nodes
+	if ip != nil && !netutil.IsLAN(ip) {
+		r.ban(enode.Ban{IP: ip, Expiry: expiry, Reason: reason})
+	}
+	r.log.Info("Banned misbehaving peer", "id", id, "ip", ip, "until", expiry, "reason", reason)
+	return true
+}
+
+// pruneScores drops the scores which decayed below the smallest penalty. The
+// caller must hold the lock.
+func (r *reputation) pruneScores(now mclock.AbsTime) {
+	for id, score := range r.scores {
+		if score.decay(now) < 1 {
+			delete(r.scores, id)
+		}
+	}
+}
+
+// ban adds a node ID or IP ban and persists it. The caller must hold the lock.
+func (r *reputation) ban(ban enode.Ban) {
+	if ban.IP != nil {
+		r.ips[ban.IP.String()] = ban
+	} else {
+		r.ids[ban.ID] = ban
+	}
+	if err := r.db.StoreBan(ban); err != nil {
+		r.log.Warn("Failed to persist ban", "id", ban.ID, "ip", ban.IP, "err", err)
+	}
+	banMeter.Mark(1)
+	activeBanGauge.Update(int64(len(r.ids) + len(r.ips)))
+}
+
+// add bans a node ID or IP explicitly.
+func (r *reputation) add(ban enode.Ban) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if ban.IP == nil {
+		delete(r.scores, ban.ID)
+	}
+	r.ban(ban)
+}
+
+// remove lifts the ban of a node ID or IP, also resetting the node score.
+func (r *reputation) remove(ban enode.Ban) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if ban.IP != nil {
+		delete(r.ips, ban.IP.String())
+	} else {
+		delete(r.ids, ban.ID)
+		delete(r.scores, ban.ID)
+	}
+	if err := r.db.DeleteBan(ban); err != nil {
+		r.log.Warn("Failed to delete ban", "id", ban.ID, "ip", ban.IP, "err", err)
+	}
+	activeBanGauge.Update(int64(len(r.ids) + len(r.ips)))
+}
+
+// bannedID returns whether a node ID is banned.
+func (r *reputation) bannedID(id enode.ID) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	ban, ok := r.ids[id]
+	if ok && !ban.Expiry.After(time.Now()) {
+		delete(r.ids, id)
+		activeBanGauge.Update(int64(len(r.ids) + len(r.ips)))
+		return false
+	}
+	return ok
+}
+
+// bannedIP returns whether an IP is banned.
+func (r *reputation) bannedIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	ban, ok := r.ips[ip.String()]
+	if ok && !ban.Expiry.After(time.Now()) {
+		delete(r.ips, ip.String())
+		activeBanGauge.Update(int64(len(r.ids) + len(r.ips)))
+		return false
+	}
+	return ok
+}
+
+// banned returns whether the node ID or IP of a node is banned.
+func (r *reputation) banned(n *enode.Node) bool {
+	return r.bannedID(n.ID()) || r.bannedIP(n.IP())
+}
+
+// bans returns the node ID and IP bans in force.
+func (r *reputation) bans() []enode.Ban {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var (
+		now  = time.Now()
+		bans = make([]enode.Ban, 0, len(r.ids)+len(r.ips))
+	)
+	for _, ban := range r.ids {
+		if ban.Expiry.After(now) {
+			bans = append(bans, ban)
+		}
+	}
+	for _, ban := range r.ips {
+		if ban.Expiry.After(now) {
+			bans = append(bans, ban)
+		}
+	}
+	return bans
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/token/common/mclock"
+	"github.com/token/log"
+	"github.com/token/p2p/enode"
+)
+
+// Tests that penalties decay over time and that peers reaching the threshold
+// get their node ID and public IP banned.
+func TestReputationBan(t *testing.T) {
+	db, _ := enode.OpenDB("")
+	defer db.Close()
+
+	var (
+		clock = new(mclock.Simulated)
+		rep   = newReputation(db, clock, time.Hour, log.Root())
+		id    = enode.ID{1}
+		ip    = net.IP{8, 8, 8, 8}
+	)
+	if rep.report(id, ip, PenaltyMajor, "test") {
+		t.Fatal("banned after a single major penalty")
+	}
+	// Let the first penalty decay to a quarter, the next one must not ban
+	clock.Run(2 * penaltyHalfLife)
+	if rep.report(id, ip, PenaltyMajor, "test") {
+		t.Fatal("banned despite decayed penalty")
+	}
+	if !rep.report(id, ip, PenaltyMajor, "test") {
+		t.Fatal("not banned after reaching the threshold")
+	}
+	if !rep.bannedID(id) || !rep.bannedIP(ip) {
+		t.Fatal("node ID or IP not banned")
+	}
+	if rep.bannedID(enode.ID{2}) || rep.bannedIP(net.IP{8, 8, 4, 4}) {
+		t.Fatal("unrelated node ID or IP banned")
+	}
+	// LAN IPs are shared by honest peers and must not be banned
+	lan := net.IP{192, 168, 0, 1}
+	if !rep.report(enode.ID{3}, lan, PenaltyFatal, "test") {
+		t.Fatal("not banned after fatal penalty")
+	}
+	if rep.bannedIP(lan) {
+		t.Fatal("LAN IP banned")
+	}
+	if have := len(rep.bans()); have != 3 {
+		t.Fatalf("ban count mismatch: have %d, want 3", have)
+	}
+	// Lift the bans and ensure the score is reset
+	rep.remove(enode.Ban{ID: id})
+	rep.remove(enode.Ban{IP: ip})
+	if rep.bannedID(id) || rep.bannedIP(ip) {
+		t.Fatal("node ID or IP still banned")
+	}
+	if rep.report(id, ip, PenaltyMajor, "test") {
+		t.Fatal("score not reset by unban")
+	}
+}
+
+// Tests that bans survive restarts through the node database and expire.
+func TestReputationPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reputation-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nodes")
+	db, err := enode.OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := newReputation(db, new(mclock.Simulated), time.Hour, log.Root())
+	rep.add(enode.Ban{ID: enode.ID{1}, Expiry: time.Now().Add(time.Hour), Reason: "test"})
+	rep.add(enode.Ban{IP: net.IP{8, 8, 8, 8}, Expiry: time.Now().Add(time.Hour), Reason: "test"})
+	rep.add(enode.Ban{ID: enode.ID{2}, Expiry: time.Now().Add(-time.Second), Reason: "test"})
+	db.Close()
+
+	if db, err = enode.OpenDB(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rep = newReputation(db, new(mclock.Simulated), time.Hour, log.Root())
+	if !rep.bannedID(enode.ID{1}) || !rep.bannedIP(net.IP{8, 8, 8, 8}) {
+		t.Fatal("bans not restored")
+	}
+	if rep.bannedID(enode.ID{2}) {
+		t.Fatal("expired ban restored")
+	}
+	if have := len(rep.bans()); have != 2 {
+		t.Fatalf("ban count mismatch: have %d, want 2", have)
+	}
+}
@@ -64,7 +64,10 @@ const (
 	frameWriteTimeout = 20 * time.Second
 )
 
-var errServerStopped = errors.New("server stopped")
+var (
+	errServerStopped = errors.New("server stopped")
+	errNotSentry     = errors.New("not a sentry node")
+)
 
 // Config holds Server options.
 type Config struct {
@@ -114,6 +117,15 @@ type Config struct {
 	// allowed to connect, even above the peer limit.
 	TrustedNodes []*enode.Node
 
+	// SentryNodes shields a validator behind the given sentry nodes. If set, the
+	// server only dials and accepts the sentries, and it must neither run
+	// discovery nor map its ports, so it is never advertised to the network.
+	SentryNodes []*enode.Node `toml:",omitempty"`
+
+	// ValidatorNodes are the validators this server is a sentry for. They are
+	// always allowed to connect, and protocols relay to them with priority.
+	ValidatorNodes []*enode.Node `toml:",omitempty"`
+
 	// Connectivity can be restricted to certain IP networks.
 	// If this option is set to a non-nil value, only hosts which match one of the
 	// IP networks contained in the list are considered.
@@ -148,6 +160,10 @@ type Config struct {
 	// If NoDial is true, the server will not dial any peers.
 	NoDial bool `toml:",omitempty"`
 
+	// BanDuration is the time misbehaving peers are banned for once their
+	// reported penalties reach the ban threshold. Zero defaults to one hour.
+	BanDuration time.Duration `toml:",omitempty"`
+
 	// If EnableMsgEvents is set then the server will emit PeerEvents
 	// whenever a message is sent to or received from a peer
 	EnableMsgEvents bool
@@ -178,12 +194,13 @@ type Server struct {
 	peerFeed     event.Feed
 	log          log.Logger
 
-	nodedb    *enode.DB
-	localnode *enode.LocalNode
-	ntab      *discover.UDPv4
-	DiscV5    *discover.UDPv5
-	discmix   *enode.FairMix
-	dialsched *dialScheduler
+	nodedb     *enode.DB
+	localnode  *enode.LocalNode
+	reputation *reputation
+	ntab       *discover.UDPv4
+	DiscV5     *discover.UDPv5
+	discmix    *enode.FairMix
+	dialsched  *dialScheduler
 
 	// Channels into the run loop.
 	quit                    chan struct{}
@@ -214,6 +231,8 @@ const (
 	staticDialedConn
 	inboundConn
 	trustedConn
+	sentryConn
+	validatorConn
 )
 
 // conn wraps a network connection with information gathered
@@ -256,6 +275,12 @@ func (f connFlag) String() string {
 	if f&trustedConn != 0 {
 		s += "-trusted"
 	}
+	if f&sentryConn != 0 {
+		s += "-sentry"
+	}
+	if f&validatorConn != 0 {
+		s += "-validator"
+	}
 	if f&dynDialedConn != 0 {
 		s += "-dyndial"
 	}
@@ -370,6 +395,97 @@ func (srv *Server) RemoveTrustedPeer(node *enode.Node) {
 	}
 }
 
+// BanPeer bans the node ID and IP of the given node for the given duration,
+// disconnecting it if it is connected. A zero duration defaults to the
+// configured ban duration.
+func (srv *Server) BanPeer(node *enode.Node, duration time.Duration, reason string) error {
+	rep := srv.currentReputation()
+	if rep == nil {
+		return errServerStopped
+	}
+	if duration == 0 {
+		duration = rep.duration
+	}
+	expiry := time.Now().Add(duration)
+	rep.add(enode.Ban{ID: node.ID(), Expiry: expiry, Reason: reason})
+	if node.IP() != nil {
+		rep.add(enode.Ban{IP: node.IP(), Expiry: expiry, Reason: reason})
+	}
+	srv.doPeerOp(func(peers map[enode.ID]*Peer) {
+		for _, p := range peers {
+			if p.ID() == node.ID() || (node.IP() != nil && node.IP().Equal(netutil.AddrIP(p.RemoteAddr()))) {
+				p.Disconnect(DiscUselessPeer)
+			}
+		}
+	})
+	return nil
+}
+
+// BanIP bans the given IP for the given duration, disconnecting the peers
+// connected from it. A zero duration defaults to the configured ban duration.
+func (srv *Server) BanIP(ip net.IP, duration time.Duration, reason string) error {
+	rep := srv.currentReputation()
+	if rep == nil {
+		return errServerStopped
+	}
+	if duration == 0 {
+		duration = rep.duration
+	}
+	rep.add(enode.Ban{IP: ip, Expiry: time.Now().Add(duration), Reason: reason})
+	srv.doPeerOp(func(peers map[enode.ID]*Peer) {
+		for _, p := range peers {
+			if ip.Equal(netutil.AddrIP(p.RemoteAddr())) {
+				p.Disconnect(DiscUselessPeer)
+			}
+		}
+	})
+	return nil
+}
+
+// UnbanPeer lifts the bans of the node ID and IP of the given node.
+func (srv *Server) UnbanPeer(node *enode.Node) error {
+	rep := srv.currentReputation()
+	if rep == nil {
+		return errServerStopped
+	}
+	rep.remove(enode.Ban{ID: node.ID()})
+	if node.IP() != nil {
+		rep.remove(enode.Ban{IP: node.IP()})
+	}
+	return nil
+}
+
+// UnbanIP lifts the ban of the given IP.
+func (srv *Server) UnbanIP(ip net.IP) error {
+	rep := srv.currentReputation()
+	if rep == nil {
+		return errServerStopped
+	}
+	rep.remove(enode.Ban{IP: ip})
+	return nil
+}
+
+// Bans returns the node ID and IP bans in force.
+func (srv *Server) Bans() []enode.Ban {
+	rep := srv.currentReputation()
+	if rep == nil {
+		return nil
+	}
+	return rep.bans()
+}
+
+// currentReputation returns the reputation tracker of the server, or nil if the
+// server is not running.
+func (srv *Server) currentReputation() *reputation {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if !srv.running {
+		return nil
+	}
+	return srv.reputation
+}
+
 // SubscribePeers subscribes the given channel to peer events
 func (srv *Server) SubscribeEvents(ch chan *PeerEvent) event.Subscription {
 	return srv.peerFeed.Subscribe(ch)
@@ -450,6 +566,9 @@ func (srv *Server) Start() (err error) {
 	if srv.NoDial && srv.ListenAddr == "" {
 		srv.log.Warn("P2P server will be useless, neither dialing nor listening")
 	}
+	if err := srv.checkTopology(); err != nil {
+		return err
+	}
 
 	// static fields
 	if srv.PrivateKey == nil {
@@ -488,6 +607,29 @@ func (srv *Server) Start() (err error) {
 	return nil
 }
 
+// checkTopology validates the sentry and validator configuration.
+func (srv *Server) checkTopology() error {
+	if len(srv.SentryNodes) == 0 {
+		return nil
+	}
+	switch {
+	case len(srv.ValidatorNodes) > 0:
+		return errors.New("sentry nodes and validator nodes are mutually exclusive")
+	case !srv.NoDiscovery || srv.DiscoveryV5:
+		return errors.New("discovery must be disabled on a validator behind sentry nodes")
+	case srv.NAT != nil:
+		return errors.New("NAT port mapping must be disabled on a validator behind sentry nodes")
+	case srv.NoDial:
+		return errors.New("dialing must be enabled on a validator behind sentry nodes")
+	}
+	for _, n := range srv.SentryNodes {
+		if n.IP() == nil || n.TCP() == 0 {
+			return fmt.Errorf("sentry node %v has no TCP endpoint", n.ID())
+		}
+	}
+	return nil
+}
+
 func (srv *Server) setupLocalNode() error {
 	// Create the devp2p handshake.
 	pubkey := crypto.FromECDSAPub(&srv.PrivateKey.PublicKey)
@@ -503,6 +645,7 @@ func (srv *Server) setupLocalNode() error {
 		return err
 	}
 	srv.nodedb = db
+	srv.reputation = newReputation(db, srv.clock, srv.BanDuration, srv.log)
 	srv.localnode = enode.NewLocalNode(db, srv.PrivateKey)
 	srv.localnode.SetFallbackIP(net.IP{127, 0, 0, 1})
 	// TODO: check conflicts
@@ -535,9 +678,12 @@ func (srv *Server) setupLocalNode() error {
 func (srv *Server) setupDiscovery() error {
 	srv.discmix = enode.NewFairMix(discmixTimeout)
 
-	// Add protocol-specific discovery sources.
+	// Add protocol-specific discovery sources, unless shielded by sentries.
 	added := make(map[string]bool)
 	for _, proto := range srv.Protocols {
+		if len(srv.SentryNodes) > 0 {
+			break
+		}
 		if proto.DialCandidates != nil && !added[proto.Name] {
 			srv.discmix.AddSource(proto.DialCandidates)
 			added[proto.Name] = true
@@ -621,6 +767,7 @@ func (srv *Server) setupDialScheduler() {
 		maxActiveDials: srv.MaxPendingPeers,
 		log:            srv.Logger,
 		netRestrict:    srv.NetRestrict,
+		banned:         srv.reputation.banned,
 		dialer:         srv.Dialer,
 		clock:          srv.clock,
 	}
@@ -634,6 +781,9 @@ func (srv *Server) setupDialScheduler() {
 	for _, n := range srv.StaticNodes {
 		srv.dialsched.addStatic(n)
 	}
+	for _, n := range srv.SentryNodes {
+		srv.dialsched.addStatic(n)
+	}
 }
 
 func (srv *Server) maxInboundConns() int {
@@ -702,12 +852,20 @@ func (srv *Server) run() {
 		peers        = make(map[enode.ID]*Peer)
 		inboundCount = 0
 		trusted      = make(map[enode.ID]bool, len(srv.TrustedNodes))
+		topology     = make(map[enode.ID]connFlag, len(srv.SentryNodes)+len(srv.ValidatorNodes))
 	)
 	// Put trusted nodes into a map to speed up checks.
 	// Trusted peers are loaded on startup or added via AddTrustedPeer RPC.
 	for _, n := range srv.TrustedNodes {
 		trusted[n.ID()] = true
 	}
+	// Sentries and validators are always allowed to connect too.
+	for _, n := range srv.SentryNodes {
+		topology[n.ID()] = sentryConn | trustedConn
+	}
+	for _, n := range srv.ValidatorNodes {
+		topology[n.ID()] = validatorConn | trustedConn
+	}
 
 running:
 	for {
@@ -746,6 +904,7 @@ running:
 				// Ensure that the trusted flag is set before checking against MaxPeers.
 				c.flags |= trustedConn
 			}
+			c.flags |= topology[c.node.ID()]
 			// TODO: track in-progress inbound node IDs (pre-Peer) to avoid dialing them.
 			c.cont <- srv.postHandshakeChecks(peers, inboundCount, c)
 
@@ -802,6 +961,8 @@ running:
 
 func (srv *Server) postHandshakeChecks(peers map[enode.ID]*Peer, inboundCount int, c *conn) error {
 	switch {
+	case len(srv.SentryNodes) > 0 && !c.is(sentryConn):
+		return errNotSentry
 	case !c.is(trustedConn) && len(peers) >= srv.MaxPeers:
 		return DiscTooManyPeers
 	case !c.is(trustedConn) && c.is(inboundConn) && inboundCount >= srv.maxInboundConns():
@@ -810,6 +971,9 @@ func (srv *Server) postHandshakeChecks(peers map[enode.ID]*Peer, inboundCount in
 		return DiscAlreadyConnected
 	case c.node.ID() == srv.localnode.ID():
 		return DiscSelf
+	case !c.is(trustedConn|staticDialedConn) && srv.reputation.banned(c.node):
+		rejectedBanMeter.Mark(1)
+		return errBanned
 	default:
 		return nil
 	}
@@ -905,6 +1069,8 @@ func (srv *Server) checkInboundConn(remoteIP net.IP) error {
 	if srv.NetRestrict != nil && !srv.NetRestrict.Contains(remoteIP) {
 		return fmt.Errorf("not whitelisted in NetRestrict")
 	}
+	// Banned peers are rejected after the handshake, once it is known whether
+	// they are trusted nodes, sentries or static dials, which are never banned.
 	// Reject Internet peers that try too often.
 	now := srv.clock.Now()
 	srv.inboundHistory.expire(now, nil)
@@ -1019,6 +1185,7 @@ func (srv *Server) launchPeer(c *conn) *Peer {
 		// to the peer.
 		p.events = &srv.peerFeed
 	}
+	p.reputation = srv.reputation
 	go srv.runPeer(p)
 	return p
 }
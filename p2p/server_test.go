@@ -17,6 +17,7 @@
 package p2p
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"errors"
@@ -32,6 +33,7 @@ import (
 	"github.com/token/log"
 	"github.com/token/p2p/enode"
 	"github.com/token/p2p/enr"
+	"github.com/token/p2p/nat"
 	"github.com/token/p2p/rlpx"
 )
 
@@ -365,6 +367,114 @@ func TestServerPeerLimits(t *testing.T) {
 	conn.Close()
 }
 
+// failDialer is a NodeDialer failing all dials.
+type failDialer struct{}
+
+func (failDialer) Dial(ctx context.Context, n *enode.Node) (net.Conn, error) {
+	return nil, errors.New("dial failed")
+}
+
+// Tests that a validator behind sentries only accepts the sentries, and that
+// conflicting configurations are rejected at startup.
+func TestServerSentryMode(t *testing.T) {
+	var (
+		sentryKey = newkey()
+		sentryID  = enode.PubkeyToIDV4(&sentryKey.PublicKey)
+		sentry    = newNode(sentryID, "127.0.0.1:30303")
+	)
+	config := Config{
+		PrivateKey:  newkey(),
+		MaxPeers:    10,
+		NoDiscovery: true,
+		SentryNodes: []*enode.Node{sentry},
+		Dialer:      failDialer{},
+		Logger:      testlog.Logger(t, log.LvlTrace),
+	}
+	// Check the configuration validation first
+	invalid := []func(*Config){
+		func(c *Config) { c.NoDiscovery = false },
+		func(c *Config) { c.DiscoveryV5 = true },
+		func(c *Config) { c.NAT = nat.ExtIP(net.IP{1, 2, 3, 4}) },
+		func(c *Config) { c.NoDial = true },
+		func(c *Config) { c.ValidatorNodes = []*enode.Node{newNode(randomID(), "")} },
+		func(c *Config) { c.SentryNodes = []*enode.Node{newNode(sentryID, "")} },
+	}
+	for i, mod := range invalid {
+		cfg := config
+		mod(&cfg)
+		srv := &Server{Config: cfg}
+		if err := srv.Start(); err == nil {
+			srv.Stop()
+			t.Errorf("invalid config %d: server started", i)
+		}
+	}
+	srv := &Server{Config: config}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	newconn := func(id enode.ID) *conn {
+		fd, _ := net.Pipe()
+		tx := newTestTransport(&sentryKey.PublicKey, fd, nil)
+		node := enode.SignNull(new(enr.Record), id)
+		return &conn{fd: fd, transport: tx, flags: inboundConn, node: node, cont: make(chan error)}
+	}
+	if err := srv.checkpoint(newconn(randomID()), srv.checkpointPostHandshake); err != errNotSentry {
+		t.Errorf("wrong error for non-sentry conn: %v", err)
+	}
+	c := newconn(sentryID)
+	if err := srv.checkpoint(c, srv.checkpointPostHandshake); err != nil {
+		t.Errorf("unexpected error for sentry conn: %v", err)
+	}
+	if !c.is(sentryConn) || !c.is(trustedConn) {
+		t.Errorf("sentry flags not set: %v", c.flags)
+	}
+}
+
+// Tests that banned IPs are only rejected after the handshake, so that trusted
+// nodes sharing them can still connect.
+func TestServerInboundBan(t *testing.T) {
+	var (
+		trustedKey = newkey()
+		trustedID  = enode.PubkeyToIDV4(&trustedKey.PublicKey)
+		bannedIP   = net.IP{95, 33, 21, 2}
+	)
+	srv := &Server{
+		Config: Config{
+			PrivateKey:   newkey(),
+			MaxPeers:     10,
+			NoDial:       true,
+			NoDiscovery:  true,
+			TrustedNodes: []*enode.Node{newNode(trustedID, "")},
+			Logger:       testlog.Logger(t, log.LvlTrace),
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	srv.reputation.add(enode.Ban{IP: bannedIP, Expiry: time.Now().Add(time.Hour), Reason: "test"})
+	if err := srv.checkInboundConn(bannedIP); err != nil {
+		t.Fatalf("banned IP rejected before handshake: %v", err)
+	}
+	newconn := func(id enode.ID) *conn {
+		fd, _ := net.Pipe()
+		tx := newTestTransport(&trustedKey.PublicKey, fd, nil)
+		var r enr.Record
+		r.Set(enr.IPv4(bannedIP))
+		node := enode.SignNull(&r, id)
+		return &conn{fd: fd, transport: tx, flags: inboundConn, node: node, cont: make(chan error)}
+	}
+	if err := srv.checkpoint(newconn(randomID()), srv.checkpointPostHandshake); err != errBanned {
+		t.Errorf("wrong error for banned conn: %v", err)
+	}
+	if err := srv.checkpoint(newconn(trustedID), srv.checkpointPostHandshake); err != nil {
+		t.Errorf("unexpected error for trusted conn from banned IP: %v", err)
+	}
+}
+
 func TestServerSetupConn(t *testing.T) {
 	var (
 		clientkey, srvkey = newkey(), newkey()
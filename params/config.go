@@ -333,6 +333,36 @@ type AlienConfig struct {
 	TrantorBlock  *big.Int          `json:"trantorBlock,omitempty"`  // Trantor switch block (nil = no fork)
 	TerminusBlock *big.Int          `json:"terminusBlock,omitempty"` // Terminus switch block (nil = no fork)
 	LightConfig   *AlienLightConfig `json:"lightConfig,omitempty"`
+
+	SystemConfig *AlienSystemConfig `json:"systemConfig,omitempty"` // Genesis system parameters (nil = engine defaults)
+}
+
+// AlienLockConfig is the genesis lock schedule of pledges or rewards, in seconds.
+type AlienLockConfig struct {
+	LockPeriod    uint64 `json:"lockPeriod"`    // Seconds before the release starts
+	ReleasePeriod uint64 `json:"releasePeriod"` // Seconds over which the lock is released
+	Interval      uint64 `json:"interval"`      // Seconds between two releases
+}
+
+// AlienSystemConfig is the initial value of the alien system parameters, which
+// are otherwise changed through SSC custom transactions. Any field left empty
+// falls back to the built-in default of the consensus engine.
+type AlienSystemConfig struct {
+	Manager          *common.Address `json:"manager,omitempty"`          // Account allowed to change the manager addresses below
+	ExchRateManager  *common.Address `json:"exchRateManager,omitempty"`  // Account allowed to change the exchange rate
+	SystemManager    *common.Address `json:"systemManager,omitempty"`    // Account allowed to change deposits and lock parameters
+	BandwidthManager *common.Address `json:"bandwidthManager,omitempty"` // Account allowed to punish PoF bandwidth
+	PofReportManager *common.Address `json:"pofReportManager,omitempty"` // Account allowed to report PoF flow
+
+	ExchRate         uint32   `json:"exchRate,omitempty"`         // Token to coin exchange ratio
+	CandidateDeposit *big.Int `json:"candidateDeposit,omitempty"` // Pledge required to become a candidate
+
+	CandidateLock *AlienLockConfig `json:"candidateLock,omitempty"` // Lock schedule of candidate pledges
+	PofLock       *AlienLockConfig `json:"pofLock,omitempty"`       // Lock schedule of PoF pledges
+	RewardLock    *AlienLockConfig `json:"rewardLock,omitempty"`    // Lock schedule of rewards
+
+	PofBasePrice    *big.Int `json:"pofBasePrice,omitempty"`    // PoF bandwidth base price
+	PosCommitPeriod *big.Int `json:"posCommitPeriod,omitempty"` // Days a candidate pledge is committed for
 }
 
 // String implements the stringer interface, returning the consensus engine details.
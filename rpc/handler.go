@@ -26,6 +26,8 @@ import (
 	"time"
 
 	"github.com/token/log"
+	"github.com/token/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // handler handles JSON-RPC messages. There is one handler per connection. Note that
@@ -61,6 +63,8 @@ type handler struct {
 	conn           jsonWriter                     // where responses will be sent
 	log            log.Logger
 	allowSubscribe bool
+	limiter        *limiter // resource limits of the server, nil if unlimited
+	limiterKey     string   // identity of the connection for rate limiting
 
 	subLock    sync.Mutex
 	serverSubs map[ID]*Subscription
@@ -71,7 +75,7 @@ type callProc struct {
 	notifiers []*Notifier
 }
 
-func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *serviceRegistry) *handler {
+func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *serviceRegistry, limiter *limiter) *handler {
 	rootCtx, cancelRoot := context.WithCancel(connCtx)
 	h := &handler{
 		reg:            reg,
@@ -84,6 +88,10 @@ func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *
 		allowSubscribe: true,
 		serverSubs:     make(map[ID]*Subscription),
 		log:            log.Root(),
+		limiter:        limiter,
+	}
+	if limiter != nil {
+		h.limiterKey = limiterKey(connCtx, conn)
 	}
 	if conn.remoteAddr() != "" {
 		h.log = h.log.New("conn", conn.remoteAddr())
@@ -101,6 +109,22 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 		})
 		return
 	}
+	// Reject batches exceeding the configured limit without executing any of them:
+	if !h.limiter.batchAllowed(len(msgs)) {
+		h.startCallProc(func(cp *callProc) {
+			answers := make([]*jsonrpcMessage, 0, len(msgs))
+			for _, msg := range msgs {
+				if msg.isCall() {
+					answers = append(answers, msg.errorResponse(&invalidRequestError{"batch too large"}))
+				}
+			}
+			if len(answers) == 0 {
+				answers = append(answers, errorMessage(&invalidRequestError{"batch too large"}))
+			}
+			h.conn.writeJSON(cp.ctx, answers)
+		})
+		return
+	}
 
 	// Handle non-call messages first:
 	calls := make([]*jsonrpcMessage, 0, len(msgs))
@@ -114,9 +138,24 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 	}
 	// Process calls on a goroutine because they may block indefinitely:
 	h.startCallProc(func(cp *callProc) {
-		answers := make([]*jsonrpcMessage, 0, len(msgs))
+		var (
+			answers = make([]*jsonrpcMessage, 0, len(msgs))
+			size    int
+		)
 		for _, msg := range calls {
-			if answer := h.handleCallMsg(cp, msg); answer != nil {
+			// Once the response grew too large, fail the rest of the batch
+			// instead of executing it.
+			if !h.limiter.responseAllowed(size) {
+				if msg.isCall() {
+					answers = append(answers, msg.errorResponse(&responseTooLargeError{"batch response too large"}))
+				}
+				continue
+			}
+			if answer := h.handleCallMsg(cp, msg, size); answer != nil {
+				size += len(answer.Result)
+				if !h.limiter.responseAllowed(size) {
+					answer = msg.errorResponse(&responseTooLargeError{"batch response too large"})
+				}
 				answers = append(answers, answer)
 			}
 		}
@@ -136,7 +175,7 @@ func (h *handler) handleMsg(msg *jsonrpcMessage) {
 		return
 	}
 	h.startCallProc(func(cp *callProc) {
-		answer := h.handleCallMsg(cp, msg)
+		answer := h.handleCallMsg(cp, msg, 0)
 		h.addSubscriptions(cp.notifiers)
 		if answer != nil {
 			h.conn.writeJSON(cp.ctx, answer)
@@ -286,16 +325,17 @@ func (h *handler) handleResponse(msg *jsonrpcMessage) {
 	}
 }
 
-// handleCallMsg executes a call message and returns the answer.
-func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
+// handleCallMsg executes a call message and returns the answer. The result of the
+// call is limited to the response size left after the given number of bytes.
+func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage, used int) *jsonrpcMessage {
 	start := time.Now()
 	switch {
 	case msg.isNotification():
-		h.handleCall(ctx, msg)
+		h.handleCall(ctx, msg, used)
 		h.log.Debug("Served "+msg.Method, "t", time.Since(start))
 		return nil
 	case msg.isCall():
-		resp := h.handleCall(ctx, msg)
+		resp := h.handleCall(ctx, msg, used)
 		var ctx []interface{}
 		ctx = append(ctx, "reqid", idForLog{msg.ID}, "t", time.Since(start))
 		if resp.Error != nil {
@@ -316,7 +356,13 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMess
 }
 
 // handleCall processes method calls.
-func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
+func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage, used int) *jsonrpcMessage {
+	release, err := h.limiter.acquire(h.limiterKey, msg.Method)
+	if err != nil {
+		return msg.errorResponse(err)
+	}
+	defer release()
+
 	if msg.isSubscribe() {
 		return h.handleSubscribe(cp, msg)
 	}
@@ -334,7 +380,15 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage
 		return msg.errorResponse(&invalidParamsError{err.Error()})
 	}
 	start := time.Now()
-	answer := h.runMethod(cp.ctx, msg, callb, args)
+	ctx, span := tracing.StartServer(cp.ctx, msg.Method, attribute.String("rpc.system", "jsonrpc"), attribute.String("rpc.service", msg.namespace()))
+	if budget, ok := h.limiter.responseBudget(used); ok {
+		ctx = withResponseBudget(ctx, budget)
+	}
+	answer := h.runMethod(ctx, msg, callb, args)
+	if answer.Error != nil {
+		tracing.SetError(span, answer.Error)
+	}
+	span.End()
 
 	// Collect the statistics for RPC calls if metrics is enabled.
 	// We only care about pure rpc call. Filter out subscription.
@@ -390,6 +444,9 @@ func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *cal
 	if err != nil {
 		return msg.errorResponse(err)
 	}
+	if budget, ok := ResponseSizeBudget(ctx); ok {
+		return msg.limitedResponse(result, budget)
+	}
 	return msg.response(result)
 }
 
@@ -17,10 +17,15 @@
 package rpc
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/token/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func confirmStatusCode(t *testing.T, got, want int) {
@@ -124,6 +129,53 @@ func TestHTTPRespBodyUnlimited(t *testing.T) {
 	}
 }
 
+// Tests that the trace context of a client call propagates through the HTTP
+// headers into the span of the server handling it.
+func TestHTTPTracePropagation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracing.Enable(exporter, "test")
+	defer tracing.Stop()
+
+	s := newTestServer()
+	defer s.Stop()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c, err := DialHTTP(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, span := tracing.Start(context.Background(), "client")
+	var r echoResult
+	if err := c.CallContext(ctx, &r, "test_echo", "hello", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CallContext(ctx, nil, "test_returnError"); err == nil {
+		t.Fatal("expected error")
+	}
+	span.End()
+	tracing.Flush()
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	for name, status := range map[string]codes.Code{"test_echo": codes.Unset, "test_returnError": codes.Error} {
+		have, ok := spans[name]
+		if !ok {
+			t.Fatalf("no span exported for %s: %v", name, spans)
+		}
+		if have.SpanContext.TraceID() != span.SpanContext().TraceID() || have.Parent.SpanID() != span.SpanContext().SpanID() || !have.Parent.IsRemote() {
+			t.Errorf("%s: span not a child of the client call: %+v", name, have)
+		}
+		if have.Status.Code != status {
+			t.Errorf("%s: status mismatch: have %v, want %v", name, have.Status.Code, status)
+		}
+	}
+}
+
 // Tests that an HTTP error results in an HTTPError instance
 // being returned with the expected attributes.
 func TestHTTPErrorResponse(t *testing.T) {
@@ -19,6 +19,7 @@ package rpc
 import (
 	"bytes"
 	"context"
+	"encoding"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -106,6 +107,63 @@ func (msg *jsonrpcMessage) response(result interface{}) *jsonrpcMessage {
 	return &jsonrpcMessage{Version: vsn, ID: msg.ID, Result: enc}
 }
 
+// limitedResponse is like response, but fails once the encoded result exceeds
+// the given number of bytes. Lists are encoded item by item, so oversized ones
+// are aborted without encoding them completely.
+func (msg *jsonrpcMessage) limitedResponse(result interface{}, limit int) *jsonrpcMessage {
+	enc, err := encodeLimited(result, limit)
+	if err != nil {
+		return msg.errorResponse(err)
+	}
+	return &jsonrpcMessage{Version: vsn, ID: msg.ID, Result: enc}
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// encodeLimited JSON encodes the value, failing if the encoding exceeds limit
+// bytes.
+func encodeLimited(v interface{}, limit int) (json.RawMessage, error) {
+	val := reflect.ValueOf(v)
+	// Encode anything but plain lists in one go
+	if val.Kind() != reflect.Slice || val.IsNil() || val.Type().Elem().Kind() == reflect.Uint8 ||
+		val.Type().Implements(jsonMarshalerType) || val.Type().Implements(textMarshalerType) {
+		enc, err := json.Marshal(v)
+		if err == nil && len(enc) > limit {
+			return nil, errResponseTooLarge()
+		}
+		return enc, err
+	}
+	if limit < len("[]") {
+		return nil, errResponseTooLarge()
+	}
+	enc := []byte{'['}
+	for i := 0; i < val.Len(); i++ {
+		if i > 0 {
+			enc = append(enc, ',')
+		}
+		// Slice items are addressable, encode them through a pointer so that
+		// pointer receiver marshalers are invoked like json.Marshal does.
+		item, err := json.Marshal(val.Index(i).Addr().Interface())
+		if err != nil {
+			return nil, err
+		}
+		if enc = append(enc, item...); len(enc)+1 > limit {
+			return nil, errResponseTooLarge()
+		}
+	}
+	return append(enc, ']'), nil
+}
+
+// errResponseTooLarge accounts and returns the error of a result exceeding the
+// response size limit.
+func errResponseTooLarge() error {
+	rpcResponseLimitedMeter.Mark(1)
+	return &responseTooLargeError{"response too large"}
+}
+
 func errorMessage(err error) *jsonrpcMessage {
 	msg := &jsonrpcMessage{Version: vsn, ID: null, Error: &jsonError{
 		Code:    defaultErrorCode,
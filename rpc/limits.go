@@ -0,0 +1,208 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// rateBucketExpiry is the time after which the rate limit bucket of an idle
+// client is dropped.
+const rateBucketExpiry = time.Minute
+
+// Limits are the resource limits a server enforces on the requests it serves.
+// A zero value disables the corresponding limit.
+type Limits struct {
+	BatchItems        int            // Maximum number of requests in a batch
+	ResponseBytes     int            // Maximum size of the results of a response or batch
+	MethodConcurrency map[string]int // Maximum number of concurrently served calls per method
+	RateLimit         float64        // Number of calls allowed per second and client
+	RateBurst         int            // Number of calls a client may burst above the rate limit
+}
+
+type clientKeyContextKey struct{}
+
+// WithClientKey returns a copy of the context carrying the identity the rate
+// limits of the requests served with it are accounted to, instead of the remote
+// IP address of the connection.
+func WithClientKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, clientKeyContextKey{}, key)
+}
+
+type responseBudgetContextKey struct{}
+
+// ResponseSizeBudget returns the number of bytes the result of the call served
+// with the given context may encode to, if the server limits the response size.
+// Handlers assembling large results should stop early once they exceed it, the
+// server rejects the result anyway.
+func ResponseSizeBudget(ctx context.Context) (int, bool) {
+	budget, ok := ctx.Value(responseBudgetContextKey{}).(int)
+	return budget, ok
+}
+
+// withResponseBudget returns a copy of the context carrying the response size
+// budget of a call.
+func withResponseBudget(ctx context.Context, budget int) context.Context {
+	return context.WithValue(ctx, responseBudgetContextKey{}, budget)
+}
+
+// limiterKey returns the identity to account the calls of a connection to. It is
+// taken from the context of the connection, or from the websocket handshake for
+// long lived connections, falling back to the remote IP address.
+func limiterKey(ctx context.Context, conn jsonWriter) string {
+	if key, ok := ctx.Value(clientKeyContextKey{}).(string); ok && key != "" {
+		return key
+	}
+	if wc, ok := conn.(*websocketCodec); ok && wc.clientKey != "" {
+		return wc.clientKey
+	}
+	remote := conn.remoteAddr()
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		return host
+	}
+	return remote
+}
+
+// rateBucket is a token bucket of a single client.
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter enforces the limits of a server, it is shared by all connections.
+type limiter struct {
+	limits Limits
+
+	methods map[string]chan struct{} // Concurrency semaphores per method
+
+	lock    sync.Mutex
+	buckets map[string]*rateBucket // Rate limit buckets per client
+	swept   time.Time
+}
+
+// newLimiter creates the limiter of the given limits, or nil if no limit is set.
+func newLimiter(limits Limits) *limiter {
+	if limits.BatchItems <= 0 && limits.ResponseBytes <= 0 && len(limits.MethodConcurrency) == 0 && limits.RateLimit <= 0 {
+		return nil
+	}
+	l := &limiter{
+		limits:  limits,
+		methods: make(map[string]chan struct{}),
+		buckets: make(map[string]*rateBucket),
+	}
+	for method, n := range limits.MethodConcurrency {
+		if n > 0 {
+			l.methods[method] = make(chan struct{}, n)
+		}
+	}
+	return l
+}
+
+// batchAllowed reports whether a batch of the given size may be served.
+func (l *limiter) batchAllowed(items int) bool {
+	if l == nil || l.limits.BatchItems <= 0 || items <= l.limits.BatchItems {
+		return true
+	}
+	rpcBatchLimitedMeter.Mark(1)
+	return false
+}
+
+// responseAllowed reports whether a response may grow to the given size.
+func (l *limiter) responseAllowed(size int) bool {
+	if l == nil || l.limits.ResponseBytes <= 0 || size <= l.limits.ResponseBytes {
+		return true
+	}
+	rpcResponseLimitedMeter.Mark(1)
+	return false
+}
+
+// responseBudget returns the number of bytes a response may still grow by if it
+// already holds the given number of bytes, and whether the response size is
+// limited at all.
+func (l *limiter) responseBudget(used int) (int, bool) {
+	if l == nil || l.limits.ResponseBytes <= 0 {
+		return 0, false
+	}
+	if used >= l.limits.ResponseBytes {
+		return 0, true
+	}
+	return l.limits.ResponseBytes - used, true
+}
+
+// acquire checks the rate limit of the client and reserves a concurrency slot
+// of the method. The returned function releases the slot.
+func (l *limiter) acquire(client, method string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if !l.allowRate(client, time.Now()) {
+		rpcRateLimitedMeter.Mark(1)
+		return nil, &limitExceededError{"rate limit exceeded"}
+	}
+	sem := l.methods[method]
+	if sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	default:
+		rpcConcurrencyLimitedMeter.Mark(1)
+		return nil, &limitExceededError{"too many concurrent requests for " + method}
+	}
+}
+
+// allowRate takes a token from the bucket of the client, if available.
+func (l *limiter) allowRate(client string, now time.Time) bool {
+	if l.limits.RateLimit <= 0 {
+		return true
+	}
+	burst := float64(l.limits.RateBurst)
+	if burst < 1 {
+		burst = 1
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// Drop the buckets of idle clients every now and then
+	if now.Sub(l.swept) > rateBucketExpiry {
+		for key, bucket := range l.buckets {
+			if now.Sub(bucket.last) > rateBucketExpiry {
+				delete(l.buckets, key)
+			}
+		}
+		l.swept = now
+	}
+	bucket := l.buckets[client]
+	if bucket == nil {
+		bucket = &rateBucket{tokens: burst, last: now}
+		l.buckets[client] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.limits.RateLimit
+	if bucket.tokens > burst {
+		bucket.tokens = burst
+	}
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
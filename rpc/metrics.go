@@ -27,6 +27,11 @@ var (
 	successfulRequestGauge = metrics.NewRegisteredGauge("rpc/success", nil)
 	failedReqeustGauge     = metrics.NewRegisteredGauge("rpc/failure", nil)
 	rpcServingTimer        = metrics.NewRegisteredTimer("rpc/duration/all", nil)
+
+	rpcBatchLimitedMeter       = metrics.NewRegisteredMeter("rpc/limits/batch", nil)
+	rpcResponseLimitedMeter    = metrics.NewRegisteredMeter("rpc/limits/response", nil)
+	rpcRateLimitedMeter        = metrics.NewRegisteredMeter("rpc/limits/rate", nil)
+	rpcConcurrencyLimitedMeter = metrics.NewRegisteredMeter("rpc/limits/concurrency", nil)
 )
 
 func newRPCServingTimer(method string, valid bool) metrics.Timer {
@@ -19,6 +19,7 @@ package rpc
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net"
@@ -45,7 +46,7 @@ func TestServerRegisterName(t *testing.T) {
 		t.Fatalf("Expected service calc to be registered")
 	}
 
-	wantCallbacks := 9
+	wantCallbacks := 11
 	if len(svc.callbacks) != wantCallbacks {
 		t.Errorf("Expected %d callbacks for service 'service', got %d", wantCallbacks, len(svc.callbacks))
 	}
@@ -150,3 +151,134 @@ func TestServerShortLivedConn(t *testing.T) {
 		}
 	}
 }
+
+// Tests that oversized batches and responses are rejected with the appropriate
+// error codes.
+func TestServerLimits(t *testing.T) {
+	server := newTestServer()
+	server.SetLimits(Limits{BatchItems: 2, ResponseBytes: 100})
+	defer server.Stop()
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	// Batches within the limit are served, every call of larger ones is rejected
+	batch := []BatchElem{
+		{Method: "test_echo", Args: []interface{}{"hello", 1, nil}, Result: new(echoResult)},
+		{Method: "test_echo", Args: []interface{}{"world", 2, nil}, Result: new(echoResult)},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatalf("batch within limit failed: %v", err)
+	}
+	for i, elem := range batch {
+		if elem.Error != nil {
+			t.Errorf("batch element %d failed: %v", i, elem.Error)
+		}
+	}
+	batch = append(batch, BatchElem{Method: "test_echo", Args: []interface{}{"!", 3, nil}, Result: new(echoResult)})
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatalf("oversized batch failed: %v", err)
+	}
+	for i, elem := range batch {
+		if rpcErr, ok := elem.Error.(Error); !ok || rpcErr.ErrorCode() != -32600 {
+			t.Errorf("oversized batch element %d not rejected: %v", i, elem.Error)
+		}
+	}
+	// Responses exceeding the size limit are replaced by an error
+	var result echoResult
+	err := client.Call(&result, "test_echo", strings.Repeat("x", 200), 1, nil)
+	if rpcErr, ok := err.(Error); !ok || rpcErr.ErrorCode() != -32003 {
+		t.Fatalf("oversized response not rejected: %v", err)
+	}
+	if err := client.Call(&result, "test_echo", "small", 1, nil); err != nil {
+		t.Fatalf("small response failed: %v", err)
+	}
+	// Lists are limited while being encoded
+	var list []string
+	err = client.Call(&list, "test_repeat", "xxxxxxxxxx", 1000)
+	if rpcErr, ok := err.(Error); !ok || rpcErr.ErrorCode() != -32003 {
+		t.Fatalf("oversized list not rejected: %v", err)
+	}
+	if err := client.Call(&list, "test_repeat", "x", 3); err != nil || len(list) != 3 {
+		t.Fatalf("small list failed: %v %v", list, err)
+	}
+	// Methods see the response size left to them
+	var budget int
+	if err := client.Call(&budget, "test_responseBudget"); err != nil || budget != 100 {
+		t.Fatalf("response budget mismatch: have %d (%v), want %d", budget, err, 100)
+	}
+	batch = []BatchElem{
+		{Method: "test_repeat", Args: []interface{}{"x", 5}, Result: new([]string)},
+		{Method: "test_responseBudget", Result: new(int)},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatalf("batch failed: %v", err)
+	}
+	if have, want := *batch[1].Result.(*int), 100-len(`["x","x","x","x","x"]`); batch[1].Error != nil || have != want {
+		t.Fatalf("batch response budget mismatch: have %d (%v), want %d", have, batch[1].Error, want)
+	}
+}
+
+// Tests that results are encoded like json.Marshal does within the size limit,
+// and rejected beyond it.
+func TestEncodeLimited(t *testing.T) {
+	type item struct{ A int }
+	tests := []interface{}{
+		nil,
+		"string",
+		[]int(nil),
+		[]int{},
+		[]int{1, 2, 3},
+		[]byte{1, 2, 3},
+		[]*item{{1}, nil, {3}},
+		[]item{{1}, {2}},
+		[][]string{{"a"}, {}, nil},
+	}
+	for i, v := range tests {
+		want, _ := json.Marshal(v)
+		have, err := encodeLimited(v, len(want))
+		if err != nil || string(have) != string(want) {
+			t.Errorf("test %d: encoding mismatch: have %s (%v), want %s", i, have, err, want)
+		}
+		if _, err := encodeLimited(v, len(want)-1); err == nil {
+			t.Errorf("test %d: oversized encoding not rejected", i)
+		}
+	}
+}
+
+// Tests that the limiter enforces per-method concurrency and per-client rates.
+func TestLimiter(t *testing.T) {
+	l := newLimiter(Limits{MethodConcurrency: map[string]int{"test_sleep": 1}})
+
+	release, err := l.acquire("a", "test_sleep")
+	if err != nil {
+		t.Fatalf("first call rejected: %v", err)
+	}
+	if _, err := l.acquire("b", "test_sleep"); err == nil {
+		t.Fatalf("concurrent call accepted")
+	}
+	if _, err := l.acquire("b", "test_echo"); err != nil {
+		t.Fatalf("unlimited method rejected: %v", err)
+	}
+	release()
+	if _, err := l.acquire("b", "test_sleep"); err != nil {
+		t.Fatalf("call after release rejected: %v", err)
+	}
+
+	l = newLimiter(Limits{RateLimit: 1, RateBurst: 2})
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if !l.allowRate("a", now) {
+			t.Fatalf("call %d within burst rejected", i)
+		}
+	}
+	if l.allowRate("a", now) {
+		t.Fatalf("call exceeding burst accepted")
+	}
+	if !l.allowRate("b", now) {
+		t.Fatalf("other client rejected")
+	}
+	if !l.allowRate("a", now.Add(time.Second)) {
+		t.Fatalf("call after refill rejected")
+	}
+}
@@ -80,6 +80,21 @@ func (s *testService) EchoWithCtx(ctx context.Context, str string, i int, args *
 	return echoResult{str, i, args}
 }
 
+func (s *testService) Repeat(str string, n int) []string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = str
+	}
+	return list
+}
+
+func (s *testService) ResponseBudget(ctx context.Context) int {
+	if budget, ok := ResponseSizeBudget(ctx); ok {
+		return budget
+	}
+	return -1
+}
+
 func (s *testService) Sleep(ctx context.Context, duration time.Duration) {
 	time.Sleep(duration)
 }
@@ -60,6 +60,9 @@ func (s *Server) WebsocketHandler(allowedOrigins []string) http.Handler {
 			return
 		}
 		codec := newWebsocketCodec(conn)
+		if key, ok := r.Context().Value(clientKeyContextKey{}).(string); ok {
+			codec.(*websocketCodec).clientKey = key
+		}
 		s.ServeCodec(codec, 0)
 	})
 }
@@ -235,6 +238,8 @@ type websocketCodec struct {
 	*jsonCodec
 	conn *websocket.Conn
 
+	clientKey string // identity the calls are rate limited by, if set during the handshake
+
 	wg        sync.WaitGroup
 	pingReset chan struct{}
 }
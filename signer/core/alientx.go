@@ -0,0 +1,255 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/token/common"
+	"github.com/token/common/hexutil"
+)
+
+// The alien consensus engine encodes its custom transactions as colon separated
+// ASCII strings in the transaction data, e.g. "ufo:1:event:vote" or
+// "SSC:1:Deposit:<amount>:<who>". The layouts below mirror the parsers in
+// consensus/alien and only serve to present these payloads to the user.
+const (
+	alienVersion = "1"
+
+	alienPosPrefix   = 0
+	alienPosVersion  = 1
+	alienPosCategory = 2
+	alienPosEvent    = 3
+)
+
+// alienFieldKind tells the decoder how to render a positional argument.
+type alienFieldKind int
+
+const (
+	alienText     alienFieldKind = iota // shown verbatim
+	alienAddress                        // 20 byte address, shown checksummed
+	alienQuantity                       // hex encoded big integer, shown in decimal
+	alienList                           // "|" separated list, shown verbatim
+)
+
+type alienFieldSpec struct {
+	name string
+	kind alienFieldKind
+}
+
+// alienTxFormat describes a single kind of custom transaction.
+type alienTxFormat struct {
+	action      string           // Stable identifier, exposed to rules
+	description string           // Human readable summary
+	fields      []alienFieldSpec // Arguments following the category (or event)
+	keyValues   bool             // Arguments are key/value pairs (proposals, declares)
+}
+
+var (
+	alienUfoEvents = map[string]alienTxFormat{
+		"vote": {action: "vote", description: "Vote for the recipient as block signer"},
+		"confirm": {action: "confirm", description: "Confirm a block as signer", fields: []alienFieldSpec{
+			{"number", alienText},
+		}},
+		"proposal": {action: "proposal", description: "Submit a governance proposal", keyValues: true},
+		"declare":  {action: "declare", description: "Declare on a governance proposal", keyValues: true},
+	}
+	alienUfoSCEvents = map[string]alienTxFormat{
+		"confirm": {action: "sc-confirm", description: "Confirm a side chain block", fields: []alienFieldSpec{
+			{"hash", alienText}, {"number", alienText}, {"time", alienText}, {"loop", alienText}, {"charging", alienText},
+		}},
+	}
+	alienTokenCategories = map[string]alienTxFormat{
+		"Exch": {action: "exchange", description: "Exchange token for coin", fields: []alienFieldSpec{
+			{"target", alienAddress}, {"amount", alienQuantity},
+		}},
+		"Bind": {action: "bind", description: "Bind a device to a revenue address", fields: []alienFieldSpec{
+			{"device", alienAddress}, {"revenueType", alienText}, {"", alienText}, {"multiSign", alienText}, {"revenue", alienAddress},
+		}},
+		"Unbind": {action: "unbind", description: "Unbind a device from its revenue address", fields: []alienFieldSpec{
+			{"device", alienAddress}, {"revenueType", alienText}, {"", alienText}, {"multiSign", alienText}, {"revenue", alienAddress},
+		}},
+		"Rebind": {action: "rebind", description: "Rebind a device to another revenue address", fields: []alienFieldSpec{
+			{"device", alienAddress}, {"revenueType", alienText}, {"", alienText}, {"multiSign", alienText}, {"revenue", alienAddress},
+		}},
+		"CandReq": {action: "candidate-pledge", description: "Pledge for a new candidate", fields: []alienFieldSpec{
+			{"miner", alienAddress},
+		}},
+		"CandExit": {action: "candidate-exit", description: "Exit candidate pledge", fields: []alienFieldSpec{
+			{"miner", alienAddress},
+		}},
+		"CandPnsh": {action: "candidate-punish", description: "Pay the punishment of a candidate", fields: []alienFieldSpec{
+			{"miner", alienAddress},
+		}},
+		"CandEntrust": {action: "entrust", description: "Entrust pledge to a candidate", fields: []alienFieldSpec{
+			{"miner", alienAddress}, {"amount", alienQuantity},
+		}},
+		"CandETExit": {action: "entrust-exit", description: "Exit entrusted pledge from a candidate", fields: []alienFieldSpec{
+			{"miner", alienAddress}, {"hash", alienText},
+		}},
+		"CandChaRate": {action: "change-rate", description: "Change the distribution rate of a candidate", fields: []alienFieldSpec{
+			{"miner", alienAddress}, {"rate", alienQuantity},
+		}},
+		"CandChaMan": {action: "change-manager", description: "Change the manager of a candidate", fields: []alienFieldSpec{
+			{"miner", alienAddress}, {"manager", alienAddress},
+		}},
+		"pofReq": {action: "pof-pledge", description: "Pledge for a PoF miner", fields: []alienFieldSpec{
+			{"miner", alienAddress}, {"bandwidth", alienQuantity}, {"price", alienText},
+		}},
+		"pofExit": {action: "pof-exit", description: "Exit PoF miner pledge", fields: []alienFieldSpec{
+			{"miner", alienAddress},
+		}},
+		"pofrpten": {action: "pof-report", description: "Report PoF flow", fields: []alienFieldSpec{
+			{"", alienText}, {"report", alienList},
+		}},
+		"pofchbw": {action: "pof-bandwidth", description: "Change the bandwidth of a PoF miner", fields: []alienFieldSpec{
+			{"miner", alienAddress}, {"bandwidth", alienQuantity},
+		}},
+		"pofprice": {action: "pof-price", description: "Change the price of a PoF miner", fields: []alienFieldSpec{
+			{"miner", alienAddress}, {"price", alienText},
+		}},
+	}
+	alienSSCCategories = map[string]alienTxFormat{
+		"ExchRate": {action: "exchange-rate", description: "Configure the token exchange rate", fields: []alienFieldSpec{
+			{"rate", alienText},
+		}},
+		"Deposit": {action: "deposit", description: "Configure the candidate deposit", fields: []alienFieldSpec{
+			{"amount", alienQuantity}, {"who", alienText},
+		}},
+		"CndLock": {action: "candidate-lock", description: "Configure the candidate pledge lock", fields: []alienFieldSpec{
+			{"lockPeriod", alienQuantity}, {"releasePeriod", alienQuantity}, {"interval", alienQuantity},
+		}},
+		"PofLock": {action: "pof-lock", description: "Configure the PoF pledge lock", fields: []alienFieldSpec{
+			{"lockPeriod", alienQuantity}, {"releasePeriod", alienQuantity}, {"interval", alienQuantity},
+		}},
+		"RwdLock": {action: "reward-lock", description: "Configure the reward lock", fields: []alienFieldSpec{
+			{"lockPeriod", alienQuantity}, {"releasePeriod", alienQuantity}, {"interval", alienQuantity},
+		}},
+		"OffLine": {action: "offline", description: "Configure the offline penalty", fields: []alienFieldSpec{
+			{"value", alienText},
+		}},
+		"Manager": {action: "manager", description: "Configure a system manager address", fields: []alienFieldSpec{
+			{"id", alienText}, {"address", alienAddress},
+		}},
+	}
+)
+
+// AlienTxField is a single decoded argument of an alien custom transaction.
+type AlienTxField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// AlienTxInfo is the decoded form of an alien custom transaction. It is attached
+// to transaction signing requests so that UIs can render it and rule scripts can
+// base their decision on it (e.g. r.alien_tx.action == "pof-report").
+type AlienTxInfo struct {
+	Prefix      string         `json:"prefix"`
+	Version     string         `json:"version"`
+	Category    string         `json:"category"`
+	Action      string         `json:"action"`
+	Description string         `json:"description"`
+	Fields      []AlienTxField `json:"fields"`
+}
+
+// String returns a one-line summary of the custom transaction.
+func (info *AlienTxInfo) String() string {
+	args := make([]string, len(info.Fields))
+	for i, f := range info.Fields {
+		args[i] = fmt.Sprintf("%s=%s", f.Name, f.Value)
+	}
+	return fmt.Sprintf("%s (%s) %s", info.Description, info.Action, strings.Join(args, " "))
+}
+
+// DecodeAlienTx tries to interpret the transaction data as an alien custom
+// transaction. It returns nil if the data is not a known custom transaction.
+func DecodeAlienTx(data []byte) *AlienTxInfo {
+	parts := strings.Split(string(data), ":")
+	if len(parts) <= alienPosCategory || parts[alienPosVersion] != alienVersion {
+		return nil
+	}
+	var (
+		format alienTxFormat
+		args   []string
+		ok     bool
+	)
+	switch parts[alienPosPrefix] {
+	case "ufo":
+		if len(parts) <= alienPosEvent {
+			return nil
+		}
+		switch parts[alienPosCategory] {
+		case "event":
+			format, ok = alienUfoEvents[parts[alienPosEvent]]
+		case "sc":
+			format, ok = alienUfoSCEvents[parts[alienPosEvent]]
+		}
+		args = parts[alienPosEvent+1:]
+	case "token":
+		format, ok = alienTokenCategories[parts[alienPosCategory]]
+		args = parts[alienPosCategory+1:]
+	case "SSC":
+		format, ok = alienSSCCategories[parts[alienPosCategory]]
+		args = parts[alienPosCategory+1:]
+	}
+	if !ok {
+		return nil
+	}
+	info := &AlienTxInfo{
+		Prefix:      parts[alienPosPrefix],
+		Version:     parts[alienPosVersion],
+		Category:    parts[alienPosCategory],
+		Action:      format.action,
+		Description: format.description,
+		Fields:      make([]AlienTxField, 0, len(args)),
+	}
+	if format.keyValues {
+		for i := 0; i+1 < len(args); i += 2 {
+			info.Fields = append(info.Fields, AlienTxField{Name: args[i], Value: args[i+1]})
+		}
+		return info
+	}
+	for i, arg := range args {
+		spec := alienFieldSpec{kind: alienText}
+		if i < len(format.fields) {
+			spec = format.fields[i]
+		}
+		if spec.name == "" {
+			spec.name = fmt.Sprintf("arg%d", i)
+		}
+		info.Fields = append(info.Fields, AlienTxField{Name: spec.name, Value: formatAlienField(spec.kind, arg)})
+	}
+	return info
+}
+
+// formatAlienField renders a raw argument according to its kind, falling back
+// to the raw value if it cannot be parsed the way the consensus engine would.
+func formatAlienField(kind alienFieldKind, raw string) string {
+	switch kind {
+	case alienAddress:
+		var addr common.Address
+		if err := addr.UnmarshalText1([]byte(raw)); err == nil {
+			return addr.Hex()
+		}
+	case alienQuantity:
+		if n, err := hexutil.UnmarshalText1([]byte(raw)); err == nil {
+			return n.String()
+		}
+	}
+	return raw
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeAlienTx(t *testing.T) {
+	tests := []struct {
+		data   string
+		action string
+		fields []AlienTxField
+	}{
+		{"ufo:1:event:vote", "vote", []AlienTxField{}},
+		{"ufo:1:event:confirm:1234", "confirm", []AlienTxField{{"number", "1234"}}},
+		{"ufo:1:event:proposal:proposal_type:1:sccount:2", "proposal", []AlienTxField{{"proposal_type", "1"}, {"sccount", "2"}}},
+		{"token:1:pofExit:000000000000000000000000000000000000dead", "pof-exit", []AlienTxField{
+			{"miner", "0x000000000000000000000000000000000000dEaD"},
+		}},
+		{"token:1:CandEntrust:0x000000000000000000000000000000000000dead:0x64", "entrust", []AlienTxField{
+			{"miner", "0x000000000000000000000000000000000000dEaD"}, {"amount", "100"},
+		}},
+		{"token:1:pofrpten:0:a|b", "pof-report", []AlienTxField{{"arg0", "0"}, {"report", "a|b"}}},
+		{"SSC:1:Deposit:0x10:0", "deposit", []AlienTxField{{"amount", "16"}, {"who", "0"}}},
+		{"SSC:1:CndLock:zz", "candidate-lock", []AlienTxField{{"lockPeriod", "zz"}}},
+	}
+	for i, tt := range tests {
+		info := DecodeAlienTx([]byte(tt.data))
+		if info == nil {
+			t.Errorf("test %d: %q not decoded", i, tt.data)
+			continue
+		}
+		if info.Action != tt.action {
+			t.Errorf("test %d: action mismatch: have %q, want %q", i, info.Action, tt.action)
+		}
+		if !reflect.DeepEqual(info.Fields, tt.fields) {
+			t.Errorf("test %d: fields mismatch: have %v, want %v", i, info.Fields, tt.fields)
+		}
+	}
+	for _, data := range []string{"", "ufo", "ufo:1:event", "ufo:2:event:vote", "token:1:unknown:0x00", "SSC:1", "\xa9\x05\x9c\xbb"} {
+		if info := DecodeAlienTx([]byte(data)); info != nil {
+			t.Errorf("%q: unexpected decode %v", data, info)
+		}
+	}
+}
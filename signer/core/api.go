@@ -23,9 +23,11 @@ import (
 	"fmt"
 	"math/big"
 	"os"
+	"path/filepath"
 	"reflect"
 
 	"github.com/token/accounts"
+	"github.com/token/accounts/hdkeystore"
 	"github.com/token/accounts/keystore"
 	"github.com/token/accounts/scwallet"
 	"github.com/token/accounts/usbwallet"
@@ -42,7 +44,7 @@ const (
 	// ExternalAPIVersion -- see extapi_changelog.md
 	ExternalAPIVersion = "6.1.0"
 	// InternalAPIVersion -- see intapi_changelog.md
-	InternalAPIVersion = "7.0.1"
+	InternalAPIVersion = "7.2.0"
 )
 
 // ExternalAPI defines the external API through which signing requests are made.
@@ -115,6 +117,7 @@ type SignerAPI struct {
 	validator   Validator
 	rejectMode  bool
 	credentials storage.Storage
+	history     *SignHistory
 }
 
 // Metadata about a request
@@ -137,6 +140,7 @@ func StartClefAccountManager(ksLocation string, nousb, lightKDF bool, scpath str
 	// support password based accounts
 	if len(ksLocation) > 0 {
 		backends = append(backends, keystore.NewKeyStore(ksLocation, n, p))
+		backends = append(backends, hdkeystore.NewKeyStore(filepath.Join(ksLocation, hdkeystore.KeyStoreDir), n, p))
 	}
 	if !nousb {
 		// Start a USB hub for Ledger hardware wallets
@@ -222,6 +226,7 @@ type (
 	SignTxRequest struct {
 		Transaction SendTxArgs       `json:"transaction"`
 		Callinfo    []ValidationInfo `json:"call_info"`
+		AlienTx     *AlienTxInfo     `json:"alien_tx,omitempty"`
 		Meta        Metadata         `json:"meta"`
 	}
 	// SignTxResponse result from SignTxRequest
@@ -278,11 +283,13 @@ var ErrRequestDenied = errors.New("request denied")
 // key that is generated when a new Account is created.
 // noUSB disables USB support that is required to support hardware devices such as
 // ledger and trezor.
-func NewSignerAPI(am *accounts.Manager, chainID int64, noUSB bool, ui UIClientAPI, validator Validator, advancedMode bool, credentials storage.Storage) *SignerAPI {
+// history records the sealed alien headers to refuse double signing, it may be
+// nil to disable the protection.
+func NewSignerAPI(am *accounts.Manager, chainID int64, noUSB bool, ui UIClientAPI, validator Validator, advancedMode bool, credentials storage.Storage, history *SignHistory) *SignerAPI {
 	if advancedMode {
 		log.Info("Clef is in advanced mode: will warn instead of reject")
 	}
-	signer := &SignerAPI{big.NewInt(chainID), am, ui, validator, !advancedMode, credentials}
+	signer := &SignerAPI{big.NewInt(chainID), am, ui, validator, !advancedMode, credentials, history}
 	if !noUSB {
 		signer.startUSBListener()
 	}
@@ -319,6 +326,28 @@ func (api *SignerAPI) openTrezor(url accounts.URL) {
 
 }
 
+// openHDWallet asks the user for the passphrase of an HD wallet mnemonic to open
+// the wallet, allowing its accounts to be derived.
+func (api *SignerAPI) openHDWallet(url accounts.URL) {
+	resp, err := api.UI.OnInputRequired(UserInputRequest{
+		Prompt:     fmt.Sprintf("Passphrase required to open HD wallet\n%v\n", url),
+		IsPassword: true,
+		Title:      "HD wallet unlock",
+	})
+	if err != nil {
+		log.Warn("failed getting HD wallet passphrase", "err", err)
+		return
+	}
+	w, err := api.am.Wallet(url.String())
+	if err != nil {
+		log.Warn("wallet unavailable", "url", url)
+		return
+	}
+	if err := w.Open(resp.Text); err != nil {
+		log.Warn("failed to open wallet", "wallet", url, "err", err)
+	}
+}
+
 // startUSBListener starts a listener for USB events, for hardware wallet interaction
 func (api *SignerAPI) startUSBListener() {
 	eventCh := make(chan accounts.WalletEvent, 16)
@@ -331,6 +360,9 @@ func (api *SignerAPI) startUSBListener() {
 			if err == usbwallet.ErrTrezorPINNeeded {
 				go api.openTrezor(wallet.URL())
 			}
+			if err == hdkeystore.ErrPassphraseNeeded {
+				go api.openHDWallet(wallet.URL())
+			}
 		}
 	}
 	go api.derivationLoop(eventCh)
@@ -347,6 +379,9 @@ func (api *SignerAPI) derivationLoop(events chan accounts.WalletEvent) {
 				if err == usbwallet.ErrTrezorPINNeeded {
 					go api.openTrezor(event.Wallet.URL())
 				}
+				if err == hdkeystore.ErrPassphraseNeeded {
+					go api.openHDWallet(event.Wallet.URL())
+				}
 			}
 		case accounts.WalletOpened:
 			status, _ := event.Wallet.Status()
@@ -565,6 +600,11 @@ func (api *SignerAPI) SignTransaction(ctx context.Context, args SendTxArgs, meth
 		Meta:        MetadataFromContext(ctx),
 		Callinfo:    msgs.Messages,
 	}
+	if args.Data != nil {
+		req.AlienTx = DecodeAlienTx(*args.Data)
+	} else if args.Input != nil {
+		req.AlienTx = DecodeAlienTx(*args.Input)
+	}
 	// Process approval
 	result, err = api.UI.ApproveTx(&req)
 	if err != nil {
@@ -141,6 +141,13 @@ func (ui *CommandlineUI) ApproveTx(request *SignTxRequest) (SignTxResponse, erro
 			fmt.Printf("data:     %v\n", hexutil.Encode(d))
 		}
 	}
+	if info := request.AlienTx; info != nil {
+		fmt.Printf("\nAlien custom transaction:\n")
+		fmt.Printf("  %s (%s:%s:%s, %s)\n", info.Description, info.Prefix, info.Version, info.Category, info.Action)
+		for _, f := range info.Fields {
+			fmt.Printf("  %-14s %v\n", f.Name+":", f.Value)
+		}
+	}
 	if request.Callinfo != nil {
 		fmt.Printf("\nTransaction validation:\n")
 		for _, m := range request.Callinfo {
@@ -0,0 +1,349 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/token/common"
+	"github.com/token/core/types"
+	"github.com/token/rlp"
+)
+
+// signHistoryLimit is the number of most recent headers retained per signer.
+// Requests below the oldest retained header are refused, since they can no
+// longer be checked against the history.
+const signHistoryLimit = 1024
+
+// signHistoryVersion is the version of the signing history interchange format.
+const signHistoryVersion = 1
+
+var (
+	// ErrDoubleSign is returned if a header conflicts with one already signed
+	// at the same number or slot.
+	ErrDoubleSign = errors.New("conflicting header already signed")
+
+	// ErrSignHistoryPruned is returned if a header is older than the retained
+	// signing history.
+	ErrSignHistoryPruned = errors.New("header below signing history")
+)
+
+// SignedHeader is a header sealed by a signer. The slot is the header timestamp,
+// which the alien engine aligns to the turn of the signer.
+type SignedHeader struct {
+	Number   uint64      `json:"number"`
+	Slot     uint64      `json:"slot"`
+	SealHash common.Hash `json:"sealHash"`
+}
+
+// signerHistory is the signing history of a single signer.
+type signerHistory struct {
+	MinNumber uint64         `json:"minNumber"` // Lowest number that can still be signed
+	MinSlot   uint64         `json:"minSlot"`   // Lowest slot that can still be signed
+	Headers   []SignedHeader `json:"headers"`   // Signed headers, sorted by number
+}
+
+// conflict returns the signed header the given one conflicts with, if any.
+func (h *signerHistory) conflict(header SignedHeader) (*SignedHeader, error) {
+	if header.Number < h.MinNumber || header.Slot < h.MinSlot {
+		return nil, fmt.Errorf("%w: number %d slot %d, history starts at number %d slot %d", ErrSignHistoryPruned, header.Number, header.Slot, h.MinNumber, h.MinSlot)
+	}
+	for i := range h.Headers {
+		signed := &h.Headers[i]
+		if signed.Number != header.Number && signed.Slot != header.Slot {
+			continue
+		}
+		if signed.Number == header.Number && signed.Slot == header.Slot && signed.SealHash == header.SealHash {
+			return signed, nil
+		}
+		return signed, fmt.Errorf("%w: number %d slot %d, signed %x at number %d slot %d", ErrDoubleSign, header.Number, header.Slot, signed.SealHash, signed.Number, signed.Slot)
+	}
+	return nil, nil
+}
+
+// add inserts a header into the history, pruning the oldest ones beyond the limit.
+func (h *signerHistory) add(header SignedHeader) {
+	h.Headers = append(h.Headers, header)
+	sort.Slice(h.Headers, func(i, j int) bool { return h.Headers[i].Number < h.Headers[j].Number })
+
+	if len(h.Headers) > signHistoryLimit {
+		for _, pruned := range h.Headers[:len(h.Headers)-signHistoryLimit] {
+			if h.MinNumber <= pruned.Number {
+				h.MinNumber = pruned.Number + 1
+			}
+			if h.MinSlot <= pruned.Slot {
+				h.MinSlot = pruned.Slot + 1
+			}
+		}
+		h.Headers = append([]SignedHeader(nil), h.Headers[len(h.Headers)-signHistoryLimit:]...)
+	}
+}
+
+// signHistoryJSON is the persisted and interchange format of the signing history.
+type signHistoryJSON struct {
+	Version uint                              `json:"version"`
+	Signers map[common.Address]*signerHistory `json:"signers"`
+}
+
+// SignHistory is a persistent record of the alien headers sealed by every signer,
+// used to refuse sealing two distinct headers at the same number or slot.
+type SignHistory struct {
+	path    string // File the history is persisted to, in memory only if empty
+	signers map[common.Address]*signerHistory
+	lock    sync.Mutex
+}
+
+// NewSignHistory opens the signing history persisted at the given path, creating
+// an empty one if the file does not exist yet. An empty path keeps the history
+// in memory only.
+func NewSignHistory(path string) (*SignHistory, error) {
+	h := &SignHistory{
+		path:    path,
+		signers: make(map[common.Address]*signerHistory),
+	}
+	if path == "" {
+		return h, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	signers, err := decodeSignHistory(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing history %s: %v", path, err)
+	}
+	h.signers = signers
+	return h, nil
+}
+
+// decodeSignHistory reads a signing history in the interchange format.
+func decodeSignHistory(r io.Reader) (map[common.Address]*signerHistory, error) {
+	var enc signHistoryJSON
+	if err := json.NewDecoder(r).Decode(&enc); err != nil {
+		return nil, err
+	}
+	if enc.Version != signHistoryVersion {
+		return nil, fmt.Errorf("unsupported version %d", enc.Version)
+	}
+	if enc.Signers == nil {
+		enc.Signers = make(map[common.Address]*signerHistory)
+	}
+	for signer, hist := range enc.Signers {
+		if hist == nil {
+			return nil, fmt.Errorf("missing history for signer %s", signer.Hex())
+		}
+		sort.Slice(hist.Headers, func(i, j int) bool { return hist.Headers[i].Number < hist.Headers[j].Number })
+	}
+	return enc.Signers, nil
+}
+
+// Record checks that the header sealed by the signer does not conflict with the
+// history, and persists it before the seal is produced. Recording the same
+// header twice is allowed.
+func (h *SignHistory) Record(signer common.Address, header SignedHeader) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	hist := h.signers[signer]
+	if hist == nil {
+		hist = new(signerHistory)
+	}
+	signed, err := hist.conflict(header)
+	if err != nil {
+		return err
+	}
+	if signed != nil {
+		return nil
+	}
+	prev := *hist
+	prev.Headers = append([]SignedHeader(nil), hist.Headers...)
+
+	hist.add(header)
+	h.signers[signer] = hist
+	if err := h.flush(); err != nil {
+		// Roll back, the seal must not be produced without being persisted
+		if len(prev.Headers) == 0 && prev.MinNumber == 0 && prev.MinSlot == 0 {
+			delete(h.signers, signer)
+		} else {
+			*hist = prev
+		}
+		return err
+	}
+	return nil
+}
+
+// Signed returns the headers in the history sealed by the signer.
+func (h *SignHistory) Signed(signer common.Address) []SignedHeader {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	hist := h.signers[signer]
+	if hist == nil {
+		return nil
+	}
+	return append([]SignedHeader(nil), hist.Headers...)
+}
+
+// Export writes the whole signing history in the interchange format.
+func (h *SignHistory) Export(w io.Writer) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&signHistoryJSON{Version: signHistoryVersion, Signers: h.signers})
+}
+
+// Import merges a signing history in the interchange format, as exported by the
+// signer a validator migrates from. Nothing is imported if any header conflicts
+// with the local history.
+func (h *SignHistory) Import(r io.Reader) (int, error) {
+	signers, err := decodeSignHistory(r)
+	if err != nil {
+		return 0, err
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	// Check the whole history before merging anything
+	for signer, imported := range signers {
+		hist := h.signers[signer]
+		if hist == nil {
+			continue
+		}
+		for _, header := range imported.Headers {
+			if _, err := (&signerHistory{Headers: hist.Headers}).conflict(header); err != nil {
+				return 0, fmt.Errorf("signer %s: %w", signer.Hex(), err)
+			}
+		}
+	}
+	merged := make(map[common.Address]*signerHistory, len(h.signers))
+	for signer, hist := range h.signers {
+		cpy := *hist
+		cpy.Headers = append([]SignedHeader(nil), hist.Headers...)
+		merged[signer] = &cpy
+	}
+	var count int
+	for signer, imported := range signers {
+		hist := merged[signer]
+		if hist == nil {
+			hist = new(signerHistory)
+			merged[signer] = hist
+		}
+		// Keep the most conservative watermarks of both histories
+		if hist.MinNumber < imported.MinNumber {
+			hist.MinNumber = imported.MinNumber
+		}
+		if hist.MinSlot < imported.MinSlot {
+			hist.MinSlot = imported.MinSlot
+		}
+		for _, header := range imported.Headers {
+			if signed, _ := (&signerHistory{Headers: hist.Headers}).conflict(header); signed != nil {
+				continue
+			}
+			hist.add(header)
+			count++
+		}
+	}
+	prev := h.signers
+	h.signers = merged
+	if err := h.flush(); err != nil {
+		h.signers = prev
+		return 0, err
+	}
+	return count, nil
+}
+
+// flush persists the history, replacing the previous file atomically.
+func (h *SignHistory) flush() error {
+	if h.path == "" {
+		return nil
+	}
+	blob, err := json.Marshal(&signHistoryJSON{Version: signHistoryVersion, Signers: h.signers})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(h.path), filepath.Base(h.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(blob); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), h.path)
+}
+
+// alienSigHeader is the part of an alien header covered by its seal, as encoded
+// by alien.AlienRLP.
+type alienSigHeader struct {
+	ParentHash  common.Hash
+	UncleHash   common.Hash
+	Coinbase    common.Address
+	Root        common.Hash
+	TxHash      common.Hash
+	ReceiptHash common.Hash
+	Bloom       types.Bloom
+	Difficulty  *big.Int
+	Number      *big.Int
+	GasLimit    uint64
+	GasUsed     uint64
+	Time        uint64
+	Extra       []byte
+	MixDigest   common.Hash
+	Nonce       types.BlockNonce
+	BaseFee     *big.Int `rlp:"optional"`
+}
+
+// decodeAlienHeader decodes the sealed part of an alien header.
+func decodeAlienHeader(data []byte) (*alienSigHeader, error) {
+	header := new(alienSigHeader)
+	if err := rlp.DecodeBytes(data, header); err != nil {
+		return nil, err
+	}
+	if header.Number == nil || !header.Number.IsUint64() {
+		return nil, errors.New("invalid alien header number")
+	}
+	return header, nil
+}
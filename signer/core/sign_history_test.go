@@ -0,0 +1,166 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/token/common"
+	"github.com/token/crypto"
+	"github.com/token/rlp"
+)
+
+func signedHeader(number, slot uint64, seed byte) SignedHeader {
+	return SignedHeader{Number: number, Slot: slot, SealHash: common.Hash{seed}}
+}
+
+// Tests that the signing history refuses distinct headers at the same number or
+// slot, and that it survives a restart.
+func TestSignHistoryRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signhistory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		path   = filepath.Join(dir, "history.json")
+		signer = common.Address{0x01}
+		other  = common.Address{0x02}
+	)
+	history, err := NewSignHistory(path)
+	if err != nil {
+		t.Fatalf("failed to open history: %v", err)
+	}
+	if err := history.Record(signer, signedHeader(10, 100, 1)); err != nil {
+		t.Fatalf("failed to record header: %v", err)
+	}
+	if err := history.Record(signer, signedHeader(10, 100, 1)); err != nil {
+		t.Fatalf("failed to record the same header again: %v", err)
+	}
+	if err := history.Record(other, signedHeader(10, 100, 2)); err != nil {
+		t.Fatalf("failed to record header of another signer: %v", err)
+	}
+	// Reopen the history and ensure conflicts are still caught
+	if history, err = NewSignHistory(path); err != nil {
+		t.Fatalf("failed to reopen history: %v", err)
+	}
+	if err := history.Record(signer, signedHeader(10, 110, 2)); !errors.Is(err, ErrDoubleSign) {
+		t.Fatalf("same number: error mismatch: have %v, want %v", err, ErrDoubleSign)
+	}
+	if err := history.Record(signer, signedHeader(11, 100, 2)); !errors.Is(err, ErrDoubleSign) {
+		t.Fatalf("same slot: error mismatch: have %v, want %v", err, ErrDoubleSign)
+	}
+	if err := history.Record(signer, signedHeader(11, 110, 2)); err != nil {
+		t.Fatalf("failed to record next header: %v", err)
+	}
+	if have := len(history.Signed(signer)); have != 2 {
+		t.Fatalf("signed header count mismatch: have %d, want 2", have)
+	}
+}
+
+// Tests that headers older than the retained history are refused.
+func TestSignHistoryPrune(t *testing.T) {
+	history, _ := NewSignHistory("")
+	signer := common.Address{0x01}
+
+	for i := uint64(1); i <= signHistoryLimit+10; i++ {
+		if err := history.Record(signer, signedHeader(i, i*10, 1)); err != nil {
+			t.Fatalf("header %d: failed to record: %v", i, err)
+		}
+	}
+	if have := len(history.Signed(signer)); have != signHistoryLimit {
+		t.Fatalf("retained header count mismatch: have %d, want %d", have, signHistoryLimit)
+	}
+	if err := history.Record(signer, signedHeader(5, 55, 1)); !errors.Is(err, ErrSignHistoryPruned) {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrSignHistoryPruned)
+	}
+}
+
+// Tests that the history of a migrated validator can be exported and imported.
+func TestSignHistoryExportImport(t *testing.T) {
+	var (
+		signer = common.Address{0x01}
+		source = common.Address{0x02}
+	)
+	old, _ := NewSignHistory("")
+	old.Record(signer, signedHeader(10, 100, 1))
+	old.Record(signer, signedHeader(11, 110, 1))
+	old.Record(source, signedHeader(10, 100, 3))
+
+	var exported bytes.Buffer
+	if err := old.Export(&exported); err != nil {
+		t.Fatalf("failed to export history: %v", err)
+	}
+	// Importing a history conflicting with the local one must fail entirely
+	conflicting, _ := NewSignHistory("")
+	conflicting.Record(signer, signedHeader(11, 110, 2))
+	if _, err := conflicting.Import(bytes.NewReader(exported.Bytes())); !errors.Is(err, ErrDoubleSign) {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrDoubleSign)
+	}
+	if have := len(conflicting.Signed(source)); have != 0 {
+		t.Fatalf("conflicting import partially applied: %d headers", have)
+	}
+	// Importing into a compatible history merges both
+	local, _ := NewSignHistory("")
+	local.Record(signer, signedHeader(11, 110, 1))
+	local.Record(signer, signedHeader(12, 120, 1))
+
+	count, err := local.Import(bytes.NewReader(exported.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to import history: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("imported header count mismatch: have %d, want 2", count)
+	}
+	if have := len(local.Signed(signer)); have != 3 {
+		t.Fatalf("merged header count mismatch: have %d, want 3", have)
+	}
+	if err := local.Record(signer, signedHeader(10, 105, 2)); !errors.Is(err, ErrDoubleSign) {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrDoubleSign)
+	}
+}
+
+// Tests that the number and slot of an alien header are decoded from its sealing
+// encoding.
+func TestDecodeAlienHeader(t *testing.T) {
+	enc := []interface{}{
+		common.Hash{}, common.Hash{}, common.Address{}, common.Hash{}, common.Hash{}, common.Hash{},
+		[256]byte{}, big.NewInt(1), big.NewInt(1337), uint64(1338), uint64(1338), uint64(1500),
+		make([]byte, 32), common.Hash{}, [8]byte{},
+	}
+	blob, err := rlp.EncodeToBytes(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := decodeAlienHeader(blob)
+	if err != nil {
+		t.Fatalf("failed to decode header: %v", err)
+	}
+	if header.Number.Uint64() != 1337 || header.Time != 1500 {
+		t.Fatalf("header mismatch: number %d time %d", header.Number, header.Time)
+	}
+	if _, err := decodeAlienHeader(crypto.Keccak256(blob)); err == nil {
+		t.Fatalf("invalid header decoded")
+	}
+}
@@ -58,6 +58,10 @@ var (
 		accounts.MimetypeClique,
 		0x02,
 	}
+	ApplicationAlien = SigFormat{
+		accounts.MimetypeAlien,
+		0x02,
+	}
 	TextPlain = SigFormat{
 		accounts.MimetypeTextPlain,
 		0x45,
@@ -147,6 +151,22 @@ func (api *SignerAPI) sign(req *SignDataRequest, legacyV bool) (hexutil.Bytes, e
 	if err != nil {
 		return nil, err
 	}
+	// Alien headers must be recorded before sealing, to never seal two distinct
+	// headers at the same number or slot
+	if req.ContentType == ApplicationAlien.Mime && api.history != nil {
+		header, err := decodeAlienHeader(req.Rawdata)
+		if err != nil {
+			return nil, err
+		}
+		signed := SignedHeader{
+			Number:   header.Number.Uint64(),
+			Slot:     header.Time,
+			SealHash: common.BytesToHash(req.Hash),
+		}
+		if err := api.history.Record(account.Address, signed); err != nil {
+			return nil, err
+		}
+	}
 	// Sign the data with the wallet
 	signature, err := wallet.SignDataWithPassphrase(account, pw, req.ContentType, req.Rawdata)
 	if err != nil {
@@ -258,6 +278,31 @@ func (api *SignerAPI) determineSignatureFormat(ctx context.Context, contentType
 		// Clique uses V on the form 0 or 1
 		usenbnV = false
 		req = &SignDataRequest{ContentType: mediaType, Rawdata: cliqueRlp, Messages: messages, Hash: sighash}
+	case ApplicationAlien.Mime:
+		// Alien headers are sent to us already encoded for sealing
+		stringData, ok := data.(string)
+		if !ok {
+			return nil, usenbnV, fmt.Errorf("input for %v must be an hex-encoded string", ApplicationAlien.Mime)
+		}
+		alienRlp, err := hexutil.Decode(stringData)
+		if err != nil {
+			return nil, usenbnV, err
+		}
+		header, err := decodeAlienHeader(alienRlp)
+		if err != nil {
+			return nil, usenbnV, err
+		}
+		sighash := crypto.Keccak256(alienRlp)
+		messages := []*NameValueType{
+			{
+				Name:  "Alien header",
+				Typ:   "alien",
+				Value: fmt.Sprintf("alien header %d at %d [0x%x]", header.Number, header.Time, sighash),
+			},
+		}
+		// Alien uses V on the form 0 or 1
+		usenbnV = false
+		req = &SignDataRequest{ContentType: mediaType, Rawdata: alienRlp, Messages: messages, Hash: sighash}
 	default: // also case TextPlain.Mime:
 		// Calculates an nbn ECDSA signature for:
 		// hash = keccak256("\x19${byteVersion}nbn Signed Message:\n${message length}${message}")
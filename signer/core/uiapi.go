@@ -25,6 +25,7 @@ import (
 	"math/big"
 
 	"github.com/token/accounts"
+	"github.com/token/accounts/hdkeystore"
 	"github.com/token/accounts/keystore"
 	"github.com/token/common"
 	"github.com/token/common/math"
@@ -130,6 +131,60 @@ func (s *UIServerAPI) ImportRawKey(privkey string, password string) (accounts.Ac
 	return fetchKeystore(s.am).ImportECDSA(key, password)
 }
 
+// fetchHDKeystore retrieves the HD keystore from the account manager.
+func fetchHDKeystore(am *accounts.Manager) (*hdkeystore.KeyStore, error) {
+	be := am.Backends(hdkeystore.KeyStoreType)
+	if len(be) == 0 {
+		return nil, errors.New("mnemonic based wallets not supported")
+	}
+	return be[0].(*hdkeystore.KeyStore), nil
+}
+
+// hdWallet is a newly created HD wallet, along with the mnemonic to back up.
+type hdWallet struct {
+	URL      string           `json:"url"`
+	Account  accounts.Account `json:"account"`
+	Mnemonic string           `json:"mnemonic"`
+}
+
+// NewHDWallet generates a new BIP-39 mnemonic, stores it into the key directory
+// encrypted with the passphrase and returns it with the first derived account.
+// Example call
+// {"jsonrpc":"2.0","method":"clef_newHDWallet","params":["test"], "id":6}
+func (s *UIServerAPI) NewHDWallet(password string) (hdWallet, error) {
+	if err := ValidatePasswordFormat(password); err != nil {
+		return hdWallet{}, fmt.Errorf("password requirements not met: %v", err)
+	}
+	ks, err := fetchHDKeystore(s.am)
+	if err != nil {
+		return hdWallet{}, err
+	}
+	wallet, mnemonic, err := ks.NewWallet(password)
+	if err != nil {
+		return hdWallet{}, err
+	}
+	return hdWallet{URL: wallet.URL().String(), Account: wallet.Accounts()[0], Mnemonic: mnemonic}, nil
+}
+
+// ImportMnemonic stores the given BIP-39 mnemonic into the key directory,
+// encrypting it with the passphrase, and returns the first derived account.
+// Example call
+// {"jsonrpc":"2.0","method":"clef_importMnemonic","params":["abandon abandon ... about","test"], "id":6}
+func (s *UIServerAPI) ImportMnemonic(mnemonic string, password string) (accounts.Account, error) {
+	if err := ValidatePasswordFormat(password); err != nil {
+		return accounts.Account{}, fmt.Errorf("password requirements not met: %v", err)
+	}
+	ks, err := fetchHDKeystore(s.am)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	wallet, err := ks.ImportMnemonic(mnemonic, password)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	return wallet.Accounts()[0], nil
+}
+
 // OpenWallet initiates a hardware wallet opening procedure, establishing a USB
 // connection and attempting to authenticate via the provided passphrase. Note,
 // the method may return an extra challenge requiring a second open (e.g. the
@@ -95,6 +95,11 @@ func (db *Database) ValidateCallData(selector *string, data []byte, messages *co
 	if len(data) == 0 {
 		return
 	}
+	// Alien custom transactions are plain text, not ABI encoded
+	if info := core.DecodeAlienTx(data); info != nil {
+		messages.Info(fmt.Sprintf("Transaction is an alien custom transaction: %v", info))
+		return
+	}
 	// Validate the call data that it has the 4byte prefix and the rest divisible by 32 bytes
 	if len(data) < 4 {
 		messages.Warn("Transaction data is not valid ABI (missing the 4 byte call prefix)")
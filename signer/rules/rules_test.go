@@ -194,6 +194,51 @@ func TestSignTxRequest(t *testing.T) {
 	}
 }
 
+func TestSignAlienTxRequest(t *testing.T) {
+	js := `
+	function ApproveTx(r){
+		if(!r.alien_tx){ return }
+		if(r.alien_tx.action == "pof-report"){ return "Approve" }
+		if(r.alien_tx.action == "pof-exit" && r.alien_tx.fields[0].name == "miner"){ return "Reject" }
+	}`
+	from, err := mixAddr("0000000000000000000000000000000000001337")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		data     string
+		approved bool
+		manual   bool
+	}{
+		{"token:1:pofrpten:0:report", true, false},
+		{"token:1:pofExit:0x000000000000000000000000000000000000dead", false, false},
+		{"ufo:1:event:vote", false, true},
+		{"", false, true},
+	}
+	for i, tt := range tests {
+		ui := &dummyUI{}
+		r, err := NewRuleEvaluator(ui, storage.NewEphemeralStorage())
+		if err != nil {
+			t.Fatalf("failed to create js engine: %v", err)
+		}
+		if err := r.Init(js); err != nil {
+			t.Fatalf("failed to load js: %v", err)
+		}
+		data := hexutil.Bytes(tt.data)
+		resp, _ := r.ApproveTx(&core.SignTxRequest{
+			Transaction: core.SendTxArgs{From: *from, To: from, Data: &data},
+			AlienTx:     core.DecodeAlienTx(data),
+			Meta:        core.Metadata{Remote: "remoteip", Local: "localip", Scheme: "inproc"},
+		})
+		if resp.Approved != tt.approved {
+			t.Errorf("test %d: approval mismatch: have %v, want %v", i, resp.Approved, tt.approved)
+		}
+		if manual := len(ui.calls) > 0; manual != tt.manual {
+			t.Errorf("test %d: manual processing mismatch: have %v, want %v", i, manual, tt.manual)
+		}
+	}
+}
+
 type dummyUI struct {
 	calls []string
 }
@@ -0,0 +1,108 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// NewOTLPExporter creates an exporter posting spans over OTLP/HTTP to a collector.
+// If the endpoint has no path, the default /v1/traces one is used.
+func NewOTLPExporter(endpoint string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid OTLP endpoint scheme %q", u.Scheme)
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	if path := strings.TrimSuffix(u.Path, "/"); path != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	return otlptrace.New(context.Background(), otlptracehttp.NewClient(opts...))
+}
+
+// NewWriterExporter creates an exporter writing each batch of spans into the
+// writer, as a line of OTLP export request in the protobuf JSON mapping.
+func NewWriterExporter(out io.Writer) sdktrace.SpanExporter {
+	exporter, _ := otlptrace.New(context.Background(), &fileClient{out: out, close: func() error { return nil }})
+	return exporter
+}
+
+// NewFileExporter creates an exporter appending each batch of spans as a line of
+// JSON to the file, or writing them to the standard output if the path is
+// "stdout".
+func NewFileExporter(path string) (sdktrace.SpanExporter, error) {
+	if path == "stdout" {
+		return NewWriterExporter(os.Stdout), nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return otlptrace.New(context.Background(), &fileClient{out: file, close: file.Close})
+}
+
+// fileClient is an OTLP transport writing the export requests into a local
+// writer instead of sending them to a collector.
+type fileClient struct {
+	out   io.Writer
+	close func() error
+	lock  sync.Mutex
+}
+
+// Start implements otlptrace.Client, there's no connection to establish.
+func (c *fileClient) Start(ctx context.Context) error { return nil }
+
+// Stop implements otlptrace.Client, closing the output.
+func (c *fileClient) Stop(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.close()
+}
+
+// UploadTraces implements otlptrace.Client, writing the export request as a line
+// of JSON.
+func (c *fileClient) UploadTraces(ctx context.Context, spans []*tracepb.ResourceSpans) error {
+	blob, err := protojson.Marshal(&coltracepb.ExportTraceServiceRequest{ResourceSpans: spans})
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, err = c.out.Write(append(blob, '\n'))
+	return err
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package tracing wires the node's hot paths into OpenTelemetry, exporting spans
+// over OTLP/HTTP or into a local file.
+//
+// Tracing is disabled by default, in which case spans come from a no-op tracer,
+// so instrumented code doesn't need to check.
+package tracing
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/token/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// scopeName is the instrumentation scope of all the spans of the node.
+const scopeName = "github.com/token/tracing"
+
+// shutdownTimeout is the maximum time allowed for exporting the spans still
+// queued when tracing is stopped.
+const shutdownTimeout = 10 * time.Second
+
+var (
+	provider   *sdktrace.TracerProvider // Active span pipeline, nil if tracing is disabled
+	providerMu sync.Mutex               // Serializes enabling and stopping tracing
+
+	tracer atomic.Value // tracerRef to the active provider's tracer, no-op if disabled
+)
+
+// tracerRef wraps the active tracer, as atomic.Value requires a consistent type.
+type tracerRef struct{ trace.Tracer }
+
+func init() {
+	tracer.Store(tracerRef{trace.NewNoopTracerProvider().Tracer(scopeName)})
+}
+
+// Enable starts collecting spans and exporting them in batches through the
+// exporter, with the given service name attached. Any previously enabled
+// exporter is shut down.
+func Enable(exporter sdktrace.SpanExporter, service string) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+
+	stop()
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(sdkresource.NewSchemaless(semconv.ServiceNameKey.String(service))),
+	)
+	tracer.Store(tracerRef{provider.Tracer(scopeName)})
+}
+
+// Enabled reports whether spans are currently collected.
+func Enabled() bool {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+
+	return provider != nil
+}
+
+// Flush blocks until all spans ended so far have been handed to the exporter.
+func Flush() {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+
+	if provider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := provider.ForceFlush(ctx); err != nil {
+			log.Warn("Failed to flush spans", "err", err)
+		}
+	}
+}
+
+// Stop disables tracing, exporting the spans still queued and shutting down the
+// exporter.
+func Stop() {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+
+	stop()
+}
+
+// stop disables the active provider, if any. The caller must hold providerMu.
+func stop() {
+	if provider == nil {
+		return
+	}
+	tracer.Store(tracerRef{trace.NewNoopTracerProvider().Tracer(scopeName)})
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := provider.Shutdown(ctx); err != nil {
+		log.Warn("Failed to shut down span exporter", "err", err)
+	}
+	provider = nil
+}
+
+// Start creates a span for an operation internal to the node, as a child of the
+// span carried by the context, if any. The returned context carries the new span
+// for its children. The span must be ended by the caller.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Load().(tracerRef).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartServer creates a span for handling a request of a remote client, as a
+// child of the span carried by the context, if any. Unsampled remote parents
+// suppress the span.
+func StartServer(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Load().(tracerRef).Start(ctx, name, trace.WithAttributes(attrs...), trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// Uint64 creates an integer attribute. Values beyond the int64 range wrap, as
+// OpenTelemetry doesn't support unsigned integers.
+func Uint64(key string, value uint64) attribute.KeyValue {
+	return attribute.Int64(key, int64(value))
+}
+
+// SetError records the error on the span and marks it as failed, if the error
+// is non-nil.
+func SetError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
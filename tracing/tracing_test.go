@@ -0,0 +1,194 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Tests that spans are no-ops while tracing is disabled.
+func TestDisabled(t *testing.T) {
+	ctx, span := Start(context.Background(), "test")
+	if span.IsRecording() || span.SpanContext().IsValid() {
+		t.Fatal("span recorded while tracing is disabled")
+	}
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		t.Fatal("span context set while tracing is disabled")
+	}
+	span.SetAttributes(attribute.String("key", "value"))
+	SetError(span, errors.New("failure"))
+	span.End()
+}
+
+// Tests that child spans join the trace of their parent and that ended spans are
+// exported with their attributes and status.
+func TestSpanHierarchy(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	Enable(exporter, "test")
+	defer Stop()
+
+	ctx, root := StartServer(context.Background(), "root", attribute.String("key", "value"))
+	_, child := Start(ctx, "child")
+	SetError(child, nil)
+	SetError(child, errors.New("failure"))
+	child.End()
+	root.End()
+	Flush()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("exported span count mismatch: have %d, want 2", len(spans))
+	}
+	have, want := spans[0], spans[1]
+	if have.Name != "child" || want.Name != "root" {
+		t.Fatalf("span order mismatch: have %s, %s", have.Name, want.Name)
+	}
+	if have.SpanContext.TraceID() != want.SpanContext.TraceID() {
+		t.Errorf("child trace mismatch: have %s, want %s", have.SpanContext.TraceID(), want.SpanContext.TraceID())
+	}
+	if have.Parent.SpanID() != want.SpanContext.SpanID() {
+		t.Errorf("child parent mismatch: have %s, want %s", have.Parent.SpanID(), want.SpanContext.SpanID())
+	}
+	if have.Status.Code != codes.Error || have.Status.Description != "failure" || len(have.Events) != 1 {
+		t.Errorf("child status mismatch: have %v %q", have.Status.Code, have.Status.Description)
+	}
+	if want.SpanKind != trace.SpanKindServer || want.Parent.IsValid() || len(want.Attributes) != 1 {
+		t.Errorf("root span mismatch: %+v", want)
+	}
+}
+
+// Tests that span contexts round trip through the traceparent header, and that
+// unsampled remote parents suppress their children.
+func TestPropagation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	Enable(exporter, "test")
+	defer Stop()
+
+	ctx, span := Start(context.Background(), "client")
+	header := make(http.Header)
+	Inject(ctx, header)
+	span.End()
+
+	remote := trace.SpanContextFromContext(Extract(context.Background(), header))
+	if !remote.IsRemote() || remote.TraceID() != span.SpanContext().TraceID() || remote.SpanID() != span.SpanContext().SpanID() || !remote.IsSampled() {
+		t.Fatalf("propagated span context mismatch: have %+v, want %+v", remote, span.SpanContext())
+	}
+	header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+	if _, span := StartServer(Extract(context.Background(), header), "unsampled"); span.IsRecording() {
+		t.Fatal("span recorded for unsampled remote parent")
+	}
+	header.Set("traceparent", "00-00000000000000000000000000000000-b7ad6b7169203331-01")
+	if sc := trace.SpanContextFromContext(Extract(context.Background(), header)); sc.IsValid() {
+		t.Errorf("invalid traceparent accepted: %+v", sc)
+	}
+	Flush()
+	if spans := exporter.GetSpans(); len(spans) != 1 {
+		t.Errorf("exported span count mismatch: have %d, want 1", len(spans))
+	}
+}
+
+// Tests that the OTLP exporter posts spans to the collector's traces endpoint,
+// and that the writer exporter produces the same export request.
+func TestOTLPExport(t *testing.T) {
+	var (
+		lock   sync.Mutex
+		bodies [][]byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+
+		lock.Lock()
+		bodies = append(bodies, body)
+		lock.Unlock()
+	}))
+	defer srv.Close()
+
+	otlp, err := NewOTLPExporter(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to create exporter: %v", err)
+	}
+	var out bytes.Buffer
+	Enable(otlp, "nbn")
+	_, span := Start(context.Background(), "test", Uint64("number", 1), attribute.Bool("flag", true))
+	span.End()
+	Stop()
+
+	Enable(NewWriterExporter(&out), "nbn")
+	_, span = Start(context.Background(), "test", Uint64("number", 1), attribute.Bool("flag", true))
+	span.End()
+	Stop()
+
+	if len(bodies) != 1 {
+		t.Fatalf("collector request count mismatch: have %d, want 1", len(bodies))
+	}
+	var posted coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(bodies[0], &posted); err != nil {
+		t.Fatalf("failed to decode collector request: %v", err)
+	}
+	var written coltracepb.ExportTraceServiceRequest
+	scanner := bufio.NewScanner(&out)
+	if !scanner.Scan() {
+		t.Fatal("no spans written")
+	}
+	if err := protojson.Unmarshal(scanner.Bytes(), &written); err != nil {
+		t.Fatalf("failed to decode written request: %v", err)
+	}
+	for i, req := range []*coltracepb.ExportTraceServiceRequest{&posted, &written} {
+		if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+			t.Fatalf("request %d: layout mismatch: %v", i, req)
+		}
+		var service string
+		for _, attr := range req.ResourceSpans[0].Resource.Attributes {
+			if attr.Key == "service.name" {
+				service = attr.Value.GetStringValue()
+			}
+		}
+		if service != "nbn" {
+			t.Errorf("request %d: service name mismatch: have %q, want %q", i, service, "nbn")
+		}
+		scope := req.ResourceSpans[0].ScopeSpans[0]
+		if scope.Scope.Name != scopeName || len(scope.Spans) != 1 || scope.Spans[0].Name != "test" {
+			t.Fatalf("request %d: exported span mismatch: %v", i, scope)
+		}
+		if attr := scope.Spans[0].Attributes[0]; attr.Key != "number" || attr.Value.GetIntValue() != 1 {
+			t.Errorf("request %d: integer attribute mismatch: %v", i, attr)
+		}
+	}
+	if id := span.SpanContext().TraceID(); !bytes.Equal(written.ResourceSpans[0].ScopeSpans[0].Spans[0].TraceId, id[:]) {
+		t.Errorf("written trace mismatch: have %x, want %s", written.ResourceSpans[0].ScopeSpans[0].Spans[0].TraceId, id)
+	}
+}
@@ -88,6 +88,11 @@ type Database struct {
 	childrenSize  common.StorageSize // Storage size of the external children tracking
 	preimagesSize common.StorageSize // Storage size of the preimages cache
 
+	path *pathDB // Path-based node storage, nil for the hash-based scheme
+
+	writeHook func(hash common.Hash) // Callback invoked before a node is flushed to disk
+	hookLock  sync.RWMutex           // Lock protecting the write hook
+
 	lock sync.RWMutex
 }
 
@@ -277,6 +282,9 @@ type Config struct {
 	Cache     int    // Memory allowance (MB) to use for caching trie nodes in memory
 	Journal   string // Journal of clean cache to survive node restarts
 	Preimages bool   // Flag whether the preimage of trie key is recorded
+
+	Scheme       string // Scheme of the persisted trie nodes, hash-based if empty
+	StateHistory uint64 // Number of recent states the path-based scheme can be rolled back to
 }
 
 // NewDatabase creates a new trie database to store ephemeral trie content before
@@ -308,9 +316,20 @@ func NewDatabaseWithConfig(diskdb ethdb.KeyValueStore, config *Config) *Database
 	if config == nil || config.Preimages { // TODO(karalabe): Flip to default off in the future
 		db.preimages = make(map[common.Hash][]byte)
 	}
+	if config != nil && config.Scheme == rawdb.PathScheme {
+		db.path = newPathDB(diskdb, cleans, config.StateHistory)
+	}
 	return db
 }
 
+// Scheme returns the scheme of the persisted trie nodes.
+func (db *Database) Scheme() string {
+	if db.path != nil {
+		return rawdb.PathScheme
+	}
+	return rawdb.HashScheme
+}
+
 // DiskDB retrieves the persistent storage backing the trie database.
 func (db *Database) DiskDB() ethdb.KeyValueStore {
 	return db.diskdb
@@ -404,12 +423,21 @@ func (db *Database) node(hash common.Hash) node {
 }
 
 // Node retrieves an encoded cached trie node from memory. If it cannot be found
-// cached, the method queries the persistent database for the content.
+// cached, the method queries the persistent database for the content. Under the
+// path-based scheme only the in-memory layers can be queried by hash, ErrHashLookup
+// is returned for the persisted nodes.
 func (db *Database) Node(hash common.Hash) ([]byte, error) {
 	// It doesn't make sense to retrieve the metaroot
 	if hash == (common.Hash{}) {
 		return nil, errors.New("not found")
 	}
+	// Persisted path-based nodes can't be looked up by hash
+	if db.path != nil {
+		if blob := db.path.dirtyNode(hash); blob != nil {
+			return blob, nil
+		}
+		return nil, ErrHashLookup
+	}
 	// Retrieve the node from the clean cache if available
 	if db.cleans != nil {
 		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
@@ -443,6 +471,18 @@ func (db *Database) Node(hash common.Hash) ([]byte, error) {
 	return nil, errors.New("not found")
 }
 
+// nodeBlob retrieves an encoded trie node by hash, or by owner and path under
+// the path-based scheme.
+func (db *Database) nodeBlob(owner common.Hash, path []byte, hash common.Hash) ([]byte, error) {
+	if db.path == nil {
+		return db.Node(hash)
+	}
+	if blob := db.path.node(owner, path, hash); blob != nil {
+		return blob, nil
+	}
+	return nil, errors.New("not found")
+}
+
 // preimage retrieves a cached trie node pre-image from memory. If it cannot be
 // found cached, the method queries the persistent database for the content.
 func (db *Database) preimage(hash common.Hash) []byte {
@@ -624,6 +664,7 @@ func (db *Database) Cap(limit common.StorageSize) error {
 	for size > limit && oldest != (common.Hash{}) {
 		// Fetch the oldest referenced node and push into the batch
 		node := db.dirties[oldest]
+		db.noteWrite(oldest)
 		rawdb.WriteTrieNode(batch, oldest, node.rlp())
 
 		// If we exceeded the ideal batch size, commit and reset
@@ -693,6 +734,9 @@ func (db *Database) Cap(limit common.StorageSize) error {
 // Note, this method is a non-synchronized mutator. It is unsafe to call this
 // concurrently with other mutators.
 func (db *Database) Commit(node common.Hash, report bool, callback func(common.Hash)) error {
+	if db.path != nil {
+		return db.commitLayers(node, report)
+	}
 	// Create a database batch to flush persistent data out. It is important that
 	// outside code doesn't see an inconsistent state (referenced data removed from
 	// memory cache during commit but not yet in persistent storage). This is ensured
@@ -769,6 +813,7 @@ func (db *Database) commit(hash common.Hash, batch ethdb.Batch, uncacher *cleane
 		return err
 	}
 	// If we've reached an optimal batch size, commit and start over
+	db.noteWrite(hash)
 	rawdb.WriteTrieNode(batch, hash, node.rlp())
 	if callback != nil {
 		callback(hash)
@@ -785,6 +830,25 @@ func (db *Database) commit(hash common.Hash, batch ethdb.Batch, uncacher *cleane
 	return nil
 }
 
+// SetWriteHook installs a callback invoked with the hash of every node about to
+// be flushed to disk, before the write happens. A nil hook removes it.
+func (db *Database) SetWriteHook(hook func(hash common.Hash)) {
+	db.hookLock.Lock()
+	defer db.hookLock.Unlock()
+
+	db.writeHook = hook
+}
+
+// noteWrite notifies the write hook, if any, of a node about to be flushed.
+func (db *Database) noteWrite(hash common.Hash) {
+	db.hookLock.RLock()
+	defer db.hookLock.RUnlock()
+
+	if db.writeHook != nil {
+		db.writeHook(hash)
+	}
+}
+
 // cleaner is a database batch replayer that takes a batch of write operations
 // and cleans up the trie database from anything written to disk.
 type cleaner struct {
@@ -837,6 +901,12 @@ func (c *cleaner) Delete(key []byte) error {
 // Size returns the current storage size of the memory cache in front of the
 // persistent database layer.
 func (db *Database) Size() (common.StorageSize, common.StorageSize) {
+	if db.path != nil {
+		db.lock.RLock()
+		defer db.lock.RUnlock()
+
+		return db.path.memory(), db.preimagesSize
+	}
 	db.lock.RLock()
 	defer db.lock.RUnlock()
 
@@ -17,19 +17,28 @@
 package trie
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/token/common"
 )
 
+// ErrHashLookup is returned when a persisted trie node is looked up by hash
+// alone, which the path-based scheme can't serve since it stores nodes by path.
+var ErrHashLookup = errors.New("trie node lookup by hash not supported by the path scheme")
+
 // MissingNodeError is returned by the trie functions (TryGet, TryUpdate, TryDelete)
 // in the case where a trie node is not present in the local database. It contains
 // information necessary for retrieving the missing node.
 type MissingNodeError struct {
+	Owner    common.Hash // owner of the trie, only set for the path-based scheme
 	NodeHash common.Hash // hash of the missing node
 	Path     []byte      // hex-encoded path to the missing node
 }
 
 func (err *MissingNodeError) Error() string {
+	if err.Owner != (common.Hash{}) {
+		return fmt.Sprintf("missing trie node %x (owner %x) (path %x)", err.NodeHash, err.Owner, err.Path)
+	}
 	return fmt.Sprintf("missing trie node %x (path %x)", err.NodeHash, err.Path)
 }
@@ -0,0 +1,112 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"fmt"
+
+	"github.com/token/common"
+)
+
+// memoryNode is a trie node modified by a commit, along with its hash. Deleted
+// nodes have no encoding.
+type memoryNode struct {
+	hash common.Hash
+	blob []byte
+}
+
+// size returns the memory used by the node, including its path.
+func (n *memoryNode) size(path string) common.StorageSize {
+	return common.StorageSize(len(path) + common.HashLength + len(n.blob))
+}
+
+// NodeSet contains the nodes of a single trie modified by a commit, keyed by
+// their path in the trie. It is only populated by the path-based scheme.
+type NodeSet struct {
+	owner common.Hash // Owner of the trie, the zero hash for the account trie
+	nodes map[string]*memoryNode
+}
+
+// NewNodeSet creates an empty node set for the trie of the given owner.
+func NewNodeSet(owner common.Hash) *NodeSet {
+	return &NodeSet{
+		owner: owner,
+		nodes: make(map[string]*memoryNode),
+	}
+}
+
+// markUpdated records a node written at the given path.
+func (set *NodeSet) markUpdated(path []byte, hash common.Hash, blob []byte) {
+	set.nodes[string(path)] = &memoryNode{hash: hash, blob: blob}
+}
+
+// markDeleted records a node removed from the given path.
+func (set *NodeSet) markDeleted(path []byte) {
+	set.nodes[string(path)] = &memoryNode{}
+}
+
+// Owner returns the owner of the trie the set belongs to.
+func (set *NodeSet) Owner() common.Hash {
+	return set.owner
+}
+
+// Len returns the number of modified nodes in the set.
+func (set *NodeSet) Len() int {
+	return len(set.nodes)
+}
+
+// MergedNodeSet is the union of the node sets of all the tries modified by a
+// state transition, along with the accounts whose whole storage got destructed.
+type MergedNodeSet struct {
+	sets      map[common.Hash]*NodeSet
+	destructs map[common.Hash]struct{}
+}
+
+// NewMergedNodeSet creates an empty merged node set.
+func NewMergedNodeSet() *MergedNodeSet {
+	return &MergedNodeSet{
+		sets:      make(map[common.Hash]*NodeSet),
+		destructs: make(map[common.Hash]struct{}),
+	}
+}
+
+// Merge adds the node set of a trie to the merged set. Every trie can only be
+// merged once.
+func (set *MergedNodeSet) Merge(other *NodeSet) error {
+	if _, present := set.sets[other.owner]; present {
+		return fmt.Errorf("duplicate trie for owner %#x", other.owner)
+	}
+	set.sets[other.owner] = other
+	return nil
+}
+
+// Destruct marks the whole storage of an account deleted. The destruction takes
+// effect before any update of the storage trie within the same set.
+func (set *MergedNodeSet) Destruct(owner common.Hash) {
+	set.destructs[owner] = struct{}{}
+}
+
+// size returns the memory used by the nodes of the set.
+func (set *MergedNodeSet) size() common.StorageSize {
+	size := common.StorageSize(len(set.destructs) * common.HashLength)
+	for _, subset := range set.sets {
+		for path, n := range subset.nodes {
+			size += n.size(path)
+		}
+	}
+	return size
+}
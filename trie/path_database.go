@@ -0,0 +1,515 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/token/common"
+	"github.com/token/core/rawdb"
+	"github.com/token/crypto"
+	"github.com/token/ethdb"
+	"github.com/token/log"
+	"github.com/token/metrics"
+	"github.com/token/rlp"
+)
+
+var (
+	pathDirtyHitMeter  = metrics.NewRegisteredMeter("trie/path/dirty/hit", nil)
+	pathCleanHitMeter  = metrics.NewRegisteredMeter("trie/path/clean/hit", nil)
+	pathCleanMissMeter = metrics.NewRegisteredMeter("trie/path/clean/miss", nil)
+
+	pathFlushTimeTimer  = metrics.NewRegisteredResettingTimer("trie/path/flush/time", nil)
+	pathFlushNodesMeter = metrics.NewRegisteredMeter("trie/path/flush/nodes", nil)
+	pathFlushSizeMeter  = metrics.NewRegisteredMeter("trie/path/flush/size", nil)
+
+	// errStateUnrecoverable is returned if a state is requested to be recovered
+	// while its history is not retained anymore.
+	errStateUnrecoverable = errors.New("state is unrecoverable")
+)
+
+// pathLayer is an in-memory diff layer of the path-based scheme, holding the
+// trie nodes modified by a single state transition on top of its parent.
+type pathLayer struct {
+	root   common.Hash        // Root of the state after the transition
+	parent common.Hash        // Root of the state the transition applies to
+	id     uint64             // Id of the state, one above its parent
+	nodes  *MergedNodeSet     // Trie nodes modified by the transition
+	size   common.StorageSize // Memory used by the modified nodes
+}
+
+// indexedNode is a trie node of the diff layers, shared by all the layers which
+// contain a node with the same hash.
+type indexedNode struct {
+	blob []byte
+	refs int
+}
+
+// pathDB is the path-based backend of the trie database. The nodes of the most
+// recent states are kept in a tree of in-memory diff layers, similarly to the
+// state snapshots, on top of a single state persisted to disk. The persisted
+// nodes are keyed by their owner and path, so every node flushed to disk replaces
+// the stale one at its path.
+//
+// A history reverting every flushed transition is retained for the configured
+// number of states, so that the persisted state can be rolled back.
+type pathDB struct {
+	diskdb  ethdb.KeyValueStore // Persistent storage of the disk layer
+	cleans  *fastcache.Cache    // Clean node cache of the disk layer, keyed by path
+	history uint64              // Number of recent states whose history is retained
+
+	root   common.Hash                  // Root of the persisted state
+	id     uint64                       // Id of the persisted state
+	layers map[common.Hash]*pathLayer   // Diff layers on top of the disk, keyed by root
+	index  map[common.Hash]*indexedNode // Nodes of all the diff layers, keyed by hash
+	size   common.StorageSize           // Memory used by the diff layers
+
+	lock sync.RWMutex
+}
+
+// newPathDB opens the path-based state stored in the database.
+func newPathDB(diskdb ethdb.KeyValueStore, cleans *fastcache.Cache, history uint64) *pathDB {
+	db := &pathDB{
+		diskdb:  diskdb,
+		cleans:  cleans,
+		history: history,
+		root:    emptyRoot,
+		id:      rawdb.ReadPersistentStateID(diskdb),
+		layers:  make(map[common.Hash]*pathLayer),
+		index:   make(map[common.Hash]*indexedNode),
+	}
+	if blob := rawdb.ReadTrieNodeByPath(diskdb, common.Hash{}, nil); len(blob) > 0 {
+		db.root = crypto.Keccak256Hash(blob)
+	}
+	// Mark fresh databases path-based, even if their state is still empty
+	if db.id == 0 {
+		rawdb.WritePersistentStateID(diskdb, 0)
+	}
+	return db
+}
+
+// node retrieves the encoded trie node with the given hash, stored at the given
+// path of the trie of the given owner. Nil is returned if the node is neither
+// part of a diff layer, nor of the persisted state.
+func (db *pathDB) node(owner common.Hash, path []byte, hash common.Hash) []byte {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	// Nodes are content addressed, any diff layer holding the hash will do
+	if n := db.index[hash]; n != nil {
+		pathDirtyHitMeter.Mark(1)
+		return n.blob
+	}
+	key := rawdb.TrieNodePathKey(owner, path)
+	if db.cleans != nil {
+		if blob := db.cleans.Get(nil, key); len(blob) > 0 && crypto.Keccak256Hash(blob) == hash {
+			pathCleanHitMeter.Mark(1)
+			return blob
+		}
+		pathCleanMissMeter.Mark(1)
+	}
+	// The persisted node might belong to a different state, verify it
+	blob, _ := db.diskdb.Get(key)
+	if len(blob) == 0 || crypto.Keccak256Hash(blob) != hash {
+		return nil
+	}
+	if db.cleans != nil {
+		db.cleans.Set(key, blob)
+	}
+	return blob
+}
+
+// dirtyNode retrieves an encoded trie node of the diff layers by hash.
+func (db *pathDB) dirtyNode(hash common.Hash) []byte {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if n := db.index[hash]; n != nil {
+		return n.blob
+	}
+	return nil
+}
+
+// update adds a diff layer for the transition from the parent state to the one
+// with the given root.
+func (db *pathDB) update(root common.Hash, parent common.Hash, nodes *MergedNodeSet) error {
+	if parent == (common.Hash{}) {
+		parent = emptyRoot
+	}
+	// Reject noop updates to avoid self-loops, like empty Alien or Clique blocks
+	if root == parent {
+		return nil
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if _, ok := db.layers[root]; ok || root == db.root {
+		return nil
+	}
+	var id uint64
+	if parent == db.root {
+		id = db.id + 1
+	} else if layer, ok := db.layers[parent]; ok {
+		id = layer.id + 1
+	} else {
+		return fmt.Errorf("parent state %#x missing", parent)
+	}
+	layer := &pathLayer{
+		root:   root,
+		parent: parent,
+		id:     id,
+		nodes:  nodes,
+		size:   nodes.size(),
+	}
+	for _, set := range nodes.sets {
+		for _, n := range set.nodes {
+			if n.blob == nil {
+				continue
+			}
+			if entry := db.index[n.hash]; entry != nil {
+				entry.refs++
+			} else {
+				db.index[n.hash] = &indexedNode{blob: n.blob, refs: 1}
+			}
+		}
+	}
+	db.layers[root] = layer
+	db.size += layer.size
+	return nil
+}
+
+// cap flattens the diff layers below the state with the given root into the
+// disk layer, until at most the given number of layers remain above it. The
+// diff layers not descending from the new disk layer are discarded.
+func (db *pathDB) cap(root common.Hash, layers int) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	var chain []*pathLayer
+	for current := root; current != db.root; {
+		layer, ok := db.layers[current]
+		if !ok {
+			return fmt.Errorf("state %#x missing", root)
+		}
+		chain = append(chain, layer)
+		current = layer.parent
+	}
+	if len(chain) <= layers {
+		return nil
+	}
+	for i := len(chain) - 1; i >= layers; i-- {
+		if err := db.flatten(chain[i]); err != nil {
+			return err
+		}
+	}
+	for _, layer := range db.layers {
+		if !db.descends(layer) {
+			db.remove(layer)
+		}
+	}
+	return nil
+}
+
+// descends reports whether the diff layer is built on top of the disk layer.
+func (db *pathDB) descends(layer *pathLayer) bool {
+	for layer.parent != db.root {
+		parent, ok := db.layers[layer.parent]
+		if !ok {
+			return false
+		}
+		layer = parent
+	}
+	return true
+}
+
+// remove drops a diff layer, along with its nodes not shared with other layers.
+func (db *pathDB) remove(layer *pathLayer) {
+	for _, set := range layer.nodes.sets {
+		for _, n := range set.nodes {
+			if n.blob == nil {
+				continue
+			}
+			if entry := db.index[n.hash]; entry != nil {
+				if entry.refs--; entry.refs == 0 {
+					delete(db.index, n.hash)
+				}
+			}
+		}
+	}
+	delete(db.layers, layer.root)
+	db.size -= layer.size
+}
+
+// flatten writes the bottom-most diff layer into the disk layer, along with the
+// history reverting it.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *pathDB) flatten(layer *pathLayer) error {
+	var (
+		start    = time.Now()
+		batch    = db.diskdb.NewBatch()
+		history  = &stateHistory{Parent: db.root, Root: layer.root}
+		recorded = make(map[string]struct{})
+		nodes    int
+	)
+	// record saves the persisted node at the key before it is overwritten
+	record := func(owner common.Hash, path []byte, key []byte, prev []byte) {
+		if _, ok := recorded[string(key)]; ok {
+			return
+		}
+		recorded[string(key)] = struct{}{}
+		history.Nodes = append(history.Nodes, historyNode{Owner: owner, Path: common.CopyBytes(path), Blob: common.CopyBytes(prev)})
+	}
+	// Wipe the storage of the destructed accounts first, the set might contain
+	// the storage of the resurrected ones
+	for owner := range layer.nodes.destructs {
+		prefix := rawdb.TrieNodePathKey(owner, nil)
+		it := db.diskdb.NewIterator(prefix, nil)
+		for it.Next() {
+			key := common.CopyBytes(it.Key())
+			record(owner, key[len(prefix):], key, it.Value())
+			batch.Delete(key)
+			if db.cleans != nil {
+				db.cleans.Del(key)
+			}
+		}
+		it.Release()
+	}
+	for owner, set := range layer.nodes.sets {
+		for path, n := range set.nodes {
+			key := rawdb.TrieNodePathKey(owner, []byte(path))
+			if _, ok := recorded[string(key)]; !ok {
+				prev, _ := db.diskdb.Get(key)
+				record(owner, []byte(path), key, prev)
+			}
+			if n.blob == nil {
+				batch.Delete(key)
+				if db.cleans != nil {
+					db.cleans.Del(key)
+				}
+			} else {
+				batch.Put(key, n.blob)
+				if db.cleans != nil {
+					db.cleans.Set(key, n.blob)
+				}
+			}
+			nodes++
+		}
+	}
+	if db.history > 0 {
+		blob, err := rlp.EncodeToBytes(history)
+		if err != nil {
+			return err
+		}
+		rawdb.WriteStateHistory(batch, layer.id, blob)
+		rawdb.WriteStateID(batch, history.Parent, layer.id-1)
+		rawdb.WriteStateID(batch, layer.root, layer.id)
+		if layer.id > db.history {
+			db.pruneHistory(batch, layer.id-db.history)
+		}
+	}
+	rawdb.WritePersistentStateID(batch, layer.id)
+	size := batch.ValueSize()
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	db.root, db.id = layer.root, layer.id
+	db.remove(layer)
+
+	pathFlushTimeTimer.Update(time.Since(start))
+	pathFlushNodesMeter.Mark(int64(nodes))
+	pathFlushSizeMeter.Mark(int64(size))
+
+	log.Debug("Persisted state diff layer", "id", layer.id, "root", layer.root, "nodes", nodes, "size", common.StorageSize(size), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// pruneHistory deletes the history reverting the state with the given id, its
+// parent becoming unrecoverable.
+func (db *pathDB) pruneHistory(batch ethdb.KeyValueWriter, id uint64) {
+	blob := rawdb.ReadStateHistory(db.diskdb, id)
+	if len(blob) == 0 {
+		return
+	}
+	var history stateHistory
+	if err := rlp.DecodeBytes(blob, &history); err == nil {
+		if stored := rawdb.ReadStateID(db.diskdb, history.Parent); stored != nil && *stored == id-1 {
+			rawdb.DeleteStateID(batch, history.Parent)
+		}
+	}
+	rawdb.DeleteStateHistory(batch, id)
+}
+
+// recoverable reports whether the state with the given root is available, or
+// can be recovered by reverting the persisted state.
+func (db *pathDB) recoverable(root common.Hash) bool {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if _, ok := db.layers[root]; ok || root == db.root {
+		return true
+	}
+	id := rawdb.ReadStateID(db.diskdb, root)
+	if id == nil || *id >= db.id {
+		return false
+	}
+	return len(rawdb.ReadStateHistory(db.diskdb, *id+1)) > 0
+}
+
+// recover makes the state with the given root available again, reverting the
+// persisted state through its history if needed. All the diff layers are
+// discarded when the persisted state is reverted.
+func (db *pathDB) recover(root common.Hash) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if _, ok := db.layers[root]; ok || root == db.root {
+		return nil
+	}
+	id := rawdb.ReadStateID(db.diskdb, root)
+	if id == nil || *id >= db.id || len(rawdb.ReadStateHistory(db.diskdb, *id+1)) == 0 {
+		return errStateUnrecoverable
+	}
+	for _, layer := range db.layers {
+		db.remove(layer)
+	}
+	start := time.Now()
+	for db.id > *id {
+		var history stateHistory
+		if err := rlp.DecodeBytes(rawdb.ReadStateHistory(db.diskdb, db.id), &history); err != nil {
+			return fmt.Errorf("invalid state history %d: %v", db.id, err)
+		}
+		if history.Root != db.root {
+			return fmt.Errorf("state history %d mismatch: have %#x, want %#x", db.id, history.Root, db.root)
+		}
+		batch := db.diskdb.NewBatch()
+		for _, n := range history.Nodes {
+			key := rawdb.TrieNodePathKey(n.Owner, n.Path)
+			if len(n.Blob) == 0 {
+				batch.Delete(key)
+				if db.cleans != nil {
+					db.cleans.Del(key)
+				}
+			} else {
+				batch.Put(key, n.Blob)
+				if db.cleans != nil {
+					db.cleans.Set(key, n.Blob)
+				}
+			}
+		}
+		rawdb.DeleteStateHistory(batch, db.id)
+		rawdb.DeleteStateID(batch, history.Root)
+		rawdb.WritePersistentStateID(batch, db.id-1)
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		db.root, db.id = history.Parent, db.id-1
+	}
+	log.Info("Reverted persisted state", "root", root, "id", db.id, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// memory returns the memory used by the diff layers.
+func (db *pathDB) memory() common.StorageSize {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.size
+}
+
+// Update adds the trie nodes modified by the transition from the parent state
+// to the one with the given root to the database. It's a noop for the hash-based
+// scheme, whose nodes are inserted while committing the tries.
+func (db *Database) Update(root common.Hash, parent common.Hash, nodes *MergedNodeSet) error {
+	if db.path == nil {
+		return nil
+	}
+	return db.path.update(root, parent, nodes)
+}
+
+// CapLayers flattens the diff layers below the state with the given root to disk
+// until at most the given number of layers remain in memory, flushing the
+// pre-images too if they grew large. It's a noop for the hash-based scheme.
+func (db *Database) CapLayers(root common.Hash, layers int) error {
+	if db.path == nil {
+		return nil
+	}
+	if err := db.flushPreimages(false); err != nil {
+		return err
+	}
+	return db.path.cap(root, layers)
+}
+
+// Recoverable reports whether the state with the given root is available or can
+// be recovered by rolling back the persisted state. Only the path-based scheme
+// supports rolling back.
+func (db *Database) Recoverable(root common.Hash) bool {
+	if db.path == nil {
+		return false
+	}
+	return db.path.recoverable(root)
+}
+
+// Recover rolls back the persisted state to the one with the given root, using
+// the retained state history. Only the path-based scheme supports rolling back.
+func (db *Database) Recover(root common.Hash) error {
+	if db.path == nil {
+		return errors.New("state rollback requires the path scheme")
+	}
+	return db.path.recover(root)
+}
+
+// commitLayers persists the state with the given root, along with all the diff
+// layers below it.
+func (db *Database) commitLayers(root common.Hash, report bool) error {
+	start := time.Now()
+	if err := db.flushPreimages(true); err != nil {
+		return err
+	}
+	if err := db.path.cap(root, 0); err != nil {
+		log.Error("Failed to commit state layers", "err", err)
+		return err
+	}
+	logger := log.Info
+	if !report {
+		logger = log.Debug
+	}
+	logger("Persisted state diff layers", "root", root, "time", time.Since(start), "livesize", db.path.memory())
+	return nil
+}
+
+// flushPreimages writes the cached pre-images to disk, unless they are still
+// small and the flush isn't forced.
+func (db *Database) flushPreimages(force bool) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.preimages == nil || len(db.preimages) == 0 || (!force && db.preimagesSize <= 4*1024*1024) {
+		return nil
+	}
+	batch := db.diskdb.NewBatch()
+	rawdb.WritePreimages(batch, db.preimages)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	db.preimages, db.preimagesSize = make(map[common.Hash][]byte), 0
+	return nil
+}
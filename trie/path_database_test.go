@@ -0,0 +1,241 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/token/common"
+	"github.com/token/core/rawdb"
+	"github.com/token/crypto"
+	"github.com/token/ethdb"
+)
+
+// commitPathTrie commits the trie and adds its nodes to the path-based database
+// as a diff layer on top of the parent state.
+func commitPathTrie(t *testing.T, db *Database, tr *Trie, parent common.Hash) common.Hash {
+	root, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	nodes := NewMergedNodeSet()
+	if err := nodes.Merge(tr.Committed()); err != nil {
+		t.Fatalf("failed to merge nodes: %v", err)
+	}
+	if err := db.Update(root, parent, nodes); err != nil {
+		t.Fatalf("failed to update database: %v", err)
+	}
+	return root
+}
+
+// checkPathTrie verifies that the trie with the given root holds exactly the
+// given content, and that the database persisted exactly its nodes.
+func checkPathTrie(t *testing.T, diskdb ethdb.Database, root common.Hash, content map[string][]byte) {
+	db := NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})
+	tr, err := New(root, db)
+	if err != nil {
+		t.Fatalf("failed to open trie %x: %v", root, err)
+	}
+	for key, val := range content {
+		if have := tr.Get([]byte(key)); !bytes.Equal(have, val) {
+			t.Fatalf("value mismatch for key %x: have %x, want %x", key, have, val)
+		}
+	}
+	want := make(map[string]struct{})
+	it := tr.NodeIterator(nil)
+	for it.Next(true) {
+		if it.Hash() != (common.Hash{}) {
+			want[string(it.Path())] = struct{}{}
+		}
+	}
+	if it.Error() != nil {
+		t.Fatalf("failed to iterate trie: %v", it.Error())
+	}
+	iter := diskdb.NewIterator(rawdb.TrieNodeAccountPrefix, nil)
+	defer iter.Release()
+
+	stored := 0
+	for iter.Next() {
+		path := iter.Key()[len(rawdb.TrieNodeAccountPrefix):]
+		if _, ok := want[string(path)]; !ok {
+			t.Fatalf("stale node at path %x", path)
+		}
+		stored++
+	}
+	if stored != len(want) {
+		t.Fatalf("persisted node count mismatch: have %d, want %d", stored, len(want))
+	}
+}
+
+// randomPathUpdate applies random insertions, updates and deletions to the trie.
+func randomPathUpdate(tr *Trie, content map[string][]byte, rnd *rand.Rand) {
+	for key := range content {
+		switch rnd.Intn(3) {
+		case 0:
+			tr.Delete([]byte(key))
+			delete(content, key)
+		case 1:
+			val := crypto.Keccak256([]byte(key), []byte{byte(rnd.Intn(256))})
+			tr.Update([]byte(key), val)
+			content[key] = val
+		}
+	}
+	for i := 0; i < 100; i++ {
+		key, val := make([]byte, 32), make([]byte, 1+rnd.Intn(64))
+		rnd.Read(key)
+		rnd.Read(val)
+		tr.Update(key, val)
+		content[string(key)] = val
+	}
+}
+
+func copyContent(content map[string][]byte) map[string][]byte {
+	cpy := make(map[string][]byte, len(content))
+	for key, val := range content {
+		cpy[key] = val
+	}
+	return cpy
+}
+
+// Tests that the diff layers of the path-based scheme serve the recent states
+// and that flattening them leaves no stale node on disk.
+func TestPathSchemeLayers(t *testing.T) {
+	var (
+		diskdb  = rawdb.NewMemoryDatabase()
+		db      = NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})
+		rnd     = rand.New(rand.NewSource(1))
+		content = make(map[string][]byte)
+		roots   []common.Hash
+		states  []map[string][]byte
+		parent  = emptyRoot
+	)
+	tr, _ := New(common.Hash{}, db)
+	for i := 0; i < 8; i++ {
+		randomPathUpdate(tr, content, rnd)
+		parent = commitPathTrie(t, db, tr, parent)
+		roots, states = append(roots, parent), append(states, copyContent(content))
+	}
+	// All the states must be served by the diff layers
+	for i, root := range roots {
+		tr, err := New(root, db)
+		if err != nil {
+			t.Fatalf("state %d: failed to open trie: %v", i, err)
+		}
+		for key, val := range states[i] {
+			if have := tr.Get([]byte(key)); !bytes.Equal(have, val) {
+				t.Fatalf("state %d: value mismatch for key %x: have %x, want %x", i, key, have, val)
+			}
+		}
+	}
+	// Flatten half the layers, the remaining ones must still be served
+	if err := db.CapLayers(roots[len(roots)-1], 4); err != nil {
+		t.Fatalf("failed to cap layers: %v", err)
+	}
+	checkPathTrie(t, diskdb, roots[3], states[3])
+	for i := 4; i < len(roots); i++ {
+		if _, err := New(roots[i], db); err != nil {
+			t.Fatalf("state %d: failed to open trie: %v", i, err)
+		}
+	}
+	// Flatten everything and check the persisted state is the head one
+	if err := db.Commit(roots[len(roots)-1], false, nil); err != nil {
+		t.Fatalf("failed to commit layers: %v", err)
+	}
+	checkPathTrie(t, diskdb, roots[len(roots)-1], states[len(states)-1])
+
+	if size, _ := db.Size(); size != 0 {
+		t.Fatalf("diff layers left in memory: %v", size)
+	}
+}
+
+// Tests that the persisted state can be rolled back within the retained history.
+func TestPathSchemeRecover(t *testing.T) {
+	var (
+		diskdb  = rawdb.NewMemoryDatabase()
+		db      = NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme, StateHistory: 4})
+		rnd     = rand.New(rand.NewSource(2))
+		content = make(map[string][]byte)
+		roots   []common.Hash
+		states  []map[string][]byte
+		parent  = emptyRoot
+	)
+	tr, _ := New(common.Hash{}, db)
+	for i := 0; i < 6; i++ {
+		randomPathUpdate(tr, content, rnd)
+		parent = commitPathTrie(t, db, tr, parent)
+		roots, states = append(roots, parent), append(states, copyContent(content))
+
+		if err := db.CapLayers(parent, 0); err != nil {
+			t.Fatalf("failed to cap layers: %v", err)
+		}
+	}
+	// Only the states within the history limit are recoverable
+	for i, root := range roots {
+		if have, want := db.Recoverable(root), i >= len(roots)-5; have != want {
+			t.Fatalf("state %d: recoverable mismatch: have %v, want %v", i, have, want)
+		}
+	}
+	if err := db.Recover(roots[0]); err == nil {
+		t.Fatalf("pruned state recovered")
+	}
+	// Roll back and ensure the persisted state matches the earlier one
+	if err := db.Recover(roots[2]); err != nil {
+		t.Fatalf("failed to recover state: %v", err)
+	}
+	checkPathTrie(t, diskdb, roots[2], states[2])
+	if db.Recoverable(roots[4]) {
+		t.Fatalf("reverted state still recoverable")
+	}
+	// The database must accept new states on top of the recovered one
+	tr, _ = New(roots[2], db)
+	content = copyContent(states[2])
+	randomPathUpdate(tr, content, rnd)
+	root := commitPathTrie(t, db, tr, roots[2])
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to commit layers: %v", err)
+	}
+	checkPathTrie(t, diskdb, root, content)
+}
+
+// Tests that nodes are served by hash from the diff layers only, and that the
+// lookup of persisted nodes fails explicitly instead of reporting them missing.
+func TestPathSchemeNodeByHash(t *testing.T) {
+	var (
+		diskdb  = rawdb.NewMemoryDatabase()
+		db      = NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})
+		content = make(map[string][]byte)
+	)
+	tr, _ := New(common.Hash{}, db)
+	randomPathUpdate(tr, content, rand.New(rand.NewSource(3)))
+	root := commitPathTrie(t, db, tr, emptyRoot)
+
+	blob, err := db.Node(root)
+	if err != nil {
+		t.Fatalf("failed to retrieve diff layer node: %v", err)
+	}
+	if hash := crypto.Keccak256Hash(blob); hash != root {
+		t.Fatalf("node hash mismatch: have %x, want %x", hash, root)
+	}
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to commit layers: %v", err)
+	}
+	if _, err := db.Node(root); err != ErrHashLookup {
+		t.Fatalf("persisted node lookup error mismatch: have %v, want %v", err, ErrHashLookup)
+	}
+}
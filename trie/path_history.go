@@ -0,0 +1,35 @@
+// Copyright 2021 The nbn Authors
+// This file is part of the nbn library.
+//
+// The nbn library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The nbn library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the nbn library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import "github.com/token/common"
+
+// historyNode is a trie node as persisted before a state transition, an empty
+// blob meaning that no node was stored at the path.
+type historyNode struct {
+	Owner common.Hash
+	Path  []byte
+	Blob  []byte
+}
+
+// stateHistory reverts a state transition flushed to disk by the path-based
+// scheme, restoring the persisted nodes it overwrote or deleted.
+type stateHistory struct {
+	Parent common.Hash // Root of the state before the transition
+	Root   common.Hash // Root of the state after the transition
+	Nodes  []historyNode
+}
@@ -58,12 +58,20 @@ type LeafCallback func(paths [][]byte, hexpath []byte, leaf []byte, parent commo
 //
 // Trie is not safe for concurrent use.
 type Trie struct {
-	db   *Database
-	root node
+	db    *Database
+	root  node
+	owner common.Hash // Account hash owning a storage trie, zero for the account trie
+
 	// Keep track of the number leafs which have been inserted since the last
 	// hashing operation. This number will not directly map to the number of
 	// actually unhashed nodes
 	unhashed int
+
+	// Paths of the nodes loaded from the database since the last commit, and
+	// the nodes modified by the last commit. Both are only tracked for the
+	// path-based scheme, which needs to delete the nodes removed from the trie.
+	loaded    map[string]struct{}
+	committed *NodeSet
 }
 
 // newFlag returns the cache flag value for a newly created node.
@@ -78,11 +86,22 @@ func (t *Trie) newFlag() nodeFlag {
 // New will panic if db is nil and returns a MissingNodeError if root does
 // not exist in the database. Accessing the trie loads nodes from db on demand.
 func New(root common.Hash, db *Database) (*Trie, error) {
+	return NewWithOwner(common.Hash{}, root, db)
+}
+
+// NewWithOwner creates a trie with an existing root node from db, owned by the
+// account with the given hash. The owner is needed to locate the nodes of the
+// storage tries under the path-based scheme.
+func NewWithOwner(owner common.Hash, root common.Hash, db *Database) (*Trie, error) {
 	if db == nil {
 		panic("trie.New called without a database")
 	}
 	trie := &Trie{
-		db: db,
+		db:    db,
+		owner: owner,
+	}
+	if db.path != nil {
+		trie.loaded = make(map[string]struct{})
 	}
 	if root != (common.Hash{}) && root != emptyRoot {
 		rootnode, err := trie.resolveHash(root[:], nil)
@@ -188,7 +207,7 @@ func (t *Trie) tryGetNode(origNode node, path []byte, pos int) (item []byte, new
 		if hash == nil {
 			return nil, origNode, 0, errors.New("non-consensus node")
 		}
-		blob, err := t.db.Node(common.BytesToHash(hash))
+		blob, err := t.db.nodeBlob(t.owner, path, common.BytesToHash(hash))
 		return blob, origNode, 1, err
 	}
 	// Path still needs to be traversed, descend into children
@@ -433,7 +452,7 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 				// shortNode{..., shortNode{...}}.  Since the entry
 				// might not be loaded yet, resolve it just for this
 				// check.
-				cnode, err := t.resolve(n.Children[pos], prefix)
+				cnode, err := t.resolve(n.Children[pos], append(append([]byte{}, prefix...), byte(pos)))
 				if err != nil {
 					return false, nil, err
 				}
@@ -490,6 +509,13 @@ func (t *Trie) resolve(n node, prefix []byte) (node, error) {
 
 func (t *Trie) resolveHash(n hashNode, prefix []byte) (node, error) {
 	hash := common.BytesToHash(n)
+	if t.db.path != nil {
+		if blob := t.db.path.node(t.owner, prefix, hash); blob != nil {
+			t.loaded[string(prefix)] = struct{}{}
+			return mustDecodeNode(hash[:], blob), nil
+		}
+		return nil, &MissingNodeError{Owner: t.owner, NodeHash: hash, Path: prefix}
+	}
 	if node := t.db.node(hash); node != nil {
 		return node, nil
 	}
@@ -510,6 +536,22 @@ func (t *Trie) Commit(onleaf LeafCallback) (root common.Hash, err error) {
 	if t.db == nil {
 		panic("commit called on trie with nil database")
 	}
+	// Under the path-based scheme, the stored nodes removed from the trie must
+	// be deleted explicitly, collect them before the trie gets collapsed
+	var set *NodeSet
+	if t.db.path != nil {
+		set = NewNodeSet(t.owner)
+		if t.root != nil {
+			t.Hash()
+		}
+		for path := range t.loaded {
+			if !t.storedAt([]byte(path)) {
+				set.markDeleted([]byte(path))
+			}
+		}
+		t.loaded = make(map[string]struct{})
+		t.committed = set
+	}
 	if t.root == nil {
 		return emptyRoot, nil
 	}
@@ -525,6 +567,7 @@ func (t *Trie) Commit(onleaf LeafCallback) (root common.Hash, err error) {
 	if _, dirty := t.root.cache(); !dirty {
 		return rootHash, nil
 	}
+	h.nodes = set
 	var wg sync.WaitGroup
 	if onleaf != nil {
 		h.onleaf = onleaf
@@ -552,6 +595,55 @@ func (t *Trie) Commit(onleaf LeafCallback) (root common.Hash, err error) {
 	return rootHash, nil
 }
 
+// Committed returns the nodes modified by the last commit of the trie, nil if
+// it isn't backed by the path-based scheme.
+func (t *Trie) Committed() *NodeSet {
+	return t.committed
+}
+
+// storedAt reports whether the hashed trie still has a node stored in its own
+// database entry at the given path. Unresolved subtries are assumed unchanged.
+func (t *Trie) storedAt(path []byte) bool {
+	n := t.root
+	for {
+		switch cn := n.(type) {
+		case nil, valueNode:
+			return false
+		case hashNode:
+			return true
+		case *shortNode:
+			if len(path) == 0 {
+				hash, _ := cn.cache()
+				return hash != nil
+			}
+			if len(path) < len(cn.Key) || !bytes.Equal(cn.Key, path[:len(cn.Key)]) {
+				return false
+			}
+			n, path = cn.Val, path[len(cn.Key):]
+		case *fullNode:
+			if len(path) == 0 {
+				hash, _ := cn.cache()
+				return hash != nil
+			}
+			n, path = cn.Children[path[0]], path[1:]
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+		}
+	}
+}
+
+// copyLoaded returns a copy of the paths loaded since the last commit.
+func (t *Trie) copyLoaded() map[string]struct{} {
+	if t.loaded == nil {
+		return nil
+	}
+	loaded := make(map[string]struct{}, len(t.loaded))
+	for path := range t.loaded {
+		loaded[path] = struct{}{}
+	}
+	return loaded
+}
+
 // hashRoot calculates the root hash of the given trie
 func (t *Trie) hashRoot() (node, node, error) {
 	if t.root == nil {